@@ -55,6 +55,9 @@ func main() {
 
 	log.Printf("Database manager initialized: %s", cfg.Database.Path)
 
+	// Tell the IMAP server about delivered messages
+	dbManager.ForwardMailboxChanges()
+
 	// Initialize S3 blob storage if enabled
 	var s3Storage *blobstorage.S3BlobStorage
 	if cfg.BlobStorage.Enabled {
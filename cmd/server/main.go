@@ -35,6 +35,12 @@ func main() {
 
 	log.Printf("Database manager initialized: %s", *dbPath)
 
+	// Learn about messages delivered by the LMTP service so IDLE can report them
+	if err := dbManager.ListenForMailboxChanges(); err != nil {
+		log.Printf("Warning: %v", err)
+		log.Println("Idling clients will not be told about delivered messages")
+	}
+
 	// Try to load configuration for S3 blob storage
 	var s3Storage *blobstorage.S3BlobStorage
 	cfg, err := conf.LoadConfig()
@@ -37,6 +37,13 @@ type Config struct {
 	OAuthAudience []string           `yaml:"oauth_audience"`
 	OAuthSkewSec  int                `yaml:"oauth_clock_skew_seconds"`
 	BlobStorage   blobstorage.Config `yaml:"blob_storage"`
+	Admins        []string           `yaml:"admins"` // Addresses allowed to run administrative commands such as SETQUOTA
+
+	// Thunder IDP, used to find the role mailboxes a user may open
+	ThunderHost         string `yaml:"thunder_host"`
+	ThunderPort         string `yaml:"thunder_port"`
+	TokenRefreshSeconds int    `yaml:"token_refresh_seconds"`
+	RoleCacheTTLSeconds int    `yaml:"role_cache_ttl_seconds"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -77,6 +84,15 @@ func (c *Config) SetDefaults() {
 	if c.SASLScope == "" {
 		c.SASLScope = SASLScopeAll
 	}
+	if c.ThunderPort == "" {
+		c.ThunderPort = "8090"
+	}
+	if c.TokenRefreshSeconds == 0 {
+		c.TokenRefreshSeconds = 3300 // 55 minutes
+	}
+	if c.RoleCacheTTLSeconds == 0 {
+		c.RoleCacheTTLSeconds = 300 // 5 minutes
+	}
 }
 
 // Validate checks if the configuration is valid
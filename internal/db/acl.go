@@ -0,0 +1,190 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Mailbox access control lists (RFC 4314)
+//
+// Rights are stored per mailbox in the owner's database. The owner of a
+// mailbox implicitly holds every right. Because other users' databases cannot
+// be searched efficiently, the shared database keeps an index of which owners
+// have granted anything to whom; it is used to discover delegated mailboxes.
+
+// AllRights are the rights supported by the server, in canonical order
+const AllRights = "lrswipkxtea"
+
+// ACLIdentifierAnyone is the identifier that grants rights to every user
+const ACLIdentifierAnyone = "anyone"
+
+// ACLEntry is an identifier and the rights it holds on a mailbox
+type ACLEntry struct {
+	Identifier string
+	Rights     string
+}
+
+func createMailboxACLTablePerUser(db *sql.DB) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS mailbox_acl (
+		mailbox_id INTEGER NOT NULL,
+		identifier TEXT NOT NULL,
+		rights TEXT NOT NULL,
+		PRIMARY KEY (mailbox_id, identifier),
+		FOREIGN KEY (mailbox_id) REFERENCES mailboxes(id) ON DELETE CASCADE
+	);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+func createMailboxSharesTable(db *sql.DB) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS mailbox_shares (
+		owner TEXT NOT NULL,
+		grantee TEXT NOT NULL,
+		PRIMARY KEY (owner, grantee)
+	);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+// GetMailboxACLPerUser returns the ACL entries of a mailbox ordered by identifier
+func GetMailboxACLPerUser(db *sql.DB, mailboxID int64) ([]ACLEntry, error) {
+	rows, err := db.Query("SELECT identifier, rights FROM mailbox_acl WHERE mailbox_id = ? ORDER BY identifier", mailboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []ACLEntry
+	for rows.Next() {
+		var entry ACLEntry
+		if err := rows.Scan(&entry.Identifier, &entry.Rights); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// SetMailboxRightsPerUser stores the rights of an identifier on a mailbox.
+// Empty rights remove the identifier from the ACL.
+func SetMailboxRightsPerUser(db *sql.DB, mailboxID int64, identifier, rights string) error {
+	identifier = normalizeACLIdentifier(identifier)
+	if rights == "" {
+		_, err := db.Exec("DELETE FROM mailbox_acl WHERE mailbox_id = ? AND identifier = ?", mailboxID, identifier)
+		return err
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO mailbox_acl (mailbox_id, identifier, rights) VALUES (?, ?, ?)
+		ON CONFLICT(mailbox_id, identifier) DO UPDATE SET rights = excluded.rights
+	`, mailboxID, identifier, rights)
+	return err
+}
+
+// GetIdentifierRightsPerUser returns the rights stored for exactly this identifier
+func GetIdentifierRightsPerUser(db *sql.DB, mailboxID int64, identifier string) (string, error) {
+	var rights string
+	err := db.QueryRow("SELECT rights FROM mailbox_acl WHERE mailbox_id = ? AND identifier = ?",
+		mailboxID, normalizeACLIdentifier(identifier)).Scan(&rights)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return rights, err
+}
+
+// GetMailboxRightsPerUser returns the effective rights of a user on a mailbox:
+// the union of the user's own entry and the "anyone" entry
+func GetMailboxRightsPerUser(db *sql.DB, mailboxID int64, email string) (string, error) {
+	rows, err := db.Query("SELECT rights FROM mailbox_acl WHERE mailbox_id = ? AND identifier IN (?, ?)",
+		mailboxID, normalizeACLIdentifier(email), ACLIdentifierAnyone)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var combined string
+	for rows.Next() {
+		var rights string
+		if err := rows.Scan(&rights); err != nil {
+			return "", err
+		}
+		combined += rights
+	}
+
+	return CanonicalRights(combined), rows.Err()
+}
+
+// HasGrantsForPerUser reports whether an identifier appears in any ACL of the database
+func HasGrantsForPerUser(db *sql.DB, identifier string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM mailbox_acl WHERE identifier = ?", normalizeACLIdentifier(identifier)).Scan(&count)
+	return count > 0, err
+}
+
+// CanonicalRights removes duplicates and unknown rights and orders them like AllRights
+func CanonicalRights(rights string) string {
+	var result strings.Builder
+	for _, right := range AllRights {
+		if strings.ContainsRune(rights, right) {
+			result.WriteRune(right)
+		}
+	}
+	return result.String()
+}
+
+// AddMailboxShare records in the shared database that owner granted rights to grantee
+func AddMailboxShare(sharedDB *sql.DB, owner, grantee string) error {
+	_, err := sharedDB.Exec("INSERT OR IGNORE INTO mailbox_shares (owner, grantee) VALUES (?, ?)",
+		normalizeACLIdentifier(owner), normalizeACLIdentifier(grantee))
+	return err
+}
+
+// RemoveMailboxShare removes a share record once grantee has no rights left on owner's mailboxes
+func RemoveMailboxShare(sharedDB *sql.DB, owner, grantee string) error {
+	_, err := sharedDB.Exec("DELETE FROM mailbox_shares WHERE owner = ? AND grantee = ?",
+		normalizeACLIdentifier(owner), normalizeACLIdentifier(grantee))
+	return err
+}
+
+// HasMailboxShare reports whether owner granted rights to grantee or to anyone
+func HasMailboxShare(sharedDB *sql.DB, owner, grantee string) (bool, error) {
+	var exists bool
+	err := sharedDB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM mailbox_shares WHERE owner = ? AND (grantee = ? OR grantee = ?))
+	`, normalizeACLIdentifier(owner), normalizeACLIdentifier(grantee), ACLIdentifierAnyone).Scan(&exists)
+	return exists, err
+}
+
+// GetMailboxShareOwners returns the users that granted rights to grantee or to anyone
+func GetMailboxShareOwners(sharedDB *sql.DB, grantee string) ([]string, error) {
+	rows, err := sharedDB.Query(`
+		SELECT DISTINCT owner FROM mailbox_shares
+		WHERE (grantee = ? OR grantee = ?) AND owner != ?
+		ORDER BY owner
+	`, normalizeACLIdentifier(grantee), ACLIdentifierAnyone, normalizeACLIdentifier(grantee))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var owners []string
+	for rows.Next() {
+		var owner string
+		if err := rows.Scan(&owner); err != nil {
+			return nil, err
+		}
+		owners = append(owners, owner)
+	}
+
+	return owners, rows.Err()
+}
+
+// normalizeACLIdentifier lower-cases identifiers, which are email addresses or "anyone"
+func normalizeACLIdentifier(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
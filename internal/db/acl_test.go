@@ -0,0 +1,119 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestMailboxACL_SetAndGet(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	if err := SetMailboxRightsPerUser(userDB, inboxID, "Bob@Example.com", "lr"); err != nil {
+		t.Fatalf("SetMailboxRightsPerUser failed: %v", err)
+	}
+	if err := SetMailboxRightsPerUser(userDB, inboxID, ACLIdentifierAnyone, "s"); err != nil {
+		t.Fatalf("SetMailboxRightsPerUser failed: %v", err)
+	}
+
+	entries, err := GetMailboxACLPerUser(userDB, inboxID)
+	if err != nil {
+		t.Fatalf("GetMailboxACLPerUser failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Identifier != "anyone" || entries[1].Identifier != "bob@example.com" {
+		t.Errorf("Unexpected ACL entries: %v", entries)
+	}
+
+	// Effective rights combine the user's entry with "anyone"
+	rights, err := GetMailboxRightsPerUser(userDB, inboxID, "bob@example.com")
+	if err != nil {
+		t.Fatalf("GetMailboxRightsPerUser failed: %v", err)
+	}
+	if rights != "lrs" {
+		t.Errorf("Expected rights lrs, got %q", rights)
+	}
+
+	rights, _ = GetMailboxRightsPerUser(userDB, inboxID, "carol@example.com")
+	if rights != "s" {
+		t.Errorf("Expected rights s for another user, got %q", rights)
+	}
+}
+
+func TestMailboxACL_EmptyRightsRemoveEntry(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	_ = SetMailboxRightsPerUser(userDB, inboxID, "bob@example.com", "lr")
+	if hasGrants, _ := HasGrantsForPerUser(userDB, "bob@example.com"); !hasGrants {
+		t.Fatal("Expected grants for bob")
+	}
+
+	if err := SetMailboxRightsPerUser(userDB, inboxID, "bob@example.com", ""); err != nil {
+		t.Fatalf("SetMailboxRightsPerUser failed: %v", err)
+	}
+
+	rights, _ := GetIdentifierRightsPerUser(userDB, inboxID, "bob@example.com")
+	if rights != "" {
+		t.Errorf("Expected no rights after removal, got %q", rights)
+	}
+	if hasGrants, _ := HasGrantsForPerUser(userDB, "bob@example.com"); hasGrants {
+		t.Error("Expected no grants after removal")
+	}
+}
+
+func TestMailboxACL_DeletedWithMailbox(t *testing.T) {
+	userDB, _ := setupModSeqTestDB(t)
+
+	mailboxID, err := CreateMailboxPerUser(userDB, "Shared", "")
+	if err != nil {
+		t.Fatalf("CreateMailboxPerUser failed: %v", err)
+	}
+	_ = SetMailboxRightsPerUser(userDB, mailboxID, "bob@example.com", "lr")
+
+	if err := DeleteMailboxPerUser(userDB, "Shared"); err != nil {
+		t.Fatalf("DeleteMailboxPerUser failed: %v", err)
+	}
+
+	if hasGrants, _ := HasGrantsForPerUser(userDB, "bob@example.com"); hasGrants {
+		t.Error("Expected ACL entries to be removed with the mailbox")
+	}
+}
+
+func TestCanonicalRights(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"rl":          "lr",
+		"aetxkpiwsrl": AllRights,
+		"llrrz":       "lr",
+	}
+	for input, expected := range tests {
+		if got := CanonicalRights(input); got != expected {
+			t.Errorf("CanonicalRights(%q) = %q, want %q", input, got, expected)
+		}
+	}
+}
+
+func TestMailboxShares(t *testing.T) {
+	manager, err := NewDBManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDBManager failed: %v", err)
+	}
+	t.Cleanup(func() { _ = manager.Close() })
+	sharedDB := manager.GetSharedDB()
+
+	_ = AddMailboxShare(sharedDB, "alice@example.com", "bob@example.com")
+	_ = AddMailboxShare(sharedDB, "alice@example.com", "bob@example.com")
+	_ = AddMailboxShare(sharedDB, "carol@example.com", ACLIdentifierAnyone)
+	_ = AddMailboxShare(sharedDB, "bob@example.com", ACLIdentifierAnyone)
+
+	owners, err := GetMailboxShareOwners(sharedDB, "Bob@example.com")
+	if err != nil {
+		t.Fatalf("GetMailboxShareOwners failed: %v", err)
+	}
+	if len(owners) != 2 || owners[0] != "alice@example.com" || owners[1] != "carol@example.com" {
+		t.Errorf("Unexpected owners: %v", owners)
+	}
+
+	_ = RemoveMailboxShare(sharedDB, "alice@example.com", "bob@example.com")
+	owners, _ = GetMailboxShareOwners(sharedDB, "bob@example.com")
+	if len(owners) != 1 || owners[0] != "carol@example.com" {
+		t.Errorf("Unexpected owners after removal: %v", owners)
+	}
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mailbox changes across processes
+//
+// The IMAP server and the LMTP delivery service open the same database
+// directory. The server listens on a datagram socket in that directory and
+// the delivery service sends one datagram per published change, naming the
+// account and the mailbox. Datagrams are fire-and-forget: delivery never
+// waits for the server, and changes made while no server listens are simply
+// not announced, which is fine since nobody can be idling then.
+
+// mailboxChangesSocket is the name of the socket in the database directory
+const mailboxChangesSocket = "mailbox-changes.sock"
+
+func (m *DBManager) mailboxChangesSocketPath() string {
+	return filepath.Join(m.basePath, mailboxChangesSocket)
+}
+
+// ListenForMailboxChanges publishes the changes that other processes forward
+// with ForwardMailboxChanges on this manager's bus. The socket is closed by
+// Close.
+func (m *DBManager) ListenForMailboxChanges() error {
+	path := m.mailboxChangesSocketPath()
+
+	// A socket left behind by a previous server would make the bind fail
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale mailbox change socket: %v", err)
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to listen for mailbox changes: %v", err)
+	}
+
+	m.cacheMutex.Lock()
+	m.changeListener = conn
+	m.cacheMutex.Unlock()
+
+	go m.receiveMailboxChanges(conn)
+	return nil
+}
+
+func (m *DBManager) receiveMailboxChanges(conn *net.UnixConn) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			// Closed by Close
+			return
+		}
+
+		account, mailbox, ok := strings.Cut(string(buf[:n]), "\t")
+		if !ok {
+			continue
+		}
+		mailboxID, err := strconv.ParseInt(mailbox, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		// Only databases that are open can have subscribers
+		m.cacheMutex.RLock()
+		db, exists := m.userDBCache[account]
+		m.cacheMutex.RUnlock()
+		if exists {
+			m.changes.Publish(db, mailboxID)
+		}
+	}
+}
+
+// ForwardMailboxChanges sends every change published on this manager's bus to
+// the process that called ListenForMailboxChanges on the same directory
+func (m *DBManager) ForwardMailboxChanges() {
+	addr := &net.UnixAddr{Name: m.mailboxChangesSocketPath(), Net: "unixgram"}
+
+	m.changes.mu.Lock()
+	m.changes.forward = func(db *sql.DB, mailboxID int64) {
+		account, ok := m.accountForDB(db)
+		if !ok {
+			return
+		}
+
+		conn, err := net.DialUnix("unixgram", nil, addr)
+		if err != nil {
+			// No server is listening
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte(account + "\t" + strconv.FormatInt(mailboxID, 10)))
+	}
+	m.changes.mu.Unlock()
+}
+
+// accountForDB returns the account whose cached database is db
+func (m *DBManager) accountForDB(db *sql.DB) (string, bool) {
+	m.cacheMutex.RLock()
+	defer m.cacheMutex.RUnlock()
+	for account, cached := range m.userDBCache {
+		if cached == db {
+			return account, true
+		}
+	}
+	return "", false
+}
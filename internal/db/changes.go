@@ -0,0 +1,100 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// Mailbox change notifications
+//
+// Writers in this process (APPEND, COPY, MOVE, STORE, EXPUNGE) publish a
+// change after they commit, and IDLE/NOTIFY sessions subscribe to the
+// mailboxes they watch instead of polling the database. A publication only
+// says "something changed"; subscribers re-read the mailbox to find out what.
+//
+// LMTP delivery runs in another process. Its bus forwards each publication
+// to the IMAP server over a datagram socket (see change_socket.go), where it
+// is published again on the server's bus.
+
+// AllMailboxes subscribes to changes in every mailbox of a database
+const AllMailboxes int64 = 0
+
+type mailboxKey struct {
+	db        *sql.DB
+	mailboxID int64
+}
+
+// MailboxChanges is a bus of mailbox change notifications
+type MailboxChanges struct {
+	mu   sync.Mutex
+	subs map[mailboxKey]map[chan struct{}]int
+
+	// forward, when set, also sends publications to another process
+	forward func(db *sql.DB, mailboxID int64)
+}
+
+// NewMailboxChanges creates an empty change bus
+func NewMailboxChanges() *MailboxChanges {
+	return &MailboxChanges{subs: make(map[mailboxKey]map[chan struct{}]int)}
+}
+
+// Subscribe signals notify whenever the mailbox in db changes. notify should
+// be buffered; signals are dropped rather than queued when it is full, so a
+// slow subscriber sees one wakeup for any number of changes. The same
+// channel may be subscribed to several mailboxes. The returned function
+// removes the subscription.
+func (c *MailboxChanges) Subscribe(db *sql.DB, mailboxID int64, notify chan struct{}) func() {
+	if c == nil {
+		return func() {}
+	}
+
+	key := mailboxKey{db: db, mailboxID: mailboxID}
+	c.mu.Lock()
+	if c.subs[key] == nil {
+		c.subs[key] = make(map[chan struct{}]int)
+	}
+	c.subs[key][notify]++
+	c.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.subs[key][notify]--; c.subs[key][notify] <= 0 {
+				delete(c.subs[key], notify)
+			}
+			if len(c.subs[key]) == 0 {
+				delete(c.subs, key)
+			}
+		})
+	}
+}
+
+// Publish wakes the subscribers of the mailbox and of all mailboxes in db.
+// Publishing AllMailboxes, for changes that are not tied to one mailbox or
+// whose mailbox is not known, wakes every subscriber of db. It never blocks.
+func (c *MailboxChanges) Publish(db *sql.DB, mailboxID int64) {
+	if c == nil || db == nil {
+		return
+	}
+
+	c.mu.Lock()
+	for key, subscribers := range c.subs {
+		if key.db != db || (mailboxID != AllMailboxes && key.mailboxID != mailboxID && key.mailboxID != AllMailboxes) {
+			continue
+		}
+		for notify := range subscribers {
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+	forward := c.forward
+	c.mu.Unlock()
+
+	if forward != nil {
+		forward(db, mailboxID)
+	}
+}
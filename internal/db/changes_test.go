@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestMailboxChanges_PublishWakesSubscribers(t *testing.T) {
+	changes := NewMailboxChanges()
+	userDB, otherDB := &sql.DB{}, &sql.DB{}
+
+	inbox := make(chan struct{}, 1)
+	all := make(chan struct{}, 1)
+	unsubscribeInbox := changes.Subscribe(userDB, 1, inbox)
+	defer changes.Subscribe(userDB, AllMailboxes, all)()
+
+	changes.Publish(userDB, 2)
+	if len(inbox) != 0 || len(all) != 1 {
+		t.Fatalf("Expected only the all-mailboxes subscriber to wake, got inbox=%d all=%d", len(inbox), len(all))
+	}
+	<-all
+
+	// Signals coalesce instead of blocking the publisher
+	changes.Publish(userDB, 1)
+	changes.Publish(userDB, 1)
+	if len(inbox) != 1 || len(all) != 1 {
+		t.Fatalf("Expected one pending wakeup each, got inbox=%d all=%d", len(inbox), len(all))
+	}
+	<-inbox
+	<-all
+
+	changes.Publish(otherDB, 1)
+	if len(inbox) != 0 || len(all) != 0 {
+		t.Fatal("Expected changes in another database to be ignored")
+	}
+
+	changes.Publish(userDB, AllMailboxes)
+	if len(inbox) != 1 {
+		t.Fatal("Expected an all-mailboxes change to wake mailbox subscribers")
+	}
+	<-inbox
+
+	unsubscribeInbox()
+	changes.Publish(userDB, 1)
+	if len(inbox) != 0 {
+		t.Error("Expected no wakeup after unsubscribing")
+	}
+}
+
+func TestMailboxChanges_NilBus(t *testing.T) {
+	var manager *DBManager
+	changes := manager.MailboxChanges()
+
+	// Handlers publish unconditionally, including in setups without a manager
+	changes.Publish(&sql.DB{}, 1)
+	changes.Subscribe(&sql.DB{}, 1, make(chan struct{}, 1))()
+}
+
+func TestMailboxChanges_ForwardedFromOtherProcess(t *testing.T) {
+	dir := t.TempDir()
+
+	// The IMAP server and the delivery service each have their own manager
+	server, err := NewDBManager(dir)
+	if err != nil {
+		t.Fatalf("NewDBManager failed: %v", err)
+	}
+	defer server.Close()
+	if err := server.ListenForMailboxChanges(); err != nil {
+		t.Fatalf("ListenForMailboxChanges failed: %v", err)
+	}
+
+	delivery, err := NewDBManager(dir)
+	if err != nil {
+		t.Fatalf("NewDBManager failed: %v", err)
+	}
+	defer delivery.Close()
+	delivery.ForwardMailboxChanges()
+
+	serverDB, err := server.GetUserDB("user@localhost")
+	if err != nil {
+		t.Fatalf("GetUserDB failed: %v", err)
+	}
+	deliveryDB, err := delivery.GetUserDB("user@localhost")
+	if err != nil {
+		t.Fatalf("GetUserDB failed: %v", err)
+	}
+
+	inbox := make(chan struct{}, 1)
+	other := make(chan struct{}, 1)
+	defer server.MailboxChanges().Subscribe(serverDB, 1, inbox)()
+	defer server.MailboxChanges().Subscribe(serverDB, 2, other)()
+
+	delivery.MailboxChanges().Publish(deliveryDB, 1)
+	select {
+	case <-inbox:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the change published by the delivery service to reach the server")
+	}
+	if len(other) != 0 {
+		t.Fatal("Expected subscribers of other mailboxes not to wake")
+	}
+}
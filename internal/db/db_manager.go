@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,6 +18,14 @@ type DBManager struct {
 	sharedDB    *sql.DB
 	userDBCache map[string]*sql.DB
 	cacheMutex  sync.RWMutex
+
+	// Converts legacy modified UTF-7 mailbox names when a database is migrated
+	decodeMailboxName MailboxNameDecoder
+
+	changes *MailboxChanges
+
+	// Receives changes forwarded by other processes, once listening
+	changeListener *net.UnixConn
 }
 
 // NewDBManager creates a new database manager
@@ -29,6 +38,7 @@ func NewDBManager(basePath string) (*DBManager, error) {
 	manager := &DBManager{
 		basePath:    basePath,
 		userDBCache: make(map[string]*sql.DB),
+		changes:     NewMailboxChanges(),
 	}
 
 	// Initialize shared database
@@ -44,6 +54,22 @@ func (m *DBManager) GetSharedDB() *sql.DB {
 	return m.sharedDB
 }
 
+// MailboxChanges returns the bus on which mailbox changes are published
+func (m *DBManager) MailboxChanges() *MailboxChanges {
+	if m == nil {
+		return nil
+	}
+	return m.changes
+}
+
+// SetMailboxNameDecoder sets the decoder used to convert mailbox names of
+// existing databases from modified UTF-7 to UTF-8 when they are opened
+func (m *DBManager) SetMailboxNameDecoder(decode MailboxNameDecoder) {
+	m.cacheMutex.Lock()
+	defer m.cacheMutex.Unlock()
+	m.decodeMailboxName = decode
+}
+
 // GetUserDB returns a database connection for a specific user identified by email
 func (m *DBManager) GetUserDB(email string) (*sql.DB, error) {
 	// Check cache first
@@ -83,12 +109,15 @@ func (m *DBManager) GetUserDB(email string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to enable foreign keys: %v", err)
 	}
 
-	// Initialize schema if this is a new database
+	// Initialize schema if this is a new database, otherwise upgrade it in place
 	if !exists {
 		if err := m.initUserDB(db); err != nil {
 			_ = db.Close()
 			return nil, fmt.Errorf("failed to initialize user database: %v", err)
 		}
+	} else if err := migrateUserDB(db, m.decodeMailboxName); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to migrate user database: %v", err)
 	}
 
 	// Cache the connection
@@ -118,6 +147,18 @@ func (m *DBManager) initSharedDB() error {
 		return fmt.Errorf("failed to create blobs table: %v", err)
 	}
 
+	// Index of users that granted mailbox rights to others (ACL)
+	if err := createMailboxSharesTable(db); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("failed to create mailbox_shares table: %v", err)
+	}
+
+	// Server-level shared annotations (METADATA-SERVER)
+	if err := createServerMetadataTable(db); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("failed to create server_metadata table: %v", err)
+	}
+
 	// Create shared database indexes
 	if err := createSharedIndexes(db); err != nil {
 		_ = db.Close()
@@ -173,6 +214,37 @@ func (m *DBManager) initUserDB(db *sql.DB) error {
 		return fmt.Errorf("failed to create outbound_queue table: %v", err)
 	}
 
+	if err := createExpungedMessagesTablePerUser(db); err != nil {
+		return fmt.Errorf("failed to create expunged_messages table: %v", err)
+	}
+
+	if err := createQuotaTablePerUser(db); err != nil {
+		return fmt.Errorf("failed to create quota_limits table: %v", err)
+	}
+
+	if err := createMailboxACLTablePerUser(db); err != nil {
+		return fmt.Errorf("failed to create mailbox_acl table: %v", err)
+	}
+
+	if err := createMetadataTablePerUser(db); err != nil {
+		return fmt.Errorf("failed to create metadata table: %v", err)
+	}
+
+	// Keep per-message mod-sequences up to date (CONDSTORE/QRESYNC)
+	if err := createModSeqTriggersPerUser(db); err != nil {
+		return err
+	}
+
+	// Keep per-mailbox sizes up to date (STATUS SIZE)
+	if err := createMailboxSizeTriggersPerUser(db); err != nil {
+		return err
+	}
+
+	// Full-text index for SEARCH, when SQLite has FTS5
+	if err := createSearchIndexPerUser(db); err != nil {
+		return err
+	}
+
 	// Create user database indexes
 	if err := createUserIndexes(db); err != nil {
 		return fmt.Errorf("failed to create user indexes: %v", err)
@@ -183,10 +255,28 @@ func (m *DBManager) initUserDB(db *sql.DB) error {
 		return fmt.Errorf("failed to create default mailboxes: %v", err)
 	}
 
+	// Mailbox names in new databases are stored as UTF-8 from the start
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", mailboxNamesUTF8Version)); err != nil {
+		return fmt.Errorf("failed to set schema version: %v", err)
+	}
+
 	return nil
 }
 
 // getUserDBPath returns the file path for a user's database
+// UserDBExists reports whether the database of an account exists, without
+// creating it
+func (m *DBManager) UserDBExists(email string) bool {
+	m.cacheMutex.RLock()
+	_, cached := m.userDBCache[email]
+	m.cacheMutex.RUnlock()
+	if cached {
+		return true
+	}
+	_, err := os.Stat(m.getUserDBPath(email))
+	return err == nil
+}
+
 func (m *DBManager) getUserDBPath(email string) string {
 	if strings.HasSuffix(email, ".db") {
 		// Preserve explicit mailbox identity paths (for example role_<name>@<domain>.db).
@@ -218,5 +308,13 @@ func (m *DBManager) Close() error {
 		delete(m.userDBCache, email)
 	}
 
+	if m.changeListener != nil {
+		if err := m.changeListener.Close(); err != nil {
+			lastErr = err
+		}
+		os.Remove(m.mailboxChangesSocketPath())
+		m.changeListener = nil
+	}
+
 	return lastErr
 }
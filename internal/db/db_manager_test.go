@@ -284,7 +284,7 @@ func TestSharedDBTables(t *testing.T) {
 
 	sharedDB := manager.GetSharedDB()
 
-	expectedTables := []string{"blobs"}
+	expectedTables := []string{"blobs", "mailbox_shares", "server_metadata"}
 	for _, tableName := range expectedTables {
 		var count int
 		err = sharedDB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", tableName).Scan(&count)
@@ -320,7 +320,8 @@ func TestUserDBTables(t *testing.T) {
 		"mailboxes", "aliases", "messages",
 		"subscriptions", "addresses", "message_parts",
 		"deliveries", "message_mailbox", "message_headers",
-		"outbound_queue",
+		"outbound_queue", "expunged_messages", "quota_limits",
+		"mailbox_acl", "metadata",
 	}
 	for _, tableName := range expectedTables {
 		var count int
@@ -389,6 +390,7 @@ func TestUserDBIndexes(t *testing.T) {
 		"idx_mailboxes_parent",
 		"idx_messages_date",
 		"idx_messages_thread",
+		"idx_messages_message_id_header",
 		"idx_addresses_message",
 		"idx_addresses_email",
 		"idx_message_parts_message",
@@ -396,6 +398,8 @@ func TestUserDBIndexes(t *testing.T) {
 		"idx_message_mailbox_mailbox",
 		"idx_message_mailbox_message",
 		"idx_message_mailbox_uid",
+		"idx_message_mailbox_modseq",
+		"idx_expunged_messages_modseq",
 		"idx_message_headers_message",
 		"idx_deliveries_message",
 		"idx_deliveries_status",
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Full-text search index for SEARCH BODY, TEXT, SUBJECT, FROM, TO, CC and BCC
+//
+// message_search is an FTS5 table with one row per message, keyed by the
+// message id. It holds the decoded text of the message body, its address and
+// subject headers, and all of its headers for TEXT. The trigram tokenizer
+// makes phrase queries case-insensitive substring matches, as IMAP SEARCH
+// requires.
+//
+// FTS5 is only compiled into SQLite when the server is built with the
+// sqlite_fts5 tag. Without it there is no index and SEARCH reads the messages
+// themselves.
+
+// ErrSearchIndexUnavailable is returned when SQLite was built without FTS5
+var ErrSearchIndexUnavailable = errors.New("full-text search index not available")
+
+// SearchDocument is the text of a message kept in the full-text index
+type SearchDocument struct {
+	Subject string
+	From    string
+	To      string
+	Cc      string
+	Bcc     string
+	Headers string // All header fields, one "Name: value" per line
+	Body    string // Decoded text of the body parts
+}
+
+// searchIndexColumns maps the IMAP search keys to the index columns. TEXT
+// searches them all.
+var searchIndexColumns = map[string]string{
+	"SUBJECT": "subject",
+	"FROM":    "from_addr",
+	"TO":      "to_addr",
+	"CC":      "cc_addr",
+	"BCC":     "bcc_addr",
+	"BODY":    "body",
+}
+
+// createSearchIndexPerUser creates the full-text index when SQLite has FTS5.
+// Messages are removed from it by the expunge code rather than by a trigger,
+// because a trigger using the index would make every expunge fail in a
+// process built without FTS5. Databases that still have such a trigger from
+// an earlier version of this schema lose it here.
+func createSearchIndexPerUser(db *sql.DB) error {
+	if _, err := db.Exec("DROP TRIGGER IF EXISTS trg_message_search_expunge"); err != nil {
+		return fmt.Errorf("failed to drop trigger: %v", err)
+	}
+
+	_, err := db.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS message_search USING fts5(
+			subject, from_addr, to_addr, cc_addr, bcc_addr, headers, body,
+			tokenize = 'trigram'
+		)
+	`)
+	if err != nil && !isMissingFTS5(err) {
+		return fmt.Errorf("failed to create message_search table: %v", err)
+	}
+	return nil
+}
+
+func isMissingFTS5(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such module: fts5")
+}
+
+// SearchIndexAvailable reports whether the database has a usable full-text index
+func SearchIndexAvailable(db *sql.DB) bool {
+	rows, err := db.Query("SELECT rowid FROM message_search LIMIT 0")
+	if err != nil {
+		return false
+	}
+	_ = rows.Close()
+	return true
+}
+
+// IndexMessagePerUser adds a message to the full-text index, replacing what
+// was indexed for it before. It does nothing when there is no index.
+func IndexMessagePerUser(db *sql.DB, messageID int64, doc SearchDocument) error {
+	if !SearchIndexAvailable(db) {
+		return nil
+	}
+
+	if _, err := db.Exec("DELETE FROM message_search WHERE rowid = ?", messageID); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO message_search (rowid, subject, from_addr, to_addr, cc_addr, bcc_addr, headers, body)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, messageID, doc.Subject, doc.From, doc.To, doc.Cc, doc.Bcc, doc.Headers, doc.Body)
+	return err
+}
+
+// ExpungeMessagePerUser removes a message from a mailbox by its
+// message_mailbox row id, and from the full-text index when it is in no other
+// mailbox
+func ExpungeMessagePerUser(db *sql.DB, rowID int64) error {
+	indexed := SearchIndexAvailable(db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var messageID int64
+	if err := tx.QueryRow("SELECT message_id FROM message_mailbox WHERE id = ?", rowID).Scan(&messageID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM message_mailbox WHERE id = ?", rowID); err != nil {
+		return err
+	}
+	if indexed {
+		_, err := tx.Exec(`
+			DELETE FROM message_search
+			WHERE rowid = ? AND NOT EXISTS (SELECT 1 FROM message_mailbox WHERE message_id = ?)
+		`, messageID, messageID)
+		if err != nil {
+			return fmt.Errorf("failed to remove message from search index: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// unindexMailboxTx removes from the full-text index the messages of a mailbox
+// that is about to be deleted, except those also in another mailbox
+func unindexMailboxTx(tx *sql.Tx, mailboxID int64) error {
+	_, err := tx.Exec(`
+		DELETE FROM message_search
+		WHERE rowid IN (SELECT message_id FROM message_mailbox WHERE mailbox_id = ?)
+		  AND rowid NOT IN (SELECT message_id FROM message_mailbox WHERE mailbox_id != ?)
+	`, mailboxID, mailboxID)
+	if err != nil {
+		return fmt.Errorf("failed to remove messages from search index: %v", err)
+	}
+	return nil
+}
+
+// ClearSearchIndexPerUser removes every message from the full-text index
+func ClearSearchIndexPerUser(db *sql.DB) error {
+	if !SearchIndexAvailable(db) {
+		return ErrSearchIndexUnavailable
+	}
+	_, err := db.Exec("DELETE FROM message_search")
+	return err
+}
+
+// GetIndexedMessagesPerUser returns the ids of the messages in the full-text index
+func GetIndexedMessagesPerUser(db *sql.DB) (map[int64]bool, error) {
+	return querySearchIndex(db, "SELECT rowid FROM message_search")
+}
+
+// SearchIndexMatchesPerUser returns the ids of the indexed messages whose
+// field contains text, ignoring case. key is one of the IMAP search keys
+// SUBJECT, FROM, TO, CC, BCC, BODY or TEXT.
+func SearchIndexMatchesPerUser(db *sql.DB, key string, text string) (map[int64]bool, error) {
+	columns := []string{"subject", "from_addr", "to_addr", "cc_addr", "bcc_addr", "headers", "body"}
+	if key != "TEXT" {
+		column, ok := searchIndexColumns[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown search key %s", key)
+		}
+		columns = []string{column}
+	}
+
+	// Trigrams can only find strings of three or more characters; shorter
+	// ones are looked for in the indexed text directly
+	if utf8.RuneCountInString(text) < 3 {
+		conditions := make([]string, len(columns))
+		args := make([]interface{}, len(columns))
+		for i, column := range columns {
+			conditions[i] = fmt.Sprintf("instr(lower(%s), lower(?)) > 0", column)
+			args[i] = text
+		}
+		// #nosec G201 -- columns are fixed names from searchIndexColumns
+		return querySearchIndex(db, "SELECT rowid FROM message_search WHERE "+strings.Join(conditions, " OR "), args...)
+	}
+
+	query := `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+	if key != "TEXT" {
+		query = "{" + columns[0] + "} : " + query
+	}
+	return querySearchIndex(db, "SELECT rowid FROM message_search WHERE message_search MATCH ?", query)
+}
+
+func querySearchIndex(db *sql.DB, query string, args ...interface{}) (map[int64]bool, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// GetMailboxMessageIDsPerUser returns the ids of the messages that are in at
+// least one mailbox
+func GetMailboxMessageIDsPerUser(db *sql.DB) ([]int64, error) {
+	rows, err := db.Query("SELECT DISTINCT message_id FROM message_mailbox ORDER BY message_id")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
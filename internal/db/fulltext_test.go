@@ -0,0 +1,161 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func setupSearchIndexTestDB(t *testing.T) (*sql.DB, int64) {
+	t.Helper()
+	userDB, inboxID := setupModSeqTestDB(t)
+	if !SearchIndexAvailable(userDB) {
+		t.Skip("SQLite built without FTS5 (build with -tags sqlite_fts5)")
+	}
+	return userDB, inboxID
+}
+
+func assertSearchIndexMatches(t *testing.T, userDB *sql.DB, key, text string, want ...int64) {
+	t.Helper()
+	ids, err := SearchIndexMatchesPerUser(userDB, key, text)
+	if err != nil {
+		t.Fatalf("SearchIndexMatchesPerUser(%s %q) failed: %v", key, text, err)
+	}
+	if len(ids) != len(want) {
+		t.Errorf("%s %q: expected messages %v, got %v", key, text, want, ids)
+		return
+	}
+	for _, id := range want {
+		if !ids[id] {
+			t.Errorf("%s %q: expected messages %v, got %v", key, text, want, ids)
+			return
+		}
+	}
+}
+
+func TestSearchIndex_MatchesSubstrings(t *testing.T) {
+	userDB, _ := setupSearchIndexTestDB(t)
+
+	if err := IndexMessagePerUser(userDB, 1, SearchDocument{
+		Subject: "Quarterly Invoice",
+		From:    "Alice Smith <alice@example.com>",
+		To:      "bob@example.com",
+		Headers: "Subject: Quarterly Invoice\nX-Priority: 1\n",
+		Body:    "Please find the numbers attached.",
+	}); err != nil {
+		t.Fatalf("IndexMessagePerUser failed: %v", err)
+	}
+	if err := IndexMessagePerUser(userDB, 2, SearchDocument{
+		Subject: "Lunch",
+		From:    "carol@example.com",
+		Cc:      "smith@example.org",
+		Body:    "Invoice later",
+	}); err != nil {
+		t.Fatalf("IndexMessagePerUser failed: %v", err)
+	}
+
+	assertSearchIndexMatches(t, userDB, "SUBJECT", "invoice", 1)
+	assertSearchIndexMatches(t, userDB, "FROM", "SMITH", 1)
+	assertSearchIndexMatches(t, userDB, "CC", "smith", 2)
+	assertSearchIndexMatches(t, userDB, "BODY", "numbers att", 1)
+	assertSearchIndexMatches(t, userDB, "TEXT", "invoice", 1, 2)
+	assertSearchIndexMatches(t, userDB, "TEXT", "X-Priority", 1)
+	assertSearchIndexMatches(t, userDB, "TO", "nobody")
+
+	// Strings too short for trigrams are still found
+	assertSearchIndexMatches(t, userDB, "SUBJECT", "lu", 2)
+
+	// Quotes in the search string are matched literally
+	assertSearchIndexMatches(t, userDB, "BODY", `"numbers"`)
+
+	// Indexing a message again replaces its text
+	if err := IndexMessagePerUser(userDB, 2, SearchDocument{Subject: "Dinner"}); err != nil {
+		t.Fatalf("IndexMessagePerUser failed: %v", err)
+	}
+	assertSearchIndexMatches(t, userDB, "TEXT", "invoice", 1)
+}
+
+func TestSearchIndex_RemovedWhenExpungedEverywhere(t *testing.T) {
+	userDB, inboxID := setupSearchIndexTestDB(t)
+	archiveID, err := CreateMailboxPerUser(userDB, "Archive", "")
+	if err != nil {
+		t.Fatalf("CreateMailboxPerUser failed: %v", err)
+	}
+	oldID, err := CreateMailboxPerUser(userDB, "Old", "")
+	if err != nil {
+		t.Fatalf("CreateMailboxPerUser failed: %v", err)
+	}
+
+	report, _ := CreateMessage(userDB, "Report", "", "", time.Now(), 100)
+	memo, _ := CreateMessage(userDB, "Memo", "", "", time.Now(), 100)
+	for _, msg := range []struct {
+		id        int64
+		subject   string
+		mailboxes []int64
+	}{
+		{report, "Report", []int64{inboxID, archiveID}},
+		{memo, "Memo", []int64{oldID}},
+	} {
+		if err := IndexMessagePerUser(userDB, msg.id, SearchDocument{Subject: msg.subject}); err != nil {
+			t.Fatalf("IndexMessagePerUser failed: %v", err)
+		}
+		for _, mailboxID := range msg.mailboxes {
+			if err := AddMessageToMailboxPerUser(userDB, msg.id, mailboxID, "", time.Now()); err != nil {
+				t.Fatalf("AddMessageToMailboxPerUser failed: %v", err)
+			}
+		}
+	}
+
+	expunge := func(mailboxID int64) {
+		t.Helper()
+		var rowID int64
+		if err := userDB.QueryRow("SELECT id FROM message_mailbox WHERE mailbox_id = ?", mailboxID).Scan(&rowID); err != nil {
+			t.Fatalf("Failed to find message: %v", err)
+		}
+		if err := ExpungeMessagePerUser(userDB, rowID); err != nil {
+			t.Fatalf("ExpungeMessagePerUser failed: %v", err)
+		}
+	}
+
+	// A copy is left in Archive, so the message stays in the index
+	expunge(inboxID)
+	assertSearchIndexMatches(t, userDB, "SUBJECT", "report", report)
+
+	expunge(archiveID)
+	assertSearchIndexMatches(t, userDB, "SUBJECT", "report")
+
+	// Deleting a mailbox removes its messages too
+	if err := DeleteMailboxPerUser(userDB, "Old"); err != nil {
+		t.Fatalf("DeleteMailboxPerUser failed: %v", err)
+	}
+	indexed, err := GetIndexedMessagesPerUser(userDB)
+	if err != nil || len(indexed) != 0 {
+		t.Errorf("Expected an empty index, got %v (%v)", indexed, err)
+	}
+}
+
+func TestExpungeMessagePerUser(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	msgID, _ := CreateMessage(userDB, "Hello", "", "", time.Now(), 100)
+	if err := AddMessageToMailboxPerUser(userDB, msgID, inboxID, "", time.Now()); err != nil {
+		t.Fatalf("AddMessageToMailboxPerUser failed: %v", err)
+	}
+	var rowID int64
+	if err := userDB.QueryRow("SELECT id FROM message_mailbox WHERE message_id = ?", msgID).Scan(&rowID); err != nil {
+		t.Fatalf("Failed to find message: %v", err)
+	}
+
+	// Works with and without the full-text index
+	if err := ExpungeMessagePerUser(userDB, rowID); err != nil {
+		t.Fatalf("ExpungeMessagePerUser failed: %v", err)
+	}
+	var count int
+	if err := userDB.QueryRow("SELECT COUNT(*) FROM message_mailbox WHERE id = ?", rowID).Scan(&count); err != nil || count != 0 {
+		t.Errorf("Expected the message to be expunged, got %d (%v)", count, err)
+	}
+
+	if err := ExpungeMessagePerUser(userDB, rowID); err == nil {
+		t.Error("Expected an error for a message that is already gone")
+	}
+}
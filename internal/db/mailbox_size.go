@@ -0,0 +1,118 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Mailbox size accounting for STATUS SIZE (RFC 8438) and DELETED-STORAGE
+// (RFC 9208)
+//
+// mailboxes.total_size is the sum of the sizes of the messages in a mailbox
+// and mailboxes.deleted_size that of the ones flagged \Deleted. Like the
+// mod-sequences they are kept by triggers, so every writer keeps them right
+// and reading them never scans the mailbox.
+
+func createMailboxSizeTriggersPerUser(db *sql.DB) error {
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS trg_message_mailbox_size_insert
+		AFTER INSERT ON message_mailbox
+		BEGIN
+			UPDATE mailboxes
+			SET total_size = total_size + COALESCE((SELECT size_bytes FROM messages WHERE id = NEW.message_id), 0),
+			    deleted_size = deleted_size + CASE WHEN COALESCE(NEW.flags, '') LIKE '%\Deleted%'
+			        THEN COALESCE((SELECT size_bytes FROM messages WHERE id = NEW.message_id), 0) ELSE 0 END
+			WHERE id = NEW.mailbox_id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_message_mailbox_size_delete
+		AFTER DELETE ON message_mailbox
+		BEGIN
+			UPDATE mailboxes
+			SET total_size = total_size - COALESCE((SELECT size_bytes FROM messages WHERE id = OLD.message_id), 0),
+			    deleted_size = deleted_size - CASE WHEN COALESCE(OLD.flags, '') LIKE '%\Deleted%'
+			        THEN COALESCE((SELECT size_bytes FROM messages WHERE id = OLD.message_id), 0) ELSE 0 END
+			WHERE id = OLD.mailbox_id;
+		END`,
+		// Flag changes and moves between mailboxes (INBOX rename) are an
+		// expunge from the old state and an insert of the new one
+		`CREATE TRIGGER IF NOT EXISTS trg_message_mailbox_size_update
+		AFTER UPDATE OF flags, mailbox_id ON message_mailbox
+		WHEN OLD.flags IS NOT NEW.flags OR OLD.mailbox_id != NEW.mailbox_id
+		BEGIN
+			UPDATE mailboxes
+			SET total_size = total_size - COALESCE((SELECT size_bytes FROM messages WHERE id = OLD.message_id), 0),
+			    deleted_size = deleted_size - CASE WHEN COALESCE(OLD.flags, '') LIKE '%\Deleted%'
+			        THEN COALESCE((SELECT size_bytes FROM messages WHERE id = OLD.message_id), 0) ELSE 0 END
+			WHERE id = OLD.mailbox_id;
+			UPDATE mailboxes
+			SET total_size = total_size + COALESCE((SELECT size_bytes FROM messages WHERE id = NEW.message_id), 0),
+			    deleted_size = deleted_size + CASE WHEN COALESCE(NEW.flags, '') LIKE '%\Deleted%'
+			        THEN COALESCE((SELECT size_bytes FROM messages WHERE id = NEW.message_id), 0) ELSE 0 END
+			WHERE id = NEW.mailbox_id;
+		END`,
+	}
+
+	for _, trigger := range triggers {
+		if _, err := db.Exec(trigger); err != nil {
+			return fmt.Errorf("failed to create trigger: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// migrateMailboxSizesPerUser adds the size counters to an existing database
+// and computes them from its messages. This is the only time the sizes are
+// summed up.
+func migrateMailboxSizesPerUser(db *sql.DB) error {
+	exists, err := columnExists(db, "mailboxes", "total_size")
+	if err != nil {
+		return fmt.Errorf("failed to inspect mailboxes: %v", err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := ensureColumn(db, "mailboxes", "total_size", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "mailboxes", "deleted_size", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE mailboxes SET
+			total_size = (
+				SELECT COALESCE(SUM(m.size_bytes), 0)
+				FROM message_mailbox mm JOIN messages m ON m.id = mm.message_id
+				WHERE mm.mailbox_id = mailboxes.id
+			),
+			deleted_size = (
+				SELECT COALESCE(SUM(m.size_bytes), 0)
+				FROM message_mailbox mm JOIN messages m ON m.id = mm.message_id
+				WHERE mm.mailbox_id = mailboxes.id AND COALESCE(mm.flags, '') LIKE '%\Deleted%'
+			)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to compute mailbox sizes: %v", err)
+	}
+
+	return nil
+}
+
+// GetMailboxSizePerUser returns the total size of the messages in a mailbox
+// and the size of those flagged \Deleted
+func GetMailboxSizePerUser(db *sql.DB, mailboxID int64) (total, deleted int64, err error) {
+	err = db.QueryRow("SELECT total_size, deleted_size FROM mailboxes WHERE id = ?", mailboxID).Scan(&total, &deleted)
+	return
+}
+
+// GetDeletedCountPerUser returns the number of messages flagged \Deleted in a mailbox
+func GetDeletedCountPerUser(db *sql.DB, mailboxID int64) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM message_mailbox
+		WHERE mailbox_id = ? AND flags LIKE '%\Deleted%'
+	`, mailboxID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func assertMailboxSize(t *testing.T, userDB *sql.DB, mailboxID, wantTotal, wantDeleted int64) {
+	t.Helper()
+	total, deleted, err := GetMailboxSizePerUser(userDB, mailboxID)
+	if err != nil {
+		t.Fatalf("GetMailboxSizePerUser failed: %v", err)
+	}
+	if total != wantTotal || deleted != wantDeleted {
+		t.Errorf("Expected size %d (%d deleted), got %d (%d deleted)", wantTotal, wantDeleted, total, deleted)
+	}
+}
+
+func TestMailboxSize_TrackedByTriggers(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+	archiveID, err := CreateMailboxPerUser(userDB, "Archive", "")
+	if err != nil {
+		t.Fatalf("CreateMailboxPerUser failed: %v", err)
+	}
+
+	small, _ := CreateMessage(userDB, "Small", "", "", time.Now(), 100)
+	large, _ := CreateMessage(userDB, "Large", "", "", time.Now(), 5000)
+	if err := AddMessageToMailboxPerUser(userDB, small, inboxID, "", time.Now()); err != nil {
+		t.Fatalf("AddMessageToMailboxPerUser failed: %v", err)
+	}
+	if err := AddMessageToMailboxPerUser(userDB, large, inboxID, "\\Seen", time.Now()); err != nil {
+		t.Fatalf("AddMessageToMailboxPerUser failed: %v", err)
+	}
+	assertMailboxSize(t, userDB, inboxID, 5100, 0)
+
+	// Flagging and unflagging \Deleted moves the size in and out of deleted_size
+	if _, err := userDB.Exec("UPDATE message_mailbox SET flags = '\\Seen \\Deleted' WHERE message_id = ?", large); err != nil {
+		t.Fatalf("Failed to flag message: %v", err)
+	}
+	assertMailboxSize(t, userDB, inboxID, 5100, 5000)
+
+	// Moving a message between mailboxes moves its size along
+	if _, err := userDB.Exec("UPDATE message_mailbox SET mailbox_id = ? WHERE message_id = ?", archiveID, small); err != nil {
+		t.Fatalf("Failed to move message: %v", err)
+	}
+	assertMailboxSize(t, userDB, inboxID, 5000, 5000)
+	assertMailboxSize(t, userDB, archiveID, 100, 0)
+
+	// Expunging removes the message from both counters
+	if _, err := userDB.Exec("DELETE FROM message_mailbox WHERE message_id = ?", large); err != nil {
+		t.Fatalf("Failed to expunge message: %v", err)
+	}
+	assertMailboxSize(t, userDB, inboxID, 0, 0)
+
+	if count, err := GetDeletedCountPerUser(userDB, inboxID); err != nil || count != 0 {
+		t.Errorf("Expected no deleted messages, got %d (%v)", count, err)
+	}
+}
+
+func TestMailboxSize_MigrationComputesSizes(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	msgID, _ := CreateMessage(userDB, "Old", "", "", time.Now(), 700)
+	if err := AddMessageToMailboxPerUser(userDB, msgID, inboxID, "\\Deleted", time.Now()); err != nil {
+		t.Fatalf("AddMessageToMailboxPerUser failed: %v", err)
+	}
+
+	// Turn the database back into one from before size accounting
+	for _, stmt := range []string{
+		"DROP TRIGGER trg_message_mailbox_size_insert",
+		"DROP TRIGGER trg_message_mailbox_size_delete",
+		"DROP TRIGGER trg_message_mailbox_size_update",
+		"ALTER TABLE mailboxes DROP COLUMN total_size",
+		"ALTER TABLE mailboxes DROP COLUMN deleted_size",
+	} {
+		if _, err := userDB.Exec(stmt); err != nil {
+			t.Fatalf("Failed to downgrade schema: %v", err)
+		}
+	}
+
+	if err := migrateUserDB(userDB, nil); err != nil {
+		t.Fatalf("migrateUserDB failed: %v", err)
+	}
+	assertMailboxSize(t, userDB, inboxID, 700, 700)
+
+	if count, err := GetDeletedCountPerUser(userDB, inboxID); err != nil || count != 1 {
+		t.Errorf("Expected 1 deleted message, got %d (%v)", count, err)
+	}
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Mailbox and server annotations (RFC 5464)
+//
+// Mailbox entries live in the database of the account that holds the mailbox.
+// Shared entries (/shared/...) are stored with an empty user_email, private
+// entries (/private/...) with the address of the user who set them, so that
+// delegates keep their own private entries. Private server entries use
+// mailbox_id 0 in the user's own database; shared server entries are kept in
+// the shared database.
+
+// MetadataServerMailboxID is the mailbox_id used for server-level private entries
+const MetadataServerMailboxID = 0
+
+// Limits applied by SETMETADATA
+const (
+	MaxMetadataValueSize  = 64 * 1024 // Largest value of a single entry, in octets
+	MaxMetadataEntryCount = 100       // Most entries per mailbox (or server) and user
+)
+
+// ErrMetadataTooMany is returned when storing an entry would exceed MaxMetadataEntryCount
+var ErrMetadataTooMany = errors.New("too many metadata entries")
+
+// MetadataEntry is an annotation name and its value
+type MetadataEntry struct {
+	Name  string
+	Value []byte
+}
+
+func createMetadataTablePerUser(db *sql.DB) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS metadata (
+		mailbox_id INTEGER NOT NULL,
+		user_email TEXT NOT NULL DEFAULT '',
+		entry TEXT NOT NULL,
+		value BLOB NOT NULL,
+		PRIMARY KEY (mailbox_id, user_email, entry)
+	);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+func createServerMetadataTable(db *sql.DB) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS server_metadata (
+		entry TEXT PRIMARY KEY,
+		value BLOB NOT NULL
+	);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+// GetMetadataPerUser returns the entries of a mailbox (or the server, with
+// MetadataServerMailboxID) visible to a user: shared entries and the user's own
+// private entries. Only entries named in names, or their descendants up to
+// depth levels below them (-1 for any depth), are returned.
+func GetMetadataPerUser(db *sql.DB, mailboxID int64, email string, names []string, depth int) ([]MetadataEntry, error) {
+	rows, err := db.Query(`
+		SELECT entry, value FROM metadata
+		WHERE mailbox_id = ? AND (
+			(entry LIKE '/shared/%' AND user_email = '') OR
+			(entry LIKE '/private/%' AND user_email = ?)
+		)
+		ORDER BY entry
+	`, mailboxID, strings.ToLower(email))
+	if err != nil {
+		return nil, err
+	}
+	return filterMetadataRows(rows, names, depth)
+}
+
+// SetMetadataPerUser stores or, with a nil value, removes an entry of a mailbox
+// (or the server, with MetadataServerMailboxID)
+func SetMetadataPerUser(db *sql.DB, mailboxID int64, email string, name string, value []byte) error {
+	name = strings.ToLower(name)
+	owner := ""
+	if strings.HasPrefix(name, "/private/") {
+		owner = strings.ToLower(email)
+	}
+
+	if value == nil {
+		_, err := db.Exec("DELETE FROM metadata WHERE mailbox_id = ? AND user_email = ? AND entry = ?", mailboxID, owner, name)
+		return err
+	}
+
+	var exists, count int
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(entry = ?), 0), COUNT(*) FROM metadata
+		WHERE mailbox_id = ? AND user_email = ?
+	`, name, mailboxID, owner).Scan(&exists, &count)
+	if err != nil {
+		return err
+	}
+	if exists == 0 && count >= MaxMetadataEntryCount {
+		return ErrMetadataTooMany
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO metadata (mailbox_id, user_email, entry, value) VALUES (?, ?, ?, ?)
+		ON CONFLICT(mailbox_id, user_email, entry) DO UPDATE SET value = excluded.value
+	`, mailboxID, owner, name, value)
+	return err
+}
+
+// GetServerMetadata returns shared server entries from the shared database
+func GetServerMetadata(sharedDB *sql.DB, names []string, depth int) ([]MetadataEntry, error) {
+	rows, err := sharedDB.Query("SELECT entry, value FROM server_metadata ORDER BY entry")
+	if err != nil {
+		return nil, err
+	}
+	return filterMetadataRows(rows, names, depth)
+}
+
+// SetServerMetadata stores or, with a nil value, removes a shared server entry
+func SetServerMetadata(sharedDB *sql.DB, name string, value []byte) error {
+	name = strings.ToLower(name)
+	if value == nil {
+		_, err := sharedDB.Exec("DELETE FROM server_metadata WHERE entry = ?", name)
+		return err
+	}
+
+	var exists, count int
+	err := sharedDB.QueryRow("SELECT COALESCE(SUM(entry = ?), 0), COUNT(*) FROM server_metadata", name).Scan(&exists, &count)
+	if err != nil {
+		return err
+	}
+	if exists == 0 && count >= MaxMetadataEntryCount {
+		return ErrMetadataTooMany
+	}
+
+	_, err = sharedDB.Exec(`
+		INSERT INTO server_metadata (entry, value) VALUES (?, ?)
+		ON CONFLICT(entry) DO UPDATE SET value = excluded.value
+	`, name, value)
+	return err
+}
+
+// filterMetadataRows reads entry rows and keeps those matching names and depth
+func filterMetadataRows(rows *sql.Rows, names []string, depth int) ([]MetadataEntry, error) {
+	defer func() { _ = rows.Close() }()
+
+	var entries []MetadataEntry
+	for rows.Next() {
+		var entry MetadataEntry
+		if err := rows.Scan(&entry.Name, &entry.Value); err != nil {
+			return nil, err
+		}
+		if metadataNameMatches(entry.Name, names, depth) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, rows.Err()
+}
+
+// metadataNameMatches reports whether an entry is one of names or lies at most
+// depth levels below one of them (-1 for any depth)
+func metadataNameMatches(entry string, names []string, depth int) bool {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if entry == name {
+			return true
+		}
+		if depth == 0 || !strings.HasPrefix(entry, name+"/") {
+			continue
+		}
+		if depth < 0 || strings.Count(entry[len(name)+1:], "/") < depth {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestMetadata_PrivateAndShared(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	if err := SetMetadataPerUser(userDB, inboxID, "alice@example.com", "/shared/comment", []byte("team inbox")); err != nil {
+		t.Fatalf("SetMetadataPerUser failed: %v", err)
+	}
+	if err := SetMetadataPerUser(userDB, inboxID, "Alice@Example.com", "/Private/Color", []byte("red")); err != nil {
+		t.Fatalf("SetMetadataPerUser failed: %v", err)
+	}
+	_ = SetMetadataPerUser(userDB, inboxID, "bob@example.com", "/private/color", []byte("blue"))
+
+	entries, err := GetMetadataPerUser(userDB, inboxID, "alice@example.com", []string{"/private/color", "/shared/comment"}, 0)
+	if err != nil {
+		t.Fatalf("GetMetadataPerUser failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "/private/color" || string(entries[0].Value) != "red" ||
+		string(entries[1].Value) != "team inbox" {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+
+	// Private entries of other users are not visible
+	entries, _ = GetMetadataPerUser(userDB, inboxID, "bob@example.com", []string{"/private/color"}, 0)
+	if len(entries) != 1 || string(entries[0].Value) != "blue" {
+		t.Errorf("Unexpected entries for bob: %v", entries)
+	}
+
+	// A nil value removes the entry
+	if err := SetMetadataPerUser(userDB, inboxID, "alice@example.com", "/shared/comment", nil); err != nil {
+		t.Fatalf("SetMetadataPerUser failed: %v", err)
+	}
+	entries, _ = GetMetadataPerUser(userDB, inboxID, "alice@example.com", []string{"/shared/comment"}, 0)
+	if len(entries) != 0 {
+		t.Errorf("Expected entry to be removed, got %v", entries)
+	}
+}
+
+func TestMetadata_Depth(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	for _, name := range []string{"/shared/vendor", "/shared/vendor/a", "/shared/vendor/a/b", "/shared/vendors"} {
+		_ = SetMetadataPerUser(userDB, inboxID, "alice@example.com", name, []byte("x"))
+	}
+
+	tests := []struct {
+		depth    int
+		expected int
+	}{
+		{0, 1},
+		{1, 2},
+		{-1, 3},
+	}
+	for _, tt := range tests {
+		entries, err := GetMetadataPerUser(userDB, inboxID, "alice@example.com", []string{"/shared/vendor"}, tt.depth)
+		if err != nil {
+			t.Fatalf("GetMetadataPerUser failed: %v", err)
+		}
+		if len(entries) != tt.expected {
+			t.Errorf("Depth %d: expected %d entries, got %v", tt.depth, tt.expected, entries)
+		}
+	}
+}
+
+func TestMetadata_TooMany(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	for i := 0; i < MaxMetadataEntryCount; i++ {
+		name := "/private/entry" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		if err := SetMetadataPerUser(userDB, inboxID, "alice@example.com", name, []byte("x")); err != nil {
+			t.Fatalf("SetMetadataPerUser failed: %v", err)
+		}
+	}
+
+	if err := SetMetadataPerUser(userDB, inboxID, "alice@example.com", "/private/extra", []byte("x")); err != ErrMetadataTooMany {
+		t.Errorf("Expected ErrMetadataTooMany, got %v", err)
+	}
+	// Existing entries can still be updated
+	if err := SetMetadataPerUser(userDB, inboxID, "alice@example.com", "/private/entryaa", []byte("y")); err != nil {
+		t.Errorf("Expected update to succeed, got %v", err)
+	}
+}
+
+func TestMetadata_DeletedWithMailbox(t *testing.T) {
+	userDB, _ := setupModSeqTestDB(t)
+
+	mailboxID, err := CreateMailboxPerUser(userDB, "Projects", "")
+	if err != nil {
+		t.Fatalf("CreateMailboxPerUser failed: %v", err)
+	}
+	_ = SetMetadataPerUser(userDB, mailboxID, "alice@example.com", "/shared/comment", []byte("x"))
+
+	if err := DeleteMailboxPerUser(userDB, "Projects"); err != nil {
+		t.Fatalf("DeleteMailboxPerUser failed: %v", err)
+	}
+
+	var count int
+	_ = userDB.QueryRow("SELECT COUNT(*) FROM metadata WHERE mailbox_id = ?", mailboxID).Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected metadata to be removed with the mailbox, got %d entries", count)
+	}
+}
+
+func TestServerMetadata(t *testing.T) {
+	manager, err := NewDBManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDBManager failed: %v", err)
+	}
+	t.Cleanup(func() { _ = manager.Close() })
+	sharedDB := manager.GetSharedDB()
+
+	if err := SetServerMetadata(sharedDB, "/shared/admin", []byte("mailto:postmaster@example.com")); err != nil {
+		t.Fatalf("SetServerMetadata failed: %v", err)
+	}
+	_ = SetServerMetadata(sharedDB, "/shared/comment", []byte("Raven"))
+
+	entries, err := GetServerMetadata(sharedDB, []string{"/shared"}, -1)
+	if err != nil {
+		t.Fatalf("GetServerMetadata failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "/shared/admin" {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+
+	_ = SetServerMetadata(sharedDB, "/shared/comment", nil)
+	entries, _ = GetServerMetadata(sharedDB, []string{"/shared/comment"}, 0)
+	if len(entries) != 0 {
+		t.Errorf("Expected entry to be removed, got %v", entries)
+	}
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// mailboxNamesUTF8Version is the user_version of databases whose mailbox
+// names are stored as UTF-8 rather than as sent by clients
+const mailboxNamesUTF8Version = 1
+
+// MailboxNameDecoder converts a mailbox name from the modified UTF-7 that
+// clients send (RFC 3501) to UTF-8. It is provided by the IMAP server.
+type MailboxNameDecoder func(name string) (string, error)
+
+// migrateUserDB brings an existing per-user database up to the current schema.
+// Every step is idempotent so it is safe to run each time a database is opened.
+func migrateUserDB(db *sql.DB, decode MailboxNameDecoder) error {
+	if err := ensureColumn(db, "mailboxes", "highest_modseq", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	if err := ensureColumn(db, "message_mailbox", "modseq", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	if err := ensureColumn(db, "messages", "message_id_header", "TEXT"); err != nil {
+		return err
+	}
+
+	if err := ensureColumn(db, "messages", "preview", "TEXT"); err != nil {
+		return err
+	}
+
+	if err := createExpungedMessagesTablePerUser(db); err != nil {
+		return fmt.Errorf("failed to create expunged_messages table: %v", err)
+	}
+
+	if err := createQuotaTablePerUser(db); err != nil {
+		return fmt.Errorf("failed to create quota_limits table: %v", err)
+	}
+
+	if err := createMailboxACLTablePerUser(db); err != nil {
+		return fmt.Errorf("failed to create mailbox_acl table: %v", err)
+	}
+
+	if err := createMetadataTablePerUser(db); err != nil {
+		return fmt.Errorf("failed to create metadata table: %v", err)
+	}
+
+	if err := createModSeqTriggersPerUser(db); err != nil {
+		return err
+	}
+
+	if err := migrateMailboxSizesPerUser(db); err != nil {
+		return err
+	}
+
+	if err := createMailboxSizeTriggersPerUser(db); err != nil {
+		return err
+	}
+
+	if err := createSearchIndexPerUser(db); err != nil {
+		return err
+	}
+
+	if err := createUserIndexes(db); err != nil {
+		return fmt.Errorf("failed to create user indexes: %v", err)
+	}
+
+	if decode != nil {
+		if err := migrateMailboxNamesToUTF8(db, decode); err != nil {
+			return fmt.Errorf("failed to migrate mailbox names: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// migrateMailboxNamesToUTF8 converts mailbox and subscription names stored in
+// modified UTF-7 by older releases to UTF-8. It runs once per database; names
+// that do not decode, or whose UTF-8 form is already taken, are left as they are.
+func migrateMailboxNamesToUTF8(db *sql.DB, decode MailboxNameDecoder) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version >= mailboxNamesUTF8Version {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, table := range []struct{ name, column string }{
+		{"mailboxes", "name"},
+		{"subscriptions", "mailbox_name"},
+	} {
+		if err := decodeNameColumn(tx, table.name, table.column, decode); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", mailboxNamesUTF8Version)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// decodeNameColumn rewrites the names in one column of a table to UTF-8
+func decodeNameColumn(tx *sql.Tx, table, column string, decode MailboxNameDecoder) error {
+	// #nosec G202 -- table and column are fixed strings from migrateMailboxNamesToUTF8
+	rows, err := tx.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s LIKE '%%&%%'", column, table, column))
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		decoded, err := decode(name)
+		if err != nil || decoded == name {
+			continue
+		}
+
+		var taken int
+		// #nosec G202 -- table and column are fixed strings from migrateMailboxNamesToUTF8
+		if err := tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", table, column), decoded).Scan(&taken); err != nil {
+			return err
+		}
+		if taken > 0 {
+			continue
+		}
+
+		// #nosec G202 -- table and column are fixed strings from migrateMailboxNamesToUTF8
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?", table, column, column), decoded, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureColumn adds a column to a table if it does not exist yet
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	exists, err := columnExists(db, table, column)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %v", table, err)
+	}
+	if exists {
+		return nil
+	}
+
+	// #nosec G202 -- table, column and definition are fixed strings from migrateUserDB
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add %s.%s: %v", table, column, err)
+	}
+
+	return nil
+}
+
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	// #nosec G202 -- table is a fixed string from migrateUserDB
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Mod-sequence tracking for CONDSTORE/QRESYNC (RFC 7162)
+//
+// Every change to a message_mailbox row (new message, flag change, expunge)
+// takes the next value of mailboxes.highest_modseq. This is done with triggers
+// so that every writer (delivery, APPEND, COPY, MOVE, STORE, EXPUNGE) stays
+// consistent without having to bump the counter explicitly.
+
+func createExpungedMessagesTablePerUser(db *sql.DB) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS expunged_messages (
+		id INTEGER PRIMARY KEY,
+		mailbox_id INTEGER NOT NULL,
+		uid INTEGER NOT NULL,
+		modseq INTEGER NOT NULL,
+		expunged_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+func createModSeqTriggersPerUser(db *sql.DB) error {
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS trg_message_mailbox_modseq_insert
+		AFTER INSERT ON message_mailbox
+		BEGIN
+			UPDATE mailboxes SET highest_modseq = highest_modseq + 1 WHERE id = NEW.mailbox_id;
+			UPDATE message_mailbox
+			SET modseq = (SELECT highest_modseq FROM mailboxes WHERE id = NEW.mailbox_id)
+			WHERE id = NEW.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_message_mailbox_modseq_flags
+		AFTER UPDATE OF flags ON message_mailbox
+		WHEN OLD.flags IS NOT NEW.flags
+		BEGIN
+			UPDATE mailboxes SET highest_modseq = highest_modseq + 1 WHERE id = NEW.mailbox_id;
+			UPDATE message_mailbox
+			SET modseq = (SELECT highest_modseq FROM mailboxes WHERE id = NEW.mailbox_id)
+			WHERE id = NEW.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_message_mailbox_modseq_delete
+		AFTER DELETE ON message_mailbox
+		BEGIN
+			UPDATE mailboxes SET highest_modseq = highest_modseq + 1 WHERE id = OLD.mailbox_id;
+			INSERT INTO expunged_messages (mailbox_id, uid, modseq)
+			SELECT OLD.mailbox_id, OLD.uid, highest_modseq FROM mailboxes WHERE id = OLD.mailbox_id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_mailboxes_expunged_cleanup
+		AFTER DELETE ON mailboxes
+		BEGIN
+			DELETE FROM expunged_messages WHERE mailbox_id = OLD.id;
+		END`,
+	}
+
+	for _, trigger := range triggers {
+		if _, err := db.Exec(trigger); err != nil {
+			return fmt.Errorf("failed to create trigger: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// GetHighestModSeqPerUser returns the HIGHESTMODSEQ value of a mailbox
+func GetHighestModSeqPerUser(db *sql.DB, mailboxID int64) (int64, error) {
+	var modseq int64
+	err := db.QueryRow("SELECT highest_modseq FROM mailboxes WHERE id = ?", mailboxID).Scan(&modseq)
+	return modseq, err
+}
+
+// GetMailboxCountersPerUser returns the HIGHESTMODSEQ, message count and
+// UIDNEXT of a mailbox, which together change whenever a message is added,
+// expunged or has its flags changed
+func GetMailboxCountersPerUser(db *sql.DB, mailboxID int64) (highestModSeq int64, messages int, uidNext int64, err error) {
+	err = db.QueryRow(`
+		SELECT highest_modseq, uid_next,
+		       (SELECT COUNT(*) FROM message_mailbox WHERE mailbox_id = mailboxes.id)
+		FROM mailboxes WHERE id = ?
+	`, mailboxID).Scan(&highestModSeq, &uidNext, &messages)
+	return highestModSeq, messages, uidNext, err
+}
+
+// GetMessageModSeqPerUser returns the mod-sequence of a message identified by UID
+func GetMessageModSeqPerUser(db *sql.DB, mailboxID, uid int64) (int64, error) {
+	var modseq int64
+	err := db.QueryRow(`
+		SELECT modseq FROM message_mailbox
+		WHERE mailbox_id = ? AND uid = ?
+	`, mailboxID, uid).Scan(&modseq)
+	return modseq, err
+}
+
+// GetExpungedUIDsSincePerUser returns the UIDs expunged from a mailbox after the given mod-sequence
+func GetExpungedUIDsSincePerUser(db *sql.DB, mailboxID, modseq int64) ([]int64, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT uid FROM expunged_messages
+		WHERE mailbox_id = ? AND modseq > ?
+		ORDER BY uid ASC
+	`, mailboxID, modseq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var uids []int64
+	for rows.Next() {
+		var uid int64
+		if err := rows.Scan(&uid); err == nil {
+			uids = append(uids, uid)
+		}
+	}
+
+	return uids, rows.Err()
+}
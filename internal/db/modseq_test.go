@@ -0,0 +1,202 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupModSeqTestDB(t *testing.T) (*sql.DB, int64) {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	manager, err := NewDBManager(tmpDir)
+	if err != nil {
+		t.Fatalf("NewDBManager failed: %v", err)
+	}
+	t.Cleanup(func() { _ = manager.Close() })
+
+	userDB, err := manager.GetUserDB(testEmailFromID(1))
+	if err != nil {
+		t.Fatalf("GetUserDB failed: %v", err)
+	}
+
+	inboxID, err := GetMailboxByNamePerUser(userDB, "INBOX")
+	if err != nil {
+		t.Fatalf("Failed to get INBOX: %v", err)
+	}
+
+	return userDB, inboxID
+}
+
+func TestModSeq_AssignedOnInsert(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	before, err := GetHighestModSeqPerUser(userDB, inboxID)
+	if err != nil {
+		t.Fatalf("GetHighestModSeqPerUser failed: %v", err)
+	}
+
+	msgID, _ := CreateMessage(userDB, "Test", "", "", time.Now(), 100)
+	if err := AddMessageToMailboxPerUser(userDB, msgID, inboxID, "", time.Now()); err != nil {
+		t.Fatalf("AddMessageToMailboxPerUser failed: %v", err)
+	}
+
+	after, _ := GetHighestModSeqPerUser(userDB, inboxID)
+	if after != before+1 {
+		t.Errorf("Expected HIGHESTMODSEQ %d, got %d", before+1, after)
+	}
+
+	modseq, err := GetMessageModSeqPerUser(userDB, inboxID, 1)
+	if err != nil {
+		t.Fatalf("GetMessageModSeqPerUser failed: %v", err)
+	}
+	if modseq != after {
+		t.Errorf("Expected message modseq %d, got %d", after, modseq)
+	}
+}
+
+func TestModSeq_BumpedOnFlagChangeOnly(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	msgID, _ := CreateMessage(userDB, "Test", "", "", time.Now(), 100)
+	_ = AddMessageToMailboxPerUser(userDB, msgID, inboxID, "", time.Now())
+	initial, _ := GetMessageModSeqPerUser(userDB, inboxID, 1)
+
+	if err := UpdateMessageFlagsPerUser(userDB, inboxID, msgID, `\Seen`); err != nil {
+		t.Fatalf("UpdateMessageFlagsPerUser failed: %v", err)
+	}
+	changed, _ := GetMessageModSeqPerUser(userDB, inboxID, 1)
+	if changed <= initial {
+		t.Errorf("Expected modseq to increase after flag change, got %d -> %d", initial, changed)
+	}
+
+	// Writing the same flags again is not a modification
+	_ = UpdateMessageFlagsPerUser(userDB, inboxID, msgID, `\Seen`)
+	unchanged, _ := GetMessageModSeqPerUser(userDB, inboxID, 1)
+	if unchanged != changed {
+		t.Errorf("Expected modseq to stay at %d, got %d", changed, unchanged)
+	}
+}
+
+func TestModSeq_ExpungeRecorded(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	msgID, _ := CreateMessage(userDB, "Test", "", "", time.Now(), 100)
+	_ = AddMessageToMailboxPerUser(userDB, msgID, inboxID, "", time.Now())
+	before, _ := GetHighestModSeqPerUser(userDB, inboxID)
+
+	if _, err := userDB.Exec("DELETE FROM message_mailbox WHERE mailbox_id = ? AND uid = 1", inboxID); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+
+	uids, err := GetExpungedUIDsSincePerUser(userDB, inboxID, before)
+	if err != nil {
+		t.Fatalf("GetExpungedUIDsSincePerUser failed: %v", err)
+	}
+	if len(uids) != 1 || uids[0] != 1 {
+		t.Errorf("Expected expunged UID 1, got %v", uids)
+	}
+
+	after, _ := GetHighestModSeqPerUser(userDB, inboxID)
+	if uids, _ := GetExpungedUIDsSincePerUser(userDB, inboxID, after); len(uids) != 0 {
+		t.Errorf("Expected no expunged UIDs after %d, got %v", after, uids)
+	}
+}
+
+func TestGetMailboxCountersPerUser(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	modseq, messages, uidNext, err := GetMailboxCountersPerUser(userDB, inboxID)
+	if err != nil {
+		t.Fatalf("GetMailboxCountersPerUser failed: %v", err)
+	}
+	if messages != 0 || uidNext != 1 {
+		t.Errorf("Expected an empty mailbox with UIDNEXT 1, got %d messages and UIDNEXT %d", messages, uidNext)
+	}
+
+	msgID, _ := CreateMessage(userDB, "Test", "", "", time.Now(), 100)
+	_ = AddMessageToMailboxPerUser(userDB, msgID, inboxID, "", time.Now())
+	_ = UpdateMessageFlagsPerUser(userDB, inboxID, msgID, `\Seen`)
+
+	after, messages, uidNext, err := GetMailboxCountersPerUser(userDB, inboxID)
+	if err != nil {
+		t.Fatalf("GetMailboxCountersPerUser failed: %v", err)
+	}
+	if after <= modseq || messages != 1 || uidNext != 2 {
+		t.Errorf("Expected a higher modseq, 1 message and UIDNEXT 2, got %d, %d and %d", after, messages, uidNext)
+	}
+
+	if _, _, _, err := GetMailboxCountersPerUser(userDB, 9999); err == nil {
+		t.Error("Expected an error for a missing mailbox")
+	}
+}
+
+func TestMigrateUserDB_AddsModSeqColumns(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "user_legacy@example.com.db")
+
+	// Build a database with the pre-CONDSTORE schema
+	legacy, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE mailboxes (id INTEGER PRIMARY KEY, name TEXT NOT NULL, parent_id INTEGER,
+			uid_validity INTEGER NOT NULL, uid_next INTEGER NOT NULL, special_use TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, UNIQUE(name))`,
+		`CREATE TABLE message_mailbox (id INTEGER PRIMARY KEY, message_id INTEGER NOT NULL,
+			mailbox_id INTEGER NOT NULL, uid INTEGER NOT NULL, flags TEXT, internal_date TIMESTAMP NOT NULL,
+			added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, previous_mailbox_id INTEGER, UNIQUE(mailbox_id, uid))`,
+		`INSERT INTO mailboxes (name, uid_validity, uid_next) VALUES ('INBOX', 1, 2)`,
+		`INSERT INTO message_mailbox (message_id, mailbox_id, uid, flags, internal_date) VALUES (1, 1, 1, '', CURRENT_TIMESTAMP)`,
+	} {
+		if _, err := legacy.Exec(stmt); err != nil {
+			t.Fatalf("Failed to build legacy schema: %v", err)
+		}
+	}
+
+	// Remaining tables are unchanged; the index migration expects them to exist
+	for _, create := range []func(*sql.DB) error{
+		createMessagesTable, createAddressesTable, createMessagePartsTablePerUser,
+		createMessageHeadersTable, createDeliveriesTablePerUser, createOutboundQueueTablePerUser,
+	} {
+		if err := create(legacy); err != nil {
+			t.Fatalf("Failed to create supporting table: %v", err)
+		}
+	}
+	_ = legacy.Close()
+
+	manager, err := NewDBManager(tmpDir)
+	if err != nil {
+		t.Fatalf("NewDBManager failed: %v", err)
+	}
+	defer func() { _ = manager.Close() }()
+
+	userDB, err := manager.GetUserDB("user_legacy@example.com.db")
+	if err != nil {
+		t.Fatalf("GetUserDB failed on legacy database: %v", err)
+	}
+
+	highest, err := GetHighestModSeqPerUser(userDB, 1)
+	if err != nil {
+		t.Fatalf("Expected highest_modseq column after migration: %v", err)
+	}
+	if highest != 1 {
+		t.Errorf("Expected default HIGHESTMODSEQ 1, got %d", highest)
+	}
+
+	if _, err := userDB.Exec("UPDATE message_mailbox SET flags = ? WHERE uid = 1", `\Seen`); err != nil {
+		t.Fatalf("Failed to update flags: %v", err)
+	}
+	modseq, err := GetMessageModSeqPerUser(userDB, 1, 1)
+	if err != nil {
+		t.Fatalf("Expected modseq column after migration: %v", err)
+	}
+	if modseq != 2 {
+		t.Errorf("Expected modseq 2 after flag change, got %d", modseq)
+	}
+}
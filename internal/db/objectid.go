@@ -0,0 +1,69 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Object identifiers for OBJECTID (RFC 8474)
+//
+// Identifiers are derived from row IDs that never change for the life of the
+// object. A message keeps its messages row when it is moved or copied, so its
+// EMAILID survives MOVE, COPY and the auto-Junk move; message rows are never
+// deleted, so an EMAILID is never reused. A mailbox keeps its row when it is
+// renamed, but mailbox rows are deleted and SQLite may hand out a deleted ID
+// again, so MAILBOXID also carries the mailbox's UIDVALIDITY. Clients must
+// treat the identifiers as opaque strings.
+
+const (
+	emailIDPrefix   = "M"
+	threadIDPrefix  = "T"
+	mailboxIDPrefix = "F"
+)
+
+// EmailObjectID returns the EMAILID of a stored message
+func EmailObjectID(messageID int64) string {
+	return emailIDPrefix + strconv.FormatInt(messageID, 10)
+}
+
+// ThreadObjectID returns the THREADID of a conversation thread
+func ThreadObjectID(threadID int64) string {
+	return threadIDPrefix + strconv.FormatInt(threadID, 10)
+}
+
+// MailboxObjectID returns the MAILBOXID of a mailbox
+func MailboxObjectID(mailboxID, uidValidity int64) string {
+	return fmt.Sprintf("%s%d-%d", mailboxIDPrefix, mailboxID, uidValidity)
+}
+
+// ParseEmailObjectID returns the message ID named by an EMAILID
+func ParseEmailObjectID(objectID string) (int64, bool) {
+	return parseObjectID(objectID, emailIDPrefix)
+}
+
+// ParseThreadObjectID returns the thread ID named by a THREADID
+func ParseThreadObjectID(objectID string) (int64, bool) {
+	return parseObjectID(objectID, threadIDPrefix)
+}
+
+func parseObjectID(objectID, prefix string) (int64, bool) {
+	if !strings.HasPrefix(objectID, prefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(objectID[len(prefix):], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// GetMailboxObjectIDPerUser returns the MAILBOXID of a mailbox
+func GetMailboxObjectIDPerUser(db *sql.DB, mailboxID int64) (string, error) {
+	uidValidity, _, err := GetMailboxInfoPerUser(db, mailboxID)
+	if err != nil {
+		return "", err
+	}
+	return MailboxObjectID(mailboxID, uidValidity), nil
+}
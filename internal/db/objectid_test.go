@@ -0,0 +1,53 @@
+package db
+
+import "testing"
+
+func TestObjectIDs_RoundTrip(t *testing.T) {
+	if id, ok := ParseEmailObjectID(EmailObjectID(42)); !ok || id != 42 {
+		t.Errorf("EMAILID round trip gave %d, %v", id, ok)
+	}
+	if id, ok := ParseThreadObjectID(ThreadObjectID(7)); !ok || id != 7 {
+		t.Errorf("THREADID round trip gave %d, %v", id, ok)
+	}
+
+	// Identifiers of one kind do not name objects of another
+	if _, ok := ParseEmailObjectID(ThreadObjectID(7)); ok {
+		t.Error("Expected a THREADID not to parse as an EMAILID")
+	}
+	for _, invalid := range []string{"", "M", "M-1", "Mabc", "42"} {
+		if _, ok := ParseEmailObjectID(invalid); ok {
+			t.Errorf("Expected %q not to parse as an EMAILID", invalid)
+		}
+	}
+}
+
+func TestGetMailboxObjectID_ChangesWhenMailboxRecreated(t *testing.T) {
+	userDB, _ := setupModSeqTestDB(t)
+
+	mailboxID, err := CreateMailboxPerUser(userDB, "Projects", "")
+	if err != nil {
+		t.Fatalf("CreateMailboxPerUser failed: %v", err)
+	}
+	before, err := GetMailboxObjectIDPerUser(userDB, mailboxID)
+	if err != nil {
+		t.Fatalf("GetMailboxObjectIDPerUser failed: %v", err)
+	}
+
+	if err := RenameMailboxPerUser(userDB, "Projects", "Archive"); err != nil {
+		t.Fatalf("RenameMailboxPerUser failed: %v", err)
+	}
+	if after, _ := GetMailboxObjectIDPerUser(userDB, mailboxID); after != before {
+		t.Errorf("Expected MAILBOXID %s after rename, got %s", before, after)
+	}
+
+	// A mailbox that reuses the row ID of a deleted one gets a new MAILBOXID
+	if err := DeleteMailboxPerUser(userDB, "Archive"); err != nil {
+		t.Fatalf("DeleteMailboxPerUser failed: %v", err)
+	}
+	if _, err := userDB.Exec("INSERT INTO mailboxes (id, name, uid_validity, uid_next) VALUES (?, 'Projects', 1, 1)", mailboxID); err != nil {
+		t.Fatalf("Failed to recreate mailbox: %v", err)
+	}
+	if recreated, _ := GetMailboxObjectIDPerUser(userDB, mailboxID); recreated == before {
+		t.Errorf("Expected a new MAILBOXID for the recreated mailbox, got %s", recreated)
+	}
+}
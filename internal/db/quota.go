@@ -0,0 +1,149 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Per-user quota limits (RFC 9208)
+//
+// Limits live in the user's own database, one row per resource. A resource
+// without a row is unlimited. STORAGE is kept in bytes here and converted to
+// the 1024-octet units used on the wire by the IMAP layer.
+
+// Quota resource names
+const (
+	QuotaResourceStorage = "STORAGE"
+	QuotaResourceMessage = "MESSAGE"
+	QuotaResourceMailbox = "MAILBOX"
+)
+
+// QuotaResources lists the supported quota resources in response order
+var QuotaResources = []string{QuotaResourceStorage, QuotaResourceMessage, QuotaResourceMailbox}
+
+// ErrOverQuota is returned when an operation would exceed a quota limit
+var ErrOverQuota = errors.New("quota exceeded")
+
+// QuotaUsage is the current resource usage of a user
+type QuotaUsage struct {
+	StorageBytes int64
+	Messages     int64
+	Mailboxes    int64
+}
+
+// Value returns the usage for a resource name
+func (u QuotaUsage) Value(resource string) int64 {
+	switch resource {
+	case QuotaResourceStorage:
+		return u.StorageBytes
+	case QuotaResourceMessage:
+		return u.Messages
+	case QuotaResourceMailbox:
+		return u.Mailboxes
+	}
+	return 0
+}
+
+func createQuotaTablePerUser(db *sql.DB) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS quota_limits (
+		resource TEXT PRIMARY KEY,
+		limit_value INTEGER NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+// GetQuotaLimitsPerUser returns the configured limits keyed by resource name
+func GetQuotaLimitsPerUser(db *sql.DB) (map[string]int64, error) {
+	rows, err := db.Query("SELECT resource, limit_value FROM quota_limits")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	limits := make(map[string]int64)
+	for rows.Next() {
+		var resource string
+		var limit int64
+		if err := rows.Scan(&resource, &limit); err != nil {
+			return nil, err
+		}
+		limits[resource] = limit
+	}
+
+	return limits, rows.Err()
+}
+
+// SetQuotaLimitsPerUser replaces all limits of a user. Resources missing from
+// limits become unlimited, as SETQUOTA requires.
+func SetQuotaLimitsPerUser(db *sql.DB, limits map[string]int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("DELETE FROM quota_limits"); err != nil {
+		return err
+	}
+
+	for resource, limit := range limits {
+		if _, err := tx.Exec("INSERT INTO quota_limits (resource, limit_value) VALUES (?, ?)", resource, limit); err != nil {
+			return fmt.Errorf("failed to set %s limit: %v", resource, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetQuotaUsagePerUser computes the current storage, message and mailbox usage.
+// A message copied into several mailboxes counts once per copy. Storage is
+// taken from the per-mailbox size counters.
+func GetQuotaUsagePerUser(db *sql.DB) (QuotaUsage, error) {
+	var usage QuotaUsage
+	err := db.QueryRow("SELECT COALESCE(SUM(total_size), 0), COUNT(*) FROM mailboxes").Scan(&usage.StorageBytes, &usage.Mailboxes)
+	if err != nil {
+		return usage, fmt.Errorf("failed to calculate usage: %v", err)
+	}
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM message_mailbox").Scan(&usage.Messages); err != nil {
+		return usage, fmt.Errorf("failed to count messages: %v", err)
+	}
+
+	return usage, nil
+}
+
+// CheckQuotaPerUser returns ErrOverQuota if adding the given bytes, messages
+// and mailboxes would exceed any configured limit
+func CheckQuotaPerUser(db *sql.DB, addBytes, addMessages, addMailboxes int64) error {
+	limits, err := GetQuotaLimitsPerUser(db)
+	if err != nil {
+		return err
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+
+	usage, err := GetQuotaUsagePerUser(db)
+	if err != nil {
+		return err
+	}
+
+	additions := map[string]int64{
+		QuotaResourceStorage: addBytes,
+		QuotaResourceMessage: addMessages,
+		QuotaResourceMailbox: addMailboxes,
+	}
+	for resource, limit := range limits {
+		add := additions[resource]
+		if add > 0 && usage.Value(resource)+add > limit {
+			return ErrOverQuota
+		}
+	}
+
+	return nil
+}
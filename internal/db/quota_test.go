@@ -0,0 +1,73 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuotaLimits_SetAndReplace(t *testing.T) {
+	userDB, _ := setupModSeqTestDB(t)
+
+	limits, err := GetQuotaLimitsPerUser(userDB)
+	if err != nil {
+		t.Fatalf("GetQuotaLimitsPerUser failed: %v", err)
+	}
+	if len(limits) != 0 {
+		t.Errorf("Expected no limits for a new user, got %v", limits)
+	}
+
+	if err := SetQuotaLimitsPerUser(userDB, map[string]int64{QuotaResourceStorage: 2048, QuotaResourceMessage: 10}); err != nil {
+		t.Fatalf("SetQuotaLimitsPerUser failed: %v", err)
+	}
+
+	// Setting a new list replaces the previous one
+	if err := SetQuotaLimitsPerUser(userDB, map[string]int64{QuotaResourceMailbox: 20}); err != nil {
+		t.Fatalf("SetQuotaLimitsPerUser failed: %v", err)
+	}
+
+	limits, _ = GetQuotaLimitsPerUser(userDB)
+	if len(limits) != 1 || limits[QuotaResourceMailbox] != 20 {
+		t.Errorf("Expected only MAILBOX 20, got %v", limits)
+	}
+}
+
+func TestQuotaUsageAndCheck(t *testing.T) {
+	userDB, inboxID := setupModSeqTestDB(t)
+
+	for i := 0; i < 2; i++ {
+		msgID, _ := CreateMessage(userDB, "Test", "", "", time.Now(), 600)
+		if err := AddMessageToMailboxPerUser(userDB, msgID, inboxID, "", time.Now()); err != nil {
+			t.Fatalf("AddMessageToMailboxPerUser failed: %v", err)
+		}
+	}
+
+	usage, err := GetQuotaUsagePerUser(userDB)
+	if err != nil {
+		t.Fatalf("GetQuotaUsagePerUser failed: %v", err)
+	}
+	if usage.StorageBytes != 1200 || usage.Messages != 2 || usage.Mailboxes == 0 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	if err := CheckQuotaPerUser(userDB, 1<<30, 100, 100); err != nil {
+		t.Errorf("Expected no limit without quota rows, got %v", err)
+	}
+
+	if err := SetQuotaLimitsPerUser(userDB, map[string]int64{QuotaResourceStorage: 2000, QuotaResourceMessage: 3}); err != nil {
+		t.Fatalf("SetQuotaLimitsPerUser failed: %v", err)
+	}
+
+	if err := CheckQuotaPerUser(userDB, 600, 1, 0); err != nil {
+		t.Errorf("Expected message within quota, got %v", err)
+	}
+	if err := CheckQuotaPerUser(userDB, 900, 1, 0); !errors.Is(err, ErrOverQuota) {
+		t.Errorf("Expected ErrOverQuota for STORAGE, got %v", err)
+	}
+	if err := CheckQuotaPerUser(userDB, 10, 2, 0); !errors.Is(err, ErrOverQuota) {
+		t.Errorf("Expected ErrOverQuota for MESSAGE, got %v", err)
+	}
+	if err := CheckQuotaPerUser(userDB, 0, 0, 5); err != nil {
+		t.Errorf("MAILBOX is unlimited, got %v", err)
+	}
+}
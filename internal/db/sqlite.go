@@ -146,7 +146,9 @@ func createMessagesTable(db *sql.DB) error {
 		date TIMESTAMP,
 		size_bytes INTEGER NOT NULL,
 		received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		thread_id INTEGER
+		thread_id INTEGER,
+		message_id_header TEXT,
+		preview TEXT
 	);
 	`
 	_, err := db.Exec(schema)
@@ -243,6 +245,7 @@ func createMessageMailboxTable(db *sql.DB) error {
 		internal_date TIMESTAMP NOT NULL,
 		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		previous_mailbox_id INTEGER,
+		modseq INTEGER NOT NULL DEFAULT 1,
 		FOREIGN KEY (message_id) REFERENCES messages(id),
 		FOREIGN KEY (mailbox_id) REFERENCES mailboxes(id),
 		FOREIGN KEY (previous_mailbox_id) REFERENCES mailboxes(id),
@@ -891,6 +894,20 @@ func CreateMessage(db *sql.DB, subject, inReplyTo, references string, date time.
 	return result.LastInsertId()
 }
 
+// SetMessagePreview stores the PREVIEW text of a message (RFC 8970)
+func SetMessagePreview(db *sql.DB, messageID int64, preview string) error {
+	_, err := db.Exec("UPDATE messages SET preview = ? WHERE id = ?", preview, messageID)
+	return err
+}
+
+// GetMessagePreview returns the stored PREVIEW text of a message. stored is
+// false for messages saved before previews were kept.
+func GetMessagePreview(db *sql.DB, messageID int64) (preview string, stored bool, err error) {
+	var value sql.NullString
+	err = db.QueryRow("SELECT preview FROM messages WHERE id = ?", messageID).Scan(&value)
+	return value.String, value.Valid, err
+}
+
 func AddMessageToMailbox(db *sql.DB, messageID, mailboxID int64, flags string, internalDate time.Time) error {
 	// Get next UID for this mailbox
 	uid, err := IncrementUIDNext(db, mailboxID)
@@ -1293,6 +1310,7 @@ func createUserIndexes(db *sql.DB) error {
 		"CREATE INDEX IF NOT EXISTS idx_mailboxes_parent ON mailboxes(parent_id)",
 		"CREATE INDEX IF NOT EXISTS idx_messages_date ON messages(date)",
 		"CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages(thread_id)",
+		"CREATE INDEX IF NOT EXISTS idx_messages_message_id_header ON messages(message_id_header)",
 		"CREATE INDEX IF NOT EXISTS idx_addresses_message ON addresses(message_id)",
 		"CREATE INDEX IF NOT EXISTS idx_addresses_email ON addresses(email)",
 		"CREATE INDEX IF NOT EXISTS idx_message_parts_message ON message_parts(message_id)",
@@ -1300,6 +1318,8 @@ func createUserIndexes(db *sql.DB) error {
 		"CREATE INDEX IF NOT EXISTS idx_message_mailbox_mailbox ON message_mailbox(mailbox_id)",
 		"CREATE INDEX IF NOT EXISTS idx_message_mailbox_message ON message_mailbox(message_id)",
 		"CREATE INDEX IF NOT EXISTS idx_message_mailbox_uid ON message_mailbox(mailbox_id, uid)",
+		"CREATE INDEX IF NOT EXISTS idx_message_mailbox_modseq ON message_mailbox(mailbox_id, modseq)",
+		"CREATE INDEX IF NOT EXISTS idx_expunged_messages_modseq ON expunged_messages(mailbox_id, modseq)",
 		"CREATE INDEX IF NOT EXISTS idx_message_headers_message ON message_headers(message_id)",
 		"CREATE INDEX IF NOT EXISTS idx_deliveries_message ON deliveries(message_id)",
 		"CREATE INDEX IF NOT EXISTS idx_deliveries_status ON deliveries(status)",
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// Conversation threading for THREAD and SORT (RFC 5256)
+//
+// Every stored message gets a thread_id. Messages are linked through their
+// Message-ID, In-Reply-To and References headers; a message joins the thread of
+// any message it references, that references it, or that shares a referenced
+// ancestor. Threads that become connected this way are merged.
+
+// AssignThreadPerUser stores the Message-ID of a message and links it into a
+// conversation thread. references holds the message IDs from In-Reply-To and
+// References. A message without relatives starts a thread named after its own ID.
+func AssignThreadPerUser(db *sql.DB, messageID int64, messageIDHeader string, references []string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	ids := references
+	if messageIDHeader != "" {
+		ids = append([]string{messageIDHeader}, references...)
+	}
+
+	threads := make(map[int64]bool)
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		rows, err := tx.Query(`
+			SELECT DISTINCT thread_id FROM messages
+			WHERE id != ? AND thread_id IS NOT NULL
+			  AND (message_id_header = ? OR instr(in_reply_to, ?) > 0 OR instr(references_header, ?) > 0)
+		`, messageID, id, id, id)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var threadID int64
+			if err := rows.Scan(&threadID); err == nil {
+				threads[threadID] = true
+			}
+		}
+		_ = rows.Close()
+	}
+
+	// The oldest thread wins so existing thread IDs stay stable
+	threadID := messageID
+	for id := range threads {
+		if id < threadID {
+			threadID = id
+		}
+	}
+
+	for id := range threads {
+		if id == threadID {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE messages SET thread_id = ? WHERE thread_id = ?", threadID, id); err != nil {
+			return 0, err
+		}
+	}
+
+	var header interface{}
+	if messageIDHeader != "" {
+		header = messageIDHeader
+	}
+	if _, err := tx.Exec("UPDATE messages SET thread_id = ?, message_id_header = ? WHERE id = ?", threadID, header, messageID); err != nil {
+		return 0, err
+	}
+
+	return threadID, tx.Commit()
+}
+
+// GetMessageThreadPerUser returns the thread ID of a message
+func GetMessageThreadPerUser(db *sql.DB, messageID int64) (int64, error) {
+	var threadID sql.NullInt64
+	err := db.QueryRow("SELECT thread_id FROM messages WHERE id = ?", messageID).Scan(&threadID)
+	return threadID.Int64, err
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssignThread_LinksReplies(t *testing.T) {
+	userDB, _ := setupModSeqTestDB(t)
+
+	rootID, _ := CreateMessage(userDB, "Plans", "", "", time.Now(), 100)
+	rootThread, err := AssignThreadPerUser(userDB, rootID, "<root@example.com>", nil)
+	if err != nil {
+		t.Fatalf("AssignThreadPerUser failed: %v", err)
+	}
+	if rootThread != rootID {
+		t.Errorf("Expected new thread %d, got %d", rootID, rootThread)
+	}
+
+	replyID, _ := CreateMessage(userDB, "Re: Plans", "<root@example.com>", "<root@example.com>", time.Now(), 100)
+	replyThread, err := AssignThreadPerUser(userDB, replyID, "<reply@example.com>", []string{"<root@example.com>"})
+	if err != nil {
+		t.Fatalf("AssignThreadPerUser failed: %v", err)
+	}
+	if replyThread != rootThread {
+		t.Errorf("Expected reply to join thread %d, got %d", rootThread, replyThread)
+	}
+
+	otherID, _ := CreateMessage(userDB, "Unrelated", "", "", time.Now(), 100)
+	otherThread, _ := AssignThreadPerUser(userDB, otherID, "<other@example.com>", nil)
+	if otherThread == rootThread {
+		t.Error("Unrelated message must start its own thread")
+	}
+}
+
+func TestAssignThread_MergesOutOfOrderDelivery(t *testing.T) {
+	userDB, _ := setupModSeqTestDB(t)
+
+	// Two replies arrive before the message they both answer
+	firstID, _ := CreateMessage(userDB, "Re: Topic", "<parent@example.com>", "", time.Now(), 100)
+	firstThread, _ := AssignThreadPerUser(userDB, firstID, "<a@example.com>", []string{"<parent@example.com>"})
+
+	secondID, _ := CreateMessage(userDB, "Re: Topic", "<parent@example.com>", "", time.Now(), 100)
+	secondThread, _ := AssignThreadPerUser(userDB, secondID, "<b@example.com>", []string{"<parent@example.com>"})
+	if secondThread != firstThread {
+		t.Errorf("Expected siblings to share thread %d, got %d", firstThread, secondThread)
+	}
+
+	parentID, _ := CreateMessage(userDB, "Topic", "", "", time.Now(), 100)
+	parentThread, err := AssignThreadPerUser(userDB, parentID, "<parent@example.com>", nil)
+	if err != nil {
+		t.Fatalf("AssignThreadPerUser failed: %v", err)
+	}
+	if parentThread != firstThread {
+		t.Errorf("Expected parent to join thread %d, got %d", firstThread, parentThread)
+	}
+
+	threadID, err := GetMessageThreadPerUser(userDB, parentID)
+	if err != nil || threadID != firstThread {
+		t.Errorf("Expected stored thread %d, got %d (%v)", firstThread, threadID, err)
+	}
+}
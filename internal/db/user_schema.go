@@ -26,6 +26,9 @@ func createMailboxesTablePerUser(db *sql.DB) error {
 		uid_validity INTEGER NOT NULL,
 		uid_next INTEGER NOT NULL,
 		special_use TEXT,
+		highest_modseq INTEGER NOT NULL DEFAULT 1,
+		total_size INTEGER NOT NULL DEFAULT 0,
+		deleted_size INTEGER NOT NULL DEFAULT 0,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (parent_id) REFERENCES mailboxes(id),
 		UNIQUE(name)
@@ -184,6 +187,26 @@ func GetUserMailboxesPerUser(db *sql.DB) ([]string, error) {
 	return mailboxes, rows.Err()
 }
 
+// GetMailboxSpecialUsesPerUser returns the special-use attributes (RFC 6154) of all
+// mailboxes that have one, keyed by mailbox name
+func GetMailboxSpecialUsesPerUser(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT name, special_use FROM mailboxes WHERE special_use IS NOT NULL AND special_use != ''")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	specialUses := make(map[string]string)
+	for rows.Next() {
+		var name, specialUse string
+		if err := rows.Scan(&name, &specialUse); err == nil {
+			specialUses[name] = specialUse
+		}
+	}
+
+	return specialUses, rows.Err()
+}
+
 func DeleteMailboxPerUser(db *sql.DB, mailboxName string) error {
 	// Cannot delete INBOX
 	if strings.ToUpper(mailboxName) == "INBOX" {
@@ -225,6 +248,8 @@ func DeleteMailboxPerUser(db *sql.DB, mailboxName string) error {
 		}
 	}
 
+	indexed := SearchIndexAvailable(db)
+
 	// Start transaction
 	tx, err := db.Begin()
 	if err != nil {
@@ -232,12 +257,24 @@ func DeleteMailboxPerUser(db *sql.DB, mailboxName string) error {
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	if indexed {
+		if err := unindexMailboxTx(tx, mailboxID); err != nil {
+			return err
+		}
+	}
+
 	// Delete message_mailbox entries
 	_, err = tx.Exec("DELETE FROM message_mailbox WHERE mailbox_id = ?", mailboxID)
 	if err != nil {
 		return err
 	}
 
+	// Delete the mailbox's annotations (METADATA)
+	_, err = tx.Exec("DELETE FROM metadata WHERE mailbox_id = ?", mailboxID)
+	if err != nil {
+		return err
+	}
+
 	// Delete mailbox
 	_, err = tx.Exec("DELETE FROM mailboxes WHERE id = ?", mailboxID)
 	if err != nil {
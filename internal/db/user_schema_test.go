@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -41,6 +42,9 @@ func setupTestDBPerUser(t *testing.T) *sql.DB {
 	if err := createOutboundQueueTablePerUser(db); err != nil {
 		t.Fatalf("Failed to create outbound_queue table: %v", err)
 	}
+	if err := createMetadataTablePerUser(db); err != nil {
+		t.Fatalf("Failed to create metadata table: %v", err)
+	}
 
 	return db
 }
@@ -755,3 +759,45 @@ func TestRetryOutboundMessagePerUser(t *testing.T) {
 		t.Errorf("Expected retry count 1, got %d", retryCount)
 	}
 }
+
+func TestMigrateMailboxNamesToUTF8(t *testing.T) {
+	db := setupTestDBPerUser(t)
+	defer func() { _ = db.Close() }()
+
+	_, _ = CreateMailboxPerUser(db, "INBOX", "\\Inbox")
+	_, _ = CreateMailboxPerUser(db, "&AMk-t&AOk-", "")
+	_, _ = CreateMailboxPerUser(db, "&AMk-t&AOk-/Projects", "")
+	_, _ = CreateMailboxPerUser(db, "R&D", "")
+	_ = SubscribeToMailboxPerUser(db, "&AMk-t&AOk-")
+
+	decode := func(name string) (string, error) {
+		replaced := strings.ReplaceAll(name, "&AMk-t&AOk-", "Été")
+		if strings.Contains(replaced, "&") {
+			return "", errors.New("invalid")
+		}
+		return replaced, nil
+	}
+
+	if err := migrateMailboxNamesToUTF8(db, decode); err != nil {
+		t.Fatalf("migrateMailboxNamesToUTF8 failed: %v", err)
+	}
+
+	for _, name := range []string{"Été", "Été/Projects", "R&D"} {
+		if exists, _ := MailboxExistsPerUser(db, name); !exists {
+			t.Errorf("Expected mailbox %q after migration", name)
+		}
+	}
+	subscriptions, _ := GetUserSubscriptionsPerUser(db)
+	if len(subscriptions) != 1 || subscriptions[0] != "Été" {
+		t.Errorf("Expected the subscription to be migrated, got %v", subscriptions)
+	}
+
+	// The migration only runs once
+	_, _ = CreateMailboxPerUser(db, "&AMk-t&AOk-", "")
+	if err := migrateMailboxNamesToUTF8(db, decode); err != nil {
+		t.Fatalf("migrateMailboxNamesToUTF8 failed: %v", err)
+	}
+	if exists, _ := MailboxExistsPerUser(db, "&AMk-t&AOk-"); !exists {
+		t.Error("Expected names created after the migration to be left alone")
+	}
+}
@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"database/sql"
+	"fmt"
+	"mime"
+	"strings"
+
+	"raven/internal/blobstorage"
+	"raven/internal/db"
+)
+
+// BuildSearchDocument returns the text of a message kept in the full-text
+// index: its subject and address headers, all of its header fields, and the
+// decoded text of its body parts with the markup removed from HTML.
+// Attachments are left out.
+func BuildSearchDocument(parsed *ParsedMessage) db.SearchDocument {
+	var doc db.SearchDocument
+	fields := map[string][]string{}
+	var headers strings.Builder
+	for _, header := range parsed.Headers {
+		value := decodeHeaderValue(header.Value)
+		name := strings.ToLower(header.Name)
+		fields[name] = append(fields[name], value)
+		headers.WriteString(header.Name + ": " + value + "\n")
+	}
+	doc.Subject = strings.Join(fields["subject"], "\n")
+	doc.From = strings.Join(fields["from"], "\n")
+	doc.To = strings.Join(fields["to"], "\n")
+	doc.Cc = strings.Join(fields["cc"], "\n")
+	doc.Bcc = strings.Join(fields["bcc"], "\n")
+	doc.Headers = headers.String()
+
+	var body []string
+	for i := range parsed.Parts {
+		part := &parsed.Parts[i]
+		if part.Filename != "" || strings.HasPrefix(strings.ToLower(part.ContentDisposition), "attachment") {
+			continue
+		}
+		contentType := strings.ToLower(part.ContentType)
+		switch {
+		case contentType == "text/html":
+			body = append(body, htmlToText(decodePartText(part)))
+		case strings.HasPrefix(contentType, "text/"):
+			body = append(body, decodePartText(part))
+		}
+	}
+	doc.Body = strings.Join(body, "\n")
+
+	return doc
+}
+
+// decodeHeaderValue decodes the RFC 2047 encoded words of a header value,
+// keeping the value as it is when they do not decode
+func decodeHeaderValue(value string) string {
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+// ReindexMessagesPerUser rebuilds the full-text index of a per-user database
+// from the stored messages, for mailboxes filled before the index existed.
+// It returns the number of messages indexed; messages that cannot be read
+// back are skipped.
+func ReindexMessagesPerUser(sharedDB *sql.DB, userDB *sql.DB, s3Storage *blobstorage.S3BlobStorage) (int, error) {
+	if err := db.ClearSearchIndexPerUser(userDB); err != nil {
+		return 0, err
+	}
+
+	messageIDs, err := db.GetMailboxMessageIDsPerUser(userDB)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list messages: %v", err)
+	}
+
+	indexed := 0
+	for _, messageID := range messageIDs {
+		rawMsg, err := ReconstructMessageWithSharedDBAndS3(sharedDB, userDB, messageID, s3Storage)
+		if err != nil {
+			fmt.Printf("WARNING: Failed to reconstruct message %d for indexing: %v\n", messageID, err)
+			continue
+		}
+		parsed, err := ParseMIMEMessage(rawMsg)
+		if err != nil {
+			fmt.Printf("WARNING: Failed to parse message %d for indexing: %v\n", messageID, err)
+			continue
+		}
+		if err := db.IndexMessagePerUser(userDB, messageID, BuildSearchDocument(parsed)); err != nil {
+			return indexed, fmt.Errorf("failed to index message %d: %v", messageID, err)
+		}
+		indexed++
+	}
+
+	return indexed, nil
+}
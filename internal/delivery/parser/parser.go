@@ -32,19 +32,21 @@ type Message struct {
 
 // ParsedMessage represents a parsed email message with full MIME structure
 type ParsedMessage struct {
-	MessageID  int64
-	Subject    string
-	From       []mail.Address
-	To         []mail.Address
-	Cc         []mail.Address
-	Bcc        []mail.Address
-	Date       time.Time
-	InReplyTo  string
-	References string
-	Headers    []MessageHeader
-	Parts      []MessagePart
-	RawMessage string
-	SizeBytes  int64
+	MessageID       int64
+	MessageIDHeader string
+	Subject         string
+	From            []mail.Address
+	To              []mail.Address
+	Cc              []mail.Address
+	Bcc             []mail.Address
+	Date            time.Time
+	InReplyTo       string
+	References      string
+	Headers         []MessageHeader
+	Parts           []MessagePart
+	RawMessage      string
+	SizeBytes       int64
+	Preview         string // PREVIEW text (RFC 8970)
 }
 
 // MessageHeader represents a single email header
@@ -167,6 +169,9 @@ func ParseMIMEMessage(rawMessage string) (*ParsedMessage, error) {
 	parsed.Subject = msg.Header.Get("Subject")
 	parsed.InReplyTo = msg.Header.Get("In-Reply-To")
 	parsed.References = msg.Header.Get("References")
+	if ids := ExtractMessageIDs(msg.Header.Get("Message-Id")); len(ids) > 0 {
+		parsed.MessageIDHeader = ids[0]
+	}
 
 	// Parse date
 	dateStr := msg.Header.Get("Date")
@@ -282,6 +287,8 @@ func ParseMIMEMessage(rawMessage string) (*ParsedMessage, error) {
 		parsed.Parts = append(parsed.Parts, part)
 	}
 
+	parsed.Preview = BuildPreview(parsed.Parts)
+
 	return parsed, nil
 }
 
@@ -406,6 +413,22 @@ func StoreMessagePerUserWithSharedDBAndS3(sharedDB *sql.DB, userDB *sql.DB, pars
 		}
 	}
 
+	// Link the message into its conversation thread (used by THREAD and SORT)
+	references := ExtractMessageIDs(parsed.InReplyTo + " " + parsed.References)
+	if _, err := db.AssignThreadPerUser(userDB, messageID, parsed.MessageIDHeader, references); err != nil {
+		return 0, fmt.Errorf("failed to assign thread: %v", err)
+	}
+
+	// Keep the preview so FETCH PREVIEW does not have to load the body
+	if err := db.SetMessagePreview(userDB, messageID, parsed.Preview); err != nil {
+		return 0, fmt.Errorf("failed to store preview: %v", err)
+	}
+
+	// Add the message to the full-text index used by SEARCH
+	if err := db.IndexMessagePerUser(userDB, messageID, BuildSearchDocument(parsed)); err != nil {
+		return 0, fmt.Errorf("failed to index message: %v", err)
+	}
+
 	// Store addresses in user database
 	if err := storeAddresses(userDB, messageID, "from", parsed.From); err != nil {
 		return 0, fmt.Errorf("failed to store from addresses: %v", err)
@@ -1035,6 +1058,30 @@ func parseAddressList(addrList string) []string {
 	return result
 }
 
+// ExtractMessageIDs returns the <msg-id> tokens of a Message-ID, In-Reply-To or
+// References header in order of appearance, without duplicates
+func ExtractMessageIDs(header string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for {
+		start := strings.Index(header, "<")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(header[start:], ">")
+		if end == -1 {
+			break
+		}
+		id := header[start : start+end+1]
+		if len(id) > 2 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		header = header[start+end+1:]
+	}
+	return ids
+}
+
 // generateMessageID generates a unique Message-ID
 func generateMessageID() string {
 	return fmt.Sprintf("<%d@raven-delivery>", time.Now().UnixNano())
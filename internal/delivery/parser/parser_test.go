@@ -1624,3 +1624,110 @@ imagedata
 	//   image/png             <- SECOND (resource)
 	t.Logf("Reconstructed structure order verified successfully")
 }
+
+func TestExtractMessageIDs(t *testing.T) {
+	ids := parser.ExtractMessageIDs("<a@example.com> <b@example.com>\r\n <a@example.com> junk <c@example.com>")
+	expected := []string{"<a@example.com>", "<b@example.com>", "<c@example.com>"}
+	if len(ids) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, ids)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Errorf("Expected %s at %d, got %s", expected[i], i, ids[i])
+		}
+	}
+
+	msg, err := parser.ParseMIMEMessage("From: a@example.com\r\nMessage-ID: <id@example.com>\r\nSubject: x\r\n\r\nbody")
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if msg.MessageIDHeader != "<id@example.com>" {
+		t.Errorf("Expected MessageIDHeader <id@example.com>, got '%s'", msg.MessageIDHeader)
+	}
+}
+
+func TestParseMIMEMessage_Preview(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{
+			name:     "plain text with quote and signature",
+			raw:      "From: a@example.com\r\nSubject: x\r\n\r\nHello   there,\r\n\r\n> quoted reply\r\nSee you.\r\n-- \r\nAlice\r\n",
+			expected: "Hello there, See you.",
+		},
+		{
+			name: "html only",
+			raw: "From: a@example.com\r\nSubject: x\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+				"<html><head><style>p { color: red; }</style></head><body><p>Caf&eacute;<br>menu</p></body></html>",
+			expected: "Café menu",
+		},
+		{
+			name: "plain part preferred over html and attachments",
+			raw: "From: a@example.com\r\nSubject: x\r\nContent-Type: multipart/mixed; boundary=b1\r\n\r\n" +
+				"--b1\r\nContent-Type: text/plain; name=notes.txt\r\nContent-Disposition: attachment; filename=notes.txt\r\n\r\nattached\r\n" +
+				"--b1\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n" +
+				"--b1\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nplain =C3=A9t=C3=A9\r\n" +
+				"--b1--\r\n",
+			expected: "plain été",
+		},
+		{
+			name:     "no text",
+			raw:      "From: a@example.com\r\nSubject: x\r\nContent-Type: image/png\r\nContent-Transfer-Encoding: base64\r\n\r\niVBORw0KGgo=\r\n",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parser.ParseMIMEMessage(tt.raw)
+			if err != nil {
+				t.Fatalf("Failed to parse message: %v", err)
+			}
+			if msg.Preview != tt.expected {
+				t.Errorf("Expected preview %q, got %q", tt.expected, msg.Preview)
+			}
+		})
+	}
+
+	msg, err := parser.ParseMIMEMessage("From: a@example.com\r\nSubject: x\r\n\r\n" + strings.Repeat("word ", 100))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if length := len([]rune(msg.Preview)); length > parser.PreviewLength {
+		t.Errorf("Expected preview of at most %d characters, got %d", parser.PreviewLength, length)
+	}
+}
+
+func TestBuildSearchDocument(t *testing.T) {
+	raw := "From: =?UTF-8?Q?Ren=C3=A9e?= <renee@example.com>\r\nTo: bob@example.com\r\nCc: carol@example.com\r\n" +
+		"Subject: Quarterly report\r\nX-Mailer: Test\r\nContent-Type: multipart/mixed; boundary=b1\r\n\r\n" +
+		"--b1\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		"UmV2ZW51ZSBpcyB1cA==\r\n" +
+		"--b1\r\nContent-Type: text/html\r\n\r\n<style>.x{}</style><p>Costs &amp; savings</p>\r\n" +
+		"--b1\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=data.txt\r\n\r\nattached secret\r\n" +
+		"--b1--\r\n"
+
+	msg, err := parser.ParseMIMEMessage(raw)
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	doc := parser.BuildSearchDocument(msg)
+
+	if doc.Subject != "Quarterly report" || doc.To != "bob@example.com" || doc.Cc != "carol@example.com" || doc.Bcc != "" {
+		t.Errorf("Unexpected header fields: %+v", doc)
+	}
+	if doc.From != "Renée <renee@example.com>" {
+		t.Errorf("Expected decoded From, got %q", doc.From)
+	}
+	if !strings.Contains(doc.Headers, "X-Mailer: Test\n") {
+		t.Errorf("Expected all headers to be kept, got %q", doc.Headers)
+	}
+	if !strings.Contains(doc.Body, "Revenue is up") || !strings.Contains(doc.Body, "Costs & savings") {
+		t.Errorf("Expected decoded text parts in body, got %q", doc.Body)
+	}
+	if strings.Contains(doc.Body, "attached secret") || strings.Contains(doc.Body, ".x{}") {
+		t.Errorf("Expected attachments and styles to be left out, got %q", doc.Body)
+	}
+}
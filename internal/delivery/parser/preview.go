@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"encoding/base64"
+	"html"
+	"io"
+	"mime/quotedprintable"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PreviewLength is the number of characters kept in a message preview.
+// RFC 8970 allows up to 256.
+const PreviewLength = 200
+
+var (
+	htmlHiddenElements = regexp.MustCompile(`(?is)<(head|script|style|title)\b.*?</(head|script|style|title)\s*>`)
+	htmlComments       = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlTags           = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// BuildPreview returns the PREVIEW text of a message (RFC 8970): the start of
+// its first text/plain part, or of its first text/html part with the markup
+// removed, on one line. Quoted lines and the signature are left out. It is
+// empty for messages without text.
+func BuildPreview(parts []MessagePart) string {
+	var htmlPart *MessagePart
+	for i := range parts {
+		part := &parts[i]
+		if part.Filename != "" || strings.HasPrefix(strings.ToLower(part.ContentDisposition), "attachment") {
+			continue
+		}
+		switch strings.ToLower(part.ContentType) {
+		case "text/plain":
+			return normalizePreview(decodePartText(part))
+		case "text/html":
+			if htmlPart == nil {
+				htmlPart = part
+			}
+		}
+	}
+
+	if htmlPart == nil {
+		return ""
+	}
+	return normalizePreview(htmlToText(decodePartText(htmlPart)))
+}
+
+// htmlToText removes the markup and the invisible elements from HTML
+func htmlToText(text string) string {
+	text = htmlHiddenElements.ReplaceAllString(text, " ")
+	text = htmlComments.ReplaceAllString(text, " ")
+	text = htmlTags.ReplaceAllString(text, " ")
+	return html.UnescapeString(text)
+}
+
+// decodePartText undoes the Content-Transfer-Encoding of a text part and
+// converts it to UTF-8. Charsets other than UTF-8 and Latin-1 are not
+// converted; their invalid bytes are dropped.
+func decodePartText(part *MessagePart) string {
+	content := part.TextContent
+	switch strings.ToLower(strings.TrimSpace(part.ContentTransferEncoding)) {
+	case "base64":
+		stripped := strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, content)
+		if decoded, err := base64.StdEncoding.DecodeString(stripped); err == nil {
+			content = string(decoded)
+		}
+	case "quoted-printable":
+		if decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(content))); err == nil {
+			content = string(decoded)
+		}
+	}
+
+	switch strings.ToLower(part.Charset) {
+	case "iso-8859-1", "latin1", "windows-1252":
+		runes := make([]rune, len(content))
+		for i := 0; i < len(content); i++ {
+			runes[i] = rune(content[i])
+		}
+		return string(runes)
+	}
+	return strings.ToValidUTF8(content, "")
+}
+
+// normalizePreview reduces text to its first PreviewLength characters on a
+// single line, skipping quoted lines and stopping at a signature separator
+func normalizePreview(text string) string {
+	var words []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if line == "-- " {
+			break
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), ">") {
+			continue
+		}
+		words = append(words, strings.FieldsFunc(line, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsControl(r)
+		})...)
+	}
+
+	preview := strings.Join(words, " ")
+	if utf8.RuneCountInString(preview) > PreviewLength {
+		preview = strings.TrimSpace(string([]rune(preview)[:PreviewLength]))
+	}
+	return preview
+}
@@ -142,6 +142,7 @@ func (s *Storage) DeliverMessage(recipient string, msg *parser.Message, folder s
 	if err != nil {
 		return fmt.Errorf("failed to add message to mailbox: %w", err)
 	}
+	s.dbManager.MailboxChanges().Publish(targetDB, mailboxID)
 
 	// Record delivery
 	err = db.RecordDeliveryPerUser(targetDB, messageID, recipient, msg.From, "delivered", "250 OK")
@@ -184,29 +185,30 @@ func (s *Storage) GetUserQuota(email string) (int64, error) {
 	}
 
 	// Calculate total size of all messages in the per-user DB
-	query := `
-		SELECT COALESCE(SUM(m.size_bytes), 0)
-		FROM messages m
-		JOIN message_mailbox mm ON m.id = mm.message_id
-		JOIN mailboxes mb ON mm.mailbox_id = mb.id
-	`
-
-	var totalSize int64
-	err = userDB.QueryRow(query).Scan(&totalSize)
+	usage, err := db.GetQuotaUsagePerUser(userDB)
 	if err != nil {
 		return 0, fmt.Errorf("failed to calculate quota: %w", err)
 	}
 
-	return totalSize, nil
+	return usage.StorageBytes, nil
 }
 
-// CheckQuota checks if a user has enough quota for a message
+// CheckQuota checks if a user has enough quota for a message.
+// A per-user STORAGE limit (set with IMAP SETQUOTA) takes precedence over quotaLimit.
 func (s *Storage) CheckQuota(username string, messageSize int64, quotaLimit int64) error {
 	currentUsage, err := s.GetUserQuota(username)
 	if err != nil {
 		return fmt.Errorf("failed to get quota: %w", err)
 	}
 
+	if userDB, err := s.dbManager.GetUserDB(username); err == nil {
+		if limits, err := db.GetQuotaLimitsPerUser(userDB); err == nil {
+			if limit, ok := limits[db.QuotaResourceStorage]; ok {
+				quotaLimit = limit
+			}
+		}
+	}
+
 	if currentUsage+messageSize > quotaLimit {
 		return fmt.Errorf("quota exceeded: current=%d, limit=%d, message=%d",
 			currentUsage, quotaLimit, messageSize)
@@ -0,0 +1,77 @@
+package models
+
+import "sort"
+
+// MessageMap is a session's sequence number map of its selected mailbox
+// (RFC 9051 Section 2.3.1.2): message n has UID UIDs[n-1]. It only changes
+// when the session is told about new or expunged messages, so sequence
+// numbers stay stable while other sessions change the mailbox.
+type MessageMap struct {
+	MailboxID int64
+	Owner     string           // SelectedOwner the map belongs to
+	UIDs      []int64          // UIDs in ascending (sequence) order
+	Flags     map[int64]string // Flags last reported to the client, by UID
+
+	// Version is the state of the mailbox the map was last brought fully up
+	// to date with; the zero value matches no mailbox
+	Version MailboxVersion
+}
+
+// MailboxVersion identifies the state of a mailbox: adding, expunging or
+// changing the flags of a message changes at least one of its fields
+type MailboxVersion struct {
+	HighestModSeq int64
+	Messages      int
+	UIDNext       int64
+}
+
+// NewMessageMap creates an empty map of a mailbox
+func NewMessageMap(mailboxID int64, owner string) *MessageMap {
+	return &MessageMap{MailboxID: mailboxID, Owner: owner, Flags: make(map[int64]string)}
+}
+
+// Count returns the number of messages the session knows about
+func (m *MessageMap) Count() int {
+	return len(m.UIDs)
+}
+
+// UID returns the UID of message seqNum
+func (m *MessageMap) UID(seqNum int) (int64, bool) {
+	if seqNum < 1 || seqNum > len(m.UIDs) {
+		return 0, false
+	}
+	return m.UIDs[seqNum-1], true
+}
+
+// SeqNum returns the sequence number of the message with the given UID
+func (m *MessageMap) SeqNum(uid int64) (int, bool) {
+	i := sort.Search(len(m.UIDs), func(i int) bool { return m.UIDs[i] >= uid })
+	if i == len(m.UIDs) || m.UIDs[i] != uid {
+		return 0, false
+	}
+	return i + 1, true
+}
+
+// Add appends a message; its UID must be higher than all known UIDs
+func (m *MessageMap) Add(uid int64, flags string) {
+	m.UIDs = append(m.UIDs, uid)
+	m.Flags[uid] = flags
+}
+
+// Expunge removes a message and returns the sequence number it had
+func (m *MessageMap) Expunge(uid int64) (int, bool) {
+	seqNum, ok := m.SeqNum(uid)
+	if !ok {
+		return 0, false
+	}
+	m.UIDs = append(m.UIDs[:seqNum-1], m.UIDs[seqNum:]...)
+	delete(m.Flags, uid)
+	return seqNum, true
+}
+
+// SetFlags records flags the client has been told about
+func (m *MessageMap) SetFlags(uid int64, flags string) {
+	if _, ok := m.Flags[uid]; ok {
+		m.Flags[uid] = flags
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestMessageMap_SequenceNumbers(t *testing.T) {
+	m := NewMessageMap(1, "")
+	m.Add(3, `\Seen`)
+	m.Add(7, "")
+	m.Add(9, "")
+
+	if m.Count() != 3 {
+		t.Fatalf("Expected 3 messages, got %d", m.Count())
+	}
+	if uid, ok := m.UID(2); !ok || uid != 7 {
+		t.Errorf("Expected message 2 to be UID 7, got %d (%v)", uid, ok)
+	}
+	if _, ok := m.UID(4); ok {
+		t.Error("Expected no message 4")
+	}
+	if seqNum, ok := m.SeqNum(9); !ok || seqNum != 3 {
+		t.Errorf("Expected UID 9 to be message 3, got %d (%v)", seqNum, ok)
+	}
+	if _, ok := m.SeqNum(8); ok {
+		t.Error("Expected UID 8 to be unknown")
+	}
+}
+
+func TestMessageMap_Expunge(t *testing.T) {
+	m := NewMessageMap(1, "")
+	for _, uid := range []int64{1, 2, 3, 4} {
+		m.Add(uid, "")
+	}
+
+	// Each expunge reports the sequence number after earlier expunges
+	if seqNum, ok := m.Expunge(2); !ok || seqNum != 2 {
+		t.Errorf("Expected UID 2 to be expunged as message 2, got %d (%v)", seqNum, ok)
+	}
+	if seqNum, ok := m.Expunge(4); !ok || seqNum != 3 {
+		t.Errorf("Expected UID 4 to be expunged as message 3, got %d (%v)", seqNum, ok)
+	}
+	if _, ok := m.Expunge(4); ok {
+		t.Error("Expected a second expunge of UID 4 to fail")
+	}
+	if seqNum, _ := m.SeqNum(3); seqNum != 2 {
+		t.Errorf("Expected UID 3 to be message 2, got %d", seqNum)
+	}
+
+	m.SetFlags(3, `\Flagged`)
+	m.SetFlags(4, `\Seen`)
+	if m.Flags[3] != `\Flagged` {
+		t.Errorf("Expected flags of UID 3 to be updated, got %q", m.Flags[3])
+	}
+	if _, ok := m.Flags[4]; ok {
+		t.Error("Expected flags of an expunged message not to be recorded")
+	}
+}
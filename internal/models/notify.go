@@ -0,0 +1,28 @@
+package models
+
+// NotifySettings holds the NOTIFY (RFC 5465) filters of a session together
+// with the personal mailbox state last reported to the client. The selected
+// mailbox is tracked by the session's MessageMap.
+type NotifySettings struct {
+	Filters []NotifyFilter
+
+	// Personal mailboxes and their counters as last reported
+	Mailboxes     map[string]NotifyMailboxStatus
+	Subscriptions map[string]bool
+}
+
+// NotifyFilter is one "(filter events)" group of NOTIFY SET
+type NotifyFilter struct {
+	Kind      string          // SELECTED, SELECTED-DELAYED, PERSONAL, INBOXES, SUBSCRIBED, SUBTREE or MAILBOXES
+	Mailboxes []string        // Mailbox names for SUBTREE and MAILBOXES
+	Events    map[string]bool // Upper-case event names; empty for NONE
+	FetchAtts string          // FETCH items sent for MessageNew in the selected mailbox
+}
+
+// NotifyMailboxStatus is the mailbox state behind STATUS notifications
+type NotifyMailboxStatus struct {
+	MailboxID int64
+	Messages  int
+	UIDNext   int64
+	Unseen    int
+}
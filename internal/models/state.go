@@ -16,4 +16,22 @@ type ClientState struct {
 	LastRecentCount    int    // Last known recent (unseen) message count
 	UIDValidity        int64  // UID validity for selected mailbox
 	UIDNext            int64  // Next UID for selected mailbox
+	ReadOnly           bool   // Selected mailbox was opened read-only (EXAMINE or no write rights)
+	// CONDSTORE/QRESYNC (RFC 7162) session state
+	CondStoreEnabled   bool   // Client issued a CONDSTORE enabling command
+	QResyncEnabled     bool   // Client enabled QRESYNC; expunges are reported as VANISHED
+	// ENABLE (RFC 5161) session state
+	UTF8Enabled        bool   // Client enabled UTF8=ACCEPT (RFC 6855); mailbox names are sent as UTF-8
+	IMAP4rev2Enabled   bool   // Client enabled IMAP4rev2 (RFC 9051): no \Recent, ESEARCH results, UTF-8 mailbox names
+	// COMPRESS (RFC 4978) session state
+	CompressionActive  bool   // The connection is DEFLATE-compressed in both directions
+	// NOTIFY (RFC 5465): nil until the client issues NOTIFY SET
+	Notify             *NotifySettings
+	// SEARCHRES (RFC 5182) saved search result, referenced as "$"
+	SearchResult       []int64 // UIDs saved by SEARCH RETURN (SAVE)
+	// ACL (RFC 4314): set when the selected mailbox belongs to another user
+	SelectedOwner      string // Owner's email address; empty for the user's own mailboxes
+	SelectedRights     string // Rights held on the selected mailbox when SelectedOwner is set
+	// Sequence numbers of the selected mailbox as known to the client (RFC 9051 Section 7.5.1)
+	Messages           *MessageMap
 }
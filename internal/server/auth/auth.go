@@ -18,6 +18,7 @@ import (
 	"raven/internal/blobstorage"
 	"raven/internal/conf"
 	"raven/internal/models"
+	"raven/internal/server/utils"
 )
 
 // ServerDeps defines the dependencies that auth handlers need from the server
@@ -43,7 +44,7 @@ func oauthSASLReady(deps ServerDeps) bool {
 }
 
 func buildCapabilities(deps ServerDeps, isTLS bool) []string {
-	capabilities := []string{"IMAP4rev1"}
+	capabilities := []string{"IMAP4rev1", "IMAP4rev2"}
 
 	if isTLS {
 		capabilities = append(capabilities, "AUTH=PLAIN", "LOGIN")
@@ -61,6 +62,38 @@ func buildCapabilities(deps ServerDeps, isTLS bool) []string {
 		"NAMESPACE",
 		"UNSELECT",
 		"LITERAL+",
+		"MOVE",
+		"CONDSTORE",
+		"QRESYNC",
+		"SPECIAL-USE",
+		"CREATE-SPECIAL-USE",
+		"LIST-EXTENDED",
+		"LIST-STATUS",
+		"ESEARCH",
+		"SEARCHRES",
+		"SORT",
+		"SORT=DISPLAY",
+		"THREAD=ORDEREDSUBJECT",
+		"THREAD=REFERENCES",
+		"QUOTA",
+		"QUOTA=RES-STORAGE",
+		"QUOTA=RES-MESSAGE",
+		"QUOTA=RES-MAILBOX",
+		"QUOTASET",
+		"ACL",
+		"RIGHTS=kxte",
+		"METADATA",
+		"METADATA-SERVER",
+		"ENABLE",
+		"UTF8=ACCEPT",
+		"BINARY",
+		"COMPRESS=DEFLATE",
+		"NOTIFY",
+		"OBJECTID",
+		"PREVIEW",
+		"STATUS=SIZE",
+		"SAVEDATE",
+		"MULTISEARCH",
 	)
 
 	return capabilities
@@ -114,9 +147,9 @@ func HandleLogin(deps ServerDeps, conn net.Conn, tag string, parts []string, sta
 		return
 	}
 
-	// Extract username and password, removing quotes if present
-	username := strings.Trim(parts[2], "\"")
-	password := strings.Trim(parts[3], "\"")
+	// Extract username and password; either may be a quoted string or a literal
+	username := utils.ParseQuotedString(parts[2])
+	password := utils.ParseQuotedString(parts[3])
 
 	// Use common authentication logic
 	authenticateUser(deps, conn, tag, username, password, state)
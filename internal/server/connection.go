@@ -2,8 +2,8 @@ package server
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"strings"
 	"time"
@@ -15,33 +15,46 @@ import (
 	"raven/internal/server/message"
 	"raven/internal/server/selection"
 	"raven/internal/server/uid"
+	"raven/internal/server/utils"
 )
 
 func handleClient(s *IMAPServer, conn net.Conn, state *models.ClientState) {
+	// Close the connection the session ended on, which after COMPRESS wraps
+	// the one HandleConnection closes and stops its decompressor
+	defer func() { _ = conn.Close() }()
+
 	// Use buffered reader to properly handle command lines and literal data
 	reader := bufio.NewReader(conn)
 
 	for {
 		_ = conn.SetReadDeadline(time.Now().Add(30 * time.Minute))
 
-		// Read one line at a time (until CRLF or LF)
-		line, err := reader.ReadString('\n')
+		// Read one command, including the literals in its arguments
+		command, err := utils.ReadCommand(reader, func() {
+			s.sendResponse(conn, "+ Ready for literal data")
+		})
+		if errors.Is(err, utils.ErrNonSyncLiteralTooLarge) {
+			// The literal data follows without a continuation and would be
+			// read as commands, so the session cannot go on (RFC 7888)
+			s.sendResponse(conn, fmt.Sprintf("%s BAD [TOOBIG] Literal too large", command.Tag))
+			s.sendResponse(conn, "* BYE Literal too large")
+			return
+		}
+		if errors.Is(err, utils.ErrLiteralTooLarge) {
+			s.sendResponse(conn, fmt.Sprintf("%s BAD Literal too large", command.Tag))
+			continue
+		}
 		if err != nil {
-			if err != io.EOF {
-				return
-			}
-			if line == "" {
-				return
-			}
+			return
 		}
 
-		line = strings.TrimSpace(line)
+		line := strings.TrimSpace(command.Line)
 		if line == "" {
 			continue
 		}
 
 		fmt.Printf("Client: %s\n", line)
-		parts := strings.Fields(line)
+		parts := command.Parts()
 		if len(parts) < 2 {
 			s.sendResponse(conn, "* BAD Invalid command format")
 			continue
@@ -50,6 +63,17 @@ func handleClient(s *IMAPServer, conn net.Conn, state *models.ClientState) {
 		tag := parts[0]
 		cmd := strings.ToUpper(parts[1])
 
+		// NOTIFY (RFC 5465): report changes made elsewhere before the command
+		// runs, then absorb the changes the command itself makes
+		notify := state.Notify != nil && extension.NotificationsAllowed(parts)
+		if notify {
+			extension.DeliverNotifications(s, conn, state)
+		} else if state.Notify == nil {
+			// Tell the client about changes to the selected mailbox made by
+			// other sessions, as far as the command allows (RFC 9051 Section 7)
+			message.SendMailboxUpdates(s, conn, state, message.UpdatesAllowed(parts), "")
+		}
+
 		switch cmd {
 		case "CAPABILITY":
 			auth.HandleCapability(s, conn, tag, state)
@@ -73,18 +97,58 @@ func handleClient(s *IMAPServer, conn net.Conn, state *models.ClientState) {
 			message.HandleFetch(s, conn, tag, parts, state)
 		case "SEARCH":
 			message.HandleSearch(s, conn, tag, parts, state)
+		case "ESEARCH":
+			message.HandleEsearch(s, conn, tag, parts, state)
 		case "STORE":
 			message.HandleStore(s, conn, tag, parts, state)
 		case "COPY":
 			message.HandleCopy(s, conn, tag, parts, state)
+		case "MOVE":
+			message.HandleMove(s, conn, tag, parts, state)
+		case "SORT":
+			message.HandleSort(s, conn, tag, parts, state)
+		case "THREAD":
+			message.HandleThread(s, conn, tag, parts, state)
 		case "STATUS":
 			mailbox.HandleStatus(s, conn, tag, parts, state)
 		case "UID":
 			uid.HandleUID(s, conn, tag, parts, state)
 		case "IDLE":
 			extension.HandleIdle(s, conn, tag, state)
+		case "ENABLE":
+			extension.HandleEnable(s, conn, tag, parts, state)
+		case "NOTIFY":
+			extension.HandleNotify(s, conn, tag, parts, state)
+		case "COMPRESS":
+			// Continue the session on the compressed connection
+			if compressed := extension.HandleCompress(s, conn, tag, parts, state); compressed != nil {
+				conn = compressed
+				reader = bufio.NewReader(conn)
+			}
 		case "NAMESPACE":
 			extension.HandleNamespace(s, conn, tag, state)
+		case "GETQUOTA":
+			extension.HandleGetQuota(s, conn, tag, parts, state)
+		case "GETQUOTAROOT":
+			extension.HandleGetQuotaRoot(s, conn, tag, parts, state)
+		case "SETQUOTA":
+			extension.HandleSetQuota(s, conn, tag, parts, state)
+		case "XREINDEX":
+			extension.HandleReindex(s, conn, tag, parts, state)
+		case "GETMETADATA":
+			extension.HandleGetMetadata(s, conn, tag, parts, state)
+		case "SETMETADATA":
+			extension.HandleSetMetadata(s, conn, tag, parts, state)
+		case "SETACL":
+			mailbox.HandleSetACL(s, conn, tag, parts, state)
+		case "DELETEACL":
+			mailbox.HandleDeleteACL(s, conn, tag, parts, state)
+		case "GETACL":
+			mailbox.HandleGetACL(s, conn, tag, parts, state)
+		case "LISTRIGHTS":
+			mailbox.HandleListRights(s, conn, tag, parts, state)
+		case "MYRIGHTS":
+			mailbox.HandleMyRights(s, conn, tag, parts, state)
 		case "UNSELECT":
 			selection.HandleUnselect(s, conn, tag, state)
 		case "APPEND":
@@ -114,6 +178,10 @@ func handleClient(s *IMAPServer, conn net.Conn, state *models.ClientState) {
 		default:
 			s.sendResponse(conn, fmt.Sprintf("%s BAD Unknown command: %s", tag, cmd))
 		}
+
+		if notify {
+			extension.ResetNotifications(s, state)
+		}
 	}
 }
 
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestHandleClient_Literals tests commands whose arguments are literals and quoted strings with spaces
+func TestHandleClient_Literals(t *testing.T) {
+	srv := SetupTestServerSimple(t)
+	state := SetupAuthenticatedState(t, srv, "literaluser")
+	conn := NewMockConn()
+
+	conn.AddReadData("A001 CREATE {8}\r\nMy Stuff\r\n")
+	conn.AddReadData("A002 CREATE {10+}\r\nWork Plans\r\n")
+	conn.AddReadData("A003 LIST \"\" \"My Stuff\"\r\n")
+	handleClient(srv.server, conn, state)
+
+	response := conn.GetWrittenData()
+	if strings.Count(response, "+ Ready for literal data") != 1 {
+		t.Errorf("Expected one continuation request for the synchronizing literal, got: %s", response)
+	}
+	if !strings.Contains(response, "A001 OK") || !strings.Contains(response, "A002 OK") {
+		t.Fatalf("Expected both CREATEs to succeed, got: %s", response)
+	}
+	if !strings.Contains(response, `"/" "My Stuff"`) {
+		t.Errorf("Expected the mailbox with a space in its name, got: %s", response)
+	}
+}
+
+// TestHandleClient_LiteralTooLarge tests that oversized literals are refused
+func TestHandleClient_LiteralTooLarge(t *testing.T) {
+	srv := SetupTestServerSimple(t)
+	state := SetupAuthenticatedState(t, srv, "literaluser")
+	conn := NewMockConn()
+
+	conn.AddReadData("A001 CREATE {99999999}\r\nA002 NOOP\r\n")
+	handleClient(srv.server, conn, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "A001 BAD Literal too large") || strings.Contains(response, "+ Ready") {
+		t.Errorf("Expected the literal to be refused without a continuation, got: %s", response)
+	}
+	if !strings.Contains(response, "A002 OK NOOP completed") {
+		t.Errorf("Expected the next command to run, got: %s", response)
+	}
+}
+
+// TestHandleClient_NonSyncLiteralTooLarge tests that an oversized
+// non-synchronizing literal ends the session instead of being read as commands
+func TestHandleClient_NonSyncLiteralTooLarge(t *testing.T) {
+	srv := SetupTestServerSimple(t)
+	state := SetupAuthenticatedState(t, srv, "literaluser")
+	conn := NewMockConn()
+
+	conn.AddReadData("A001 CREATE {99999999999999999999+}\r\nA002 DELETE INBOX\r\n")
+	handleClient(srv.server, conn, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "A001 BAD [TOOBIG] Literal too large") || !strings.Contains(response, "* BYE") {
+		t.Errorf("Expected the literal to be refused and the session closed, got: %s", response)
+	}
+	if strings.Contains(response, "A002") {
+		t.Errorf("Expected the literal data not to run as a command, got: %s", response)
+	}
+}
@@ -0,0 +1,195 @@
+package extension
+
+import (
+	"compress/flate"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"raven/internal/models"
+)
+
+// ===== COMPRESS (RFC 4978) =====
+
+// HandleCompress implements the COMPRESS command. On success it returns the
+// compressed connection that the session must use from then on; otherwise it
+// returns nil and the session continues on conn.
+// Syntax: COMPRESS DEFLATE
+func HandleCompress(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) net.Conn {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return nil
+	}
+
+	if len(parts) != 3 || !strings.EqualFold(parts[2], "DEFLATE") {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD COMPRESS requires the DEFLATE mechanism", tag))
+		return nil
+	}
+
+	if state.CompressionActive {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [COMPRESSIONACTIVE] DEFLATE active via COMPRESS", tag))
+		return nil
+	}
+
+	// The OK response is the last data sent uncompressed
+	deps.SendResponse(conn, fmt.Sprintf("%s OK DEFLATE active", tag))
+
+	compressed, err := newCompressConn(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil
+	}
+
+	state.CompressionActive = true
+	state.Conn = compressed
+	return compressed
+}
+
+// compressConn is a net.Conn that compresses everything written to it and
+// decompresses everything read from it with raw DEFLATE (RFC 1951).
+// Decompression runs in its own goroutine so that read deadlines (used by
+// IDLE to poll for DONE) never interrupt, and so corrupt, the DEFLATE stream.
+type compressConn struct {
+	net.Conn
+
+	writeMu sync.Mutex
+	writer  *flate.Writer
+
+	chunks    chan []byte // Decompressed client data, closed when the stream ends
+	streamErr error       // Why the stream ended, set before chunks is closed
+	done      chan struct{}
+	pending   []byte
+	readErr   error
+
+	deadlineMu   sync.Mutex
+	readDeadline time.Time
+
+	closeOnce sync.Once
+}
+
+func newCompressConn(conn net.Conn) (*compressConn, error) {
+	writer, err := flate.NewWriter(conn, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deadlines are enforced by Read; the underlying reads must block
+	_ = conn.SetReadDeadline(time.Time{})
+
+	c := &compressConn{
+		Conn:   conn,
+		writer: writer,
+		chunks: make(chan []byte),
+		done:   make(chan struct{}),
+	}
+	go c.readLoop(flate.NewReader(conn))
+	return c, nil
+}
+
+// readLoop decompresses client data and hands it to Read. It ends when the
+// underlying connection fails or the compressed connection is closed,
+// without waiting for Read to collect the error.
+func (c *compressConn) readLoop(r io.Reader) {
+	defer close(c.chunks)
+	for {
+		buf := make([]byte, 4096)
+		n, err := r.Read(buf)
+		if n > 0 {
+			select {
+			case c.chunks <- buf[:n]:
+			case <-c.done:
+				c.streamErr = net.ErrClosed
+				return
+			}
+		}
+		if err != nil {
+			c.streamErr = err
+			return
+		}
+	}
+}
+
+// Read returns decompressed client data, honouring the read deadline
+func (c *compressConn) Read(b []byte) (int, error) {
+	if len(c.pending) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+
+		var timeout <-chan time.Time
+		c.deadlineMu.Lock()
+		deadline := c.readDeadline
+		c.deadlineMu.Unlock()
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		select {
+		case data, ok := <-c.chunks:
+			if !ok {
+				c.readErr = c.streamErr
+				return 0, c.readErr
+			}
+			c.pending = data
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write compresses b and flushes it so each response reaches the client at once
+func (c *compressConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	n, err := c.writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, c.writer.Flush()
+}
+
+func (c *compressConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+func (c *compressConn) SetDeadline(t time.Time) error {
+	_ = c.SetReadDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *compressConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+// IsTLS reports whether the compressed connection runs over TLS, so LOGIN
+// and AUTHENTICATE keep working after COMPRESS
+func (c *compressConn) IsTLS() bool {
+	if _, ok := c.Conn.(*tls.Conn); ok {
+		return true
+	}
+	type tlsAware interface{ IsTLS() bool }
+	if ta, ok := c.Conn.(tlsAware); ok {
+		return ta.IsTLS()
+	}
+	return false
+}
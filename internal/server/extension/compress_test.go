@@ -0,0 +1,156 @@
+package extension_test
+
+import (
+	"bufio"
+	"compress/flate"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"raven/internal/models"
+	"raven/internal/server"
+)
+
+// ===== COMPRESS TESTS =====
+
+// startCompression runs COMPRESS DEFLATE over a pipe and returns the server's
+// compressed connection and the client's end of the pipe
+func startCompression(t *testing.T, srv *server.TestInterface, state *models.ClientState) (net.Conn, net.Conn, *bufio.Reader) {
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	})
+
+	result := make(chan net.Conn, 1)
+	go func() {
+		result <- srv.HandleCompress(serverConn, "C001", []string{"C001", "COMPRESS", "DEFLATE"}, state)
+	}()
+
+	clientReader := bufio.NewReader(clientConn)
+	line, err := clientReader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "C001 OK") {
+		t.Fatalf("Expected OK before compression starts, got: %q (%v)", line, err)
+	}
+
+	compressed := <-result
+	if compressed == nil {
+		t.Fatal("Expected a compressed connection")
+	}
+	return compressed, clientConn, clientReader
+}
+
+// TestCompress_RoundTrip tests that data is compressed in both directions after COMPRESS DEFLATE
+func TestCompress_RoundTrip(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	state := server.SetupAuthenticatedState(t, srv, "zipuser")
+	compressed, clientConn, clientReader := startCompression(t, srv, state)
+
+	if !state.CompressionActive {
+		t.Error("Expected compression to be recorded in the session")
+	}
+
+	// Client to server
+	go func() {
+		w, _ := flate.NewWriter(clientConn, flate.DefaultCompression)
+		_, _ = w.Write([]byte("C002 NOOP\r\n"))
+		_ = w.Flush()
+	}()
+	line, err := bufio.NewReader(compressed).ReadString('\n')
+	if err != nil || line != "C002 NOOP\r\n" {
+		t.Fatalf("Expected the decompressed command, got: %q (%v)", line, err)
+	}
+
+	// Server to client
+	go func() {
+		_, _ = compressed.Write([]byte("* OK still here\r\n"))
+	}()
+	buf := make([]byte, len("* OK still here\r\n"))
+	if _, err := io.ReadFull(flate.NewReader(clientReader), buf); err != nil || string(buf) != "* OK still here\r\n" {
+		t.Errorf("Expected the decompressed response, got: %q (%v)", buf, err)
+	}
+}
+
+// TestCompress_ReadDeadline tests that a read timeout does not break the DEFLATE stream
+func TestCompress_ReadDeadline(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	state := server.SetupAuthenticatedState(t, srv, "zipuser")
+	compressed, clientConn, _ := startCompression(t, srv, state)
+
+	_ = compressed.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := compressed.Read(make([]byte, 16)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected a timeout, got: %v", err)
+	}
+
+	go func() {
+		w, _ := flate.NewWriter(clientConn, flate.DefaultCompression)
+		_, _ = w.Write([]byte("DONE\r\n"))
+		_ = w.Flush()
+	}()
+	_ = compressed.SetReadDeadline(time.Time{})
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(compressed, buf); err != nil || string(buf) != "DONE\r\n" {
+		t.Errorf("Expected data after the timeout, got: %q (%v)", buf, err)
+	}
+}
+
+// TestCompress_InvalidRequests tests COMPRESS error responses
+func TestCompress_InvalidRequests(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+
+	if c := srv.HandleCompress(conn, "C003", []string{"C003", "COMPRESS", "DEFLATE"}, &models.ClientState{}); c != nil {
+		t.Error("Expected no compression before authentication")
+	}
+	if response := conn.GetWrittenData(); !strings.Contains(response, "C003 NO") {
+		t.Errorf("Expected NO before authentication, got: %s", response)
+	}
+
+	state := server.SetupAuthenticatedState(t, srv, "zipuser")
+	conn.ClearWriteBuffer()
+	srv.HandleCompress(conn, "C004", []string{"C004", "COMPRESS", "GZIP"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "C004 BAD") {
+		t.Errorf("Expected BAD for an unknown mechanism, got: %s", response)
+	}
+
+	state.CompressionActive = true
+	conn.ClearWriteBuffer()
+	srv.HandleCompress(conn, "C005", []string{"C005", "COMPRESS", "DEFLATE"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "C005 NO [COMPRESSIONACTIVE]") {
+		t.Errorf("Expected COMPRESSIONACTIVE, got: %s", response)
+	}
+}
+
+// TestCompress_StreamEnds tests that reads fail once the client goes away or
+// the connection is closed, instead of blocking forever
+func TestCompress_StreamEnds(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+
+	for _, name := range []string{"client disconnects", "server closes"} {
+		t.Run(name, func(t *testing.T) {
+			state := server.SetupAuthenticatedState(t, srv, "zipuser")
+			compressed, clientConn, _ := startCompression(t, srv, state)
+
+			if name == "client disconnects" {
+				_ = clientConn.Close()
+			} else {
+				_ = compressed.Close()
+			}
+
+			_ = compressed.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, err := compressed.Read(make([]byte, 16))
+			if err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("Expected the end of the stream, got: %v", err)
+			}
+
+			// The error sticks
+			if _, again := compressed.Read(make([]byte, 16)); again != err {
+				t.Errorf("Expected %v again, got: %v", err, again)
+			}
+		})
+	}
+}
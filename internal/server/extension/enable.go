@@ -0,0 +1,68 @@
+package extension
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"raven/internal/models"
+)
+
+// ===== ENABLE (RFC 5161) =====
+
+// HandleEnable implements the ENABLE command. Supported extensions are
+// CONDSTORE, QRESYNC (RFC 7162) and UTF8=ACCEPT (RFC 6855); others are
+// ignored. The ENABLED response lists only what this command newly enabled.
+// Syntax: ENABLE capability ...
+func HandleEnable(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 3 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD ENABLE requires at least one capability", tag))
+		return
+	}
+
+	if state.SelectedMailboxID > 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD ENABLE is not allowed while a mailbox is selected", tag))
+		return
+	}
+
+	var enabled []string
+	for _, capability := range parts[2:] {
+		switch strings.ToUpper(capability) {
+		case "CONDSTORE":
+			if !state.CondStoreEnabled {
+				state.CondStoreEnabled = true
+				enabled = append(enabled, "CONDSTORE")
+			}
+		case "QRESYNC":
+			// QRESYNC implies CONDSTORE
+			if !state.QResyncEnabled {
+				state.CondStoreEnabled = true
+				state.QResyncEnabled = true
+				enabled = append(enabled, "QRESYNC")
+			}
+		case "IMAP4REV2":
+			// RFC 9051 Section 6.3.1: the session follows IMAP4rev2 rules from now on
+			if !state.IMAP4rev2Enabled {
+				state.IMAP4rev2Enabled = true
+				enabled = append(enabled, "IMAP4rev2")
+			}
+		case "UTF8=ACCEPT":
+			if !state.UTF8Enabled {
+				state.UTF8Enabled = true
+				enabled = append(enabled, "UTF8=ACCEPT")
+			}
+		}
+	}
+
+	response := "* ENABLED"
+	if len(enabled) > 0 {
+		response += " " + strings.Join(enabled, " ")
+	}
+	deps.SendResponse(conn, response)
+	deps.SendResponse(conn, fmt.Sprintf("%s OK ENABLE completed", tag))
+}
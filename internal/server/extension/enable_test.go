@@ -0,0 +1,128 @@
+package extension_test
+
+import (
+	"strings"
+	"testing"
+
+	"raven/internal/models"
+	"raven/internal/server"
+)
+
+// ===== ENABLE TESTS =====
+
+// TestEnable_UTF8Accept tests that ENABLE UTF8=ACCEPT is reported once and recorded in the session
+func TestEnable_UTF8Accept(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "enableuser")
+
+	srv.HandleEnable(conn, "E001", []string{"E001", "ENABLE", "utf8=accept", "X-UNKNOWN"}, state)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* ENABLED UTF8=ACCEPT\r\n") || !strings.Contains(response, "E001 OK ENABLE completed") {
+		t.Errorf("Expected UTF8=ACCEPT to be enabled, got: %s", response)
+	}
+	if !state.UTF8Enabled {
+		t.Error("Expected UTF8Enabled to be set")
+	}
+
+	// Extensions that are already enabled are not reported again
+	conn.ClearWriteBuffer()
+	srv.HandleEnable(conn, "E002", []string{"E002", "ENABLE", "UTF8=ACCEPT"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "* ENABLED\r\n") {
+		t.Errorf("Expected an empty ENABLED response, got: %s", response)
+	}
+}
+
+// TestEnable_QResyncImpliesCondStore tests that ENABLE QRESYNC also enables CONDSTORE
+func TestEnable_QResyncImpliesCondStore(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "enableuser")
+
+	srv.HandleEnable(conn, "E003", []string{"E003", "ENABLE", "QRESYNC"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "* ENABLED QRESYNC") {
+		t.Errorf("Expected QRESYNC to be enabled, got: %s", response)
+	}
+	if !state.QResyncEnabled || !state.CondStoreEnabled {
+		t.Error("Expected QRESYNC and CONDSTORE to be enabled")
+	}
+}
+
+// TestEnable_IMAP4rev2 tests that ENABLE IMAP4rev2 switches the session to RFC 9051 responses
+func TestEnable_IMAP4rev2(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "enableuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	server.InsertTestMail(t, database, "enableuser", "Hello", "sender@example.com", "enableuser@localhost", "INBOX")
+	userDB, err := database.GetUserDB(state.Email)
+	if err != nil {
+		t.Fatalf("Failed to get user database: %v", err)
+	}
+	if _, err := userDB.Exec(`UPDATE message_mailbox SET flags = '\Recent \Seen'`); err != nil {
+		t.Fatalf("Failed to set flags: %v", err)
+	}
+
+	srv.HandleEnable(conn, "E010", []string{"E010", "ENABLE", "IMAP4rev2"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "* ENABLED IMAP4rev2\r\n") || !state.IMAP4rev2Enabled {
+		t.Fatalf("Expected IMAP4rev2 to be enabled, got: %s", response)
+	}
+
+	// No RECENT response; the forwarding and junk keywords are listed
+	conn.ClearWriteBuffer()
+	srv.HandleSelect(conn, "E011", []string{"E011", "SELECT", "INBOX"}, state)
+	response := conn.GetWrittenData()
+	if strings.Contains(response, "RECENT") {
+		t.Errorf("Expected no RECENT response, got: %s", response)
+	}
+	if !strings.Contains(response, "* FLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft $Forwarded $Junk $NotJunk)") {
+		t.Errorf("Expected the IMAP4rev2 keywords in FLAGS, got: %s", response)
+	}
+
+	// No \Recent flag
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "E012", []string{"E012", "FETCH", "1", "(FLAGS)"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "* 1 FETCH (FLAGS (\\Seen))") {
+		t.Errorf("Expected FLAGS without \\Recent, got: %s", response)
+	}
+
+	// SEARCH results are ESEARCH responses
+	conn.ClearWriteBuffer()
+	srv.HandleSearch(conn, "E013", []string{"E013", "SEARCH", "ALL"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* ESEARCH (TAG "E013") ALL 1`) {
+		t.Errorf("Expected an ESEARCH response, got: %s", response)
+	}
+
+	// LIST always reports children
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "E014", []string{"E014", "LIST", `""`, "INBOX"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "\\HasNoChildren") {
+		t.Errorf("Expected \\HasNoChildren in LIST, got: %s", response)
+	}
+}
+
+// TestEnable_InvalidStates tests ENABLE before authentication and with a mailbox selected
+func TestEnable_InvalidStates(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+
+	srv.HandleEnable(conn, "E004", []string{"E004", "ENABLE", "UTF8=ACCEPT"}, &models.ClientState{})
+	if response := conn.GetWrittenData(); !strings.Contains(response, "E004 NO Please authenticate first") {
+		t.Errorf("Expected authentication error, got: %s", response)
+	}
+
+	state := server.SetupAuthenticatedState(t, srv, "enableuser")
+	state.SelectedMailboxID = 1
+	conn.ClearWriteBuffer()
+	srv.HandleEnable(conn, "E005", []string{"E005", "ENABLE", "UTF8=ACCEPT"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "E005 BAD") || state.UTF8Enabled {
+		t.Errorf("Expected ENABLE to be refused with a mailbox selected, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleEnable(conn, "E006", []string{"E006", "ENABLE"}, server.SetupAuthenticatedState(t, srv, "other"))
+	if response := conn.GetWrittenData(); !strings.Contains(response, "E006 BAD") {
+		t.Errorf("Expected BAD without capabilities, got: %s", response)
+	}
+}
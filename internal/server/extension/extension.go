@@ -2,7 +2,9 @@ package extension
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"time"
@@ -10,81 +12,29 @@ import (
 	"raven/internal/blobstorage"
 	"raven/internal/db"
 	"raven/internal/models"
+	"raven/internal/server/message"
+	"raven/internal/server/utils"
 )
 
 // ServerDeps defines the dependencies that extension handlers need from the server
 type ServerDeps interface {
 	SendResponse(conn net.Conn, response string)
 	GetUserDB(email string) (*sql.DB, error)
+	GetSelectedDB(state *models.ClientState) (*sql.DB, error)
+	GetSharedDB() *sql.DB
+	GetDBManager() *db.DBManager
+	GetUserRoles(email string) []string
 	GetS3Storage() *blobstorage.S3BlobStorage
+	IsAdmin(email string) bool
 }
 
 // ===== NOOP =====
 
 func HandleNoop(deps ServerDeps, conn net.Conn, tag string, state *models.ClientState) {
 	// NOOP can be used before authentication
-	// If authenticated and a folder is selected, check for mailbox updates
-	// and send untagged responses per RFC 3501
-	if state.Authenticated && state.SelectedMailboxID > 0 {
-		// Get user database
-		userDB, err := deps.GetUserDB(state.Email)
-		if err != nil {
-			deps.SendResponse(conn, fmt.Sprintf("%s OK NOOP completed", tag))
-			return
-		}
-
-		// Get current mailbox state using new schema
-		currentCount, err := db.GetMessageCountPerUser(userDB, state.SelectedMailboxID)
-		if err != nil {
-			// If there's a database error, just complete normally
-			deps.SendResponse(conn, fmt.Sprintf("%s OK NOOP completed", tag))
-			return
-		}
-
-		currentRecent, err := db.GetRecentCountPerUser(userDB, state.SelectedMailboxID)
-		if err != nil {
-			currentRecent = 0
-		}
-
-		// Debug logging
-		fmt.Printf("NOOP Debug: mailbox_id=%d, lastCount=%d, currentCount=%d, lastRecent=%d, currentRecent=%d\n",
-			state.SelectedMailboxID, state.LastMessageCount, currentCount, state.LastRecentCount, currentRecent)
-
-		// Check for new messages (EXISTS response)
-		if currentCount > state.LastMessageCount {
-			deps.SendResponse(conn, fmt.Sprintf("* %d EXISTS", currentCount))
-
-			// Calculate new recent messages
-			newRecent := currentCount - state.LastMessageCount
-			if newRecent > 0 {
-				deps.SendResponse(conn, fmt.Sprintf("* %d RECENT", newRecent))
-			}
-		}
-
-		// Check for expunged (deleted) messages
-		if currentCount < state.LastMessageCount {
-			// Send EXPUNGE for each deleted message
-			// Note: In a real implementation, you'd track which specific messages
-			// were expunged. Here we send generic expunge notifications.
-			for i := state.LastMessageCount; i > currentCount; i-- {
-				deps.SendResponse(conn, fmt.Sprintf("* %d EXPUNGE", i))
-			}
-		}
-
-		// Check for flag changes (simplified - just report recent count changes)
-		if currentRecent != state.LastRecentCount && currentCount == state.LastMessageCount {
-			// Messages exist but recent count changed (flags were modified)
-			// In a full implementation, you'd send FETCH responses with updated flags
-			// For now, we send an informational message
-			if currentRecent > 0 {
-				deps.SendResponse(conn, fmt.Sprintf("* %d RECENT", currentRecent))
-			}
-		}
-
-		// Update state tracking
-		state.LastMessageCount = currentCount
-		state.LastRecentCount = currentRecent
-	}
+	// If authenticated and a folder is selected, report mailbox updates
+	// as untagged responses per RFC 9051 Section 6.1.2
+	message.SendMailboxUpdates(deps, conn, state, message.AllMailboxUpdates, "")
 
 	// Always complete successfully per RFC 3501
 	deps.SendResponse(conn, fmt.Sprintf("%s OK NOOP completed", tag))
@@ -92,79 +42,70 @@ func HandleNoop(deps ServerDeps, conn net.Conn, tag string, state *models.Client
 
 // ===== IDLE =====
 
+// idleDoneInterval is how often an idling session checks for DONE
+const idleDoneInterval = 250 * time.Millisecond
+
 func HandleIdle(deps ServerDeps, conn net.Conn, tag string, state *models.ClientState) {
 	if !state.Authenticated {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
 		return
 	}
 
+	// With NOTIFY (RFC 5465) the session's filters replace the selected
+	// mailbox updates below, and no mailbox needs to be selected
+	if state.Notify != nil {
+		idleWithNotify(deps, conn, tag, state)
+		return
+	}
+
 	if state.SelectedMailboxID == 0 {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO No folder selected", tag))
 		return
 	}
 
-	// Tell client we're entering idle mode
-	deps.SendResponse(conn, "+ idling")
-
-	buf := make([]byte, 4096)
-
-	// Get user database
-	userDB, err := deps.GetUserDB(state.Email)
+	// Get appropriate database (user or role mailbox)
+	targetDB, err := deps.GetSelectedDB(state)
 	if err != nil {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
 		return
 	}
 
-	// Track previous state of the folder using new schema
-	prevCount, _ := db.GetMessageCountPerUser(userDB, state.SelectedMailboxID)
-	prevRecent, _ := db.GetRecentCountPerUser(userDB, state.SelectedMailboxID)
-	prevUnseen, _ := db.GetUnseenCountPerUser(userDB, state.SelectedMailboxID)
+	// Wake up when delivery, APPEND, COPY, MOVE, STORE or EXPUNGE changes the mailbox
+	changes := make(chan struct{}, 1)
+	defer deps.GetDBManager().MailboxChanges().Subscribe(targetDB, state.SelectedMailboxID, changes)()
 
-	for {
-		// Poll every 500ms for changes to ensure responsive notifications
-		time.Sleep(500 * time.Millisecond)
-
-		// Check current mailbox state using new schema
-		count, _ := db.GetMessageCountPerUser(userDB, state.SelectedMailboxID)
-		recent, _ := db.GetRecentCountPerUser(userDB, state.SelectedMailboxID)
-		unseen, _ := db.GetUnseenCountPerUser(userDB, state.SelectedMailboxID)
-
-		// Notify about new messages
-		if count > prevCount {
-			deps.SendResponse(conn, fmt.Sprintf("* %d EXISTS", count))
-			newRecent := count - prevCount
-			if newRecent > 0 {
-				deps.SendResponse(conn, fmt.Sprintf("* %d RECENT", newRecent))
-			}
-		}
-
-		// Notify about expunged (deleted) messages
-		if count < prevCount {
-			for i := prevCount; i > count; i-- {
-				deps.SendResponse(conn, fmt.Sprintf("* %d EXPUNGE", i))
-			}
-		}
+	// Tell client we're entering idle mode
+	deps.SendResponse(conn, "+ idling")
 
-		if recent != prevRecent && count == prevCount && recent > 0 {
-			deps.SendResponse(conn, fmt.Sprintf("* %d RECENT", recent))
-		}
+	report := func() {
+		message.SendMailboxUpdates(deps, conn, state, message.AllMailboxUpdates, "")
+	}
+	report()
+	idleLoop(deps, conn, tag, changes, report)
+}
 
-		// Notify about unseen count change
-		if unseen != prevUnseen {
-			deps.SendResponse(conn, fmt.Sprintf("* OK [UNSEEN %d] Message %d is first unseen", unseen, unseen))
-		}
+// idleLoop runs report whenever a change is signalled, until the client sends
+// DONE or disconnects
+func idleLoop(deps ServerDeps, conn net.Conn, tag string, changes <-chan struct{}, report func()) {
+	doneCheck := time.NewTicker(idleDoneInterval)
+	defer doneCheck.Stop()
 
-		// Update cached values
-		prevCount = count
-		prevRecent = recent
-		prevUnseen = unseen
-
-		// Check if client sent DONE (non-blocking read)
-		_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
-		n, err := conn.Read(buf)
-		if err == nil && strings.TrimSpace(strings.ToUpper(string(buf[:n]))) == "DONE" {
-			deps.SendResponse(conn, fmt.Sprintf("%s OK IDLE terminated", tag))
-			return
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-changes:
+			report()
+		case <-doneCheck.C:
+			// Check if client sent DONE (non-blocking read)
+			_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			n, err := conn.Read(buf)
+			if err == nil && strings.TrimSpace(strings.ToUpper(string(buf[:n]))) == "DONE" {
+				deps.SendResponse(conn, fmt.Sprintf("%s OK IDLE terminated", tag))
+				return
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return
+			}
 		}
 	}
 }
@@ -177,7 +118,9 @@ func HandleNamespace(deps ServerDeps, conn net.Conn, tag string, state *models.C
 		return
 	}
 
-	// Send namespace response - simple single personal namespace
-	deps.SendResponse(conn, `* NAMESPACE (("" "/")) NIL NIL`)
+	// Personal namespace, the "Other Users" namespace for mailboxes shared via
+	// ACL (RFC 4314) and the shared namespace for role mailboxes
+	deps.SendResponse(conn, fmt.Sprintf(`* NAMESPACE (("" "/")) (("%s" "/")) (("%s" "/"))`,
+		utils.OtherUsersNamespace, utils.SharedNamespace))
 	deps.SendResponse(conn, fmt.Sprintf("%s OK NAMESPACE completed", tag))
 }
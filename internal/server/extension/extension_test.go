@@ -269,19 +269,26 @@ func TestNoopCommand_ExpungedMessages(t *testing.T) {
 	// Insert test messages
 	dbMgr := srv.GetDBManager().(*db.DBManager)
 	server.InsertTestMail(t, dbMgr, "testuser", "Test 1", "sender@test.com", "testuser@localhost", "INBOX")
+	server.InsertTestMail(t, dbMgr, "testuser", "Test 2", "sender@test.com", "testuser@localhost", "INBOX")
 
-	// Setup state with higher message count (simulate messages were deleted)
-	state.SelectedFolder = "INBOX"
-	state.SelectedMailboxID = 1
-	state.LastMessageCount = 5 // Client thinks there are 5 messages
-	state.LastRecentCount = 0
+	srv.HandleSelect(conn, "SEL", []string{"SEL", "SELECT", "INBOX"}, state)
+
+	// Another session expunges the first message
+	userDB, err := dbMgr.GetUserDB(state.Email)
+	if err != nil {
+		t.Fatalf("Failed to get user database: %v", err)
+	}
+	if _, err := userDB.Exec(`DELETE FROM message_mailbox WHERE mailbox_id = ? AND uid = 1`, state.SelectedMailboxID); err != nil {
+		t.Fatalf("Failed to expunge: %v", err)
+	}
 
+	conn.ClearWriteBuffer()
 	srv.HandleNoop(conn, "EXP", state)
 
 	response := conn.GetWrittenData()
 
-	// Should report EXPUNGE for deleted messages
-	if !strings.Contains(response, "EXPUNGE") {
+	// Should report EXPUNGE for the deleted message
+	if !strings.Contains(response, "* 1 EXPUNGE") {
 		t.Errorf("Expected EXPUNGE response, got: %s", response)
 	}
 
@@ -294,6 +301,50 @@ func TestNoopCommand_ExpungedMessages(t *testing.T) {
 	if state.LastMessageCount != 1 {
 		t.Errorf("Expected LastMessageCount=1, got %d", state.LastMessageCount)
 	}
+
+	// Nothing is reported twice
+	conn.ClearWriteBuffer()
+	srv.HandleNoop(conn, "EXP2", state)
+	if response := conn.GetWrittenData(); strings.Contains(response, "EXPUNGE") {
+		t.Errorf("Expected no further EXPUNGE, got: %s", response)
+	}
+}
+
+// TestNoopCommand_UnchangedMailbox tests that NOOP only compares the
+// session's map with the mailbox after the mailbox has changed
+func TestNoopCommand_UnchangedMailbox(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	dbMgr := srv.GetDBManager().(*db.DBManager)
+	server.InsertTestMail(t, dbMgr, "testuser", "Test 1", "sender@test.com", "testuser@localhost", "INBOX")
+
+	srv.HandleSelect(conn, "SEL", []string{"SEL", "SELECT", "INBOX"}, state)
+	srv.HandleNoop(conn, "N1", state)
+
+	// A map that disagrees with an unchanged mailbox is not reloaded
+	state.Messages.Flags[1] = `\Draft`
+	conn.ClearWriteBuffer()
+	srv.HandleNoop(conn, "N2", state)
+	if response := conn.GetWrittenData(); strings.Contains(response, "FETCH") {
+		t.Errorf("Expected no updates for an unchanged mailbox, got: %s", response)
+	}
+
+	// Another session changes the flags
+	userDB, err := dbMgr.GetUserDB(state.Email)
+	if err != nil {
+		t.Fatalf("Failed to get user database: %v", err)
+	}
+	if _, err := userDB.Exec(`UPDATE message_mailbox SET flags = '\Seen' WHERE mailbox_id = ? AND uid = 1`, state.SelectedMailboxID); err != nil {
+		t.Fatalf("Failed to update flags: %v", err)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleNoop(conn, "N3", state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* 1 FETCH (UID 1 FLAGS (\Seen))`) {
+		t.Errorf("Expected the flag change, got: %s", response)
+	}
 }
 
 // TestNoopCommand_FlagChanges tests NOOP when only flags change
@@ -573,6 +624,49 @@ func TestIdleCommand_WithNewMessages(t *testing.T) {
 	}
 }
 
+// TestIdleCommand_ChangesFromOtherSession tests that STORE and EXPUNGE in
+// another session are pushed to an idling client without waiting for a resync
+func TestIdleCommand_ChangesFromOtherSession(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	dbMgr := srv.GetDBManager().(*db.DBManager)
+	server.InsertTestMail(t, dbMgr, "testuser", "Initial", "sender@test.com", "testuser@localhost", "INBOX")
+
+	other := server.SetupAuthenticatedState(t, srv, "testuser")
+	srv.HandleSelect(server.NewMockConn(), "S1", []string{"S1", "SELECT", "INBOX"}, other)
+	state.SelectedMailboxID = other.SelectedMailboxID
+	state.SelectedFolder = "INBOX"
+
+	go func() {
+		otherConn := server.NewMockConn()
+		time.Sleep(200 * time.Millisecond)
+		srv.HandleStore(otherConn, "S2", []string{"S2", "STORE", "1", "+FLAGS", `(\Deleted)`}, other)
+		time.Sleep(400 * time.Millisecond)
+		srv.HandleExpunge(otherConn, "S3", other)
+		time.Sleep(400 * time.Millisecond)
+		conn.AddReadData("DONE\r\n")
+	}()
+
+	start := time.Now()
+	srv.HandleIdle(conn, "IDLE3", state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* 1 FETCH (UID 1 FLAGS (\Deleted))`) {
+		t.Errorf("Expected a FLAGS update, got: %s", response)
+	}
+	if !strings.Contains(response, "* 1 EXPUNGE") {
+		t.Errorf("Expected an EXPUNGE update, got: %s", response)
+	}
+	if !strings.Contains(response, "IDLE3 OK IDLE terminated") {
+		t.Errorf("Expected termination, got: %s", response)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected updates without a resync, IDLE took %v", elapsed)
+	}
+}
+
 // TestIdleCommand_MultipleStates tests IDLE with various mailbox states
 func TestIdleCommand_MultipleStates(t *testing.T) {
 	srv := server.SetupTestServerSimple(t)
@@ -651,7 +745,7 @@ func TestNamespaceCommand_Authenticated(t *testing.T) {
 	}
 
 	// Check untagged NAMESPACE response
-	expectedUntagged := `* NAMESPACE (("" "/")) NIL NIL`
+	expectedUntagged := `* NAMESPACE (("" "/")) (("Other Users/" "/")) (("Shared/" "/"))`
 	if lines[0] != expectedUntagged {
 		t.Errorf("Expected '%s', got: '%s'", expectedUntagged, lines[0])
 	}
@@ -701,9 +795,9 @@ func TestNamespaceCommand_RFC2342Compliance(t *testing.T) {
 
 	// RFC 2342 requires specific format: * NAMESPACE personal shared other
 	// Personal namespace: (("" "/"))
-	// Shared namespace: NIL
-	// Other users' namespace: NIL
-	if !strings.Contains(response, `* NAMESPACE (("" "/")) NIL NIL`) {
+	// Other users' namespace: (("Other Users/" "/"))
+	// Shared namespace: (("Shared/" "/"))
+	if !strings.Contains(response, `* NAMESPACE (("" "/")) (("Other Users/" "/")) (("Shared/" "/"))`) {
 		t.Errorf("NAMESPACE response not RFC 2342 compliant: %s", response)
 	}
 }
@@ -803,7 +897,7 @@ func TestNamespaceCommand_DifferentUsers(t *testing.T) {
 			response := conn.GetWrittenData()
 
 			// All users should get the same namespace structure
-			if !strings.Contains(response, `* NAMESPACE (("" "/")) NIL NIL`) {
+			if !strings.Contains(response, `* NAMESPACE (("" "/")) (("Other Users/" "/")) (("Shared/" "/"))`) {
 				t.Errorf("User %s should get standard namespace: %s", username, response)
 			}
 
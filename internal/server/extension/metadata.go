@@ -0,0 +1,413 @@
+package extension
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"raven/internal/db"
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== METADATA (RFC 5464) =====
+//
+// Annotations are attached to a mailbox or, with the mailbox name "", to the
+// server (METADATA-SERVER). Entries under /private/ are visible only to the
+// user who set them; entries under /shared/ are visible to everyone who can
+// read the mailbox. Shared server entries are kept in the shared database and
+// can only be changed by administrators.
+
+// metadataValue is an entry name and its value in SETMETADATA; a nil value
+// removes the entry
+type metadataValue struct {
+	name  string
+	value []byte
+}
+
+// HandleGetMetadata implements the GETMETADATA command
+// Syntax: GETMETADATA [(options)] mailbox (entry ...) | entry
+func HandleGetMetadata(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	args := parts[2:]
+	maxSize, depth := int64(-1), 0
+	if len(args) > 0 && strings.HasPrefix(args[0], "(") {
+		content, rest, err := utils.ParseParenthesizedList(args)
+		if err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid GETMETADATA options", tag))
+			return
+		}
+		maxSize, depth, err = parseMetadataOptions(strings.Fields(content))
+		if err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD %s", tag, err.Error()))
+			return
+		}
+		args = rest
+	}
+
+	if len(args) < 2 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD GETMETADATA requires mailbox and entries", tag))
+		return
+	}
+
+	mailboxName, err := utils.ParseMailboxName(args[0], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
+	names := []string{args[1]}
+	if strings.HasPrefix(args[1], "(") {
+		content, rest, err := utils.ParseParenthesizedList(args[1:])
+		if err != nil || len(rest) > 0 {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid entry list", tag))
+			return
+		}
+		names = strings.Fields(content)
+	} else if len(args) > 2 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Unexpected arguments after entry", tag))
+		return
+	}
+
+	for i, name := range names {
+		// The /private and /shared roots may be retrieved with DEPTH
+		names[i] = strings.ToLower(utils.ParseQuotedString(name))
+		if !validMetadataEntry(names[i]) && names[i] != "/private" && names[i] != "/shared" {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid entry name %s", tag, name))
+			return
+		}
+	}
+
+	entries, ok := lookupMetadata(deps, conn, tag, mailboxName, names, depth, state)
+	if !ok {
+		return
+	}
+
+	// Values larger than MAXSIZE are left out and reported with LONGENTRIES
+	var longest int64
+	var items []string
+	for _, entry := range entries {
+		if maxSize >= 0 && int64(len(entry.Value)) > maxSize {
+			longest = max(longest, int64(len(entry.Value)))
+			continue
+		}
+		items = append(items, entry.Name+" "+formatMetadataValue(entry.Value))
+	}
+
+	if len(items) > 0 {
+		deps.SendResponse(conn, fmt.Sprintf("* METADATA \"%s\" (%s)", utils.ClientMailboxName(mailboxName, state), strings.Join(items, " ")))
+	}
+	if longest > 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s OK [METADATA LONGENTRIES %d] GETMETADATA completed", tag, longest))
+		return
+	}
+	deps.SendResponse(conn, fmt.Sprintf("%s OK GETMETADATA completed", tag))
+}
+
+// HandleSetMetadata implements the SETMETADATA command
+// Syntax: SETMETADATA mailbox (entry value ...)
+func HandleSetMetadata(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 4 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD SETMETADATA requires mailbox and entry values", tag))
+		return
+	}
+
+	mailboxName, err := utils.ParseMailboxName(parts[2], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
+	content, rest, err := utils.ParseParenthesizedList(parts[3:])
+	if err != nil || len(rest) > 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid entry value list", tag))
+		return
+	}
+
+	values, responseText := parseMetadataValues(content)
+	if responseText != "" {
+		deps.SendResponse(conn, fmt.Sprintf("%s %s", tag, responseText))
+		return
+	}
+
+	if mailboxName == "" {
+		setServerMetadata(deps, conn, tag, values, state)
+		return
+	}
+
+	access, err := utils.ResolveMailboxAccess(deps, state.Email, mailboxName)
+	if errors.Is(err, utils.ErrNoSuchMailbox) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NONEXISTENT] Mailbox does not exist", tag))
+		return
+	}
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	// Private entries need the lookup right, shared entries the write right
+	for _, v := range values {
+		required := "l"
+		if strings.HasPrefix(v.name, "/shared/") {
+			required = "lw"
+		}
+		if !utils.HasRights(access.Rights, required) {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+			return
+		}
+	}
+
+	for _, v := range values {
+		if !storeMetadata(deps, conn, tag, db.SetMetadataPerUser(access.DB, access.MailboxID, state.Email, v.name, v.value)) {
+			return
+		}
+	}
+
+	deps.SendResponse(conn, fmt.Sprintf("%s OK SETMETADATA completed", tag))
+}
+
+// setServerMetadata stores server entries: private ones in the user's
+// database and shared ones, for administrators only, in the shared database
+func setServerMetadata(deps ServerDeps, conn net.Conn, tag string, values []metadataValue, state *models.ClientState) {
+	for _, v := range values {
+		if strings.HasPrefix(v.name, "/shared/") && !deps.IsAdmin(state.Email) {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+			return
+		}
+	}
+
+	userDB, err := deps.GetUserDB(state.Email)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+	sharedDB := deps.GetSharedDB()
+
+	for _, v := range values {
+		if strings.HasPrefix(v.name, "/shared/") {
+			err = db.SetServerMetadata(sharedDB, v.name, v.value)
+		} else {
+			err = db.SetMetadataPerUser(userDB, db.MetadataServerMailboxID, state.Email, v.name, v.value)
+		}
+		if !storeMetadata(deps, conn, tag, err) {
+			return
+		}
+	}
+
+	deps.SendResponse(conn, fmt.Sprintf("%s OK SETMETADATA completed", tag))
+}
+
+// storeMetadata sends the error response for a failed write and reports
+// whether the write succeeded
+func storeMetadata(deps ServerDeps, conn net.Conn, tag string, err error) bool {
+	if errors.Is(err, db.ErrMetadataTooMany) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [METADATA TOOMANY] Too many metadata entries", tag))
+		return false
+	}
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO SETMETADATA failed: %v", tag, err))
+		return false
+	}
+	return true
+}
+
+// lookupMetadata returns the entries of a mailbox or, for "", of the server
+// that the user may read. It sends the error response on failure.
+func lookupMetadata(deps ServerDeps, conn net.Conn, tag string, mailboxName string, names []string, depth int, state *models.ClientState) ([]db.MetadataEntry, bool) {
+	if mailboxName == "" {
+		userDB, err := deps.GetUserDB(state.Email)
+		if err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+			return nil, false
+		}
+		entries, err := db.GetMetadataPerUser(userDB, db.MetadataServerMailboxID, state.Email, names, depth)
+		if err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+			return nil, false
+		}
+		if sharedDB := deps.GetSharedDB(); sharedDB != nil {
+			serverEntries, err := db.GetServerMetadata(sharedDB, names, depth)
+			if err != nil {
+				deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+				return nil, false
+			}
+			entries = append(entries, serverEntries...)
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		}
+		return entries, true
+	}
+
+	access, err := utils.ResolveMailboxAccess(deps, state.Email, mailboxName)
+	if errors.Is(err, utils.ErrNoSuchMailbox) || (err == nil && !utils.HasRights(access.Rights, "l")) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NONEXISTENT] Mailbox does not exist", tag))
+		return nil, false
+	}
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return nil, false
+	}
+
+	entries, err := db.GetMetadataPerUser(access.DB, access.MailboxID, state.Email, names, depth)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return nil, false
+	}
+
+	// Shared entries are only visible with the read right
+	if !utils.HasRights(access.Rights, "r") {
+		visible := entries[:0]
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name, "/private/") {
+				visible = append(visible, entry)
+			}
+		}
+		entries = visible
+	}
+
+	return entries, true
+}
+
+// parseMetadataOptions parses the MAXSIZE and DEPTH options of GETMETADATA.
+// A maxSize of -1 means no limit and a depth of -1 means "infinity".
+func parseMetadataOptions(options []string) (maxSize int64, depth int, err error) {
+	maxSize = -1
+	for i := 0; i < len(options); i += 2 {
+		if i+1 >= len(options) {
+			return 0, 0, fmt.Errorf("missing value for option %s", options[i])
+		}
+		value := options[i+1]
+		switch strings.ToUpper(options[i]) {
+		case "MAXSIZE":
+			maxSize, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || maxSize < 0 {
+				return 0, 0, fmt.Errorf("invalid MAXSIZE %s", value)
+			}
+		case "DEPTH":
+			switch strings.ToLower(value) {
+			case "0":
+				depth = 0
+			case "1":
+				depth = 1
+			case "infinity":
+				depth = -1
+			default:
+				return 0, 0, fmt.Errorf("invalid DEPTH %s", value)
+			}
+		default:
+			return 0, 0, fmt.Errorf("unknown option %s", options[i])
+		}
+	}
+	return maxSize, depth, nil
+}
+
+// parseMetadataValues parses the "entry value" pairs of SETMETADATA. Values
+// are quoted strings or NIL to remove the entry. On failure it returns the
+// tagged response text.
+func parseMetadataValues(content string) ([]metadataValue, string) {
+	tokens, err := splitMetadataTokens(content)
+	if err != nil {
+		return nil, "BAD " + err.Error()
+	}
+	if len(tokens) == 0 || len(tokens)%2 != 0 {
+		return nil, "BAD Entry values must be given in pairs"
+	}
+
+	var values []metadataValue
+	for i := 0; i < len(tokens); i += 2 {
+		name := strings.ToLower(tokens[i].text)
+		if !validMetadataEntry(name) {
+			return nil, fmt.Sprintf("BAD Invalid entry name %s", tokens[i].text)
+		}
+
+		v := metadataValue{name: name}
+		if tokens[i+1].quoted || !strings.EqualFold(tokens[i+1].text, "NIL") {
+			v.value = []byte(tokens[i+1].text)
+		}
+		if len(v.value) > db.MaxMetadataValueSize {
+			return nil, fmt.Sprintf("NO [METADATA MAXSIZE %d] Value too large", db.MaxMetadataValueSize)
+		}
+		values = append(values, v)
+	}
+	return values, ""
+}
+
+// metadataToken is an atom or a quoted string of a SETMETADATA list
+type metadataToken struct {
+	text   string
+	quoted bool
+}
+
+// splitMetadataTokens splits the content of a SETMETADATA list into atoms and
+// unescaped quoted strings
+func splitMetadataTokens(content string) ([]metadataToken, error) {
+	var tokens []metadataToken
+	for i := 0; i < len(content); {
+		switch content[i] {
+		case ' ':
+			i++
+		case '"':
+			var b strings.Builder
+			i++
+			for ; i < len(content) && content[i] != '"'; i++ {
+				if content[i] == '\\' && i+1 < len(content) {
+					i++
+				}
+				b.WriteByte(content[i])
+			}
+			if i >= len(content) {
+				return nil, fmt.Errorf("unterminated quoted string")
+			}
+			i++
+			tokens = append(tokens, metadataToken{text: b.String(), quoted: true})
+		case '{':
+			return nil, fmt.Errorf("literal values are not supported")
+		default:
+			end := strings.IndexByte(content[i:], ' ')
+			if end < 0 {
+				end = len(content) - i
+			}
+			tokens = append(tokens, metadataToken{text: content[i : i+end]})
+			i += end
+		}
+	}
+	return tokens, nil
+}
+
+// validMetadataEntry reports whether name is a valid entry under /private or
+// /shared: no wildcards, empty components or trailing slash
+func validMetadataEntry(name string) bool {
+	if !strings.HasPrefix(name, "/private/") && !strings.HasPrefix(name, "/shared/") {
+		return false
+	}
+	if strings.ContainsAny(name, "*%") || strings.Contains(name, "//") || strings.HasSuffix(name, "/") {
+		return false
+	}
+	for _, ch := range name {
+		if ch < 0x21 || ch > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// formatMetadataValue returns a value as a quoted string or, if it cannot be
+// quoted, as a literal
+func formatMetadataValue(value []byte) string {
+	for _, ch := range value {
+		if ch == 0 || ch == '\r' || ch == '\n' || ch > 0x7e {
+			return fmt.Sprintf("{%d}\r\n%s", len(value), value)
+		}
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(string(value))
+	return `"` + escaped + `"`
+}
@@ -0,0 +1,177 @@
+package extension_test
+
+import (
+	"strings"
+	"testing"
+
+	"raven/internal/server"
+)
+
+// ===== METADATA TESTS =====
+
+// TestMetadata_SetAndGetMailboxEntries tests storing and retrieving private and shared mailbox entries
+func TestMetadata_SetAndGetMailboxEntries(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "metauser")
+
+	srv.HandleSetMetadata(conn, "MD01", []string{"MD01", "SETMETADATA", "INBOX", "(/private/comment", `"My`, `comment"`, "/shared/Color", `"red")`}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MD01 OK SETMETADATA completed") {
+		t.Fatalf("Expected SETMETADATA to succeed, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD02", []string{"MD02", "GETMETADATA", "INBOX", "(/private/comment", "/shared/color)"}, state)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* METADATA "INBOX" (/private/comment "My comment" /shared/color "red")`) {
+		t.Errorf("Expected both entries, got: %s", response)
+	}
+	if !strings.Contains(response, "MD02 OK GETMETADATA completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+}
+
+// TestMetadata_NilRemovesEntry tests that setting NIL removes an entry
+func TestMetadata_NilRemovesEntry(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "metauser")
+
+	srv.HandleSetMetadata(conn, "MD03", []string{"MD03", "SETMETADATA", "INBOX", "(/private/comment", `"temp")`}, state)
+	srv.HandleSetMetadata(conn, "MD04", []string{"MD04", "SETMETADATA", "INBOX", "(/private/comment", "NIL)"}, state)
+
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD05", []string{"MD05", "GETMETADATA", "INBOX", "/private/comment"}, state)
+	response := conn.GetWrittenData()
+	if strings.Contains(response, "* METADATA") || !strings.Contains(response, "MD05 OK") {
+		t.Errorf("Expected no entries after removal, got: %s", response)
+	}
+}
+
+// TestMetadata_MaxSizeAndDepth tests the MAXSIZE and DEPTH options of GETMETADATA
+func TestMetadata_MaxSizeAndDepth(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "metauser")
+
+	srv.HandleSetMetadata(conn, "MD06", []string{"MD06", "SETMETADATA", "INBOX",
+		"(/private/vendor/a", `"short"`, "/private/vendor/b", `"a-much-longer-value"`, "/private/vendor/b/c", `"deep")`}, state)
+
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD07", []string{"MD07", "GETMETADATA", "(MAXSIZE", "10", "DEPTH", "1)", "INBOX", "/private/vendor"}, state)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* METADATA "INBOX" (/private/vendor/a "short")`) {
+		t.Errorf("Expected only the short direct child, got: %s", response)
+	}
+	if !strings.Contains(response, "MD07 OK [METADATA LONGENTRIES 19]") {
+		t.Errorf("Expected LONGENTRIES response code, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD08", []string{"MD08", "GETMETADATA", "(DEPTH", "infinity)", "INBOX", "/private/vendor"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `/private/vendor/b/c "deep"`) {
+		t.Errorf("Expected entries at any depth, got: %s", response)
+	}
+}
+
+// TestMetadata_InvalidRequests tests entry name validation and limits
+func TestMetadata_InvalidRequests(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "metauser")
+
+	srv.HandleSetMetadata(conn, "MD09", []string{"MD09", "SETMETADATA", "INBOX", "(/other/comment", `"x")`}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MD09 BAD") {
+		t.Errorf("Expected BAD for an entry outside /private and /shared, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD10", []string{"MD10", "GETMETADATA", "INBOX", "/shared/*"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MD10 BAD") {
+		t.Errorf("Expected BAD for a wildcard entry, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	large := `"` + strings.Repeat("x", 70*1024) + `")`
+	srv.HandleSetMetadata(conn, "MD11", []string{"MD11", "SETMETADATA", "INBOX", "(/private/comment", large}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MD11 NO [METADATA MAXSIZE 65536]") {
+		t.Errorf("Expected MAXSIZE response code, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD12", []string{"MD12", "GETMETADATA", "Missing", "/private/comment"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MD12 NO [NONEXISTENT]") {
+		t.Errorf("Expected NONEXISTENT for an unknown mailbox, got: %s", response)
+	}
+}
+
+// TestMetadata_ServerEntries tests METADATA-SERVER entries
+func TestMetadata_ServerEntries(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	admin := server.SetupAuthenticatedState(t, srv, "postmaster")
+	user := server.SetupAuthenticatedState(t, srv, "metauser")
+	srv.SetAdmins([]string{"postmaster@localhost"})
+
+	srv.HandleSetMetadata(conn, "MD13", []string{"MD13", "SETMETADATA", `""`, "(/shared/admin", `"mailto:postmaster@localhost")`}, user)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MD13 NO [NOPERM]") {
+		t.Errorf("Expected non-admins to be refused shared server entries, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleSetMetadata(conn, "MD14", []string{"MD14", "SETMETADATA", `""`, "(/shared/admin", `"mailto:postmaster@localhost")`}, admin)
+	srv.HandleSetMetadata(conn, "MD15", []string{"MD15", "SETMETADATA", `""`, "(/private/theme", `"dark")`}, user)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MD14 OK") || !strings.Contains(response, "MD15 OK") {
+		t.Fatalf("Expected server entries to be stored, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD16", []string{"MD16", "GETMETADATA", `""`, "(/shared/admin", "/private/theme)"}, user)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* METADATA "" (/private/theme "dark" /shared/admin "mailto:postmaster@localhost")`) {
+		t.Errorf("Expected shared and private server entries, got: %s", response)
+	}
+
+	// Private server entries are not visible to other users
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD17", []string{"MD17", "GETMETADATA", `""`, "/private/theme"}, admin)
+	if response := conn.GetWrittenData(); strings.Contains(response, "dark") {
+		t.Errorf("Expected private server entries to stay private, got: %s", response)
+	}
+}
+
+// TestMetadata_DelegatedMailbox tests rights checks on a mailbox shared via ACL
+func TestMetadata_DelegatedMailbox(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	owner := server.SetupAuthenticatedState(t, srv, "boss")
+	delegate := server.SetupAuthenticatedState(t, srv, "assistant")
+
+	srv.HandleSetMetadata(conn, "MD18", []string{"MD18", "SETMETADATA", "INBOX", "(/shared/comment", `"Boss")`}, owner)
+	srv.HandleSetACL(conn, "MD19", []string{"MD19", "SETACL", "INBOX", "assistant@localhost", "lr"}, owner)
+
+	name := "Other Users/boss@localhost/INBOX"
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD20", []string{"MD20", "GETMETADATA", name, "/shared/comment"}, delegate)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `/shared/comment "Boss"`) {
+		t.Errorf("Expected the delegate to read shared entries, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleSetMetadata(conn, "MD21", []string{"MD21", "SETMETADATA", name, "(/shared/comment", `"Mine")`}, delegate)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MD21 NO [NOPERM]") {
+		t.Errorf("Expected shared writes without the w right to be refused, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleSetMetadata(conn, "MD22", []string{"MD22", "SETMETADATA", name, "(/private/comment", `"Mine")`}, delegate)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MD22 OK") {
+		t.Errorf("Expected private writes with the l right to succeed, got: %s", response)
+	}
+
+	// The owner does not see the delegate's private entry
+	conn.ClearWriteBuffer()
+	srv.HandleGetMetadata(conn, "MD23", []string{"MD23", "GETMETADATA", "INBOX", "/private/comment"}, owner)
+	if response := conn.GetWrittenData(); strings.Contains(response, "Mine") {
+		t.Errorf("Expected the delegate's private entry to stay private, got: %s", response)
+	}
+}
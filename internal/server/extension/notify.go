@@ -0,0 +1,410 @@
+package extension
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"raven/internal/db"
+	"raven/internal/models"
+	"raven/internal/server/message"
+	"raven/internal/server/utils"
+)
+
+// ===== NOTIFY (RFC 5465) =====
+
+// notifyEvents lists the supported events, as reported in BADEVENT
+var notifyEvents = []string{"MessageNew", "MessageExpunge", "FlagChange", "MailboxName", "SubscriptionChange"}
+
+// HandleNotify implements the NOTIFY command. Notifications cover the
+// selected mailbox and the user's personal mailboxes; they are delivered
+// between commands and while the client is in IDLE.
+// Syntax: NOTIFY NONE | NOTIFY SET [STATUS] (filter events) ...
+func HandleNotify(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 3 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD NOTIFY requires NONE or SET", tag))
+		return
+	}
+
+	switch strings.ToUpper(parts[2]) {
+	case "NONE":
+		if len(parts) != 3 {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD NOTIFY NONE takes no arguments", tag))
+			return
+		}
+		state.Notify = nil
+		deps.SendResponse(conn, fmt.Sprintf("%s OK NOTIFY completed", tag))
+		return
+	case "SET":
+	default:
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD NOTIFY requires NONE or SET", tag))
+		return
+	}
+
+	nodes, err := utils.ParseArguments(strings.Join(parts[3:], " "))
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid NOTIFY arguments", tag))
+		return
+	}
+
+	sendStatus := false
+	if len(nodes) > 0 && nodes[0].Kind != utils.ArgList && strings.EqualFold(nodes[0].Value, "STATUS") {
+		sendStatus = true
+		nodes = nodes[1:]
+	}
+	if len(nodes) == 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD NOTIFY SET requires at least one event group", tag))
+		return
+	}
+
+	filters := make([]models.NotifyFilter, 0, len(nodes))
+	for _, node := range nodes {
+		filter, responseText := parseNotifyFilter(node, state)
+		if responseText != "" {
+			deps.SendResponse(conn, fmt.Sprintf("%s %s", tag, responseText))
+			return
+		}
+		filters = append(filters, filter)
+	}
+
+	state.Notify = &models.NotifySettings{Filters: filters}
+	ResetNotifications(deps, state)
+
+	// STATUS: report the current state of every watched mailbox once
+	if sendStatus {
+		for _, name := range sortedMailboxNames(state.Notify.Mailboxes) {
+			status := state.Notify.Mailboxes[name]
+			events := mailboxNotifyEvents(state.Notify, name, state.Notify.Subscriptions)
+			if isSelectedNotifyMailbox(state, status) || !(events["MESSAGENEW"] || events["FLAGCHANGE"]) {
+				continue
+			}
+			deps.SendResponse(conn, notifyStatusResponse(name, status, state))
+		}
+	}
+
+	deps.SendResponse(conn, fmt.Sprintf("%s OK NOTIFY completed", tag))
+}
+
+// NotificationsAllowed reports whether notifications may be sent around the
+// command in parts. EXPUNGE responses must not be sent during FETCH, STORE or
+// SEARCH (RFC 3501 Section 7.4.1), since they would shift the sequence
+// numbers those commands use.
+func NotificationsAllowed(parts []string) bool {
+	if len(parts) < 2 {
+		return false
+	}
+	switch strings.ToUpper(parts[1]) {
+	case "FETCH", "STORE", "SEARCH":
+		return false
+	}
+	return true
+}
+
+// DeliverNotifications sends untagged STATUS, LIST, EXPUNGE and FETCH
+// responses for changes since the last delivery that match the session's
+// NOTIFY filters
+func DeliverNotifications(deps ServerDeps, conn net.Conn, state *models.ClientState) {
+	settings := state.Notify
+	if settings == nil || !state.Authenticated {
+		return
+	}
+
+	if mailboxes, subscriptions, err := personalNotifyState(deps, state); err == nil {
+		notifyMailboxChanges(deps, conn, state, mailboxes, subscriptions)
+		settings.Mailboxes, settings.Subscriptions = mailboxes, subscriptions
+	}
+
+	notifySelectedChanges(deps, conn, state)
+}
+
+// ResetNotifications records the current state of the personal mailboxes
+// without reporting it, so changes made by the session's own commands are not
+// echoed back. The selected mailbox needs no reset: the session's message map
+// already reflects its own changes.
+func ResetNotifications(deps ServerDeps, state *models.ClientState) {
+	settings := state.Notify
+	if settings == nil {
+		return
+	}
+
+	if mailboxes, subscriptions, err := personalNotifyState(deps, state); err == nil {
+		settings.Mailboxes, settings.Subscriptions = mailboxes, subscriptions
+	}
+}
+
+// idleWithNotify runs IDLE for a session with NOTIFY filters, delivering
+// notifications until the client sends DONE
+func idleWithNotify(deps ServerDeps, conn net.Conn, tag string, state *models.ClientState) {
+	// Personal filters watch every mailbox of the user; the selected mailbox
+	// may live in a role mailbox database
+	changes := make(chan struct{}, 1)
+	changeBus := deps.GetDBManager().MailboxChanges()
+	if userDB, err := deps.GetUserDB(state.Email); err == nil {
+		defer changeBus.Subscribe(userDB, db.AllMailboxes, changes)()
+	}
+	if state.SelectedMailboxID != 0 {
+		if targetDB, err := deps.GetSelectedDB(state); err == nil {
+			defer changeBus.Subscribe(targetDB, state.SelectedMailboxID, changes)()
+		}
+	}
+
+	deps.SendResponse(conn, "+ idling")
+
+	idleLoop(deps, conn, tag, changes, func() {
+		DeliverNotifications(deps, conn, state)
+	})
+}
+
+// notifyMailboxChanges reports created, deleted and renamed mailboxes,
+// subscription changes and message changes in non-selected mailboxes
+func notifyMailboxChanges(deps ServerDeps, conn net.Conn, state *models.ClientState, mailboxes map[string]models.NotifyMailboxStatus, subscriptions map[string]bool) {
+	settings := state.Notify
+
+	// MailboxName: a renamed mailbox is reported as deleted under its old name
+	for _, name := range sortedMailboxNames(settings.Mailboxes) {
+		if _, ok := mailboxes[name]; !ok && mailboxNotifyEvents(settings, name, settings.Subscriptions)["MAILBOXNAME"] {
+			deps.SendResponse(conn, fmt.Sprintf("* LIST (\\NonExistent) \"/\" \"%s\"", utils.ClientMailboxName(name, state)))
+		}
+	}
+	for _, name := range sortedMailboxNames(mailboxes) {
+		if _, ok := settings.Mailboxes[name]; !ok && mailboxNotifyEvents(settings, name, subscriptions)["MAILBOXNAME"] {
+			deps.SendResponse(conn, fmt.Sprintf("* LIST () \"/\" \"%s\"", utils.ClientMailboxName(name, state)))
+		}
+	}
+
+	// SubscriptionChange
+	for _, name := range sortedNames(subscriptions) {
+		if !settings.Subscriptions[name] && mailboxNotifyEvents(settings, name, subscriptions)["SUBSCRIPTIONCHANGE"] {
+			deps.SendResponse(conn, fmt.Sprintf("* LIST (\\Subscribed) \"/\" \"%s\"", utils.ClientMailboxName(name, state)))
+		}
+	}
+	for _, name := range sortedNames(settings.Subscriptions) {
+		if !subscriptions[name] && mailboxNotifyEvents(settings, name, settings.Subscriptions)["SUBSCRIPTIONCHANGE"] {
+			deps.SendResponse(conn, fmt.Sprintf("* LIST () \"/\" \"%s\"", utils.ClientMailboxName(name, state)))
+		}
+	}
+
+	// MessageNew, MessageExpunge and FlagChange outside the selected mailbox
+	for _, name := range sortedMailboxNames(mailboxes) {
+		status := mailboxes[name]
+		prev, ok := settings.Mailboxes[name]
+		if !ok || prev == status || isSelectedNotifyMailbox(state, status) {
+			continue
+		}
+		events := mailboxNotifyEvents(settings, name, subscriptions)
+		messagesChanged := status.Messages != prev.Messages || status.UIDNext != prev.UIDNext
+		if (events["MESSAGENEW"] && messagesChanged) || (events["FLAGCHANGE"] && status.Unseen != prev.Unseen) {
+			deps.SendResponse(conn, notifyStatusResponse(name, status, state))
+		}
+	}
+}
+
+// notifySelectedChanges reports expunged, changed and new messages in the
+// selected mailbox when a selected filter is set
+func notifySelectedChanges(deps ServerDeps, conn net.Conn, state *models.ClientState) {
+	settings := state.Notify
+
+	var filter *models.NotifyFilter
+	for i := range settings.Filters {
+		if settings.Filters[i].Kind == "SELECTED" || settings.Filters[i].Kind == "SELECTED-DELAYED" {
+			filter = &settings.Filters[i]
+			break
+		}
+	}
+	if filter == nil || state.SelectedMailboxID == 0 {
+		return
+	}
+
+	message.SendMailboxUpdates(deps, conn, state, filter.Events, filter.FetchAtts)
+}
+
+// personalNotifyState reads the counters of the user's mailboxes and their subscriptions
+func personalNotifyState(deps ServerDeps, state *models.ClientState) (map[string]models.NotifyMailboxStatus, map[string]bool, error) {
+	userDB, err := deps.GetUserDB(state.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names, err := db.GetUserMailboxesPerUser(userDB)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mailboxes := make(map[string]models.NotifyMailboxStatus, len(names))
+	for _, name := range names {
+		mailboxID, err := db.GetMailboxByNamePerUser(userDB, name)
+		if err != nil {
+			continue
+		}
+		status := models.NotifyMailboxStatus{MailboxID: mailboxID}
+		status.Messages, _ = db.GetMessageCountPerUser(userDB, mailboxID)
+		status.Unseen, _ = db.GetUnseenCountPerUser(userDB, mailboxID)
+		_, status.UIDNext, _ = db.GetMailboxInfoPerUser(userDB, mailboxID)
+		mailboxes[name] = status
+	}
+
+	subscribed, err := db.GetUserSubscriptionsPerUser(userDB)
+	if err != nil {
+		return nil, nil, err
+	}
+	subscriptions := make(map[string]bool, len(subscribed))
+	for _, name := range subscribed {
+		subscriptions[name] = true
+	}
+
+	return mailboxes, subscriptions, nil
+}
+
+// mailboxNotifyEvents returns the events of the first non-selected filter
+// matching a personal mailbox, or nil when no filter matches
+func mailboxNotifyEvents(settings *models.NotifySettings, name string, subscriptions map[string]bool) map[string]bool {
+	for _, filter := range settings.Filters {
+		matched := false
+		switch filter.Kind {
+		case "PERSONAL":
+			matched = true
+		case "INBOXES":
+			matched = strings.EqualFold(name, "INBOX")
+		case "SUBSCRIBED":
+			matched = subscriptions[name]
+		case "SUBTREE":
+			for _, root := range filter.Mailboxes {
+				if name == root || strings.HasPrefix(name, root+"/") {
+					matched = true
+				}
+			}
+		case "MAILBOXES":
+			matched = utils.Contains(filter.Mailboxes, name)
+		}
+		if matched {
+			return filter.Events
+		}
+	}
+	return nil
+}
+
+// isSelectedNotifyMailbox reports whether a personal mailbox is the selected one
+func isSelectedNotifyMailbox(state *models.ClientState, status models.NotifyMailboxStatus) bool {
+	return state.SelectedMailboxID > 0 && state.SelectedOwner == "" && status.MailboxID == state.SelectedMailboxID
+}
+
+func notifyStatusResponse(name string, status models.NotifyMailboxStatus, state *models.ClientState) string {
+	return fmt.Sprintf("* STATUS \"%s\" (MESSAGES %d UIDNEXT %d UNSEEN %d)",
+		utils.ClientMailboxName(name, state), status.Messages, status.UIDNext, status.Unseen)
+}
+
+func sortedMailboxNames(mailboxes map[string]models.NotifyMailboxStatus) []string {
+	names := make([]string, 0, len(mailboxes))
+	for name := range mailboxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseNotifyFilter parses one "(filter events)" group. On error it returns
+// the tagged response text.
+func parseNotifyFilter(node utils.Arg, state *models.ClientState) (models.NotifyFilter, string) {
+	var filter models.NotifyFilter
+	if node.Kind != utils.ArgList || len(node.List) < 2 || node.List[0].Kind == utils.ArgList {
+		return filter, "BAD Invalid NOTIFY event group"
+	}
+
+	filter.Kind = strings.ToUpper(node.List[0].Value)
+	rest := node.List[1:]
+	switch filter.Kind {
+	case "SELECTED", "SELECTED-DELAYED", "PERSONAL", "INBOXES", "SUBSCRIBED":
+	case "SUBTREE", "MAILBOXES":
+		if len(rest) < 2 {
+			return filter, fmt.Sprintf("BAD %s requires one or more mailboxes", filter.Kind)
+		}
+		names := []utils.Arg{rest[0]}
+		if rest[0].Kind == utils.ArgList {
+			names = rest[0].List
+		}
+		if len(names) == 0 {
+			return filter, fmt.Sprintf("BAD %s requires one or more mailboxes", filter.Kind)
+		}
+		for _, n := range names {
+			if n.Kind == utils.ArgList {
+				return filter, "BAD Invalid mailbox name"
+			}
+			name, err := utils.ParseMailboxName(n.Raw, state)
+			if err != nil {
+				return filter, "BAD Invalid mailbox name"
+			}
+			filter.Mailboxes = append(filter.Mailboxes, name)
+		}
+		rest = rest[1:]
+	default:
+		return filter, "BAD Unknown NOTIFY filter"
+	}
+
+	if len(rest) != 1 {
+		return filter, "BAD Invalid NOTIFY event group"
+	}
+
+	filter.Events = make(map[string]bool)
+	events := rest[0]
+	if events.Kind != utils.ArgList {
+		if strings.EqualFold(events.Value, "NONE") {
+			return filter, ""
+		}
+		return filter, "BAD Invalid NOTIFY events"
+	}
+	if len(events.List) == 0 {
+		return filter, "BAD Invalid NOTIFY events"
+	}
+
+	for i := 0; i < len(events.List); i++ {
+		event := events.List[i]
+		if event.Kind == utils.ArgList || !isNotifyEvent(event.Value) {
+			return filter, fmt.Sprintf("NO [BADEVENT] (%s) Unsupported event", strings.Join(notifyEvents, " "))
+		}
+		name := strings.ToUpper(event.Value)
+		filter.Events[name] = true
+
+		// MessageNew may be followed by the FETCH items to send for new messages
+		if name == "MESSAGENEW" && i+1 < len(events.List) && events.List[i+1].Kind == utils.ArgList {
+			i++
+			filter.FetchAtts = strings.TrimSuffix(strings.TrimPrefix(events.List[i].Raw, "("), ")")
+		}
+	}
+
+	if filter.FetchAtts != "" && filter.Kind != "SELECTED" && filter.Kind != "SELECTED-DELAYED" {
+		return filter, "BAD FETCH attributes are only allowed for the selected mailbox"
+	}
+	if filter.Events["MESSAGENEW"] != filter.Events["MESSAGEEXPUNGE"] {
+		return filter, "BAD MessageNew and MessageExpunge must be requested together"
+	}
+	if filter.Events["FLAGCHANGE"] && !filter.Events["MESSAGENEW"] {
+		return filter, "BAD FlagChange requires MessageNew and MessageExpunge"
+	}
+
+	return filter, ""
+}
+
+// isNotifyEvent reports whether name is a supported event, ignoring case
+func isNotifyEvent(name string) bool {
+	for _, event := range notifyEvents {
+		if strings.EqualFold(event, name) {
+			return true
+		}
+	}
+	return false
+}
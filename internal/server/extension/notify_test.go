@@ -0,0 +1,154 @@
+package extension_test
+
+import (
+	"strings"
+	"testing"
+
+	"raven/internal/server"
+)
+
+// ===== NOTIFY TESTS =====
+
+// TestNotify_StatusOption tests that NOTIFY SET STATUS reports the watched mailboxes at once
+func TestNotify_StatusOption(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "notifyuser")
+
+	srv.HandleNotify(conn, "N001", []string{"N001", "NOTIFY", "SET", "STATUS", "(inboxes", "(MessageNew", "MessageExpunge))"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* STATUS "INBOX" (MESSAGES 0 UIDNEXT 1 UNSEEN 0)`) {
+		t.Errorf("Expected an initial STATUS for INBOX, got: %s", response)
+	}
+	if strings.Contains(response, `* STATUS "Sent"`) {
+		t.Errorf("Expected only INBOX to be watched, got: %s", response)
+	}
+	if !strings.Contains(response, "N001 OK NOTIFY completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+}
+
+// TestNotify_NonSelectedMailbox tests STATUS notifications for new messages in other mailboxes
+func TestNotify_NonSelectedMailbox(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "notifyuser")
+
+	srv.HandleNotify(conn, "N002", []string{"N002", "NOTIFY", "SET", "(personal", "(MessageNew", "MessageExpunge))"}, state)
+
+	server.InsertTestMail(t, server.GetDatabaseFromServer(srv), "notifyuser", "Hello", "sender@example.com", "notifyuser@localhost", "INBOX")
+
+	conn.ClearWriteBuffer()
+	srv.DeliverNotifications(conn, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* STATUS "INBOX" (MESSAGES 1 UIDNEXT 2 UNSEEN 1)`) {
+		t.Errorf("Expected a STATUS notification, got: %s", response)
+	}
+
+	// Nothing is reported twice
+	conn.ClearWriteBuffer()
+	srv.DeliverNotifications(conn, state)
+	if response := conn.GetWrittenData(); response != "" {
+		t.Errorf("Expected no further notifications, got: %s", response)
+	}
+}
+
+// TestNotify_SelectedMailbox tests EXISTS, FETCH and EXPUNGE notifications for the selected mailbox
+func TestNotify_SelectedMailbox(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "notifyuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	srv.HandleSelect(conn, "N003", []string{"N003", "SELECT", "INBOX"}, state)
+	srv.HandleNotify(conn, "N004", []string{"N004", "NOTIFY", "SET", "(selected", "(MessageNew", "(UID", "FLAGS)", "MessageExpunge", "FlagChange))"}, state)
+
+	server.InsertTestMail(t, database, "notifyuser", "First", "sender@example.com", "notifyuser@localhost", "INBOX")
+
+	conn.ClearWriteBuffer()
+	srv.DeliverNotifications(conn, state)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* 1 EXISTS") || !strings.Contains(response, "* 1 FETCH (UID 1 FLAGS ())") {
+		t.Fatalf("Expected EXISTS and FETCH for the new message, got: %s", response)
+	}
+
+	userDB, err := database.GetUserDB(state.Email)
+	if err != nil {
+		t.Fatalf("Failed to get user database: %v", err)
+	}
+	if _, err := userDB.Exec(`UPDATE message_mailbox SET flags = '\Seen' WHERE mailbox_id = ?`, state.SelectedMailboxID); err != nil {
+		t.Fatalf("Failed to set flags: %v", err)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.DeliverNotifications(conn, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* 1 FETCH (UID 1 FLAGS (\Seen))`) {
+		t.Errorf("Expected a flag change notification, got: %s", response)
+	}
+
+	if _, err := userDB.Exec(`DELETE FROM message_mailbox WHERE mailbox_id = ?`, state.SelectedMailboxID); err != nil {
+		t.Fatalf("Failed to expunge: %v", err)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.DeliverNotifications(conn, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "* 1 EXPUNGE") {
+		t.Errorf("Expected an EXPUNGE notification, got: %s", response)
+	}
+}
+
+// TestNotify_MailboxNameAndSubscription tests LIST notifications for mailbox and subscription changes
+func TestNotify_MailboxNameAndSubscription(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "notifyuser")
+
+	srv.HandleNotify(conn, "N005", []string{"N005", "NOTIFY", "SET", "(personal", "(MailboxName", "SubscriptionChange))"}, state)
+	srv.HandleCreate(conn, "N006", []string{"N006", "CREATE", "Projects"}, state)
+	srv.HandleSubscribe(conn, "N007", []string{"N007", "SUBSCRIBE", "Projects"}, state)
+
+	conn.ClearWriteBuffer()
+	srv.DeliverNotifications(conn, state)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* LIST () "/" "Projects"`) {
+		t.Errorf("Expected a MailboxName notification, got: %s", response)
+	}
+	if !strings.Contains(response, `* LIST (\Subscribed) "/" "Projects"`) {
+		t.Errorf("Expected a SubscriptionChange notification, got: %s", response)
+	}
+}
+
+// TestNotify_InvalidRequests tests NOTIFY argument validation and NOTIFY NONE
+func TestNotify_InvalidRequests(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "notifyuser")
+
+	srv.HandleNotify(conn, "N008", []string{"N008", "NOTIFY", "SET", "(personal", "(AnnotationChange))"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "N008 NO [BADEVENT]") {
+		t.Errorf("Expected BADEVENT for an unsupported event, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleNotify(conn, "N009", []string{"N009", "NOTIFY", "SET", "(personal", "(MessageNew))"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "N009 BAD") {
+		t.Errorf("Expected BAD for MessageNew without MessageExpunge, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleNotify(conn, "N010", []string{"N010", "NOTIFY", "SET", "(personal", "(MessageNew", "(UID)", "MessageExpunge))"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "N010 BAD") {
+		t.Errorf("Expected BAD for FETCH attributes outside the selected mailbox, got: %s", response)
+	}
+
+	srv.HandleNotify(conn, "N011", []string{"N011", "NOTIFY", "SET", "(subtree", "Lists", "(MessageNew", "MessageExpunge))"}, state)
+	if state.Notify == nil || len(state.Notify.Filters) != 1 || state.Notify.Filters[0].Mailboxes[0] != "Lists" {
+		t.Fatalf("Expected the subtree filter to be stored, got: %+v", state.Notify)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleNotify(conn, "N012", []string{"N012", "NOTIFY", "NONE"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "N012 OK") || state.Notify != nil {
+		t.Errorf("Expected NOTIFY NONE to clear the filters, got: %s", response)
+	}
+}
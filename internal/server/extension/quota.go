@@ -0,0 +1,215 @@
+package extension
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"raven/internal/db"
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== QUOTA (RFC 9208) =====
+//
+// Each user has a single quota root named "" that covers all of their
+// mailboxes. Administrators may also address another user's quota root by
+// using that user's email address as the root name.
+
+// HandleGetQuota implements the GETQUOTA command
+// Syntax: GETQUOTA quota-root
+func HandleGetQuota(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 3 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD GETQUOTA requires quota root", tag))
+		return
+	}
+
+	root := utils.ParseQuotedString(strings.Join(parts[2:], " "))
+	userDB, ok := quotaRootDB(deps, conn, tag, root, state)
+	if !ok {
+		return
+	}
+
+	if !sendQuotaResponse(deps, conn, tag, root, userDB) {
+		return
+	}
+	deps.SendResponse(conn, fmt.Sprintf("%s OK GETQUOTA completed", tag))
+}
+
+// HandleGetQuotaRoot implements the GETQUOTAROOT command
+// Syntax: GETQUOTAROOT mailbox
+func HandleGetQuotaRoot(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 3 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD GETQUOTAROOT requires mailbox name", tag))
+		return
+	}
+
+	mailboxName, err := utils.ParseMailboxName(strings.Join(parts[2:], " "), state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
+
+	userDB, err := deps.GetUserDB(state.Email)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	if _, err := db.GetMailboxByNamePerUser(userDB, mailboxName); err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NONEXISTENT] Mailbox does not exist", tag))
+		return
+	}
+
+	deps.SendResponse(conn, fmt.Sprintf("* QUOTAROOT \"%s\" \"\"", utils.ClientMailboxName(mailboxName, state)))
+	if !sendQuotaResponse(deps, conn, tag, "", userDB) {
+		return
+	}
+	deps.SendResponse(conn, fmt.Sprintf("%s OK GETQUOTAROOT completed", tag))
+}
+
+// HandleSetQuota implements the SETQUOTA command (administrators only)
+// Syntax: SETQUOTA quota-root (resource limit ...)
+func HandleSetQuota(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 4 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD SETQUOTA requires quota root and resource limits", tag))
+		return
+	}
+
+	if !deps.IsAdmin(state.Email) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+
+	root := utils.ParseQuotedString(parts[2])
+	content, rest, err := utils.ParseParenthesizedList(parts[3:])
+	if err != nil || len(rest) > 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid resource limit list", tag))
+		return
+	}
+
+	limits, responseText := parseQuotaLimits(content)
+	if responseText != "" {
+		deps.SendResponse(conn, fmt.Sprintf("%s %s", tag, responseText))
+		return
+	}
+
+	userDB, ok := quotaRootDB(deps, conn, tag, root, state)
+	if !ok {
+		return
+	}
+
+	if err := db.SetQuotaLimitsPerUser(userDB, limits); err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO SETQUOTA failed: %v", tag, err))
+		return
+	}
+
+	if !sendQuotaResponse(deps, conn, tag, root, userDB) {
+		return
+	}
+	deps.SendResponse(conn, fmt.Sprintf("%s OK SETQUOTA completed", tag))
+}
+
+// parseQuotaLimits parses "STORAGE 512 MESSAGE 1000" into limits stored in the
+// database. STORAGE is given in units of 1024 octets. On error it returns the
+// response text (status and message) to send.
+func parseQuotaLimits(content string) (map[string]int64, string) {
+	fields := strings.Fields(content)
+	if len(fields)%2 != 0 {
+		return nil, "BAD Invalid resource limit list"
+	}
+
+	limits := make(map[string]int64)
+	for i := 0; i < len(fields); i += 2 {
+		resource := strings.ToUpper(fields[i])
+		if !utils.Contains(db.QuotaResources, resource) {
+			return nil, fmt.Sprintf("NO Unsupported quota resource %s", fields[i])
+		}
+
+		limit, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil || limit < 0 {
+			return nil, fmt.Sprintf("BAD Invalid limit for %s", resource)
+		}
+		if resource == db.QuotaResourceStorage {
+			limit *= 1024
+		}
+		limits[resource] = limit
+	}
+
+	return limits, ""
+}
+
+// quotaRootDB resolves a quota root name to the database of the user it
+// belongs to. It sends the error response if the root is unknown.
+func quotaRootDB(deps ServerDeps, conn net.Conn, tag string, root string, state *models.ClientState) (*sql.DB, bool) {
+	email := state.Email
+	if root != "" {
+		if !deps.IsAdmin(state.Email) || !strings.Contains(root, "@") {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO [NONEXISTENT] Unknown quota root", tag))
+			return nil, false
+		}
+		email = root
+	}
+
+	userDB, err := deps.GetUserDB(email)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return nil, false
+	}
+
+	return userDB, true
+}
+
+// sendQuotaResponse sends the untagged QUOTA response for a root. Only
+// resources with a limit are listed; nothing is sent if no limit is set.
+func sendQuotaResponse(deps ServerDeps, conn net.Conn, tag string, root string, userDB *sql.DB) bool {
+	limits, err := db.GetQuotaLimitsPerUser(userDB)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return false
+	}
+	if len(limits) == 0 {
+		return true
+	}
+
+	usage, err := db.GetQuotaUsagePerUser(userDB)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return false
+	}
+
+	var resources []string
+	for _, resource := range db.QuotaResources {
+		limit, ok := limits[resource]
+		if !ok {
+			continue
+		}
+		used := usage.Value(resource)
+		if resource == db.QuotaResourceStorage {
+			// STORAGE is reported in units of 1024 octets, rounded up
+			used = (used + 1023) / 1024
+			limit /= 1024
+		}
+		resources = append(resources, fmt.Sprintf("%s %d %d", resource, used, limit))
+	}
+
+	deps.SendResponse(conn, fmt.Sprintf("* QUOTA \"%s\" (%s)", root, strings.Join(resources, " ")))
+	return true
+}
@@ -0,0 +1,138 @@
+package extension_test
+
+import (
+	"strings"
+	"testing"
+
+	"raven/internal/db"
+	"raven/internal/server"
+)
+
+// ===== QUOTA TESTS =====
+
+// TestGetQuotaRoot_NoLimits tests GETQUOTAROOT for a user without limits
+func TestGetQuotaRoot_NoLimits(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "quotauser")
+
+	srv.HandleGetQuotaRoot(conn, "Q001", []string{"Q001", "GETQUOTAROOT", "INBOX"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* QUOTAROOT "INBOX" ""`) {
+		t.Errorf("Expected QUOTAROOT response, got: %s", response)
+	}
+	if strings.Contains(response, "* QUOTA ") {
+		t.Errorf("Expected no QUOTA response without limits, got: %s", response)
+	}
+	if !strings.Contains(response, "Q001 OK GETQUOTAROOT completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+}
+
+// TestGetQuotaRoot_NonExistentMailbox tests GETQUOTAROOT for an unknown mailbox
+func TestGetQuotaRoot_NonExistentMailbox(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "quotauser")
+
+	srv.HandleGetQuotaRoot(conn, "Q002", []string{"Q002", "GETQUOTAROOT", "Missing"}, state)
+
+	if response := conn.GetWrittenData(); !strings.Contains(response, "Q002 NO [NONEXISTENT]") {
+		t.Errorf("Expected NO [NONEXISTENT], got: %s", response)
+	}
+}
+
+// TestGetQuota_ReportsUsage tests that GETQUOTA reports real usage against stored limits
+func TestGetQuota_ReportsUsage(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "quotauser")
+	database := server.GetDatabaseFromServer(srv)
+
+	server.InsertTestMail(t, database, "quotauser", "Hello", "sender@test.com", "quotauser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "quotauser", "World", "sender@test.com", "quotauser@localhost", "INBOX")
+
+	userDB, _ := database.GetUserDB(state.Email)
+	if err := db.SetQuotaLimitsPerUser(userDB, map[string]int64{db.QuotaResourceStorage: 10 * 1024, db.QuotaResourceMessage: 50}); err != nil {
+		t.Fatalf("Failed to set limits: %v", err)
+	}
+
+	srv.HandleGetQuota(conn, "Q003", []string{"Q003", "GETQUOTA", `""`}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* QUOTA "" (STORAGE 1 10 MESSAGE 2 50)`) {
+		t.Errorf("Expected QUOTA with usage, got: %s", response)
+	}
+	if !strings.Contains(response, "Q003 OK GETQUOTA completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleGetQuota(conn, "Q004", []string{"Q004", "GETQUOTA", "other@localhost"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "Q004 NO [NONEXISTENT]") {
+		t.Errorf("Expected non-admins to be refused other roots, got: %s", response)
+	}
+}
+
+// TestSetQuota_AdminOnly tests that only administrators may set limits
+func TestSetQuota_AdminOnly(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "quotauser")
+
+	srv.HandleSetQuota(conn, "Q005", []string{"Q005", "SETQUOTA", `""`, "(STORAGE", "100)"}, state)
+
+	if response := conn.GetWrittenData(); !strings.Contains(response, "Q005 NO [NOPERM]") {
+		t.Errorf("Expected NO [NOPERM], got: %s", response)
+	}
+}
+
+// TestSetQuota_AdminSetsUserLimits tests SETQUOTA on another user's quota root
+func TestSetQuota_AdminSetsUserLimits(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	admin := server.SetupAuthenticatedState(t, srv, "postmaster")
+	user := server.SetupAuthenticatedState(t, srv, "quotauser")
+	srv.SetAdmins([]string{"postmaster@localhost"})
+
+	srv.HandleSetQuota(conn, "Q006", []string{"Q006", "SETQUOTA", "quotauser@localhost", "(STORAGE", "512", "MAILBOX", "20)"}, admin)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* QUOTA "quotauser@localhost" (STORAGE 0 512 MAILBOX `) {
+		t.Errorf("Expected QUOTA response, got: %s", response)
+	}
+	if !strings.Contains(response, "Q006 OK SETQUOTA completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+
+	// The user sees the new limits on their own root
+	conn.ClearWriteBuffer()
+	srv.HandleGetQuota(conn, "Q007", []string{"Q007", "GETQUOTA", `""`}, user)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "STORAGE 0 512") {
+		t.Errorf("Expected user to see STORAGE limit, got: %s", response)
+	}
+}
+
+// TestSetQuota_InvalidResources tests SETQUOTA argument validation
+func TestSetQuota_InvalidResources(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	state := server.SetupAuthenticatedState(t, srv, "postmaster")
+	srv.SetAdmins([]string{"postmaster@localhost"})
+
+	tests := []struct {
+		parts    []string
+		expected string
+	}{
+		{[]string{"Q008", "SETQUOTA", `""`, "(X-ATTACHMENTS", "5)"}, "Q008 NO"},
+		{[]string{"Q009", "SETQUOTA", `""`, "(STORAGE", "lots)"}, "Q009 BAD"},
+		{[]string{"Q010", "SETQUOTA", `""`, "(STORAGE)"}, "Q010 BAD"},
+	}
+	for _, tt := range tests {
+		conn := server.NewMockConn()
+		srv.HandleSetQuota(conn, tt.parts[0], tt.parts, state)
+		if response := conn.GetWrittenData(); !strings.Contains(response, tt.expected) {
+			t.Errorf("Expected '%s', got: %s", tt.expected, response)
+		}
+	}
+}
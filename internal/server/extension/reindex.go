@@ -0,0 +1,61 @@
+package extension
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"raven/internal/db"
+	"raven/internal/delivery/parser"
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== XREINDEX =====
+
+// HandleReindex implements the XREINDEX command (administrators only), which
+// rebuilds the full-text search index of a user's mailboxes from the stored
+// messages. Messages delivered before the index existed are only found by
+// the slower SEARCH until their account has been reindexed.
+// Syntax: XREINDEX user-address
+func HandleReindex(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) != 3 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD XREINDEX requires a user address", tag))
+		return
+	}
+
+	if !deps.IsAdmin(state.Email) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+
+	email := utils.ParseQuotedString(parts[2])
+	if !strings.Contains(email, "@") {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid user address", tag))
+		return
+	}
+
+	userDB, err := deps.GetUserDB(email)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	indexed, err := parser.ReindexMessagesPerUser(deps.GetSharedDB(), userDB, deps.GetS3Storage())
+	if errors.Is(err, db.ErrSearchIndexUnavailable) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [UNAVAILABLE] Full-text search index is not available", tag))
+		return
+	}
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO XREINDEX failed: %v", tag, err))
+		return
+	}
+
+	deps.SendResponse(conn, fmt.Sprintf("%s OK XREINDEX completed, %d messages indexed", tag, indexed))
+}
@@ -0,0 +1,86 @@
+package extension_test
+
+import (
+	"strings"
+	"testing"
+
+	"raven/internal/db"
+	"raven/internal/server"
+)
+
+// ===== XREINDEX TESTS =====
+
+// TestReindex_RequiresAdmin tests that only administrators may reindex an account
+func TestReindex_RequiresAdmin(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "indexuser")
+
+	srv.HandleReindex(conn, "R001", []string{"R001", "XREINDEX", "indexuser@localhost"}, state)
+
+	if response := conn.GetWrittenData(); !strings.Contains(response, "R001 NO [NOPERM]") {
+		t.Errorf("Expected NO [NOPERM], got: %s", response)
+	}
+}
+
+// TestReindex_InvalidArguments tests XREINDEX argument validation
+func TestReindex_InvalidArguments(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	state := server.SetupAuthenticatedState(t, srv, "postmaster")
+	srv.SetAdmins([]string{"postmaster@localhost"})
+
+	tests := []struct {
+		parts    []string
+		expected string
+	}{
+		{[]string{"R002", "XREINDEX"}, "R002 BAD"},
+		{[]string{"R003", "XREINDEX", "indexuser"}, "R003 BAD"},
+		{[]string{"R004", "XREINDEX", "a@localhost", "b@localhost"}, "R004 BAD"},
+	}
+	for _, tt := range tests {
+		conn := server.NewMockConn()
+		srv.HandleReindex(conn, tt.parts[0], tt.parts, state)
+		if response := conn.GetWrittenData(); !strings.Contains(response, tt.expected) {
+			t.Errorf("Expected '%s', got: %s", tt.expected, response)
+		}
+	}
+}
+
+// TestReindex_RebuildsIndex tests that XREINDEX indexes messages stored
+// without an index entry
+func TestReindex_RebuildsIndex(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	admin := server.SetupAuthenticatedState(t, srv, "postmaster")
+	user := server.SetupAuthenticatedState(t, srv, "indexuser")
+	srv.SetAdmins([]string{"postmaster@localhost"})
+	database := server.GetDatabaseFromServer(srv)
+
+	userDB, err := database.GetUserDB(user.Email)
+	if err != nil {
+		t.Fatalf("Failed to get user database: %v", err)
+	}
+	if !db.SearchIndexAvailable(userDB) {
+		srv.HandleReindex(conn, "R005", []string{"R005", "XREINDEX", "indexuser@localhost"}, admin)
+		if response := conn.GetWrittenData(); !strings.Contains(response, "R005 NO [UNAVAILABLE]") {
+			t.Errorf("Expected NO [UNAVAILABLE] without FTS5, got: %s", response)
+		}
+		return
+	}
+
+	server.InsertTestMail(t, database, "indexuser", "Budget", "sender@test.com", "indexuser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "indexuser", "Roadmap", "sender@test.com", "indexuser@localhost", "Archive")
+	if err := db.ClearSearchIndexPerUser(userDB); err != nil {
+		t.Fatalf("Failed to clear index: %v", err)
+	}
+
+	srv.HandleReindex(conn, "R005", []string{"R005", "XREINDEX", "indexuser@localhost"}, admin)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "R005 OK XREINDEX completed, 2 messages indexed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+
+	ids, err := db.SearchIndexMatchesPerUser(userDB, "SUBJECT", "roadmap")
+	if err != nil || len(ids) != 1 {
+		t.Errorf("Expected the reindexed message to be found, got %v (%v)", ids, err)
+	}
+}
@@ -0,0 +1,348 @@
+package mailbox
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"raven/internal/db"
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== ACL (RFC 4314) =====
+//
+// Users hold every right on their own mailboxes and can grant rights on them
+// to other users (by email address) or to "anyone". Mailboxes shared with a
+// user appear under the "Other Users/<owner>/" namespace.
+
+// HandleSetACL implements the SETACL command
+// Syntax: SETACL mailbox identifier rights
+func HandleSetACL(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 5 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD SETACL requires mailbox, identifier and rights", tag))
+		return
+	}
+
+	mailboxName := utils.ParseQuotedString(parts[2])
+	identifier := strings.ToLower(utils.ParseQuotedString(parts[3]))
+	modification := utils.ParseQuotedString(parts[4])
+
+	access, owner, _, ok := resolveACLMailbox(deps, conn, tag, mailboxName, "a", state)
+	if !ok {
+		return
+	}
+
+	current, err := db.GetIdentifierRightsPerUser(access.DB, access.MailboxID, identifier)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	if !checkACLIdentifier(deps, conn, tag, identifier, owner, current) {
+		return
+	}
+
+	rights, err := utils.ApplyRightsModification(current, modification)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid rights: %s", tag, err.Error()))
+		return
+	}
+
+	if err := db.SetMailboxRightsPerUser(access.DB, access.MailboxID, identifier, rights); err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO SETACL failed: %v", tag, err))
+		return
+	}
+	updateMailboxShare(deps, access.DB, owner, identifier)
+
+	deps.SendResponse(conn, fmt.Sprintf("%s OK SETACL completed", tag))
+}
+
+// HandleDeleteACL implements the DELETEACL command
+// Syntax: DELETEACL mailbox identifier
+func HandleDeleteACL(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 4 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD DELETEACL requires mailbox and identifier", tag))
+		return
+	}
+
+	mailboxName := utils.ParseQuotedString(parts[2])
+	identifier := strings.ToLower(utils.ParseQuotedString(parts[3]))
+
+	access, owner, _, ok := resolveACLMailbox(deps, conn, tag, mailboxName, "a", state)
+	if !ok {
+		return
+	}
+
+	current, err := db.GetIdentifierRightsPerUser(access.DB, access.MailboxID, identifier)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	if !checkACLIdentifier(deps, conn, tag, identifier, owner, current) {
+		return
+	}
+
+	if err := db.SetMailboxRightsPerUser(access.DB, access.MailboxID, identifier, ""); err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO DELETEACL failed: %v", tag, err))
+		return
+	}
+	updateMailboxShare(deps, access.DB, owner, identifier)
+
+	deps.SendResponse(conn, fmt.Sprintf("%s OK DELETEACL completed", tag))
+}
+
+// HandleGetACL implements the GETACL command
+// Syntax: GETACL mailbox
+func HandleGetACL(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 3 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD GETACL requires mailbox name", tag))
+		return
+	}
+
+	mailboxName := utils.ParseQuotedString(parts[2])
+
+	access, owner, name, ok := resolveACLMailbox(deps, conn, tag, mailboxName, "a", state)
+	if !ok {
+		return
+	}
+
+	entries, err := db.GetMailboxACLPerUser(access.DB, access.MailboxID)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	// The owner's implicit rights are listed first
+	response := fmt.Sprintf("* ACL \"%s\" %s %s", utils.ClientMailboxName(name, state), owner, db.AllRights)
+	for _, entry := range entries {
+		response += fmt.Sprintf(" %s %s", entry.Identifier, entry.Rights)
+	}
+
+	deps.SendResponse(conn, response)
+	deps.SendResponse(conn, fmt.Sprintf("%s OK GETACL completed", tag))
+}
+
+// HandleListRights implements the LISTRIGHTS command
+// Syntax: LISTRIGHTS mailbox identifier
+func HandleListRights(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 4 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD LISTRIGHTS requires mailbox and identifier", tag))
+		return
+	}
+
+	mailboxName := utils.ParseQuotedString(parts[2])
+	identifier := strings.ToLower(utils.ParseQuotedString(parts[3]))
+
+	_, owner, name, ok := resolveACLMailbox(deps, conn, tag, mailboxName, "a", state)
+	if !ok {
+		return
+	}
+
+	// The owner always holds every right; anyone else may be granted each right independently
+	if identifier == owner {
+		deps.SendResponse(conn, fmt.Sprintf("* LISTRIGHTS \"%s\" %s %s", utils.ClientMailboxName(name, state), identifier, db.AllRights))
+	} else {
+		deps.SendResponse(conn, fmt.Sprintf("* LISTRIGHTS \"%s\" %s \"\" %s",
+			utils.ClientMailboxName(name, state), identifier, strings.Join(strings.Split(db.AllRights, ""), " ")))
+	}
+	deps.SendResponse(conn, fmt.Sprintf("%s OK LISTRIGHTS completed", tag))
+}
+
+// HandleMyRights implements the MYRIGHTS command
+// Syntax: MYRIGHTS mailbox
+func HandleMyRights(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if len(parts) < 3 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD MYRIGHTS requires mailbox name", tag))
+		return
+	}
+
+	mailboxName := utils.ParseQuotedString(parts[2])
+
+	access, _, name, ok := resolveACLMailbox(deps, conn, tag, mailboxName, "", state)
+	if !ok {
+		return
+	}
+
+	deps.SendResponse(conn, fmt.Sprintf("* MYRIGHTS \"%s\" %s", utils.ClientMailboxName(name, state), access.Rights))
+	deps.SendResponse(conn, fmt.Sprintf("%s OK MYRIGHTS completed", tag))
+}
+
+// resolveACLMailbox resolves the mailbox named in an ACL command, as sent by
+// the client, checks that the user holds the required rights on it and
+// returns the owner's address and the decoded mailbox name. It sends the
+// error response on failure.
+func resolveACLMailbox(deps ServerDeps, conn net.Conn, tag string, name string, required string, state *models.ClientState) (*utils.MailboxAccess, string, string, bool) {
+	name, err := utils.ParseMailboxName(name, state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return nil, "", "", false
+	}
+
+	access, err := utils.ResolveMailboxAccess(deps, state.Email, name)
+	if errors.Is(err, utils.ErrNoSuchMailbox) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NONEXISTENT] Mailbox does not exist", tag))
+		return nil, "", "", false
+	}
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return nil, "", "", false
+	}
+
+	if !utils.HasRights(access.Rights, required) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return nil, "", "", false
+	}
+
+	owner := access.Owner
+	if owner == "" {
+		owner = strings.ToLower(state.Email)
+	}
+
+	return access, owner, name, true
+}
+
+// checkACLIdentifier validates the identifier of SETACL and DELETEACL. Only
+// the addresses of known user accounts and "anyone" are supported, except
+// that rights already held (current) by an identifier can always be changed;
+// negative rights and changes to the owner's rights are refused. Role
+// mailboxes are shared through role membership, not ACLs.
+func checkACLIdentifier(deps ServerDeps, conn net.Conn, tag string, identifier string, owner string, current string) bool {
+	switch {
+	case strings.HasPrefix(identifier, "-"):
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Negative rights are not supported", tag))
+		return false
+	case identifier == owner:
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [CANNOT] The owner's rights cannot be changed", tag))
+		return false
+	case identifier != db.ACLIdentifierAnyone && current == "" && !isKnownAccount(deps, identifier):
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Unknown identifier %s", tag, identifier))
+		return false
+	}
+	return true
+}
+
+// isKnownAccount reports whether identifier is the address of a user account
+// that has a mailbox database
+func isKnownAccount(deps ServerDeps, identifier string) bool {
+	dbManager := deps.GetDBManager()
+	return dbManager != nil && utils.IsUserAccount(identifier) && dbManager.UserDBExists(identifier)
+}
+
+// updateMailboxShare keeps the shared index of delegations in sync after the
+// ACL of one of owner's mailboxes changed for identifier
+func updateMailboxShare(deps ServerDeps, ownerDB *sql.DB, owner string, identifier string) {
+	sharedDB := deps.GetSharedDB()
+	if sharedDB == nil {
+		return
+	}
+
+	hasGrants, err := db.HasGrantsForPerUser(ownerDB, identifier)
+	if err != nil {
+		return
+	}
+	if hasGrants {
+		_ = db.AddMailboxShare(sharedDB, owner, identifier)
+	} else {
+		_ = db.RemoveMailboxShare(sharedDB, owner, identifier)
+	}
+}
+
+// delegatedMailboxes returns the "Other Users" names of the mailboxes that
+// other users shared with the user and on which the user holds the "l" right
+func delegatedMailboxes(deps ServerDeps, email string) []string {
+	sharedDB := deps.GetSharedDB()
+	if sharedDB == nil {
+		return nil
+	}
+
+	owners, err := db.GetMailboxShareOwners(sharedDB, email)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, owner := range owners {
+		ownerDB, err := deps.GetUserDB(owner)
+		if err != nil {
+			continue
+		}
+		mailboxes, err := db.GetUserMailboxesPerUser(ownerDB)
+		if err != nil {
+			continue
+		}
+		for _, name := range mailboxes {
+			if hasRightsOn(ownerDB, name, email, "l") {
+				names = append(names, utils.OtherUsersMailboxName(owner, name))
+			}
+		}
+	}
+
+	return names
+}
+
+// accountForMailbox maps a mailbox name to the database of the account that
+// holds it and the name within that account. owner is empty for the user's
+// own account. Role accounts are not opened (userDB is nil) because their
+// hierarchy cannot be changed over IMAP, and neither are accounts that have
+// not shared any mailbox with the user.
+func accountForMailbox(deps ServerDeps, email string, name string) (userDB *sql.DB, mailbox string, owner string, err error) {
+	owner, mailbox = utils.MailboxAccount(email, name)
+	switch {
+	case owner == "":
+		userDB, err = deps.GetUserDB(email)
+	case utils.SharesWith(deps, owner, email):
+		userDB, err = deps.GetUserDB(owner)
+	}
+	return userDB, mailbox, owner, err
+}
+
+// hasRightsOn reports whether the user holds the required rights on a mailbox
+// in another user's account
+func hasRightsOn(ownerDB *sql.DB, mailbox string, email string, required string) bool {
+	if ownerDB == nil {
+		return false
+	}
+	mailboxID, err := db.GetMailboxByNamePerUser(ownerDB, mailbox)
+	if err != nil {
+		return false
+	}
+	rights, err := db.GetMailboxRightsPerUser(ownerDB, mailboxID, email)
+	return err == nil && utils.HasRights(rights, required)
+}
+
+// parentMailbox returns the parent of a hierarchical mailbox name, or "" at the top level
+func parentMailbox(name string) string {
+	if i := strings.LastIndex(name, "/"); i > 0 {
+		return name[:i]
+	}
+	return ""
+}
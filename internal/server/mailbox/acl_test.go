@@ -0,0 +1,292 @@
+package mailbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"raven/internal/db"
+	"raven/internal/models"
+	"raven/internal/server"
+)
+
+// ===== ACL TESTS =====
+
+const sharedInbox = "Other Users/boss@localhost/INBOX"
+
+// setupDelegation creates a manager and an assistant and grants the assistant
+// the given rights on the manager's INBOX
+func setupDelegation(t *testing.T, rights string) (*server.TestInterface, *models.ClientState, *models.ClientState) {
+	t.Helper()
+	srv := server.SetupTestServerSimple(t)
+	boss := server.SetupAuthenticatedState(t, srv, "boss")
+	assistant := server.SetupAuthenticatedState(t, srv, "assistant")
+
+	database := server.GetDatabaseFromServer(srv)
+	server.InsertTestMail(t, database, "boss", "Quarterly report", "cfo@test.com", "boss@localhost", "INBOX")
+
+	conn := server.NewMockConn()
+	srv.HandleSetACL(conn, "S1", []string{"S1", "SETACL", "INBOX", "assistant@localhost", rights}, boss)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "S1 OK SETACL completed") {
+		t.Fatalf("SETACL failed: %s", response)
+	}
+
+	return srv, boss, assistant
+}
+
+// TestSetACL_GetACL tests granting rights and reading the ACL back
+func TestSetACL_GetACL(t *testing.T) {
+	srv, boss, _ := setupDelegation(t, "lr")
+	conn := server.NewMockConn()
+
+	srv.HandleSetACL(conn, "ACL01", []string{"ACL01", "SETACL", "INBOX", "assistant@localhost", "+s"}, boss)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "ACL01 OK SETACL completed") {
+		t.Fatalf("Expected OK, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleGetACL(conn, "ACL02", []string{"ACL02", "GETACL", "INBOX"}, boss)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* ACL "INBOX" boss@localhost lrswipkxtea assistant@localhost lrs`) {
+		t.Errorf("Unexpected ACL response: %s", response)
+	}
+	if !strings.Contains(response, "ACL02 OK GETACL completed") {
+		t.Errorf("Expected OK, got: %s", response)
+	}
+}
+
+// TestSetACL_InvalidRequests tests the errors of SETACL
+func TestSetACL_InvalidRequests(t *testing.T) {
+	srv, boss, assistant := setupDelegation(t, "lr")
+	conn := server.NewMockConn()
+
+	tests := []struct {
+		parts    []string
+		state    *models.ClientState
+		expected string
+	}{
+		{[]string{"ACL03", "SETACL", "INBOX", "assistant@localhost", "lrz"}, boss, "ACL03 BAD Invalid rights"},
+		{[]string{"ACL04", "SETACL", "INBOX", "-assistant@localhost", "r"}, boss, "ACL04 NO Negative rights are not supported"},
+		{[]string{"ACL05", "SETACL", "INBOX", "boss@localhost", "r"}, boss, "ACL05 NO [CANNOT]"},
+		{[]string{"ACL06", "SETACL", "Missing", "assistant@localhost", "r"}, boss, "ACL06 NO [NONEXISTENT]"},
+		{[]string{"ACL07", "SETACL", sharedInbox, "other@localhost", "r"}, assistant, "ACL07 NO [NOPERM]"},
+		{[]string{"ACL08", "SETACL", "INBOX"}, boss, "ACL08 BAD"},
+		{[]string{"ACL09", "SETACL", "INBOX", "stranger@localhost", "r"}, boss, "ACL09 NO Unknown identifier"},
+		{[]string{"ACL10", "SETACL", "INBOX", "role_admin@localhost.db", "r"}, boss, "ACL10 NO Unknown identifier"},
+		{[]string{"ACL11", "SETACL", "INBOX", "staff", "r"}, boss, "ACL11 NO Unknown identifier"},
+	}
+
+	for _, tt := range tests {
+		conn.ClearWriteBuffer()
+		srv.HandleSetACL(conn, tt.parts[0], tt.parts, tt.state)
+		if response := conn.GetWrittenData(); !strings.Contains(response, tt.expected) {
+			t.Errorf("%v: expected %q, got: %s", tt.parts, tt.expected, response)
+		}
+	}
+}
+
+// TestMyRightsAndListRights tests MYRIGHTS for the owner and a delegate, and LISTRIGHTS
+func TestMyRightsAndListRights(t *testing.T) {
+	srv, boss, assistant := setupDelegation(t, "lr")
+	conn := server.NewMockConn()
+
+	srv.HandleMyRights(conn, "MR01", []string{"MR01", "MYRIGHTS", "INBOX"}, boss)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* MYRIGHTS "INBOX" lrswipkxtea`) {
+		t.Errorf("Expected all rights for the owner, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleMyRights(conn, "MR02", []string{"MR02", "MYRIGHTS", sharedInbox}, assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* MYRIGHTS "`+sharedInbox+`" lr`) {
+		t.Errorf("Expected delegated rights, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleListRights(conn, "LR01", []string{"LR01", "LISTRIGHTS", "INBOX", "assistant@localhost"}, boss)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* LISTRIGHTS "INBOX" assistant@localhost "" l r s w i p k x t e a`) {
+		t.Errorf("Unexpected LISTRIGHTS response: %s", response)
+	}
+
+	// Mailboxes that were not shared are not visible
+	conn.ClearWriteBuffer()
+	srv.HandleMyRights(conn, "MR03", []string{"MR03", "MYRIGHTS", "Other Users/boss@localhost/Sent"}, assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "MR03 NO [NONEXISTENT]") {
+		t.Errorf("Expected unshared mailbox to be hidden, got: %s", response)
+	}
+}
+
+// TestACL_MailboxNameEncoding tests that ACL responses name the mailbox in
+// the encoding the client uses
+func TestACL_MailboxNameEncoding(t *testing.T) {
+	srv, boss, _ := setupDelegation(t, "lr")
+	server.CreateMailbox(t, server.GetDatabaseFromServer(srv), "boss", "Café")
+	conn := server.NewMockConn()
+
+	srv.HandleGetACL(conn, "EN01", []string{"EN01", "GETACL", "Caf&AOk-"}, boss)
+	srv.HandleMyRights(conn, "EN02", []string{"EN02", "MYRIGHTS", `"Caf&AOk-"`}, boss)
+	srv.HandleListRights(conn, "EN03", []string{"EN03", "LISTRIGHTS", "Caf&AOk-", "assistant@localhost"}, boss)
+	response := conn.GetWrittenData()
+	for _, expected := range []string{`* ACL "Caf&AOk-" `, `* MYRIGHTS "Caf&AOk-" `, `* LISTRIGHTS "Caf&AOk-" `} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Expected %q, got: %s", expected, response)
+		}
+	}
+
+	boss.UTF8Enabled = true
+	conn.ClearWriteBuffer()
+	srv.HandleMyRights(conn, "EN04", []string{"EN04", "MYRIGHTS", "Café"}, boss)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* MYRIGHTS "Café" `) {
+		t.Errorf("Expected the UTF-8 name, got: %s", response)
+	}
+}
+
+// TestDeleteACL tests revoking a delegate's access
+func TestDeleteACL(t *testing.T) {
+	srv, boss, assistant := setupDelegation(t, "lr")
+	conn := server.NewMockConn()
+
+	srv.HandleDeleteACL(conn, "DA01", []string{"DA01", "DELETEACL", "INBOX", "assistant@localhost"}, boss)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "DA01 OK DELETEACL completed") {
+		t.Fatalf("Expected OK, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "DA02", []string{"DA02", "LIST", `""`, "*"}, assistant)
+	if response := conn.GetWrittenData(); strings.Contains(response, "Other Users/") {
+		t.Errorf("Expected no delegated mailboxes after DELETEACL, got: %s", response)
+	}
+
+	// Rights left for an account that no longer exists can still be removed
+	userDB := server.GetUserDB(t, srv, "boss@localhost")
+	inboxID, _ := db.GetMailboxByNamePerUser(userDB, "INBOX")
+	if err := db.SetMailboxRightsPerUser(userDB, inboxID, "gone@localhost", "lr"); err != nil {
+		t.Fatalf("SetMailboxRightsPerUser failed: %v", err)
+	}
+	conn.ClearWriteBuffer()
+	srv.HandleDeleteACL(conn, "DA03", []string{"DA03", "DELETEACL", "INBOX", "gone@localhost"}, boss)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "DA03 OK DELETEACL completed") {
+		t.Errorf("Expected OK, got: %s", response)
+	}
+}
+
+// TestDelegatedMailbox_ListSelectFetch tests that a delegate can find, select and read a shared mailbox
+func TestDelegatedMailbox_ListSelectFetch(t *testing.T) {
+	srv, _, assistant := setupDelegation(t, "lr")
+	conn := server.NewMockConn()
+
+	srv.HandleList(conn, "DM01", []string{"DM01", "LIST", `""`, "*"}, assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `"`+sharedInbox+`"`) {
+		t.Errorf("Expected shared INBOX in LIST, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleSelect(conn, "DM02", []string{"DM02", "SELECT", sharedInbox}, assistant)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* 1 EXISTS") {
+		t.Errorf("Expected the manager's message, got: %s", response)
+	}
+	if !strings.Contains(response, "DM02 OK [READ-ONLY]") {
+		t.Errorf("Expected read-only selection without write rights, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "DM03", []string{"DM03", "FETCH", "1", "(BODY.PEEK[HEADER.FIELDS (SUBJECT)])"}, assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "Quarterly report") {
+		t.Errorf("Expected to read the manager's message, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleStore(conn, "DM04", []string{"DM04", "STORE", "1", "+FLAGS", `(\Seen)`}, assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "DM04 NO [NOPERM]") {
+		t.Errorf("Expected STORE without the seen right to be refused, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleExpunge(conn, "DM05", assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "DM05 NO [NOPERM]") {
+		t.Errorf("Expected EXPUNGE without the expunge right to be refused, got: %s", response)
+	}
+}
+
+// TestDelegatedMailbox_StoreWithRights tests that granted rights allow changing flags
+func TestDelegatedMailbox_StoreWithRights(t *testing.T) {
+	srv, _, assistant := setupDelegation(t, "lrs")
+	conn := server.NewMockConn()
+
+	srv.HandleSelect(conn, "DS01", []string{"DS01", "SELECT", sharedInbox}, assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "DS01 OK [READ-WRITE]") {
+		t.Fatalf("Expected read-write selection, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleStore(conn, "DS02", []string{"DS02", "STORE", "1", "+FLAGS", `(\Seen)`}, assistant)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `\Seen`) || !strings.Contains(response, "DS02 OK") {
+		t.Errorf("Expected STORE with the seen right to succeed, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleStore(conn, "DS03", []string{"DS03", "STORE", "1", "+FLAGS", `(\Flagged)`}, assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "DS03 NO [NOPERM]") {
+		t.Errorf("Expected STORE without the write right to be refused, got: %s", response)
+	}
+}
+
+// TestDelegatedMailbox_StatusRequiresRead tests that STATUS needs the read right
+func TestDelegatedMailbox_StatusRequiresRead(t *testing.T) {
+	srv, _, assistant := setupDelegation(t, "l")
+	conn := server.NewMockConn()
+
+	srv.HandleStatus(conn, "ST01", []string{"ST01", "STATUS", sharedInbox, "(MESSAGES)"}, assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "ST01 NO [NOPERM]") {
+		t.Errorf("Expected STATUS without the read right to be refused, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleSelect(conn, "ST02", []string{"ST02", "SELECT", sharedInbox}, assistant)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "ST02 NO [NOPERM]") {
+		t.Errorf("Expected SELECT without the read right to be refused, got: %s", response)
+	}
+}
+
+// TestOtherUsers_UnknownOwner tests that naming an account that shared nothing
+// with the user neither opens nor creates its database
+func TestOtherUsers_UnknownOwner(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	user := server.SetupAuthenticatedState(t, srv, "curious")
+	sharedDB := server.GetSharedDB(t, srv)
+
+	var seq int
+	var name, sharedPath string
+	if err := sharedDB.QueryRow("PRAGMA database_list").Scan(&seq, &name, &sharedPath); err != nil {
+		t.Fatalf("Failed to find the shared database: %v", err)
+	}
+	dir := filepath.Dir(sharedPath)
+
+	for _, owner := range []string{"nobody@localhost", "shared.db", "../curious@localhost"} {
+		mailboxName := "Other Users/" + owner + "/INBOX"
+		conn := server.NewMockConn()
+		srv.HandleSelect(conn, "O1", []string{"O1", "SELECT", `"` + mailboxName + `"`}, user)
+		srv.HandleStatus(conn, "O2", []string{"O2", "STATUS", `"` + mailboxName + `"`, "(MESSAGES)"}, user)
+		srv.HandleGetACL(conn, "O3", []string{"O3", "GETACL", `"` + mailboxName + `"`}, user)
+		srv.HandleCreate(conn, "O4", []string{"O4", "CREATE", `"` + mailboxName + `/New"`}, user)
+
+		response := conn.GetWrittenData()
+		for _, tag := range []string{"O1", "O2", "O3", "O4"} {
+			if !strings.Contains(response, tag+" NO") {
+				t.Errorf("%s: expected %s to be refused, got: %s", owner, tag, response)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "user_nobody@localhost.db")); !os.IsNotExist(err) {
+		t.Errorf("Expected no database for an unknown owner, got %v", err)
+	}
+
+	// The shared database is never opened as a user database
+	var tables int
+	if err := sharedDB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'mailboxes'").Scan(&tables); err != nil || tables != 0 {
+		t.Errorf("Expected no mailbox tables in the shared database, got %d (%v)", tables, err)
+	}
+}
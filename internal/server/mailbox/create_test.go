@@ -1,6 +1,7 @@
 package mailbox_test
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 
@@ -8,6 +9,12 @@ import (
 	"raven/internal/server"
 )
 
+// createCompleted reports whether response contains the tagged OK of a
+// successful CREATE, which carries the MAILBOXID of the new mailbox (RFC 8474)
+func createCompleted(response, tag string) bool {
+	return regexp.MustCompile(regexp.QuoteMeta(tag) + ` OK \[MAILBOXID \([A-Za-z0-9_-]+\)\] CREATE completed`).MatchString(response)
+}
+
 // TestCreateCommand_Unauthenticated tests CREATE command without authentication
 func TestCreateCommand_Unauthenticated(t *testing.T) {
 	srv := server.SetupTestServerSimple(t)
@@ -95,7 +102,7 @@ func TestCreateCommand_ValidMailbox(t *testing.T) {
 	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Projects"}, state)
 
 	response := conn.GetWrittenData()
-	if !strings.Contains(response, "A001 OK CREATE completed") {
+	if !createCompleted(response, "A001") {
 		t.Errorf("Expected successful creation, got: %s", response)
 	}
 }
@@ -110,7 +117,7 @@ func TestCreateCommand_QuotedMailboxName(t *testing.T) {
 	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "\"My Projects\""}, state)
 
 	response := conn.GetWrittenData()
-	if !strings.Contains(response, "A001 OK CREATE completed") {
+	if !createCompleted(response, "A001") {
 		t.Errorf("Expected successful creation of quoted mailbox, got: %s", response)
 	}
 }
@@ -124,7 +131,7 @@ func TestCreateCommand_DuplicateMailbox(t *testing.T) {
 	// Create mailbox first time
 	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "TestDupe"}, state)
 	response1 := conn.GetWrittenData()
-	if !strings.Contains(response1, "A001 OK CREATE completed") {
+	if !createCompleted(response1, "A001") {
 		t.Errorf("Expected successful first creation, got: %s", response1)
 	}
 
@@ -167,7 +174,7 @@ func TestCreateCommand_HierarchicalMailbox(t *testing.T) {
 	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Projects/Work/Important"}, state)
 
 	response := conn.GetWrittenData()
-	if !strings.Contains(response, "A001 OK CREATE completed") {
+	if !createCompleted(response, "A001") {
 		t.Errorf("Expected successful creation of hierarchical mailbox, got: %s", response)
 	}
 }
@@ -182,7 +189,7 @@ func TestCreateCommand_TrailingHierarchySeparator(t *testing.T) {
 	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Projects/"}, state)
 
 	response := conn.GetWrittenData()
-	if !strings.Contains(response, "A001 OK CREATE completed") {
+	if !createCompleted(response, "A001") {
 		t.Errorf("Expected successful creation with trailing separator, got: %s", response)
 	}
 
@@ -205,7 +212,7 @@ func TestCreateCommand_ListShowsCreatedMailbox(t *testing.T) {
 	// Create a new mailbox
 	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "NewMailbox"}, state)
 	createResponse := conn.GetWrittenData()
-	if !strings.Contains(createResponse, "A001 OK CREATE completed") {
+	if !createCompleted(createResponse, "A001") {
 		t.Errorf("Expected successful creation, got: %s", createResponse)
 	}
 
@@ -236,7 +243,7 @@ func TestCreateCommand_MultipleUsers(t *testing.T) {
 
 	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "User1Mailbox"}, state1)
 	response1 := conn.GetWrittenData()
-	if !strings.Contains(response1, "A001 OK CREATE completed") {
+	if !createCompleted(response1, "A001") {
 		t.Errorf("Expected successful creation for user1, got: %s", response1)
 	}
 
@@ -248,7 +255,7 @@ func TestCreateCommand_MultipleUsers(t *testing.T) {
 
 	srv.HandleCreate(conn, "A002", []string{"A002", "CREATE", "User1Mailbox"}, state2)
 	response2 := conn.GetWrittenData()
-	if !strings.Contains(response2, "A002 OK CREATE completed") {
+	if !createCompleted(response2, "A002") {
 		t.Errorf("Expected successful creation for user2 with same mailbox name, got: %s", response2)
 	}
 }
@@ -262,7 +269,7 @@ func TestCreateCommand_RFCExample(t *testing.T) {
 	// Test the RFC 3501 example: CREATE owatagusiam/
 	srv.HandleCreate(conn, "A003", []string{"A003", "CREATE", "owatagusiam/"}, state)
 	response1 := conn.GetWrittenData()
-	if !strings.Contains(response1, "A003 OK CREATE completed") {
+	if !createCompleted(response1, "A003") {
 		t.Errorf("Expected successful creation of owatagusiam/, got: %s", response1)
 	}
 
@@ -272,7 +279,84 @@ func TestCreateCommand_RFCExample(t *testing.T) {
 	// Test the RFC 3501 example: CREATE owatagusiam/blurdybloop
 	srv.HandleCreate(conn, "A004", []string{"A004", "CREATE", "owatagusiam/blurdybloop"}, state)
 	response2 := conn.GetWrittenData()
-	if !strings.Contains(response2, "A004 OK CREATE completed") {
+	if !createCompleted(response2, "A004") {
 		t.Errorf("Expected successful creation of owatagusiam/blurdybloop, got: %s", response2)
 	}
 }
+
+// TestCreateCommand_SpecialUse tests CREATE with the USE parameter (RFC 6154)
+func TestCreateCommand_SpecialUse(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Everything", "(USE", `(\All))`}, state)
+	if response := conn.GetWrittenData(); !createCompleted(response, "A001") {
+		t.Errorf("Expected successful creation, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "A002", []string{"A002", "LIST", `""`, `"Everything"`}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* LIST (\All) "/" "Everything"`) {
+		t.Errorf("Expected \\All attribute, got: %s", response)
+	}
+}
+
+// TestCreateCommand_SpecialUseInvalid tests CREATE with an unknown special-use attribute
+func TestCreateCommand_SpecialUseInvalid(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Stuff", "(USE", `(\Important))`}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "A001 NO [USEATTR]") {
+		t.Errorf("Expected NO [USEATTR], got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleCreate(conn, "A002", []string{"A002", "CREATE", "Stuff", "(FOO", "BAR)"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "A002 BAD") {
+		t.Errorf("Expected BAD for unknown CREATE parameter, got: %s", response)
+	}
+}
+
+// TestCreateCommand_ModifiedUTF7 tests that names from legacy clients are stored
+// as UTF-8 and shown to each client in its own encoding
+func TestCreateCommand_ModifiedUTF7(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	legacy := server.SetupAuthenticatedState(t, srv, "testuser")
+	utf8Client := server.SetupAuthenticatedState(t, srv, "testuser")
+	utf8Client.UTF8Enabled = true
+
+	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", `"&AMk-t&AOk-"`}, legacy)
+	if response := conn.GetWrittenData(); !createCompleted(response, "A001") {
+		t.Fatalf("Expected successful creation, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "A002", []string{"A002", "LIST", `""`, `"*"`}, utf8Client)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `"/" "Été"`) {
+		t.Errorf("Expected the UTF-8 name for UTF8=ACCEPT clients, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleStatus(conn, "A003", []string{"A003", "STATUS", "Été", "(MESSAGES)"}, utf8Client)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* STATUS "Été" (MESSAGES 0)`) {
+		t.Errorf("Expected STATUS by UTF-8 name, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleRename(conn, "A004", []string{"A004", "RENAME", "&AMk-t&AOk-", "R&-D"}, legacy)
+	srv.HandleList(conn, "A005", []string{"A005", "LIST", `""`, `"*"`}, legacy)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "A004 OK") || !strings.Contains(response, `"/" "R&-D"`) {
+		t.Errorf("Expected the renamed mailbox in modified UTF-7, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleCreate(conn, "A006", []string{"A006", "CREATE", "R&D"}, legacy)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "A006 BAD") {
+		t.Errorf("Expected BAD for invalid modified UTF-7, got: %s", response)
+	}
+}
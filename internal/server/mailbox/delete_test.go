@@ -109,7 +109,7 @@ func TestDeleteCommand_ValidMailbox(t *testing.T) {
 	// First create a mailbox
 	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "TestDelete"}, state)
 	createResponse := conn.GetWrittenData()
-	if !strings.Contains(createResponse, "A001 OK CREATE completed") {
+	if !createCompleted(createResponse, "A001") {
 		t.Errorf("Expected successful creation, got: %s", createResponse)
 	}
 
@@ -133,7 +133,7 @@ func TestDeleteCommand_QuotedMailboxName(t *testing.T) {
 	// Create a mailbox with quoted name
 	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "\"My Projects\""}, state)
 	createResponse := conn.GetWrittenData()
-	if !strings.Contains(createResponse, "A001 OK CREATE completed") {
+	if !createCompleted(createResponse, "A001") {
 		t.Errorf("Expected successful creation of quoted mailbox, got: %s", createResponse)
 	}
 
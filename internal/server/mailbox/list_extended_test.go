@@ -341,3 +341,112 @@ func TestListCommand_SpecialCharacters(t *testing.T) {
 		})
 	}
 }
+
+// TestListExtended_SubscribedRecursiveMatch tests LIST (SUBSCRIBED RECURSIVEMATCH) from RFC 5258
+func TestListExtended_SubscribedRecursiveMatch(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Projects/Raven"}, state)
+	srv.HandleSubscribe(conn, "A002", []string{"A002", "SUBSCRIBE", "Projects/Raven"}, state)
+	srv.HandleSubscribe(conn, "A003", []string{"A003", "SUBSCRIBE", "Sent"}, state)
+	conn.ClearWriteBuffer()
+
+	srv.HandleList(conn, "A004", []string{"A004", "LIST", "(SUBSCRIBED", "RECURSIVEMATCH)", `""`, `"%"`}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* LIST (\Sent \Subscribed) "/" "Sent"`) {
+		t.Errorf("Expected subscribed Sent, got: %s", response)
+	}
+	if !strings.Contains(response, `"Projects" ("CHILDINFO" ("SUBSCRIBED"))`) {
+		t.Errorf("Expected CHILDINFO for Projects, got: %s", response)
+	}
+	if strings.Contains(response, `"Drafts"`) {
+		t.Errorf("Unsubscribed mailboxes must not be listed, got: %s", response)
+	}
+	if !strings.Contains(response, "A004 OK LIST completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+}
+
+// TestListExtended_RecursiveMatchAlone tests that RECURSIVEMATCH needs another selection option
+func TestListExtended_RecursiveMatchAlone(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	srv.HandleList(conn, "A001", []string{"A001", "LIST", "(RECURSIVEMATCH)", `""`, `"*"`}, state)
+
+	if response := conn.GetWrittenData(); !strings.Contains(response, "A001 BAD") {
+		t.Errorf("Expected BAD for RECURSIVEMATCH alone, got: %s", response)
+	}
+}
+
+// TestListExtended_MultiplePatterns tests a parenthesized list of patterns
+func TestListExtended_MultiplePatterns(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	srv.HandleList(conn, "A001", []string{"A001", "LIST", `""`, `("INBOX"`, `"Dr*")`}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `"INBOX"`) || !strings.Contains(response, `"Drafts"`) {
+		t.Errorf("Expected INBOX and Drafts, got: %s", response)
+	}
+	if strings.Contains(response, `"Sent"`) || strings.Contains(response, `"Trash"`) {
+		t.Errorf("Unexpected mailbox in response: %s", response)
+	}
+}
+
+// TestListExtended_ReturnChildren tests the CHILDREN return option
+func TestListExtended_ReturnChildren(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Work/Reports"}, state)
+	conn.ClearWriteBuffer()
+
+	srv.HandleList(conn, "A002", []string{"A002", "LIST", `""`, `"Work*"`, "RETURN", "(CHILDREN)"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* LIST (\Unmarked \HasChildren) "/" "Work"`) {
+		t.Errorf("Expected \\HasChildren for Work, got: %s", response)
+	}
+	if !strings.Contains(response, `* LIST (\Unmarked \HasNoChildren) "/" "Work/Reports"`) {
+		t.Errorf("Expected \\HasNoChildren for Work/Reports, got: %s", response)
+	}
+}
+
+// TestListExtended_ReturnStatus tests LIST-STATUS (RFC 5819)
+func TestListExtended_ReturnStatus(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	database := server.GetDatabaseFromServer(srv)
+	server.CreateTestUser(t, database, "testuser")
+	server.InsertTestMail(t, database, "testuser", "Message 1", "sender@example.com", "testuser@example.com", "INBOX")
+	server.InsertTestMail(t, database, "testuser", "Message 2", "sender@example.com", "testuser@example.com", "INBOX")
+
+	srv.HandleList(conn, "A001", []string{"A001", "LIST", `""`, `"INBOX"`, "RETURN", "(CHILDREN", "STATUS", "(MESSAGES", "UNSEEN))"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* LIST (\Unmarked \HasNoChildren) "/" "INBOX"`) {
+		t.Errorf("Expected LIST response for INBOX, got: %s", response)
+	}
+	if !strings.Contains(response, `* STATUS "INBOX" (MESSAGES 2 UNSEEN 2)`) {
+		t.Errorf("Expected inline STATUS for INBOX, got: %s", response)
+	}
+	if !strings.Contains(response, "A001 OK LIST completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "A002", []string{"A002", "LIST", `""`, `"*"`, "RETURN", "(STATUS", "(BOGUS))"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "A002 BAD") {
+		t.Errorf("Expected BAD for unknown status item, got: %s", response)
+	}
+}
@@ -372,3 +372,89 @@ func TestListCommand_ReferenceHandling(t *testing.T) {
 		t.Errorf("Expected OK completion, got: %s", response)
 	}
 }
+
+// TestListCommand_SpecialUseFromDatabase tests that attributes come from the stored special-use value
+func TestListCommand_SpecialUseFromDatabase(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	// A localized archive folder is only recognizable through its special-use attribute
+	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Archiv", "(USE", `(\Archive))`}, state)
+	conn.ClearWriteBuffer()
+
+	srv.HandleList(conn, "A002", []string{"A002", "LIST", `""`, `"*"`}, state)
+
+	response := conn.GetWrittenData()
+	for _, expected := range []string{
+		`* LIST (\Archive) "/" "Archiv"`,
+		`* LIST (\Junk) "/" "Spam"`,
+		`* LIST (\Unmarked) "/" "INBOX"`,
+	} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Expected %s, got: %s", expected, response)
+		}
+	}
+}
+
+// TestListCommand_SpecialUseSelection tests the LIST (SPECIAL-USE) selection option
+func TestListCommand_SpecialUseSelection(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Projects"}, state)
+	conn.ClearWriteBuffer()
+
+	srv.HandleList(conn, "A002", []string{"A002", "LIST", "(SPECIAL-USE)", `""`, `"*"`}, state)
+
+	response := conn.GetWrittenData()
+	for _, expected := range []string{`"Sent"`, `"Drafts"`, `"Trash"`, `"Spam"`} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Expected special-use mailbox %s, got: %s", expected, response)
+		}
+	}
+	if strings.Contains(response, `"INBOX"`) || strings.Contains(response, `"Projects"`) {
+		t.Errorf("Mailboxes without special use must not be listed, got: %s", response)
+	}
+	if !strings.Contains(response, "A002 OK LIST completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "A003", []string{"A003", "LIST", `""`, `"*"`, "RETURN", "(SPECIAL-USE)"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* LIST (\Sent) "/" "Sent"`) || !strings.Contains(response, "A003 OK LIST completed") {
+		t.Errorf("Expected RETURN (SPECIAL-USE) to be accepted, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "A004", []string{"A004", "LIST", "(BOGUS)", `""`, `"*"`}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "A004 BAD") {
+		t.Errorf("Expected BAD for unknown selection option, got: %s", response)
+	}
+}
+
+// TestListCommand_UTF8Names tests that non-ASCII names are sent in modified UTF-7
+// unless the client enabled UTF8=ACCEPT
+func TestListCommand_UTF8Names(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	srv.HandleEnable(conn, "A001", []string{"A001", "ENABLE", "UTF8=ACCEPT"}, state)
+	srv.HandleCreate(conn, "A002", []string{"A002", "CREATE", "සිංහල"}, state)
+
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "A003", []string{"A003", "LIST", `""`, `"*"`}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `"/" "සිංහල"`) {
+		t.Errorf("Expected the UTF-8 name, got: %s", response)
+	}
+
+	legacy := server.SetupAuthenticatedState(t, srv, "testuser")
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "A004", []string{"A004", "LIST", `""`, `"*"`}, legacy)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `"/" "&DcMN0g2CDcQNvQ-"`) || strings.Contains(response, "සිංහල") {
+		t.Errorf("Expected the modified UTF-7 name for legacy clients, got: %s", response)
+	}
+}
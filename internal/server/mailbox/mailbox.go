@@ -2,6 +2,7 @@ package mailbox
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
@@ -16,35 +17,73 @@ import (
 type ServerDeps interface {
 	SendResponse(conn net.Conn, response string)
 	GetUserDB(email string) (*sql.DB, error)
+	GetUserRoles(email string) []string
+	GetSharedDB() *sql.DB
+	GetDBManager() *db.DBManager
 	GetS3Storage() *blobstorage.S3BlobStorage
 }
 
 // ===== LIST =====
 
+// HandleList implements LIST with the extended grammar from RFC 5258 (LIST-EXTENDED),
+// RFC 5819 (LIST-STATUS) and RFC 6154 (SPECIAL-USE):
+//
+//	LIST [(selection-options)] reference (pattern | (pattern ...)) [RETURN (return-options)]
 func HandleList(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
 	if !state.Authenticated {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
 		return
 	}
 
-	// Parse arguments according to RFC 3501
-	if len(parts) < 4 {
+	// Parse selection options, reference and patterns
+	opts, args, err := parseListOptions(parts[min(2, len(parts)):])
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %s", tag, err.Error()))
+		return
+	}
+
+	if len(args) < 2 {
 		deps.SendResponse(conn, fmt.Sprintf("%s BAD LIST command requires reference and mailbox arguments", tag))
 		return
 	}
 
-	reference := utils.ParseQuotedString(parts[2])
-	mailboxPattern := utils.ParseQuotedString(parts[3])
+	reference, err := utils.ParseMailboxName(args[0], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
+	patterns, args, err := parseListPatterns(args[1:])
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %s", tag, err.Error()))
+		return
+	}
+	for i, pattern := range patterns {
+		if patterns[i], err = utils.ParseMailboxName(pattern, state); err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox pattern", tag))
+			return
+		}
+	}
+
+	if err := parseListReturnOptions(args, &opts); err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %s", tag, err.Error()))
+		return
+	}
+
+	// IMAP4rev2 LIST always reports whether a mailbox has children
+	// (RFC 9051 Section 7.3.1)
+	if state.IMAP4rev2Enabled {
+		opts.returnChildren = true
+	}
 
 	// Handle special case: empty mailbox name to get hierarchy delimiter
-	if mailboxPattern == "" {
+	if len(patterns) == 1 && patterns[0] == "" {
 		// Return hierarchy delimiter and root name
 		hierarchyDelimiter := "/"
 		rootName := reference
 		if reference == "" {
 			rootName = ""
 		}
-		deps.SendResponse(conn, fmt.Sprintf("* LIST (\\Noselect) \"%s\" \"%s\"", hierarchyDelimiter, rootName))
+		deps.SendResponse(conn, fmt.Sprintf("* LIST (\\Noselect) \"%s\" \"%s\"", hierarchyDelimiter, utils.ClientMailboxName(rootName, state)))
 		deps.SendResponse(conn, fmt.Sprintf("%s OK LIST completed", tag))
 		return
 	}
@@ -63,18 +102,292 @@ func HandleList(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 		return
 	}
 
-	// Apply reference and pattern matching
-	matches := utils.FilterMailboxes(mailboxes, reference, mailboxPattern)
+	// Mailboxes shared by other users appear under "Other Users/<owner>/"
+	mailboxes = append(mailboxes, delegatedMailboxes(deps, state.Email)...)
+
+	// Mailboxes of the user's roles appear under "Shared/<role>/"
+	mailboxes = append(mailboxes, roleMailboxes(deps, state.Email)...)
+
+	// Special-use attributes are stored per mailbox so they survive renames
+	// and work for mailboxes that are not named in English
+	specialUses, err := db.GetMailboxSpecialUsesPerUser(userDB)
+	if err != nil {
+		specialUses = map[string]string{}
+	}
+
+	existing := make(map[string]bool, len(mailboxes))
+	for _, name := range mailboxes {
+		existing[name] = true
+	}
+
+	subscribed := make(map[string]bool)
+	var subscriptions []string
+	if opts.subscribed || opts.returnSubscribed {
+		subscriptions, err = db.GetUserSubscriptionsPerUser(userDB)
+		if err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO LIST failure: can't list subscriptions", tag))
+			return
+		}
+		for _, name := range subscriptions {
+			subscribed[name] = true
+		}
+	}
+
+	// The SUBSCRIBED selection option lists subscriptions, which may no longer exist
+	candidates := mailboxes
+	if opts.subscribed {
+		candidates = subscriptions
+	}
+
+	// Apply reference and pattern matching for every pattern
+	matches := matchListPatterns(candidates, reference, patterns)
+
+	// RECURSIVEMATCH: report parents that do not match the selection criteria
+	// themselves but have descendants that do
+	childInfo := make(map[string]bool)
+	if opts.recursiveMatch {
+		selected := make(map[string]bool, len(matches))
+		for _, name := range matches {
+			selected[name] = true
+		}
+		seen := make(map[string]bool)
+		var parents []string
+		for _, name := range candidates {
+			if opts.specialUse && !utils.HasSpecialUseAttribute(specialUses[name]) {
+				continue
+			}
+			for _, parent := range mailboxParents(name) {
+				if !selected[parent] && !seen[parent] {
+					seen[parent] = true
+					parents = append(parents, parent)
+				}
+			}
+		}
+		for _, parent := range matchListPatterns(parents, reference, patterns) {
+			childInfo[parent] = true
+			matches = append(matches, parent)
+		}
+	}
 
 	// Return matching mailboxes
 	for _, mailboxName := range matches {
-		attrs := utils.GetMailboxAttributes(mailboxName)
-		deps.SendResponse(conn, fmt.Sprintf("* LIST (%s) \"/\" \"%s\"", attrs, mailboxName))
+		if !childInfo[mailboxName] && opts.specialUse && !utils.HasSpecialUseAttribute(specialUses[mailboxName]) {
+			continue
+		}
+
+		var attrs []string
+		if existing[mailboxName] {
+			attrs = append(attrs, utils.GetMailboxAttributesWithSpecialUse(mailboxName, specialUses[mailboxName]))
+		} else {
+			attrs = append(attrs, "\\NonExistent")
+		}
+		if opts.returnChildren && existing[mailboxName] {
+			if hasChildMailbox(mailboxes, mailboxName) {
+				attrs = append(attrs, "\\HasChildren")
+			} else {
+				attrs = append(attrs, "\\HasNoChildren")
+			}
+		}
+		if (opts.subscribed || opts.returnSubscribed) && subscribed[mailboxName] {
+			attrs = append(attrs, "\\Subscribed")
+		}
+
+		response := fmt.Sprintf("* LIST (%s) \"/\" \"%s\"", strings.Join(attrs, " "), utils.ClientMailboxName(mailboxName, state))
+		if childInfo[mailboxName] {
+			response += fmt.Sprintf(" (\"CHILDINFO\" (%s))", opts.childInfoCriteria())
+		}
+		deps.SendResponse(conn, response)
+
+		// LIST-STATUS: STATUS is only returned for mailboxes that can be selected
+		if len(opts.returnStatus) > 0 && existing[mailboxName] {
+			access, err := utils.ResolveMailboxAccess(deps, state.Email, mailboxName)
+			if err != nil || !utils.HasRights(access.Rights, "r") {
+				continue
+			}
+			items, err := mailboxStatusItems(access.DB, access.MailboxID, opts.returnStatus)
+			if err == nil {
+				deps.SendResponse(conn, fmt.Sprintf("* STATUS \"%s\" (%s)", utils.ClientMailboxName(mailboxName, state), items))
+			}
+		}
 	}
 
 	deps.SendResponse(conn, fmt.Sprintf("%s OK LIST completed", tag))
 }
 
+// listOptions holds the extended LIST selection and return options
+type listOptions struct {
+	// Selection options
+	subscribed     bool // Only subscribed mailboxes
+	recursiveMatch bool // Also report parents whose children match the other options
+	specialUse     bool // Only mailboxes with a special-use attribute
+
+	// Return options
+	returnSubscribed bool     // Include the \Subscribed attribute
+	returnChildren   bool     // Include \HasChildren / \HasNoChildren
+	returnStatus     []string // STATUS data items to return for each mailbox
+}
+
+// childInfoCriteria returns the CHILDINFO extended data for RECURSIVEMATCH results
+func (o listOptions) childInfoCriteria() string {
+	var criteria []string
+	if o.subscribed {
+		criteria = append(criteria, "\"SUBSCRIBED\"")
+	}
+	if o.specialUse {
+		criteria = append(criteria, "\"SPECIAL-USE\"")
+	}
+	return strings.Join(criteria, " ")
+}
+
+// parseListOptions parses an optional leading selection option list and
+// returns the remaining arguments (reference, patterns and return options)
+func parseListOptions(args []string) (listOptions, []string, error) {
+	var opts listOptions
+	if len(args) == 0 || !strings.HasPrefix(args[0], "(") {
+		return opts, args, nil
+	}
+
+	content, rest, err := utils.ParseParenthesizedList(args)
+	if err != nil {
+		return opts, args, fmt.Errorf("invalid LIST selection options")
+	}
+
+	for _, option := range strings.Fields(content) {
+		switch strings.ToUpper(option) {
+		case "SUBSCRIBED":
+			opts.subscribed = true
+		case "RECURSIVEMATCH":
+			opts.recursiveMatch = true
+		case "SPECIAL-USE":
+			opts.specialUse = true
+		case "REMOTE":
+			// No remote mailboxes on this server, nothing to add
+		default:
+			return opts, args, fmt.Errorf("unsupported LIST selection option %s", option)
+		}
+	}
+
+	// RFC 5258: RECURSIVEMATCH must be combined with another selection option
+	if opts.recursiveMatch && !opts.subscribed && !opts.specialUse {
+		return opts, args, fmt.Errorf("RECURSIVEMATCH requires another selection option")
+	}
+
+	// The SUBSCRIBED selection option implies the SUBSCRIBED return option
+	if opts.subscribed {
+		opts.returnSubscribed = true
+	}
+
+	return opts, rest, nil
+}
+
+// parseListPatterns parses a single mailbox pattern or a parenthesized list of patterns
+func parseListPatterns(args []string) ([]string, []string, error) {
+	if !strings.HasPrefix(args[0], "(") {
+		return []string{utils.ParseQuotedString(args[0])}, args[1:], nil
+	}
+
+	content, rest, err := utils.ParseParenthesizedList(args)
+	if err != nil {
+		return nil, args, fmt.Errorf("invalid LIST mailbox patterns")
+	}
+
+	var patterns []string
+	for _, pattern := range strings.Fields(content) {
+		patterns = append(patterns, utils.ParseQuotedString(pattern))
+	}
+	if len(patterns) == 0 {
+		return nil, args, fmt.Errorf("LIST requires at least one mailbox pattern")
+	}
+
+	return patterns, rest, nil
+}
+
+// parseListReturnOptions parses a trailing "RETURN (...)" option list
+func parseListReturnOptions(args []string, opts *listOptions) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	if strings.ToUpper(args[0]) != "RETURN" || len(args) < 2 {
+		return fmt.Errorf("invalid LIST arguments")
+	}
+
+	content, rest, err := utils.ParseParenthesizedList(args[1:])
+	if err != nil || len(rest) > 0 {
+		return fmt.Errorf("invalid LIST return options")
+	}
+
+	fields := strings.Fields(content)
+	for i := 0; i < len(fields); i++ {
+		switch strings.ToUpper(fields[i]) {
+		case "SUBSCRIBED":
+			opts.returnSubscribed = true
+		case "CHILDREN":
+			opts.returnChildren = true
+		case "SPECIAL-USE":
+			// Special-use attributes are always included in LIST responses
+		case "STATUS":
+			items, remaining, err := utils.ParseParenthesizedList(fields[i+1:])
+			if err != nil {
+				return fmt.Errorf("invalid LIST STATUS return option")
+			}
+			opts.returnStatus = strings.Fields(strings.ToUpper(items))
+			for _, item := range opts.returnStatus {
+				if !isStatusItem(item) {
+					return fmt.Errorf("unknown status data item: %s", item)
+				}
+			}
+			i = len(fields) - len(remaining) - 1
+		default:
+			return fmt.Errorf("unsupported LIST return option %s", fields[i])
+		}
+	}
+
+	return nil
+}
+
+// matchListPatterns returns the candidates that match any of the patterns,
+// in candidate order and without duplicates. Names outside the candidates
+// (such as the INBOX that FilterMailboxes always adds) are dropped.
+func matchListPatterns(candidates []string, reference string, patterns []string) []string {
+	matched := make(map[string]bool)
+	for _, pattern := range patterns {
+		for _, name := range utils.FilterMailboxes(candidates, reference, pattern) {
+			matched[name] = true
+		}
+	}
+
+	var matches []string
+	for _, name := range candidates {
+		if matched[name] {
+			matches = append(matches, name)
+			delete(matched, name)
+		}
+	}
+
+	return matches
+}
+
+// mailboxParents returns the ancestors of a hierarchical mailbox name
+func mailboxParents(name string) []string {
+	var parents []string
+	for i := strings.LastIndex(name, "/"); i > 0; i = strings.LastIndex(name[:i], "/") {
+		parents = append(parents, name[:i])
+	}
+	return parents
+}
+
+// hasChildMailbox checks if any mailbox is an inferior of the given name
+func hasChildMailbox(mailboxes []string, name string) bool {
+	prefix := name + "/"
+	for _, mailbox := range mailboxes {
+		if strings.HasPrefix(mailbox, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // ===== LSUB =====
 
 func HandleLsub(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
@@ -90,8 +403,16 @@ func HandleLsub(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 		return
 	}
 
-	reference := utils.ParseQuotedString(parts[2])
-	mailboxPattern := utils.ParseQuotedString(parts[3])
+	reference, err := utils.ParseMailboxName(parts[2], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
+	mailboxPattern, err := utils.ParseMailboxName(parts[3], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
 
 	// Handle special case: empty mailbox name to get hierarchy delimiter
 	if mailboxPattern == "" {
@@ -101,7 +422,7 @@ func HandleLsub(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 		if reference == "" {
 			rootName = ""
 		}
-		deps.SendResponse(conn, fmt.Sprintf("* LSUB (\\Noselect) \"%s\" \"%s\"", hierarchyDelimiter, rootName))
+		deps.SendResponse(conn, fmt.Sprintf("* LSUB (\\Noselect) \"%s\" \"%s\"", hierarchyDelimiter, utils.ClientMailboxName(rootName, state)))
 		deps.SendResponse(conn, fmt.Sprintf("%s OK LSUB completed", tag))
 		return
 	}
@@ -168,13 +489,18 @@ func HandleLsub(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 
 	// Send implied parents with \Noselect first
 	for parent := range impliedParents {
-		deps.SendResponse(conn, fmt.Sprintf("* LSUB (\\Noselect) \"/\" \"%s\"", parent))
+		deps.SendResponse(conn, fmt.Sprintf("* LSUB (\\Noselect) \"/\" \"%s\"", utils.ClientMailboxName(parent, state)))
+	}
+
+	specialUses, err := db.GetMailboxSpecialUsesPerUser(userDB)
+	if err != nil {
+		specialUses = map[string]string{}
 	}
 
 	// Send actual subscribed mailboxes
 	for _, mailboxName := range matches {
-		attrs := utils.GetMailboxAttributes(mailboxName)
-		deps.SendResponse(conn, fmt.Sprintf("* LSUB (%s) \"/\" \"%s\"", attrs, mailboxName))
+		attrs := utils.GetMailboxAttributesWithSpecialUse(mailboxName, specialUses[mailboxName])
+		deps.SendResponse(conn, fmt.Sprintf("* LSUB (%s) \"/\" \"%s\"", attrs, utils.ClientMailboxName(mailboxName, state)))
 	}
 
 	deps.SendResponse(conn, fmt.Sprintf("%s OK LSUB completed", tag))
@@ -193,8 +519,23 @@ func HandleCreate(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
-	// Parse mailbox name (could be quoted)
-	mailboxName := strings.Trim(parts[2], "\"")
+	// Parse mailbox name (could be quoted, in modified UTF-7)
+	mailboxName, err := utils.ParseMailboxName(parts[2], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
+
+	// Parse optional CREATE-SPECIAL-USE parameter (RFC 6154): CREATE name (USE (\Archive))
+	specialUse := ""
+	if len(parts) > 3 {
+		use, failure := parseCreateSpecialUse(parts[3:])
+		if failure != "" {
+			deps.SendResponse(conn, fmt.Sprintf("%s %s", tag, failure))
+			return
+		}
+		specialUse = use
+	}
 
 	// Remove trailing hierarchy separator if present
 	// According to RFC 3501, the name created is without the trailing hierarchy delimiter
@@ -212,13 +553,23 @@ func HandleCreate(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
-	// Get user database
-	userDB, err := deps.GetUserDB(state.Email)
+	// Get the database of the account the mailbox belongs to
+	userDB, mailboxName, owner, err := accountForMailbox(deps, state.Email, mailboxName)
 	if err != nil {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
 		return
 	}
 
+	// RFC 4314: creating a mailbox in another user's account requires the
+	// "k" right on its parent
+	if owner != "" {
+		parent := parentMailbox(mailboxName)
+		if parent == "" || !hasRightsOn(userDB, parent, state.Email, "k") {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+			return
+		}
+	}
+
 	// Check if mailbox already exists
 	exists, err := db.MailboxExistsPerUser(userDB, mailboxName)
 	if err != nil {
@@ -231,6 +582,12 @@ func HandleCreate(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
+	// RFC 9208: enforce the MAILBOX resource limit
+	if errors.Is(db.CheckQuotaPerUser(userDB, 0, 0, 1), db.ErrOverQuota) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [OVERQUOTA] Mailbox limit reached", tag))
+		return
+	}
+
 	// Handle hierarchy creation
 	// If the mailbox name contains hierarchy separators, create parent mailboxes if needed
 	if strings.Contains(mailboxName, "/") {
@@ -259,7 +616,7 @@ func HandleCreate(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 	}
 
 	// Create the target mailbox
-	_, err = db.CreateMailboxPerUser(userDB, mailboxName, "")
+	mailboxID, err := db.CreateMailboxPerUser(userDB, mailboxName, specialUse)
 	if err != nil {
 		if strings.Contains(err.Error(), "already exists") {
 			deps.SendResponse(conn, fmt.Sprintf("%s NO Mailbox already exists", tag))
@@ -269,9 +626,45 @@ func HandleCreate(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
+	deps.GetDBManager().MailboxChanges().Publish(userDB, db.AllMailboxes)
+
+	// RFC 8474 Section 4.1: report the identifier of the new mailbox
+	if objectID, err := db.GetMailboxObjectIDPerUser(userDB, mailboxID); err == nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s OK [MAILBOXID (%s)] CREATE completed", tag, objectID))
+		return
+	}
 	deps.SendResponse(conn, fmt.Sprintf("%s OK CREATE completed", tag))
 }
 
+// parseCreateSpecialUse parses the "(USE (attr ...))" CREATE parameter. It returns
+// the requested special-use attributes, or the tagged response text on failure.
+func parseCreateSpecialUse(args []string) (string, string) {
+	content, rest, err := utils.ParseParenthesizedList(args)
+	if err != nil || len(rest) > 0 {
+		return "", "BAD Invalid CREATE parameters"
+	}
+
+	fields := strings.Fields(content)
+	if len(fields) < 2 || strings.ToUpper(fields[0]) != "USE" {
+		return "", "BAD Unsupported CREATE parameter"
+	}
+
+	useList, rest, err := utils.ParseParenthesizedList(fields[1:])
+	if err != nil || len(rest) > 0 {
+		return "", "BAD Invalid USE parameter"
+	}
+
+	var attrs []string
+	for _, attr := range strings.Fields(useList) {
+		if !utils.IsSpecialUseAttribute(attr) {
+			return "", fmt.Sprintf("NO [USEATTR] Unsupported special-use attribute %s", attr)
+		}
+		attrs = append(attrs, utils.NormalizeSpecialUseAttribute(attr))
+	}
+
+	return strings.Join(attrs, " "), ""
+}
+
 // ===== DELETE =====
 
 func HandleDelete(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
@@ -285,8 +678,12 @@ func HandleDelete(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
-	// Parse mailbox name (could be quoted)
-	mailboxName := strings.Trim(parts[2], "\"")
+	// Parse mailbox name (could be quoted, in modified UTF-7)
+	mailboxName, err := utils.ParseMailboxName(parts[2], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
 
 	// Validate mailbox name
 	if mailboxName == "" {
@@ -300,13 +697,19 @@ func HandleDelete(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
-	// Get user database
-	userDB, err := deps.GetUserDB(state.Email)
+	// Get the database of the account the mailbox belongs to
+	userDB, mailboxName, owner, err := accountForMailbox(deps, state.Email, mailboxName)
 	if err != nil {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
 		return
 	}
 
+	// RFC 4314: deleting another user's mailbox requires the "x" right
+	if owner != "" && !hasRightsOn(userDB, mailboxName, state.Email, "x") {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+
 	// Attempt to delete the mailbox
 	err = db.DeleteMailboxPerUser(userDB, mailboxName)
 	if err != nil {
@@ -322,6 +725,8 @@ func HandleDelete(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
+	deps.GetDBManager().MailboxChanges().Publish(userDB, db.AllMailboxes)
+
 	deps.SendResponse(conn, fmt.Sprintf("%s OK DELETE completed", tag))
 }
 
@@ -339,8 +744,16 @@ func HandleRename(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 	}
 
 	// Parse mailbox names (could be quoted)
-	oldName := strings.Trim(parts[2], "\"")
-	newName := strings.Trim(parts[3], "\"")
+	oldName, err := utils.ParseMailboxName(parts[2], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox names", tag))
+		return
+	}
+	newName, err := utils.ParseMailboxName(parts[3], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox names", tag))
+		return
+	}
 
 	// Validate mailbox names
 	if oldName == "" || newName == "" {
@@ -348,13 +761,32 @@ func HandleRename(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
-	// Get user database
-	userDB, err := deps.GetUserDB(state.Email)
+	// Get the database of the account the mailboxes belong to
+	userDB, oldName, owner, err := accountForMailbox(deps, state.Email, oldName)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+	_, newName, newOwner, err := accountForMailbox(deps, state.Email, newName)
 	if err != nil {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
 		return
 	}
 
+	// Mailboxes cannot be moved between accounts. Within another user's account,
+	// RFC 4314 requires "x" on the old name and "k" on the new parent.
+	if owner != newOwner {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [CANNOT] Cannot rename mailboxes between accounts", tag))
+		return
+	}
+	if owner != "" {
+		parent := parentMailbox(newName)
+		if !hasRightsOn(userDB, oldName, state.Email, "x") || parent == "" || !hasRightsOn(userDB, parent, state.Email, "k") {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+			return
+		}
+	}
+
 	// Attempt to rename the mailbox
 	err = db.RenameMailboxPerUser(userDB, oldName, newName)
 	if err != nil {
@@ -370,6 +802,8 @@ func HandleRename(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
+	deps.GetDBManager().MailboxChanges().Publish(userDB, db.AllMailboxes)
+
 	deps.SendResponse(conn, fmt.Sprintf("%s OK RENAME completed", tag))
 }
 
@@ -387,11 +821,11 @@ func HandleSubscribe(deps ServerDeps, conn net.Conn, tag string, parts []string,
 		return
 	}
 
-	mailboxName := parts[2]
-
-	// Remove quotes if present
-	if len(mailboxName) >= 2 && mailboxName[0] == '"' && mailboxName[len(mailboxName)-1] == '"' {
-		mailboxName = mailboxName[1 : len(mailboxName)-1]
+	// Remove quotes if present and decode modified UTF-7
+	mailboxName, err := utils.ParseMailboxName(parts[2], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
 	}
 
 	// Validate mailbox name
@@ -415,6 +849,8 @@ func HandleSubscribe(deps ServerDeps, conn net.Conn, tag string, parts []string,
 		return
 	}
 
+	deps.GetDBManager().MailboxChanges().Publish(userDB, db.AllMailboxes)
+
 	deps.SendResponse(conn, fmt.Sprintf("%s OK SUBSCRIBE completed", tag))
 }
 
@@ -431,11 +867,11 @@ func HandleUnsubscribe(deps ServerDeps, conn net.Conn, tag string, parts []strin
 		return
 	}
 
-	mailboxName := parts[2]
-
-	// Remove quotes if present
-	if len(mailboxName) >= 2 && mailboxName[0] == '"' && mailboxName[len(mailboxName)-1] == '"' {
-		mailboxName = mailboxName[1 : len(mailboxName)-1]
+	// Remove quotes if present and decode modified UTF-7
+	mailboxName, err := utils.ParseMailboxName(parts[2], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
 	}
 
 	// Validate mailbox name
@@ -463,6 +899,8 @@ func HandleUnsubscribe(deps ServerDeps, conn net.Conn, tag string, parts []strin
 		return
 	}
 
+	deps.GetDBManager().MailboxChanges().Publish(userDB, db.AllMailboxes)
+
 	deps.SendResponse(conn, fmt.Sprintf("%s OK UNSUBSCRIBE completed", tag))
 }
 
@@ -479,28 +917,34 @@ func HandleStatus(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
-	// Get user database
-	userDB, err := deps.GetUserDB(state.Email)
+	// Parse mailbox name (could be quoted, in modified UTF-7)
+	mailboxName, err := utils.ParseMailboxName(parts[2], state)
 	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
 		return
 	}
 
-	// Parse mailbox name (could be quoted)
-	mailboxName := utils.ParseQuotedString(parts[2])
-
 	// Validate mailbox name
 	if mailboxName == "" {
 		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
 		return
 	}
 
-	// Get mailbox ID using new schema
-	mailboxID, err := db.GetMailboxByNamePerUser(userDB, mailboxName)
-	if err != nil {
+	// Resolve the mailbox, which may belong to another user (RFC 4314)
+	access, err := utils.ResolveMailboxAccess(deps, state.Email, mailboxName)
+	if errors.Is(err, utils.ErrNoSuchMailbox) {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO STATUS failure: no status for that name", tag))
 		return
 	}
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+	if !utils.HasRights(access.Rights, "r") {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+	userDB, mailboxID := access.DB, access.MailboxID
 
 	// Parse status data items - they are enclosed in parentheses
 	// Example: STATUS mailbox (MESSAGES RECENT)
@@ -524,6 +968,36 @@ func HandleStatus(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
+	for _, item := range requestedItems {
+		if !isStatusItem(item) {
+			// Unknown status item - return BAD response
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD Unknown status data item: %s", tag, item))
+			return
+		}
+	}
+
+	responseItems, err := mailboxStatusItems(userDB, mailboxID, requestedItems)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO STATUS failure: %s", tag, err.Error()))
+		return
+	}
+
+	// Send STATUS response
+	deps.SendResponse(conn, fmt.Sprintf("* STATUS \"%s\" (%s)", utils.ClientMailboxName(mailboxName, state), responseItems))
+	deps.SendResponse(conn, fmt.Sprintf("%s OK STATUS completed", tag))
+}
+
+// statusItems lists the supported STATUS data items
+var statusItems = []string{"MESSAGES", "RECENT", "UIDNEXT", "UIDVALIDITY", "UNSEEN", "MAILBOXID", "SIZE", "DELETED", "DELETED-STORAGE"}
+
+// isStatusItem checks if a STATUS data item is supported
+func isStatusItem(item string) bool {
+	return utils.Contains(statusItems, strings.ToUpper(item))
+}
+
+// mailboxStatusItems computes the requested STATUS data items for a mailbox and
+// returns them formatted for a STATUS response. Used by STATUS and LIST-STATUS.
+func mailboxStatusItems(userDB *sql.DB, mailboxID int64, requestedItems []string) (string, error) {
 	// Initialize status values
 	statusValues := make(map[string]int)
 
@@ -546,6 +1020,21 @@ func HandleStatus(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 	statusValues["RECENT"] = recentCount
 	statusValues["UNSEEN"] = unseenCount
 
+	deletedCount, err := db.GetDeletedCountPerUser(userDB, mailboxID)
+	if err != nil {
+		deletedCount = 0
+	}
+	statusValues["DELETED"] = deletedCount
+
+	// Sizes come from the mailbox's size counters (RFC 8438). DELETED-STORAGE
+	// is in the 1024-octet units of the STORAGE quota resource (RFC 9208).
+	totalSize, deletedSize, err := db.GetMailboxSizePerUser(userDB, mailboxID)
+	if err != nil {
+		totalSize, deletedSize = 0, 0
+	}
+	statusValues["SIZE"] = int(totalSize)
+	statusValues["DELETED-STORAGE"] = int((deletedSize + 1023) / 1024)
+
 	// Get mailbox info for UID values
 	uidValidity, uidNext, err := db.GetMailboxInfoPerUser(userDB, mailboxID)
 	if err == nil {
@@ -560,16 +1049,17 @@ func HandleStatus(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 	var responseItems []string
 	for _, item := range requestedItems {
 		itemUpper := strings.ToUpper(item)
-		if value, ok := statusValues[itemUpper]; ok {
-			responseItems = append(responseItems, fmt.Sprintf("%s %d", itemUpper, value))
-		} else {
-			// Unknown status item - return BAD response
-			deps.SendResponse(conn, fmt.Sprintf("%s BAD Unknown status data item: %s", tag, item))
-			return
+		if itemUpper == "MAILBOXID" {
+			// RFC 8474 Section 4.2: MAILBOXID is a parenthesized objectid
+			responseItems = append(responseItems, fmt.Sprintf("MAILBOXID (%s)", db.MailboxObjectID(mailboxID, int64(statusValues["UIDVALIDITY"]))))
+			continue
 		}
+		value, ok := statusValues[itemUpper]
+		if !ok {
+			return "", fmt.Errorf("unknown status data item: %s", item)
+		}
+		responseItems = append(responseItems, fmt.Sprintf("%s %d", itemUpper, value))
 	}
 
-	// Send STATUS response
-	deps.SendResponse(conn, fmt.Sprintf("* STATUS \"%s\" (%s)", mailboxName, strings.Join(responseItems, " ")))
-	deps.SendResponse(conn, fmt.Sprintf("%s OK STATUS completed", tag))
+	return strings.Join(responseItems, " "), nil
 }
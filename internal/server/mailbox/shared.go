@@ -0,0 +1,35 @@
+package mailbox
+
+import (
+	"raven/internal/db"
+	"raven/internal/server/utils"
+)
+
+// ===== Shared namespace =====
+//
+// Role addresses such as admin@<domain> are delivered into role_<name>@<domain>.db
+// accounts. Every user holding the role in the identity provider sees the
+// role's mailboxes under "Shared/<role>/".
+
+// roleMailboxes returns the "Shared" names of the mailboxes of the user's roles
+func roleMailboxes(deps ServerDeps, email string) []string {
+	var names []string
+	for _, role := range deps.GetUserRoles(email) {
+		account := utils.RoleMailboxIdentity(role, email)
+		if account == "" {
+			continue
+		}
+		roleDB, err := deps.GetUserDB(account)
+		if err != nil {
+			continue
+		}
+		mailboxes, err := db.GetUserMailboxesPerUser(roleDB)
+		if err != nil {
+			continue
+		}
+		for _, name := range mailboxes {
+			names = append(names, utils.SharedMailboxName(role, name))
+		}
+	}
+	return names
+}
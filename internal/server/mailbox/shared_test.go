@@ -0,0 +1,96 @@
+package mailbox_test
+
+import (
+	"strings"
+	"testing"
+
+	"raven/internal/models"
+	"raven/internal/server"
+)
+
+// ===== SHARED NAMESPACE TESTS =====
+
+// setupRoleMailbox creates a user holding the "admin" role and delivers a
+// message to the role's mailbox
+func setupRoleMailbox(t *testing.T) (*server.TestInterface, *models.ClientState, *models.ClientState) {
+	t.Helper()
+	srv := server.SetupTestServerSimple(t)
+	member := server.SetupAuthenticatedState(t, srv, "clerk")
+	outsider := server.SetupAuthenticatedState(t, srv, "visitor")
+
+	srv.SetRoleResolver(func(email string) ([]string, error) {
+		if email == "clerk@localhost" {
+			return []string{"admin"}, nil
+		}
+		return nil, nil
+	}, 300)
+
+	database := server.GetDatabaseFromServer(srv)
+	server.InsertTestMail(t, database, "role_admin@localhost.db", "Server alert", "monitor@test.com", "admin@localhost", "INBOX")
+
+	return srv, member, outsider
+}
+
+// TestSharedNamespace_ListShowsRoleMailboxes tests that role members see the role's mailboxes
+func TestSharedNamespace_ListShowsRoleMailboxes(t *testing.T) {
+	srv, member, outsider := setupRoleMailbox(t)
+	conn := server.NewMockConn()
+
+	srv.HandleList(conn, "SH01", []string{"SH01", "LIST", `""`, "*"}, member)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `"Shared/admin/INBOX"`) {
+		t.Errorf("Expected the role INBOX in LIST, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleList(conn, "SH02", []string{"SH02", "LIST", `""`, "*"}, outsider)
+	if response := conn.GetWrittenData(); strings.Contains(response, "Shared/") {
+		t.Errorf("Expected no role mailboxes for non-members, got: %s", response)
+	}
+}
+
+// TestSharedNamespace_SelectFetchStore tests that members can read and flag role mail
+func TestSharedNamespace_SelectFetchStore(t *testing.T) {
+	srv, member, _ := setupRoleMailbox(t)
+	conn := server.NewMockConn()
+
+	srv.HandleSelect(conn, "SH03", []string{"SH03", "SELECT", "Shared/admin/INBOX"}, member)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* 1 EXISTS") || !strings.Contains(response, "SH03 OK [READ-WRITE]") {
+		t.Fatalf("Expected read-write selection of the role INBOX, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "SH04", []string{"SH04", "FETCH", "1", "(BODY.PEEK[HEADER.FIELDS (SUBJECT)])"}, member)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "Server alert") {
+		t.Errorf("Expected to read the role's message, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleStore(conn, "SH05", []string{"SH05", "STORE", "1", "+FLAGS", `(\Seen)`}, member)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `\Seen`) || !strings.Contains(response, "SH05 OK") {
+		t.Errorf("Expected STORE to succeed, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleStatus(conn, "SH06", []string{"SH06", "STATUS", "Shared/admin/INBOX", "(MESSAGES UNSEEN)"}, member)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* STATUS "Shared/admin/INBOX" (MESSAGES 1 UNSEEN 0)`) {
+		t.Errorf("Expected STATUS of the role INBOX, got: %s", response)
+	}
+}
+
+// TestSharedNamespace_NonMemberRefused tests that non-members cannot open role mailboxes
+func TestSharedNamespace_NonMemberRefused(t *testing.T) {
+	srv, _, outsider := setupRoleMailbox(t)
+	conn := server.NewMockConn()
+
+	srv.HandleSelect(conn, "SH07", []string{"SH07", "SELECT", "Shared/admin/INBOX"}, outsider)
+	if response := conn.GetWrittenData(); strings.Contains(response, "SH07 OK") {
+		t.Errorf("Expected non-member SELECT to fail, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleCreate(conn, "SH08", []string{"SH08", "CREATE", "Shared/admin/Archive"}, outsider)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "SH08 NO [NOPERM]") {
+		t.Errorf("Expected CREATE in a role account to be refused, got: %s", response)
+	}
+}
@@ -2,6 +2,7 @@ package mailbox_test
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -654,3 +655,78 @@ func TestStatusCommand_CaseInsensitiveItems(t *testing.T) {
 		t.Errorf("Expected OK completion, got: %s", lines[1])
 	}
 }
+
+// TestStatusCommand_MailboxID tests that MAILBOXID is reported by CREATE and
+// STATUS and survives RENAME (RFC 8474)
+func TestStatusCommand_MailboxID(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+	mailboxID := regexp.MustCompile(`MAILBOXID \(([A-Za-z0-9_-]+)\)`)
+
+	srv.HandleCreate(conn, "A001", []string{"A001", "CREATE", "Projects"}, state)
+	created := mailboxID.FindStringSubmatch(conn.GetWrittenData())
+	if created == nil {
+		t.Fatalf("Expected MAILBOXID in CREATE response, got: %s", conn.GetWrittenData())
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleStatus(conn, "A002", []string{"A002", "STATUS", "Projects", "(MESSAGES", "MAILBOXID)"}, state)
+	status := mailboxID.FindStringSubmatch(conn.GetWrittenData())
+	if status == nil || status[1] != created[1] {
+		t.Fatalf("Expected STATUS MAILBOXID %s, got: %s", created[1], conn.GetWrittenData())
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleRename(conn, "A003", []string{"A003", "RENAME", "Projects", "Archive"}, state)
+	srv.HandleStatus(conn, "A004", []string{"A004", "STATUS", "Archive", "(MAILBOXID)"}, state)
+	renamed := mailboxID.FindStringSubmatch(conn.GetWrittenData())
+	if renamed == nil || renamed[1] != created[1] {
+		t.Errorf("Expected MAILBOXID %s after RENAME, got: %s", created[1], conn.GetWrittenData())
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleStatus(conn, "A005", []string{"A005", "STATUS", "INBOX", "(MAILBOXID)"}, state)
+	inbox := mailboxID.FindStringSubmatch(conn.GetWrittenData())
+	if inbox == nil || inbox[1] == created[1] {
+		t.Errorf("Expected INBOX to have its own MAILBOXID, got: %s", conn.GetWrittenData())
+	}
+}
+
+// TestStatusCommand_SizeAndDeleted tests the SIZE (RFC 8438), DELETED and
+// DELETED-STORAGE status items
+func TestStatusCommand_SizeAndDeleted(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	first := "From: a@example.com\r\nSubject: One\r\n\r\nfirst message\r\n"
+	second := "From: a@example.com\r\nSubject: Two\r\n\r\nsecond message, a little longer\r\n"
+	server.InsertTestRawMail(t, database, "testuser", first, "INBOX")
+	server.InsertTestRawMail(t, database, "testuser", second, "INBOX")
+
+	srv.HandleStatus(conn, "A001", []string{"A001", "STATUS", "INBOX", "(SIZE", "DELETED", "DELETED-STORAGE)"}, state)
+	expected := fmt.Sprintf("* STATUS \"INBOX\" (SIZE %d DELETED 0 DELETED-STORAGE 0)", len(first)+len(second))
+	if response := conn.GetWrittenData(); !strings.Contains(response, expected) {
+		t.Fatalf("Expected %q, got: %s", expected, response)
+	}
+
+	srv.HandleSelect(conn, "A002", []string{"A002", "SELECT", "INBOX"}, state)
+	srv.HandleStore(conn, "A003", []string{"A003", "STORE", "2", "+FLAGS", "(\\Deleted)"}, state)
+
+	conn.ClearWriteBuffer()
+	srv.HandleStatus(conn, "A004", []string{"A004", "STATUS", "INBOX", "(DELETED", "DELETED-STORAGE)"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "(DELETED 1 DELETED-STORAGE 1)") {
+		t.Errorf("Expected one deleted message, got: %s", response)
+	}
+
+	srv.HandleExpunge(conn, "A005", state)
+
+	conn.ClearWriteBuffer()
+	srv.HandleStatus(conn, "A006", []string{"A006", "STATUS", "INBOX", "(SIZE", "DELETED)"}, state)
+	expected = fmt.Sprintf("(SIZE %d DELETED 0)", len(first))
+	if response := conn.GetWrittenData(); !strings.Contains(response, expected) {
+		t.Errorf("Expected %q after EXPUNGE, got: %s", expected, response)
+	}
+}
@@ -0,0 +1,78 @@
+package message
+
+import (
+	"database/sql"
+	"strings"
+
+	"raven/internal/db"
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== ACL enforcement (RFC 4314) =====
+
+// SelectedAccountEmail returns the address of the account that holds the
+// selected mailbox, which is the owner's for a mailbox shared by another user
+func SelectedAccountEmail(state *models.ClientState) string {
+	if state.SelectedOwner != "" {
+		return state.SelectedOwner
+	}
+	return resolveStateEmail(state)
+}
+
+// StoreRequiredRights returns the rights needed to STORE the given flags:
+// "s" for \Seen, "t" for \Deleted and "w" for any other flag. Replacing all
+// flags with FLAGS may clear any of them and so needs all three.
+func StoreRequiredRights(dataItem string, flags []string) string {
+	if dataItem == "FLAGS" {
+		return "stw"
+	}
+
+	var required string
+	for _, flag := range flags {
+		switch strings.ToLower(flag) {
+		case "\\seen":
+			required += "s"
+		case "\\deleted":
+			required += "t"
+		default:
+			required += "w"
+		}
+	}
+	return required
+}
+
+// ResolveCopyTarget looks up the destination of COPY or MOVE, as sent by the
+// client, in the account of the selected mailbox. Messages cannot be copied between accounts, and a
+// destination in another account needs the "i" right. On failure it returns
+// the tagged response text.
+func ResolveCopyTarget(targetDB *sql.DB, state *models.ClientState, name string) (int64, string) {
+	name, err := utils.ParseMailboxName(name, state)
+	if err != nil {
+		return 0, "BAD Invalid mailbox name"
+	}
+
+	account, mailbox := utils.MailboxAccount(resolveStateEmail(state), name)
+	if account != state.SelectedOwner {
+		return 0, "NO [CANNOT] Cannot copy messages between accounts"
+	}
+
+	mailboxID, err := db.GetMailboxByNamePerUser(targetDB, mailbox)
+	if err != nil {
+		return 0, "NO [TRYCREATE] Destination mailbox does not exist"
+	}
+
+	// Role members hold the same rights on every mailbox of the role
+	if utils.IsRoleAccount(state.SelectedOwner) {
+		if !utils.HasRights(state.SelectedRights, "i") {
+			return 0, "NO [NOPERM] Permission denied"
+		}
+	} else if state.SelectedOwner != "" {
+		rights, err := db.GetMailboxRightsPerUser(targetDB, mailboxID, resolveStateEmail(state))
+		if err != nil || !utils.HasRights(rights, "i") {
+			return 0, "NO [NOPERM] Permission denied"
+		}
+	}
+
+	return mailboxID, ""
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"raven/internal/db"
 	"raven/internal/models"
 	"raven/internal/server"
 )
@@ -527,3 +528,61 @@ func TestAppendCommand_LiteralPlus(t *testing.T) {
 		t.Errorf("Expected APPENDUID in response, got: %s", response)
 	}
 }
+
+// TestAppendCommand_OverQuota tests that APPEND fails with OVERQUOTA once the storage limit is reached
+func TestAppendCommand_OverQuota(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	userDB, err := server.GetDatabaseFromServer(srv).GetUserDB(state.Email)
+	if err != nil {
+		t.Fatalf("Failed to get user database: %v", err)
+	}
+	if err := db.SetQuotaLimitsPerUser(userDB, map[string]int64{db.QuotaResourceStorage: 100}); err != nil {
+		t.Fatalf("Failed to set quota: %v", err)
+	}
+
+	message := "From: sender@example.com\r\nSubject: Too big\r\n\r\n" + strings.Repeat("x", 200) + "\r\n"
+	appendCmd := fmt.Sprintf("A020 APPEND INBOX {%d}", len(message))
+
+	srv.HandleAppend(conn, "A020", strings.Fields(appendCmd), appendCmd, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "A020 NO [OVERQUOTA]") {
+		t.Errorf("Expected NO [OVERQUOTA], got: %s", response)
+	}
+	if strings.Contains(response, "+ Ready for literal data") {
+		t.Errorf("Expected no continuation request, got: %s", response)
+	}
+}
+
+// TestAppendCommand_UTF8 tests APPEND UTF8 (RFC 6855) with internationalized headers
+func TestAppendCommand_UTF8(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	message := "From: ගුණපාල <gunapala@example.lk>\r\nSubject: ආයුබෝවන්\r\n\r\nBody\r\n"
+	appendCmd := fmt.Sprintf("A021 APPEND INBOX UTF8 (~{%d}", len(message))
+
+	srv.HandleAppend(conn, "A021", strings.Fields(appendCmd), appendCmd, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "A021 BAD") {
+		t.Errorf("Expected BAD without ENABLE UTF8=ACCEPT, got: %s", response)
+	}
+
+	srv.HandleEnable(conn, "A022", []string{"A022", "ENABLE", "UTF8=ACCEPT"}, state)
+	conn.ClearWriteBuffer()
+	conn.AddReadData(message + ")\r\n")
+	srv.HandleAppend(conn, "A023", strings.Fields(appendCmd), appendCmd, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "A023 OK [APPENDUID") {
+		t.Fatalf("Expected APPEND UTF8 to succeed, got: %s", response)
+	}
+
+	srv.HandleSelect(conn, "A024", []string{"A024", "SELECT", "INBOX"}, state)
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "A025", []string{"A025", "FETCH", "1", "(BODY.PEEK[HEADER.FIELDS (SUBJECT)])"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "ආයුබෝවන්") {
+		t.Errorf("Expected the UTF-8 subject to be returned, got: %s", response)
+	}
+}
@@ -0,0 +1,205 @@
+package message
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+
+	"raven/internal/db"
+)
+
+// ===== BINARY (RFC 3516) =====
+
+// ErrUnknownCTE is returned when a part cannot be decoded because its
+// content transfer encoding is not known; the command then fails with
+// NO [UNKNOWN-CTE]
+var ErrUnknownCTE = errors.New("unknown content transfer encoding")
+
+// binaryFetchItem is one BINARY[...] or BINARY.SIZE[...] item of a FETCH response
+type binaryFetchItem struct {
+	label   string // item name, plus the size for BINARY.SIZE
+	data    string // decoded content, sent as a literal
+	literal bool
+}
+
+// fetchBinaryItems builds the BINARY[section]<partial>, BINARY.PEEK[section]<partial>
+// and BINARY.SIZE[section] items requested in items. Sections are decoded from
+// their content transfer encoding; an empty section is the whole message.
+func fetchBinaryItems(deps ServerDeps, targetDB *sql.DB, messageID int64, items string, loadRawMsg func() string) ([]binaryFetchItem, error) {
+	var parts []map[string]interface{}
+	loadParts := func() {
+		if parts == nil {
+			if p, err := db.GetMessageParts(targetDB, messageID); err == nil {
+				parts = p
+			}
+		}
+	}
+
+	var result []binaryFetchItem
+	var decodeErr error
+
+	upper := strings.ToUpper(items)
+	pos := 0
+	for {
+		idx := strings.Index(upper[pos:], "BINARY")
+		if idx == -1 {
+			break
+		}
+		start := pos + idx + len("BINARY")
+
+		sizeOnly := false
+		switch {
+		case strings.HasPrefix(upper[start:], ".PEEK["):
+			start += len(".PEEK[")
+		case strings.HasPrefix(upper[start:], ".SIZE["):
+			start += len(".SIZE[")
+			sizeOnly = true
+		case strings.HasPrefix(upper[start:], "["):
+			start++
+		default:
+			pos = start
+			continue
+		}
+
+		end := strings.Index(upper[start:], "]")
+		if end == -1 {
+			break
+		}
+		end += start
+		section := items[start:end]
+		pos = end + 1
+
+		// Optional <start.length> partial range (not allowed for BINARY.SIZE)
+		partialStart, partialLength := -1, 0
+		if !sizeOnly && pos < len(upper) && upper[pos] == '<' {
+			if close := strings.Index(upper[pos:], ">"); close != -1 {
+				if _, err := fmt.Sscanf(upper[pos+1:pos+close], "%d.%d", &partialStart, &partialLength); err != nil {
+					partialStart = -1
+				}
+				pos += close + 1
+			}
+		}
+
+		var data string
+		found := false
+		if section == "" {
+			data, found = loadRawMsg(), true
+		} else if partPath, err := parsePartNumberPath(section); err == nil {
+			loadParts()
+			if target := mapIMAPPartPathToDBPart(parts, partPath); target != nil {
+				contentType, _ := target["content_type"].(string)
+				if strings.HasPrefix(strings.ToLower(contentType), "multipart/") {
+					// Containers are never encoded, so their raw content is returned as-is
+					data = extractBodySectionByPath(loadRawMsg(), partPath)
+				} else {
+					encoding, _ := target["content_transfer_encoding"].(string)
+					decoded, err := decodeTransferEncoding(partContent(deps, target), encoding)
+					if err != nil {
+						decodeErr = err
+						continue
+					}
+					data = decoded
+				}
+				found = true
+			}
+		} else {
+			continue
+		}
+
+		if sizeOnly {
+			result = append(result, binaryFetchItem{label: fmt.Sprintf("BINARY.SIZE[%s] %d", section, len(data))})
+			continue
+		}
+
+		label := fmt.Sprintf("BINARY[%s]", section)
+		if partialStart >= 0 {
+			label = fmt.Sprintf("BINARY[%s]<%d>", section, partialStart)
+			if partialStart < len(data) {
+				partialEnd := partialStart + partialLength
+				if partialEnd > len(data) {
+					partialEnd = len(data)
+				}
+				data = data[partialStart:partialEnd]
+			} else {
+				data = ""
+			}
+		}
+
+		if !found {
+			result = append(result, binaryFetchItem{label: label + " NIL"})
+			continue
+		}
+		result = append(result, binaryFetchItem{label: label, data: data, literal: true})
+	}
+
+	return result, decodeErr
+}
+
+// partContent returns the stored (still encoded) body of a leaf part from
+// blob storage, falling back to S3, or from the part's inline text content
+func partContent(deps ServerDeps, part map[string]interface{}) string {
+	if blobID, ok := part["blob_id"].(int64); ok {
+		// Blobs are kept in the shared database
+		sharedDB := deps.GetSharedDB()
+		if content, err := db.GetBlob(sharedDB, blobID); err == nil && content != "" {
+			return content
+		}
+
+		s3Storage := deps.GetS3Storage()
+		if s3Storage != nil && s3Storage.IsEnabled() {
+			if s3BlobID, storageType, err := db.GetBlobS3BlobID(sharedDB, blobID); err == nil && storageType == "s3" && s3BlobID != "" {
+				if content, err := s3Storage.Retrieve(s3BlobID); err == nil {
+					return content
+				}
+			}
+		}
+		return ""
+	}
+
+	if textContent, ok := part["text_content"].(string); ok {
+		return textContent
+	}
+	return ""
+}
+
+// decodeTransferEncoding decodes part content according to its
+// Content-Transfer-Encoding
+func decodeTransferEncoding(content, encoding string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "7bit", "8bit", "binary":
+		return content, nil
+	case "base64":
+		stripped := strings.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, content)
+		decoded, err := base64.StdEncoding.DecodeString(stripped)
+		if err != nil {
+			return "", ErrUnknownCTE
+		}
+		return string(decoded), nil
+	case "quoted-printable":
+		decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(content)))
+		if err != nil {
+			return "", ErrUnknownCTE
+		}
+		return string(decoded), nil
+	default:
+		return "", ErrUnknownCTE
+	}
+}
+
+// formatLiteral8 formats data as a literal, using the literal8 form (~{n})
+// when it contains NUL octets that a normal literal cannot carry
+func formatLiteral8(data string) string {
+	if strings.IndexByte(data, 0) >= 0 {
+		return fmt.Sprintf("~{%d}\r\n%s", len(data), data)
+	}
+	return fmt.Sprintf("{%d}\r\n%s", len(data), data)
+}
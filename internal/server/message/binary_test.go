@@ -0,0 +1,133 @@
+package message_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"raven/internal/models"
+	"raven/internal/server"
+)
+
+// binaryTestMessage is a multipart message with a base64-encoded attachment
+func binaryTestMessage(encoding, body string) string {
+	return "From: sender@example.com\r\n" +
+		"To: testuser@localhost\r\n" +
+		"Subject: Binary\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See attachment\r\n" +
+		"--b1\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=\"data.bin\"\r\n" +
+		"Content-Transfer-Encoding: " + encoding + "\r\n" +
+		"\r\n" +
+		body + "\r\n" +
+		"--b1--\r\n"
+}
+
+// setupBinaryTest stores msg in INBOX and returns a state with INBOX selected
+func setupBinaryTest(t *testing.T, srv *server.TestInterface, msg string) *models.ClientState {
+	database := server.GetDatabaseFromServer(srv)
+	userID := server.CreateTestUser(t, database, "testuser")
+	server.InsertTestRawMail(t, database, "testuser", msg, "INBOX")
+	mailboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+
+	return &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		Username:          "testuser",
+		SelectedMailboxID: mailboxID,
+	}
+}
+
+// TestFetchCommand_Binary tests that BINARY[section] returns the decoded part
+func TestFetchCommand_Binary(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	content := "Hello binary world"
+	state := setupBinaryTest(t, srv, binaryTestMessage("base64", base64.StdEncoding.EncodeToString([]byte(content))))
+
+	srv.HandleFetch(conn, "B001", []string{"B001", "FETCH", "1", "(BINARY[2]", "BINARY.SIZE[2])"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, fmt.Sprintf("BINARY.SIZE[2] %d", len(content))) {
+		t.Errorf("Expected decoded size, got: %s", response)
+	}
+	if !strings.Contains(response, fmt.Sprintf("{%d}\r\n%s", len(content), content)) {
+		t.Errorf("Expected decoded content, got: %s", response)
+	}
+	if !strings.Contains(response, "B001 OK FETCH completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+}
+
+// TestFetchCommand_BinaryPeekPartial tests BINARY.PEEK with a partial range over decoded data
+func TestFetchCommand_BinaryPeekPartial(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := setupBinaryTest(t, srv, binaryTestMessage("quoted-printable", "caf=C3=A9 au lait"))
+
+	srv.HandleFetch(conn, "B002", []string{"B002", "FETCH", "1", "BINARY.PEEK[2]<0.5>"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "BINARY[2]<0> {5}\r\ncaf\xc3\xa9") {
+		t.Errorf("Expected the first 5 decoded octets, got: %q", response)
+	}
+}
+
+// TestFetchCommand_BinaryNulUsesLiteral8 tests that data containing NUL is sent as a literal8
+func TestFetchCommand_BinaryNulUsesLiteral8(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := setupBinaryTest(t, srv, binaryTestMessage("base64", base64.StdEncoding.EncodeToString([]byte("a\x00b"))))
+
+	srv.HandleFetch(conn, "B003", []string{"B003", "FETCH", "1", "BINARY[2]"}, state)
+
+	if response := conn.GetWrittenData(); !strings.Contains(response, "BINARY[2] ~{3}\r\na\x00b") {
+		t.Errorf("Expected a literal8, got: %q", response)
+	}
+}
+
+// TestFetchCommand_BinaryUnknownCTE tests that undecodable parts fail with UNKNOWN-CTE
+func TestFetchCommand_BinaryUnknownCTE(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := setupBinaryTest(t, srv, binaryTestMessage("x-custom", "opaque"))
+
+	srv.HandleFetch(conn, "B004", []string{"B004", "FETCH", "1", "BINARY[2]"}, state)
+
+	if response := conn.GetWrittenData(); !strings.Contains(response, "B004 NO [UNKNOWN-CTE]") {
+		t.Errorf("Expected UNKNOWN-CTE response code, got: %s", response)
+	}
+}
+
+// TestAppendCommand_Literal8 tests APPEND of binary content with a literal8
+func TestAppendCommand_Literal8(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+
+	message := "From: sender@example.com\r\nSubject: Raw\r\nContent-Transfer-Encoding: binary\r\n\r\nraw\x00data\r\n"
+
+	// NUL octets are refused in a normal literal
+	appendCmd := fmt.Sprintf("B005 APPEND INBOX {%d}", len(message))
+	conn.AddReadData(message)
+	srv.HandleAppend(conn, "B005", strings.Fields(appendCmd), appendCmd, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "B005 BAD") {
+		t.Errorf("Expected BAD for NUL in a normal literal, got: %s", response)
+	}
+
+	conn.Reset()
+	appendCmd = fmt.Sprintf("B006 APPEND INBOX ~{%d}", len(message))
+	conn.AddReadData(message)
+	srv.HandleAppend(conn, "B006", strings.Fields(appendCmd), appendCmd, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "B006 OK [APPENDUID") {
+		t.Errorf("Expected literal8 APPEND to succeed, got: %s", response)
+	}
+}
@@ -0,0 +1,121 @@
+package message
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== CONDSTORE / QRESYNC (RFC 7162) =====
+
+// FetchModifiers holds the optional FETCH modifiers from RFC 7162
+type FetchModifiers struct {
+	ChangedSince int64 // Only return messages with a mod-sequence above this value (0 = unset)
+	Vanished     bool  // UID FETCH only: also report expunged UIDs (requires QRESYNC)
+}
+
+// ParseFetchModifiers splits a trailing "(CHANGEDSINCE n [VANISHED])" modifier list
+// off the FETCH items and returns the remaining items.
+func ParseFetchModifiers(items string) (string, FetchModifiers, error) {
+	var mods FetchModifiers
+
+	upper := strings.ToUpper(items)
+	keyIdx := strings.LastIndex(upper, "CHANGEDSINCE")
+	if keyIdx == -1 {
+		if strings.Contains(upper, "VANISHED") {
+			return items, mods, fmt.Errorf("VANISHED requires CHANGEDSINCE")
+		}
+		return items, mods, nil
+	}
+
+	openIdx := strings.LastIndex(upper[:keyIdx], "(")
+	if openIdx == -1 {
+		return items, mods, fmt.Errorf("invalid FETCH modifier")
+	}
+
+	modifier := strings.TrimSpace(items[openIdx:])
+	if !strings.HasSuffix(modifier, ")") {
+		return items, mods, fmt.Errorf("invalid FETCH modifier")
+	}
+
+	fields := strings.Fields(strings.ToUpper(modifier[1 : len(modifier)-1]))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "CHANGEDSINCE":
+			if i+1 >= len(fields) {
+				return items, mods, fmt.Errorf("CHANGEDSINCE requires a mod-sequence")
+			}
+			i++
+			value, err := strconv.ParseInt(fields[i], 10, 64)
+			if err != nil || value < 1 {
+				return items, mods, fmt.Errorf("invalid CHANGEDSINCE value")
+			}
+			mods.ChangedSince = value
+		case "VANISHED":
+			mods.Vanished = true
+		default:
+			return items, mods, fmt.Errorf("unknown FETCH modifier %s", fields[i])
+		}
+	}
+
+	return strings.TrimSpace(items[:openIdx]), mods, nil
+}
+
+// ParseStoreModifier extracts a "(UNCHANGEDSINCE n)" modifier that precedes the
+// STORE data item. It returns the remaining arguments and whether a modifier was present.
+func ParseStoreModifier(args []string) ([]string, int64, bool, error) {
+	if len(args) == 0 || !strings.HasPrefix(strings.ToUpper(args[0]), "(UNCHANGEDSINCE") {
+		return args, 0, false, nil
+	}
+
+	// The modifier may be split across fields: "(UNCHANGEDSINCE" "12345)"
+	end := -1
+	for i, arg := range args {
+		if strings.HasSuffix(arg, ")") {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return args, 0, false, fmt.Errorf("unterminated STORE modifier")
+	}
+
+	fields := strings.Fields(strings.Trim(strings.Join(args[:end+1], " "), "()"))
+	if len(fields) != 2 || strings.ToUpper(fields[0]) != "UNCHANGEDSINCE" {
+		return args, 0, false, fmt.Errorf("invalid STORE modifier")
+	}
+
+	value, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || value < 0 {
+		return args, 0, false, fmt.Errorf("invalid UNCHANGEDSINCE value")
+	}
+
+	return args[end+1:], value, true, nil
+}
+
+// SendExpungeNotifications reports removed messages to the client. Sequence
+// numbers must already be adjusted for earlier removals in the same batch.
+// Once QRESYNC is enabled, RFC 7162 requires VANISHED instead of EXPUNGE.
+func SendExpungeNotifications(deps ServerDeps, conn net.Conn, state *models.ClientState, seqNums []int, uids []int64) {
+	if len(uids) == 0 {
+		return
+	}
+
+	if state.QResyncEnabled {
+		deps.SendResponse(conn, fmt.Sprintf("* VANISHED %s", utils.FormatSequenceSet(uids)))
+		return
+	}
+
+	for _, seqNum := range seqNums {
+		deps.SendResponse(conn, fmt.Sprintf("* %d EXPUNGE", seqNum))
+	}
+}
+
+// formatModSeqItem renders the MODSEQ fetch data item
+func formatModSeqItem(modseq int64) string {
+	return fmt.Sprintf("MODSEQ (%d)", modseq)
+}
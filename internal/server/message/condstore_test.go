@@ -0,0 +1,180 @@
+package message_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"raven/internal/models"
+	"raven/internal/server"
+	"raven/internal/server/message"
+)
+
+func setupCondStoreMailbox(t *testing.T, count int) (*server.TestInterface, *models.ClientState, int64) {
+	t.Helper()
+	srv := server.SetupTestServerSimple(t)
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "modsequser")
+	for i := 1; i <= count; i++ {
+		server.InsertTestMail(t, database, "modsequser", fmt.Sprintf("Message %d", i), "sender@test.com", "modsequser@localhost", "INBOX")
+	}
+
+	mailboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		Username:          "modsequser",
+		SelectedMailboxID: mailboxID,
+		LastMessageCount:  count,
+	}
+
+	return srv, state, mailboxID
+}
+
+func messageModSeq(t *testing.T, srv *server.TestInterface, state *models.ClientState, uid int) int64 {
+	t.Helper()
+	userDB := server.GetUserDBByID(t, server.GetDatabaseFromServer(srv), state.UserID)
+	var modseq int64
+	if err := userDB.QueryRow("SELECT modseq FROM message_mailbox WHERE mailbox_id = ? AND uid = ?", state.SelectedMailboxID, uid).Scan(&modseq); err != nil {
+		t.Fatalf("Failed to query modseq: %v", err)
+	}
+	return modseq
+}
+
+// TestParseFetchModifiers tests extraction of CHANGEDSINCE/VANISHED modifiers
+func TestParseFetchModifiers(t *testing.T) {
+	items, mods, err := message.ParseFetchModifiers("(FLAGS UID) (CHANGEDSINCE 12345 VANISHED)")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if items != "(FLAGS UID)" {
+		t.Errorf("Expected remaining items '(FLAGS UID)', got '%s'", items)
+	}
+	if mods.ChangedSince != 12345 || !mods.Vanished {
+		t.Errorf("Unexpected modifiers: %+v", mods)
+	}
+
+	items, mods, err = message.ParseFetchModifiers("FLAGS")
+	if err != nil || items != "FLAGS" || mods.ChangedSince != 0 {
+		t.Errorf("Expected items without modifiers to pass through, got '%s' %+v %v", items, mods, err)
+	}
+
+	if _, _, err := message.ParseFetchModifiers("FLAGS (CHANGEDSINCE abc)"); err == nil {
+		t.Error("Expected error for non-numeric CHANGEDSINCE")
+	}
+}
+
+// TestFetch_ChangedSince tests that FETCH CHANGEDSINCE only returns modified messages
+func TestFetch_ChangedSince(t *testing.T) {
+	srv, state, _ := setupCondStoreMailbox(t, 3)
+	conn := server.NewMockConn()
+
+	baseline := messageModSeq(t, srv, state, 3)
+
+	// Modify message 2 only
+	srv.HandleStore(conn, "A1", []string{"A1", "STORE", "2", "+FLAGS", "(\\Flagged)"}, state)
+	conn.ClearWriteBuffer()
+
+	srv.HandleFetch(conn, "A2", []string{"A2", "FETCH", "1:3", "(FLAGS)", fmt.Sprintf("(CHANGEDSINCE %d)", baseline)}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* 2 FETCH (FLAGS (\\Flagged) MODSEQ (") {
+		t.Errorf("Expected FETCH with MODSEQ for message 2, got: %s", response)
+	}
+	if strings.Contains(response, "* 1 FETCH") || strings.Contains(response, "* 3 FETCH") {
+		t.Errorf("Unmodified messages must not be returned, got: %s", response)
+	}
+	if !strings.Contains(response, "A2 OK FETCH completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+	if !state.CondStoreEnabled {
+		t.Error("Expected CHANGEDSINCE to enable CONDSTORE for the session")
+	}
+}
+
+// TestFetch_ModSeqItem tests the MODSEQ fetch data item
+func TestFetch_ModSeqItem(t *testing.T) {
+	srv, state, _ := setupCondStoreMailbox(t, 1)
+	conn := server.NewMockConn()
+
+	modseq := messageModSeq(t, srv, state, 1)
+
+	srv.HandleFetch(conn, "A3", []string{"A3", "FETCH", "1", "(MODSEQ)"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, fmt.Sprintf("MODSEQ (%d)", modseq)) {
+		t.Errorf("Expected MODSEQ (%d), got: %s", modseq, response)
+	}
+}
+
+// TestStore_UnchangedSince tests conditional STORE with UNCHANGEDSINCE
+func TestStore_UnchangedSince(t *testing.T) {
+	srv, state, _ := setupCondStoreMailbox(t, 2)
+	conn := server.NewMockConn()
+
+	stale := messageModSeq(t, srv, state, 2)
+
+	// Another client modifies message 1 after our snapshot
+	srv.HandleStore(conn, "B1", []string{"B1", "STORE", "1", "+FLAGS", "(\\Seen)"}, state)
+	conn.ClearWriteBuffer()
+
+	srv.HandleStore(conn, "B2", []string{"B2", "STORE", "1:2", "(UNCHANGEDSINCE", fmt.Sprintf("%d)", stale), "+FLAGS.SILENT", "(\\Flagged)"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "B2 OK [MODIFIED 1] Conditional STORE failed") {
+		t.Errorf("Expected MODIFIED 1, got: %s", response)
+	}
+	// The successful update is reported with its MODSEQ even though .SILENT was used
+	if !strings.Contains(response, "* 2 FETCH (FLAGS (\\Flagged) MODSEQ (") {
+		t.Errorf("Expected FETCH with MODSEQ for message 2, got: %s", response)
+	}
+
+	userDB := server.GetUserDBByID(t, server.GetDatabaseFromServer(srv), state.UserID)
+	var flags string
+	if err := userDB.QueryRow("SELECT flags FROM message_mailbox WHERE mailbox_id = ? AND uid = 1", state.SelectedMailboxID).Scan(&flags); err != nil {
+		t.Fatalf("Failed to query flags: %v", err)
+	}
+	if strings.Contains(flags, "\\Flagged") {
+		t.Errorf("Message 1 must not be modified, flags: %s", flags)
+	}
+}
+
+// TestSearch_ModSeq tests SEARCH MODSEQ and the MODSEQ response suffix
+func TestSearch_ModSeq(t *testing.T) {
+	srv, state, _ := setupCondStoreMailbox(t, 3)
+	conn := server.NewMockConn()
+
+	srv.HandleStore(conn, "C1", []string{"C1", "STORE", "3", "+FLAGS", "(\\Seen)"}, state)
+	threshold := messageModSeq(t, srv, state, 3)
+	conn.ClearWriteBuffer()
+
+	srv.HandleSearch(conn, "C2", []string{"C2", "SEARCH", "MODSEQ", fmt.Sprintf("%d", threshold)}, state)
+
+	response := conn.GetWrittenData()
+	expected := fmt.Sprintf("* SEARCH 3 (MODSEQ %d)", threshold)
+	if !strings.Contains(response, expected) {
+		t.Errorf("Expected '%s', got: %s", expected, response)
+	}
+}
+
+// TestExpunge_VanishedWithQResync tests that EXPUNGE reports VANISHED once QRESYNC is enabled
+func TestExpunge_VanishedWithQResync(t *testing.T) {
+	srv, state, _ := setupCondStoreMailbox(t, 3)
+	conn := server.NewMockConn()
+	state.QResyncEnabled = true
+
+	srv.HandleStore(conn, "D1", []string{"D1", "STORE", "2:3", "+FLAGS.SILENT", "(\\Deleted)"}, state)
+	conn.ClearWriteBuffer()
+
+	srv.HandleExpunge(conn, "D2", state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* VANISHED 2:3") {
+		t.Errorf("Expected VANISHED 2:3, got: %s", response)
+	}
+	if strings.Contains(response, "* 2 EXPUNGE") {
+		t.Errorf("EXPUNGE responses must not be sent with QRESYNC, got: %s", response)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"raven/internal/db"
 	"raven/internal/models"
 	"raven/internal/server"
 )
@@ -546,3 +547,76 @@ func TestCopyCommand_AtomicOperation(t *testing.T) {
 		t.Errorf("Expected count to increase by 1, initial: %d, final: %d", initialCount, finalCount)
 	}
 }
+
+// TestCopyCommand_OverQuota tests that COPY fails with OVERQUOTA once the message limit is reached
+func TestCopyCommand_OverQuota(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "copyuser")
+	server.InsertTestMail(t, database, "copyuser", "Test message", "sender@test.com", "copyuser@localhost", "INBOX")
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		Username:          "copyuser",
+		SelectedMailboxID: inboxID,
+	}
+
+	userDB := server.GetUserDBByID(t, database, userID)
+	if err := db.SetQuotaLimitsPerUser(userDB, map[string]int64{db.QuotaResourceMessage: 1}); err != nil {
+		t.Fatalf("Failed to set quota: %v", err)
+	}
+
+	srv.HandleCopy(conn, "C014", []string{"COPY", "1", "Sent"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "C014 NO [OVERQUOTA]") {
+		t.Errorf("Expected NO [OVERQUOTA], got: %s", response)
+	}
+}
+
+// TestCopyCommand_UIDsNotReused tests that COPY never reassigns the UID of an
+// expunged message in the destination mailbox
+func TestCopyCommand_UIDsNotReused(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "copyuser")
+	server.InsertTestMail(t, database, "copyuser", "Test message", "sender@test.com", "copyuser@localhost", "INBOX")
+	server.CreateMailbox(t, database, "copyuser", "Sent")
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+	sentID, _ := server.GetMailboxID(t, database, userID, "Sent")
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+	}
+	userDB := server.GetUserDBByID(t, database, userID)
+
+	srv.HandleCopy(conn, "C015", []string{"COPY", "1", "Sent"}, state)
+	if _, err := userDB.Exec("DELETE FROM message_mailbox WHERE mailbox_id = ?", sentID); err != nil {
+		t.Fatalf("Failed to expunge Sent: %v", err)
+	}
+	srv.HandleCopy(conn, "C016", []string{"COPY", "1", "Sent"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "C016 OK COPY completed") {
+		t.Fatalf("Expected OK response, got: %s", response)
+	}
+
+	var uid, uidNext int64
+	if err := userDB.QueryRow("SELECT uid FROM message_mailbox WHERE mailbox_id = ?", sentID).Scan(&uid); err != nil {
+		t.Fatalf("Failed to query copied message: %v", err)
+	}
+	if err := userDB.QueryRow("SELECT uid_next FROM mailboxes WHERE id = ?", sentID).Scan(&uidNext); err != nil {
+		t.Fatalf("Failed to query uid_next: %v", err)
+	}
+	if uid != 2 || uidNext != 3 {
+		t.Errorf("Expected UID 2 and UIDNEXT 3 after the second copy, got UID %d and UIDNEXT %d", uid, uidNext)
+	}
+}
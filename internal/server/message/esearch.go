@@ -0,0 +1,182 @@
+package message
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== ESEARCH (RFC 4731) / SEARCHRES (RFC 5182) =====
+
+// SearchReturnOptions holds the RETURN options of an extended SEARCH command
+type SearchReturnOptions struct {
+	Extended bool // RETURN was given; results are sent as ESEARCH
+	Min      bool
+	Max      bool
+	All      bool
+	Count    bool
+	Save     bool // Save the result for the "$" reference
+}
+
+// ParseSearchReturnOptions parses an optional leading "RETURN (...)" option list
+// and returns the remaining search arguments
+func ParseSearchReturnOptions(args []string) (SearchReturnOptions, []string, error) {
+	var opts SearchReturnOptions
+	if len(args) == 0 || strings.ToUpper(args[0]) != "RETURN" {
+		return opts, args, nil
+	}
+
+	content, rest, err := utils.ParseParenthesizedList(args[1:])
+	if err != nil {
+		return opts, args, fmt.Errorf("invalid SEARCH return options")
+	}
+
+	opts.Extended = true
+	for _, option := range strings.Fields(content) {
+		switch strings.ToUpper(option) {
+		case "MIN":
+			opts.Min = true
+		case "MAX":
+			opts.Max = true
+		case "ALL":
+			opts.All = true
+		case "COUNT":
+			opts.Count = true
+		case "SAVE":
+			opts.Save = true
+		default:
+			return opts, args, fmt.Errorf("unknown SEARCH return option %s", option)
+		}
+	}
+
+	// RETURN () is equivalent to RETURN (ALL)
+	if !opts.Min && !opts.Max && !opts.Count && !opts.Save {
+		opts.All = true
+	}
+
+	return opts, rest, nil
+}
+
+// ExpandSearchResultTokens replaces the "$" search result reference in SEARCH
+// criteria with the saved UIDs. An empty saved result matches no messages.
+func ExpandSearchResultTokens(tokens []string, savedUIDs []int64) []string {
+	set := utils.FormatSequenceSet(savedUIDs)
+	if set == "" {
+		set = "0" // UIDs start at 1, so this never matches
+	}
+
+	expanded := make([]string, 0, len(tokens)+1)
+	for i, token := range tokens {
+		if token != "$" {
+			expanded = append(expanded, token)
+			continue
+		}
+		if i > 0 && strings.EqualFold(tokens[i-1], "UID") {
+			expanded = append(expanded, set)
+		} else {
+			expanded = append(expanded, "UID", set)
+		}
+	}
+
+	return expanded
+}
+
+// SendSearchResults reports SEARCH matches either as a classic "* SEARCH"
+// response or, when RETURN options were given, as "* ESEARCH". It also
+// records the result for the "$" reference when SAVE was requested.
+func SendSearchResults(deps ServerDeps, conn net.Conn, tag string, uidMode bool, opts SearchReturnOptions, tokens []string, matches []SearchMatch, state *models.ClientState) {
+	// IMAP4rev2 always answers with ESEARCH; no RETURN means RETURN (ALL)
+	// (RFC 9051 Section 6.4.4)
+	if state.IMAP4rev2Enabled && !opts.Extended {
+		opts.Extended, opts.All = true, true
+	}
+
+	values := make([]int64, 0, len(matches))
+	for _, match := range matches {
+		if uidMode {
+			values = append(values, match.UID)
+		} else {
+			values = append(values, int64(match.SeqNum))
+		}
+	}
+
+	if !opts.Extended {
+		var results []string
+		for _, value := range values {
+			results = append(results, strconv.FormatInt(value, 10))
+		}
+		if len(results) > 0 {
+			deps.SendResponse(conn, fmt.Sprintf("* SEARCH %s%s", strings.Join(results, " "), SearchModSeqSuffix(tokens, matches)))
+		} else {
+			deps.SendResponse(conn, "* SEARCH")
+		}
+		return
+	}
+
+	if opts.Save {
+		state.SearchResult = savedSearchResult(opts, matches)
+	}
+
+	// SAVE on its own suppresses the ESEARCH response (RFC 5182 Section 2.1)
+	if opts.Save && !opts.Min && !opts.Max && !opts.All && !opts.Count {
+		return
+	}
+
+	response := fmt.Sprintf("* ESEARCH (TAG \"%s\")", tag)
+	if uidMode {
+		response += " UID"
+	}
+	deps.SendResponse(conn, response+formatESearchData(opts, values, tokens, matches))
+}
+
+// formatESearchData formats the result items of an ESEARCH response
+func formatESearchData(opts SearchReturnOptions, values []int64, tokens []string, matches []SearchMatch) string {
+	var response string
+	if len(values) > 0 {
+		if opts.Min {
+			response += fmt.Sprintf(" MIN %d", values[0])
+		}
+		if opts.Max {
+			response += fmt.Sprintf(" MAX %d", values[len(values)-1])
+		}
+	}
+	if opts.Count {
+		response += fmt.Sprintf(" COUNT %d", len(values))
+	}
+	if opts.All && len(values) > 0 {
+		response += fmt.Sprintf(" ALL %s", utils.FormatSequenceSet(values))
+	}
+	if suffix := SearchModSeqSuffix(tokens, matches); suffix != "" {
+		response += " " + strings.Trim(suffix, " ()")
+	}
+	return response
+}
+
+// savedSearchResult returns the UIDs to save for "$". When SAVE is combined
+// with MIN and/or MAX only, just those messages are saved (RFC 5182 Section 2.4).
+func savedSearchResult(opts SearchReturnOptions, matches []SearchMatch) []int64 {
+	if len(matches) == 0 {
+		return []int64{}
+	}
+
+	if (opts.Min || opts.Max) && !opts.All && !opts.Count {
+		var saved []int64
+		if opts.Min {
+			saved = append(saved, matches[0].UID)
+		}
+		if opts.Max && (!opts.Min || len(matches) > 1) {
+			saved = append(saved, matches[len(matches)-1].UID)
+		}
+		return saved
+	}
+
+	saved := make([]int64, 0, len(matches))
+	for _, match := range matches {
+		saved = append(saved, match.UID)
+	}
+	return saved
+}
@@ -0,0 +1,187 @@
+package message_test
+
+import (
+	"strings"
+	"testing"
+
+	"raven/internal/server"
+	"raven/internal/server/message"
+)
+
+// TestParseSearchReturnOptions tests parsing of RFC 4731 RETURN options
+func TestParseSearchReturnOptions(t *testing.T) {
+	opts, rest, err := message.ParseSearchReturnOptions([]string{"RETURN", "(MIN", "COUNT)", "UNSEEN"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !opts.Extended || !opts.Min || !opts.Count || opts.All {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+	if len(rest) != 1 || rest[0] != "UNSEEN" {
+		t.Errorf("Expected remaining [UNSEEN], got %v", rest)
+	}
+
+	// RETURN () means RETURN (ALL)
+	opts, _, _ = message.ParseSearchReturnOptions([]string{"RETURN", "()", "ALL"})
+	if !opts.All {
+		t.Errorf("Expected empty RETURN to imply ALL, got %+v", opts)
+	}
+
+	if _, _, err := message.ParseSearchReturnOptions([]string{"RETURN", "(BOGUS)", "ALL"}); err == nil {
+		t.Error("Expected error for unknown return option")
+	}
+}
+
+// TestSearch_ESearchResponse tests MIN, MAX, COUNT and ALL in an ESEARCH response
+func TestSearch_ESearchResponse(t *testing.T) {
+	srv, state, _ := setupCondStoreMailbox(t, 5)
+	conn := server.NewMockConn()
+
+	srv.HandleStore(conn, "E0", []string{"E0", "STORE", "3", "+FLAGS", "(\\Seen)"}, state)
+	conn.ClearWriteBuffer()
+
+	srv.HandleSearch(conn, "E1", []string{"E1", "SEARCH", "RETURN", "(MIN", "MAX", "COUNT", "ALL)", "UNSEEN"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* ESEARCH (TAG "E1") MIN 1 MAX 5 COUNT 4 ALL 1:2,4:5`) {
+		t.Errorf("Expected ESEARCH response, got: %s", response)
+	}
+	if strings.Contains(response, "* SEARCH") {
+		t.Errorf("Classic SEARCH response must not be sent, got: %s", response)
+	}
+	if !strings.Contains(response, "E1 OK SEARCH completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+}
+
+// TestSearch_ESearchNoMatches tests that COUNT is still reported when nothing matches
+func TestSearch_ESearchNoMatches(t *testing.T) {
+	srv, state, _ := setupCondStoreMailbox(t, 2)
+	conn := server.NewMockConn()
+
+	srv.HandleSearch(conn, "E2", []string{"E2", "SEARCH", "RETURN", "(MIN", "COUNT)", "DELETED"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* ESEARCH (TAG "E2") COUNT 0`) {
+		t.Errorf("Expected COUNT 0, got: %s", response)
+	}
+	if strings.Contains(response, "MIN") {
+		t.Errorf("MIN must be omitted when nothing matches, got: %s", response)
+	}
+}
+
+// TestSearch_SaveResult tests SEARCH RETURN (SAVE) and the "$" reference
+func TestSearch_SaveResult(t *testing.T) {
+	srv, state, _ := setupCondStoreMailbox(t, 4)
+	conn := server.NewMockConn()
+
+	srv.HandleSearch(conn, "E3", []string{"E3", "SEARCH", "RETURN", "(SAVE)", "2:3"}, state)
+
+	response := conn.GetWrittenData()
+	if strings.Contains(response, "ESEARCH") || strings.Contains(response, "* SEARCH") {
+		t.Errorf("SAVE alone must not return results, got: %s", response)
+	}
+	if len(state.SearchResult) != 2 {
+		t.Fatalf("Expected 2 saved UIDs, got %v", state.SearchResult)
+	}
+
+	// Use the saved result in a later STORE and SEARCH
+	conn.ClearWriteBuffer()
+	srv.HandleStore(conn, "E4", []string{"E4", "STORE", "$", "+FLAGS", "(\\Flagged)"}, state)
+	response = conn.GetWrittenData()
+	if !strings.Contains(response, "* 2 FETCH") || !strings.Contains(response, "* 3 FETCH") || strings.Contains(response, "* 1 FETCH") {
+		t.Errorf("Expected STORE $ to update messages 2 and 3, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleSearch(conn, "E5", []string{"E5", "SEARCH", "$", "FLAGGED"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "* SEARCH 2 3") {
+		t.Errorf("Expected SEARCH $ to return 2 3, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "E6", []string{"E6", "FETCH", "$", "(FLAGS)"}, state)
+	response = conn.GetWrittenData()
+	if !strings.Contains(response, "* 2 FETCH (FLAGS (\\Flagged))") || !strings.Contains(response, "* 3 FETCH") {
+		t.Errorf("Expected FETCH $ to return messages 2 and 3, got: %s", response)
+	}
+}
+
+// TestEsearch_MultipleMailboxes tests ESEARCH IN (RFC 7377)
+func TestEsearch_MultipleMailboxes(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	server.CreateMailbox(t, database, "testuser", "Archive")
+	server.CreateMailbox(t, database, "testuser", "Archive/2020")
+	server.InsertTestMail(t, database, "testuser", "Weekly report", "sender@test.com", "testuser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "testuser", "Invoice 42", "sender@test.com", "testuser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "testuser", "Invoice 17", "sender@test.com", "testuser@localhost", "Archive/2020")
+
+	srv.HandleEsearch(conn, "E001", []string{"E001", "ESEARCH", "IN", "(personal)", "SUBJECT", "Invoice"}, state)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* ESEARCH (TAG "E001" MAILBOX "INBOX" UIDVALIDITY `) || !strings.Contains(response, `) UID ALL 2`) {
+		t.Errorf("Expected a match in INBOX, got: %s", response)
+	}
+	if !strings.Contains(response, `MAILBOX "Archive/2020" UIDVALIDITY `) {
+		t.Errorf("Expected a match in Archive/2020, got: %s", response)
+	}
+	if strings.Contains(response, `MAILBOX "Archive" `) {
+		t.Errorf("Expected no response for a mailbox without matches, got: %s", response)
+	}
+	if !strings.Contains(response, "E001 OK ESEARCH completed") {
+		t.Errorf("Expected OK completion, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleEsearch(conn, "E002", []string{"E002", "ESEARCH", "IN", "(subtree", "Archive)", "RETURN", "(COUNT)", "SUBJECT", "Invoice"}, state)
+	response = conn.GetWrittenData()
+	if !strings.Contains(response, `MAILBOX "Archive/2020"`) || !strings.Contains(response, "UID COUNT 1") || strings.Contains(response, `MAILBOX "INBOX"`) {
+		t.Errorf("Expected only the Archive subtree to be searched, got: %s", response)
+	}
+
+	// Without IN the selected mailbox is searched
+	srv.HandleSelect(conn, "S001", []string{"S001", "SELECT", "INBOX"}, state)
+	conn.ClearWriteBuffer()
+	srv.HandleEsearch(conn, "E003", []string{"E003", "ESEARCH", "SUBJECT", "Weekly"}, state)
+	response = conn.GetWrittenData()
+	if !strings.Contains(response, `MAILBOX "INBOX"`) || !strings.Contains(response, "UID ALL 1") || strings.Contains(response, "Archive") {
+		t.Errorf("Expected the selected mailbox to be searched, got: %s", response)
+	}
+
+	badCommands := [][]string{
+		{"E004", "ESEARCH", "IN", "(personal)", "1:2"},
+		{"E005", "ESEARCH", "IN", "(personal)", "NOT", "3"},
+		{"E006", "ESEARCH", "IN", "(personal)", "RETURN", "(SAVE)", "ALL"},
+		{"E007", "ESEARCH", "IN", "(everything)", "ALL"},
+	}
+	for _, parts := range badCommands {
+		conn.ClearWriteBuffer()
+		srv.HandleEsearch(conn, parts[0], parts, state)
+		if response := conn.GetWrittenData(); !strings.Contains(response, parts[0]+" BAD") {
+			t.Errorf("Expected BAD for %v, got: %s", parts, response)
+		}
+	}
+}
+
+// TestSearchMailboxes tests searching a user's mailboxes without a session
+func TestSearchMailboxes(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	server.CreateMailbox(t, database, "testuser", "Archive")
+	server.InsertTestMail(t, database, "testuser", "Weekly report", "boss@test.com", "testuser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "testuser", "Invoice 17", "billing@test.com", "testuser@localhost", "Archive")
+
+	userDB := server.GetUserDBByID(t, database, state.UserID)
+	results, err := message.SearchMailboxes(userDB, server.GetSharedDB(t, srv), nil, []string{"INBOX", "Archive", "Missing"}, []string{"FROM", "billing"}, "US-ASCII")
+	if err != nil {
+		t.Fatalf("SearchMailboxes failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Mailbox != "Archive" || len(results[0].Matches) != 1 || results[0].Matches[0].UID != 1 {
+		t.Errorf("Expected UID 1 in Archive, got %+v", results)
+	}
+}
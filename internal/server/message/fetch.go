@@ -2,6 +2,7 @@ package message
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"math"
 	"net"
@@ -14,40 +15,42 @@ import (
 	"raven/internal/delivery/parser"
 	"raven/internal/models"
 	"raven/internal/server/response"
+	"raven/internal/server/utils"
 )
 
 // ===== FETCH =====
 
 // HandleFetchForUIDs handles FETCH for a list of UIDs (used by UID FETCH command)
-func HandleFetchForUIDs(deps ServerDeps, conn net.Conn, tag string, uids []int, items string, state *models.ClientState) {
+func HandleFetchForUIDs(deps ServerDeps, conn net.Conn, tag string, uids []int, items string, state *models.ClientState) error {
+	return HandleFetchForUIDsWithModifiers(deps, conn, tag, uids, items, FetchModifiers{}, state)
+}
+
+// HandleFetchForUIDsWithModifiers handles FETCH for a list of UIDs, honouring
+// the RFC 7162 CHANGEDSINCE modifier. It returns ErrUnknownCTE when a BINARY
+// section of any message could not be decoded.
+func HandleFetchForUIDsWithModifiers(deps ServerDeps, conn net.Conn, tag string, uids []int, items string, mods FetchModifiers, state *models.ClientState) error {
 	// Get appropriate database (user or role mailbox)
 	targetDB, err := deps.GetSelectedDB(state)
 	if err != nil {
-		return
+		return err
 	}
 
-	for _, uid := range uids {
-		// Get message details by UID
-		var messageID int64
-		var seqNum int
-		var flags sql.NullString
-
-		err := targetDB.QueryRow(`
-			SELECT mm.message_id, mm.flags,
-				(SELECT COUNT(*) FROM message_mailbox mm2
-				 WHERE mm2.mailbox_id = mm.mailbox_id AND mm2.uid <= mm.uid) as seq_num
-			FROM message_mailbox mm
-			WHERE mm.mailbox_id = ? AND mm.uid = ?
-		`, state.SelectedMailboxID, uid).Scan(&messageID, &flags, &seqNum)
+	var fetchErr error
 
-		if err != nil {
-			// Non-existent UID is silently ignored
+	messages := utils.SelectedMessageMap(state, targetDB)
+	for _, uid := range uids {
+		// Messages the client has not been told about have no sequence number yet
+		seqNum, ok := messages.SeqNum(int64(uid))
+		if !ok {
 			continue
 		}
 
-		// Process this message using the same logic as handleFetch
-		processFetchForMessage(deps, conn, messageID, int64(uid), seqNum, flags.String, items, state)
+		if err := fetchMessageByUID(deps, conn, targetDB, int64(uid), seqNum, items, mods, state); err != nil {
+			fetchErr = err
+		}
 	}
+
+	return fetchErr
 }
 
 func HandleFetch(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
@@ -76,6 +79,17 @@ func HandleFetch(deps ServerDeps, conn net.Conn, tag string, parts []string, sta
 	sequence := parts[2]
 	items := strings.Join(parts[3:], " ")
 
+	// RFC 7162: optional (CHANGEDSINCE n) modifier after the item list
+	items, mods, err := ParseFetchModifiers(items)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+		return
+	}
+	if mods.Vanished {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD VANISHED is only allowed with UID FETCH", tag))
+		return
+	}
+
 	// Handle FETCH macros: ALL, FAST, FULL
 	itemsUpper := strings.ToUpper(strings.TrimSpace(items))
 	switch itemsUpper {
@@ -90,102 +104,102 @@ func HandleFetch(deps ServerDeps, conn net.Conn, tag string, parts []string, sta
 		items = strings.Trim(items, "()")
 	}
 
-	var rows *sql.Rows
-
-	// Support for sequence ranges (e.g., 1:2, 2:4, 1:*, *)
-	seqRange := strings.Split(sequence, ":")
-	var start, end int
-	var useRange bool
-
-	if len(seqRange) == 2 {
-		useRange = true
-		if seqRange[0] == "*" {
-			start = -1 // will handle below
-		} else {
-			start, err = strconv.Atoi(seqRange[0])
-			if err != nil || start < 1 {
-				deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid sequence number", tag))
-				return
-			}
+	// CHANGEDSINCE implies the MODSEQ data item
+	if mods.ChangedSince > 0 {
+		state.CondStoreEnabled = true
+		if !strings.Contains(strings.ToUpper(items), "MODSEQ") {
+			items += " MODSEQ"
 		}
-		if seqRange[1] == "*" {
-			// Get max count for end using new schema
-			end, _ = db.GetMessageCountPerUser(targetDB, state.SelectedMailboxID)
-		} else {
-			end, err = strconv.Atoi(seqRange[1])
-			if err != nil || end < 1 {
-				deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid sequence number", tag))
-				return
-			}
+	}
+
+	// SEARCHRES: "$" refers to the messages saved by SEARCH RETURN (SAVE)
+	if sequence == "$" {
+		uids := make([]int, 0, len(state.SearchResult))
+		for _, uid := range state.SearchResult {
+			uids = append(uids, int(uid))
 		}
-		if start == -1 {
-			start = end
-		}
-		if end < start {
-			end = start
-		}
-		// Query message_mailbox for messages in selected mailbox using new schema
-		query := `SELECT mm.message_id, mm.uid, mm.flags
-		          FROM message_mailbox mm
-		          WHERE mm.mailbox_id = ?
-		          ORDER BY mm.uid ASC LIMIT ? OFFSET ?`
-		rows, err = targetDB.Query(query, state.SelectedMailboxID, end-start+1, start-1)
-	} else if sequence == "1:*" || sequence == "*" {
-		query := `SELECT mm.message_id, mm.uid, mm.flags
-		          FROM message_mailbox mm
-		          WHERE mm.mailbox_id = ?
-		          ORDER BY mm.uid ASC`
-		rows, err = targetDB.Query(query, state.SelectedMailboxID)
-	} else {
-		msgNum, parseErr := strconv.Atoi(sequence)
-		if parseErr != nil {
-			deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid sequence number", tag))
+		if err := HandleFetchForUIDsWithModifiers(deps, conn, tag, uids, items, mods, state); errors.Is(err, ErrUnknownCTE) {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO [UNKNOWN-CTE] Cannot decode message part", tag))
 			return
 		}
-		query := `SELECT mm.message_id, mm.uid, mm.flags
-		          FROM message_mailbox mm
-		          WHERE mm.mailbox_id = ?
-		          ORDER BY mm.uid ASC LIMIT 1 OFFSET ?`
-		rows, err = targetDB.Query(query, state.SelectedMailboxID, msgNum-1)
+		deps.SendResponse(conn, fmt.Sprintf("%s OK FETCH completed", tag))
+		return
 	}
 
-	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+	if !validSequenceSet(sequence) {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid sequence number", tag))
 		return
 	}
-	defer func() { _ = rows.Close() }()
 
-	seqNum := 1
-	if useRange {
-		seqNum = start
-	}
-	for rows.Next() {
-		var messageID int64
-		var uid int64
-		var flagsStr sql.NullString
-		if err := rows.Scan(&messageID, &uid, &flagsStr); err != nil {
-			continue
+	// Sequence numbers refer to the session's view of the mailbox
+	messages := utils.SelectedMessageMap(state, targetDB)
+	var fetchErr error
+	for _, seqNum := range utils.ParseSequenceSet(sequence, messages.Count()) {
+		uid, _ := messages.UID(seqNum)
+		if err := fetchMessageByUID(deps, conn, targetDB, uid, seqNum, items, mods, state); err != nil {
+			fetchErr = err
 		}
+	}
 
-		flags := ""
-		if flagsStr.Valid {
-			flags = flagsStr.String
-		}
+	if errors.Is(fetchErr, ErrUnknownCTE) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [UNKNOWN-CTE] Cannot decode message part", tag))
+		return
+	}
+	deps.SendResponse(conn, fmt.Sprintf("%s OK FETCH completed", tag))
+}
 
-		// Process this message
-		processFetchForMessage(deps, conn, messageID, uid, seqNum, flags, items, state)
-		seqNum++
+// fetchMessageByUID processes FETCH for one message of the selected mailbox.
+// Messages that another session expunged are skipped.
+func fetchMessageByUID(deps ServerDeps, conn net.Conn, targetDB *sql.DB, uid int64, seqNum int, items string, mods FetchModifiers, state *models.ClientState) error {
+	var messageID, modseq int64
+	var flags sql.NullString
+	err := targetDB.QueryRow(`
+		SELECT message_id, flags, modseq
+		FROM message_mailbox
+		WHERE mailbox_id = ? AND uid = ?
+	`, state.SelectedMailboxID, uid).Scan(&messageID, &flags, &modseq)
+	if err != nil {
+		return nil
 	}
 
-	deps.SendResponse(conn, fmt.Sprintf("%s OK FETCH completed", tag))
+	// CHANGEDSINCE: skip messages that have not been modified since the given mod-sequence
+	if mods.ChangedSince > 0 && modseq <= mods.ChangedSince {
+		return nil
+	}
+
+	return processFetchForMessage(deps, conn, messageID, uid, seqNum, flags.String, items, state)
 }
 
-// processFetchForMessage processes a single message for FETCH/UID FETCH
-func processFetchForMessage(deps ServerDeps, conn net.Conn, messageID, uid int64, seqNum int, flags, items string, state *models.ClientState) {
+// validSequenceSet reports whether set is a syntactically valid sequence set
+// such as "1,3:5,7:*"
+func validSequenceSet(set string) bool {
+	if set == "" {
+		return false
+	}
+	for _, part := range strings.Split(set, ",") {
+		bounds := strings.Split(part, ":")
+		if len(bounds) > 2 {
+			return false
+		}
+		for _, bound := range bounds {
+			if bound == "*" {
+				continue
+			}
+			if n, err := strconv.Atoi(bound); err != nil || n < 1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// processFetchForMessage processes a single message for FETCH/UID FETCH.
+// It returns ErrUnknownCTE when a requested BINARY section could not be decoded.
+func processFetchForMessage(deps ServerDeps, conn net.Conn, messageID, uid int64, seqNum int, flags, items string, state *models.ClientState) error {
 	// Get appropriate database (user or role mailbox)
 	targetDB, err := deps.GetSelectedDB(state)
 	if err != nil {
-		return
+		return err
 	}
 
 	// Lazy-load the full reconstructed message only when needed
@@ -210,11 +224,13 @@ func processFetchForMessage(deps ServerDeps, conn net.Conn, messageID, uid int64
 	itemsUpper := strings.ToUpper(items)
 	responseParts := []string{}
 	var literalData string // Store literal data separately
+	var fetchErr error     // Reported in the tagged response once all messages are sent
 
 	if strings.Contains(itemsUpper, "UID") {
 		responseParts = append(responseParts, fmt.Sprintf("UID %d", uid))
 	}
 	if strings.Contains(itemsUpper, "FLAGS") {
+		flags = utils.ClientFlags(flags, state)
 		if flags == "" {
 			flags = "()"
 		} else {
@@ -222,6 +238,42 @@ func processFetchForMessage(deps ServerDeps, conn net.Conn, messageID, uid int64
 		}
 		responseParts = append(responseParts, fmt.Sprintf("FLAGS %s", flags))
 	}
+	if strings.Contains(itemsUpper, "MODSEQ") {
+		// Any use of MODSEQ enables CONDSTORE for the session (RFC 7162 Section 3.1)
+		state.CondStoreEnabled = true
+		if modseq, err := db.GetMessageModSeqPerUser(targetDB, state.SelectedMailboxID, uid); err == nil {
+			responseParts = append(responseParts, formatModSeqItem(modseq))
+		}
+	}
+	// Stable identifiers (RFC 8474 Section 5)
+	if strings.Contains(itemsUpper, "EMAILID") {
+		responseParts = append(responseParts, fmt.Sprintf("EMAILID (%s)", db.EmailObjectID(messageID)))
+	}
+	if strings.Contains(itemsUpper, "THREADID") {
+		threadID, err := db.GetMessageThreadPerUser(targetDB, messageID)
+		if err != nil || threadID == 0 {
+			responseParts = append(responseParts, "THREADID NIL")
+		} else {
+			responseParts = append(responseParts, fmt.Sprintf("THREADID (%s)", db.ThreadObjectID(threadID)))
+		}
+	}
+	// PREVIEW (RFC 8970) is kept when the message is stored. Messages stored
+	// before that get it computed and saved now, unless the client only wants
+	// previews that are cheap to produce (LAZY).
+	if strings.Contains(itemsUpper, "PREVIEW") {
+		preview, stored, err := db.GetMessagePreview(targetDB, messageID)
+		if err == nil && !stored && !strings.Contains(itemsUpper, "PREVIEW (LAZY") {
+			if parsed, parseErr := parser.ParseMIMEMessage(loadRawMsg()); parseErr == nil {
+				preview, stored = parsed.Preview, true
+				_ = db.SetMessagePreview(targetDB, messageID, preview)
+			}
+		}
+		if stored {
+			responseParts = append(responseParts, "PREVIEW "+utils.QuoteString(preview))
+		} else {
+			responseParts = append(responseParts, "PREVIEW NIL")
+		}
+	}
 	if strings.Contains(itemsUpper, "INTERNALDATE") {
 		var internalDate time.Time
 		// Query message_mailbox for internal_date using new schema
@@ -237,6 +289,16 @@ func processFetchForMessage(deps ServerDeps, conn net.Conn, messageID, uid int64
 		}
 		responseParts = append(responseParts, fmt.Sprintf("INTERNALDATE \"%s\"", dateStr))
 	}
+	// SAVEDATE is when the message was added to this mailbox (RFC 8514)
+	if strings.Contains(itemsUpper, "SAVEDATE") {
+		var savedAt sql.NullTime
+		err := targetDB.QueryRow("SELECT added_at FROM message_mailbox WHERE mailbox_id = ? AND uid = ?", state.SelectedMailboxID, uid).Scan(&savedAt)
+		if err != nil || !savedAt.Valid {
+			responseParts = append(responseParts, "SAVEDATE NIL")
+		} else {
+			responseParts = append(responseParts, fmt.Sprintf("SAVEDATE \"%s\"", savedAt.Time.Format("02-Jan-2006 15:04:05 -0700")))
+		}
+	}
 	if strings.Contains(itemsUpper, "RFC822.SIZE") {
 		msg := loadRawMsg()
 		responseParts = append(responseParts, fmt.Sprintf("RFC822.SIZE %d", len(msg)))
@@ -350,27 +412,7 @@ func processFetchForMessage(deps ServerDeps, conn net.Conn, messageID, uid int64
 							payload = extractBodySectionByPath(fullMsg, partPath)
 						} else {
 							// Part body only - for non-multipart parts
-							if blobID, ok := target["blob_id"].(int64); ok {
-								// Get shared database for blob retrieval (blobs are now in shared DB)
-								sharedDB := deps.GetSharedDB()
-
-								// Try local storage first
-								if content, err := db.GetBlob(sharedDB, blobID); err == nil && content != "" {
-									payload = content
-								} else {
-									// Try S3 storage
-									s3Storage := deps.GetS3Storage()
-									if s3Storage != nil && s3Storage.IsEnabled() {
-										if s3BlobID, storageType, err := db.GetBlobS3BlobID(sharedDB, blobID); err == nil && storageType == "s3" && s3BlobID != "" {
-											if content, err := s3Storage.Retrieve(s3BlobID); err == nil {
-												payload = content
-											}
-										}
-									}
-								}
-							} else if textContent, ok := target["text_content"].(string); ok {
-								payload = textContent
-							}
+							payload = partContent(deps, target)
 						}
 					}
 
@@ -422,6 +464,23 @@ func processFetchForMessage(deps ServerDeps, conn net.Conn, messageID, uid int64
 		}
 	}
 
+	// Handle BINARY[section], BINARY.PEEK[section] and BINARY.SIZE[section] (RFC 3516)
+	if strings.Contains(itemsUpper, "BINARY") {
+		binaryItems, err := fetchBinaryItems(deps, targetDB, messageID, items, loadRawMsg)
+		if err != nil {
+			fetchErr = err
+		}
+		for _, item := range binaryItems {
+			responseParts = append(responseParts, item.label)
+			if item.literal {
+				if literalData != "" {
+					literalData += " "
+				}
+				literalData += formatLiteral8(item.data)
+			}
+		}
+	}
+
 	// Handle multiple body parts - process each separately
 	// Handle BODY.PEEK[HEADER.FIELDS (...)] or BODY[HEADER.FIELDS (...)] - specific header fields
 	if strings.Contains(itemsUpper, "BODY.PEEK[HEADER.FIELDS") || strings.Contains(itemsUpper, "BODY[HEADER.FIELDS") {
@@ -608,6 +667,8 @@ func processFetchForMessage(deps ServerDeps, conn net.Conn, messageID, uid int64
 	} else {
 		deps.SendResponse(conn, fmt.Sprintf("* %d FETCH (FLAGS ())", seqNum))
 	}
+
+	return fetchErr
 }
 
 // extractBodySectionByPath extracts a nested MIME body section using a part path like [1, 2] for part 1.2
@@ -1,6 +1,7 @@
 package message_test
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 
@@ -723,3 +724,132 @@ func TestFetchCommand_MultipartAlternativeWithAttachment(t *testing.T) {
 		t.Errorf("Expected valid FETCH response, got: %s", response)
 	}
 }
+
+// TestFetchCommand_SequenceNumbersStable tests that another session's EXPUNGE
+// does not shift sequence numbers until this session is told about it
+func TestFetchCommand_SequenceNumbersStable(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	for _, subject := range []string{"One", "Two", "Three"} {
+		server.InsertTestMail(t, database, "testuser", subject, "sender@test.com", "testuser@localhost", "INBOX")
+	}
+	srv.HandleSelect(conn, "S001", []string{"S001", "SELECT", "INBOX"}, state)
+
+	// Another session expunges the first message
+	otherConn := server.NewMockConn()
+	other := server.SetupAuthenticatedState(t, srv, "testuser")
+	srv.HandleSelect(otherConn, "S002", []string{"S002", "SELECT", "INBOX"}, other)
+	srv.HandleStore(otherConn, "S003", []string{"S003", "STORE", "1", "+FLAGS", "(\\Deleted)"}, other)
+	srv.HandleExpunge(otherConn, "S004", other)
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "F001", []string{"F001", "FETCH", "2", "(UID)"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "* 2 FETCH (UID 2)") {
+		t.Fatalf("Expected message 2 to keep its sequence number, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleNoop(conn, "N001", state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "* 1 EXPUNGE") {
+		t.Fatalf("Expected NOOP to report the EXPUNGE, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "F002", []string{"F002", "FETCH", "1:*", "(UID)"}, state)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* 1 FETCH (UID 2)") || !strings.Contains(response, "* 2 FETCH (UID 3)") || strings.Contains(response, "* 3 FETCH") {
+		t.Errorf("Expected the renumbered messages, got: %s", response)
+	}
+}
+
+// TestFetchCommand_ObjectIDs tests that EMAILID and THREADID are returned by
+// FETCH, survive MOVE and can be searched for (RFC 8474)
+func TestFetchCommand_ObjectIDs(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	server.InsertTestMail(t, database, "testuser", "One", "sender@test.com", "testuser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "testuser", "Two", "sender@test.com", "testuser@localhost", "INBOX")
+	server.CreateMailbox(t, database, "testuser", "Archive")
+	srv.HandleSelect(conn, "S001", []string{"S001", "SELECT", "INBOX"}, state)
+	if !strings.Contains(conn.GetWrittenData(), "* OK [MAILBOXID (") {
+		t.Errorf("Expected MAILBOXID in SELECT response, got: %s", conn.GetWrittenData())
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "F001", []string{"F001", "FETCH", "2", "(EMAILID", "THREADID)"}, state)
+	response := conn.GetWrittenData()
+	match := regexp.MustCompile(`\* 2 FETCH \(EMAILID \(([A-Za-z0-9_-]+)\) THREADID \(([A-Za-z0-9_-]+)\)\)`).FindStringSubmatch(response)
+	if match == nil {
+		t.Fatalf("Expected EMAILID and THREADID, got: %s", response)
+	}
+	emailID, threadID := match[1], match[2]
+
+	srv.HandleMove(conn, "M001", []string{"M001", "MOVE", "2", "Archive"}, state)
+	srv.HandleSelect(conn, "S002", []string{"S002", "SELECT", "Archive"}, state)
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "F002", []string{"F002", "FETCH", "1", "(UID", "EMAILID)"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "EMAILID ("+emailID+")") {
+		t.Errorf("Expected EMAILID %s after MOVE, got: %s", emailID, response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleSearch(conn, "SR01", []string{"SR01", "SEARCH", "EMAILID", emailID}, state)
+	srv.HandleSearch(conn, "SR02", []string{"SR02", "SEARCH", "THREADID", threadID}, state)
+	srv.HandleSearch(conn, "SR03", []string{"SR03", "SEARCH", "EMAILID", "unknown"}, state)
+	response = conn.GetWrittenData()
+	if strings.Count(response, "* SEARCH 1\r\n") != 2 {
+		t.Errorf("Expected EMAILID and THREADID searches to match message 1, got: %s", response)
+	}
+	if !strings.Contains(response, "* SEARCH\r\nSR03 OK") {
+		t.Errorf("Expected unknown EMAILID to match nothing, got: %s", response)
+	}
+}
+
+// TestFetchCommand_Preview tests the PREVIEW fetch item (RFC 8970), for a
+// message stored with a preview and one stored before previews were kept
+func TestFetchCommand_Preview(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	server.InsertTestRawMail(t, database, "testuser", "From: a@example.com\r\nSubject: Lunch\r\n\r\nShall we meet   at \"noon\"?\r\n", "INBOX")
+	legacyID := server.InsertTestMail(t, database, "testuser", "Old", "sender@test.com", "testuser@localhost", "INBOX")
+	userDB, err := database.GetUserDB(state.Email)
+	if err != nil {
+		t.Fatalf("Failed to get user database: %v", err)
+	}
+	if _, err := userDB.Exec("UPDATE messages SET preview = NULL WHERE id = ?", legacyID); err != nil {
+		t.Fatalf("Failed to clear preview: %v", err)
+	}
+	srv.HandleSelect(conn, "S001", []string{"S001", "SELECT", "INBOX"}, state)
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "F001", []string{"F001", "FETCH", "1:2", "(PREVIEW", "(LAZY))"}, state)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* 1 FETCH (PREVIEW "Shall we meet at \"noon\"?")`) {
+		t.Errorf("Expected the stored preview, got: %s", response)
+	}
+	if !strings.Contains(response, "* 2 FETCH (PREVIEW NIL)") {
+		t.Errorf("Expected NIL for a lazy preview that is not stored, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "F002", []string{"F002", "FETCH", "2", "(PREVIEW)"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* 2 FETCH (PREVIEW "Test message body")`) {
+		t.Errorf("Expected the preview to be computed, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "F003", []string{"F003", "FETCH", "2", "(PREVIEW", "(LAZY))"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* 2 FETCH (PREVIEW "Test message body")`) {
+		t.Errorf("Expected the computed preview to be saved, got: %s", response)
+	}
+}
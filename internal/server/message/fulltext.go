@@ -0,0 +1,59 @@
+package message
+
+import (
+	"database/sql"
+
+	"raven/internal/db"
+)
+
+// searchIndex answers the string search keys of one search from the
+// full-text index of the user's database. It is opened on the first string
+// key, and each key and string is looked up only once. Messages that are not
+// in the index, such as those stored before it existed, are left to
+// matchesHeaderOrBody.
+type searchIndex struct {
+	deps    messageStore
+	email   string
+	opened  bool
+	userDB  *sql.DB
+	indexed map[int64]bool
+	results map[string]map[int64]bool
+}
+
+func newSearchIndex(deps messageStore, email string) *searchIndex {
+	return &searchIndex{deps: deps, email: email, results: make(map[string]map[int64]bool)}
+}
+
+// match reports whether a message matches a SUBJECT, FROM, TO, CC, BCC, BODY
+// or TEXT key. ok is false when the index cannot tell.
+func (s *searchIndex) match(msg messageInfo, key string, searchStr string) (matched bool, ok bool) {
+	if s == nil || !s.open() || !s.indexed[msg.messageID] {
+		return false, false
+	}
+
+	lookup := key + " " + searchStr
+	ids, found := s.results[lookup]
+	if !found {
+		var err error
+		if ids, err = db.SearchIndexMatchesPerUser(s.userDB, key, searchStr); err != nil {
+			return false, false
+		}
+		s.results[lookup] = ids
+	}
+	return ids[msg.messageID], true
+}
+
+func (s *searchIndex) open() bool {
+	if !s.opened {
+		s.opened = true
+		userDB, err := s.deps.GetUserDB(s.email)
+		if err != nil || !db.SearchIndexAvailable(userDB) {
+			return false
+		}
+		if s.indexed, err = db.GetIndexedMessagesPerUser(userDB); err != nil {
+			return false
+		}
+		s.userDB = userDB
+	}
+	return s.userDB != nil
+}
@@ -1,11 +1,14 @@
 package message
 
 import (
+	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -21,12 +24,21 @@ import (
 type ServerDeps interface {
 	SendResponse(conn net.Conn, response string)
 	GetUserDB(email string) (*sql.DB, error)
+	GetUserRoles(email string) []string
 	GetSelectedDB(state *models.ClientState) (*sql.DB, error)
 	GetSharedDB() *sql.DB
 	GetDBManager() *db.DBManager
 	GetS3Storage() *blobstorage.S3BlobStorage
 }
 
+// messageStore is where SEARCH reads the messages it cannot match from their
+// metadata alone. ServerDeps provides it for the user's own databases.
+type messageStore interface {
+	GetUserDB(email string) (*sql.DB, error)
+	GetSharedDB() *sql.DB
+	GetS3Storage() *blobstorage.S3BlobStorage
+}
+
 // ===== SEARCH =====
 
 // messageInfo holds metadata about a message for search operations
@@ -36,12 +48,16 @@ type messageInfo struct {
 	flags        string
 	internalDate time.Time
 	seqNum       int
+	modseq       int64
+	threadID     int64
+	savedAt      time.Time
 }
 
 // SearchMatch describes a mailbox message that matched SEARCH criteria.
 type SearchMatch struct {
 	UID    int64
 	SeqNum int
+	ModSeq int64
 }
 
 func resolveStateEmail(state *models.ClientState) string {
@@ -81,74 +97,124 @@ func HandleSearch(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
+	// RFC 4731: optional RETURN (...) options come before CHARSET
+	returnOpts, rest, err := ParseSearchReturnOptions(parts[2:])
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+		return
+	}
+
 	// Check for CHARSET specification
-	searchStart := 2
-	charset := "US-ASCII"
-	if len(parts) > 3 && strings.ToUpper(parts[2]) == "CHARSET" {
-		charset = strings.ToUpper(parts[3])
-		searchStart = 4
-
-		// RFC 3501: US-ASCII MUST be supported, other charsets MAY be supported
-		if charset != "US-ASCII" && charset != "UTF-8" {
-			// Return tagged NO with BADCHARSET response code
-			deps.SendResponse(conn, fmt.Sprintf("%s NO [BADCHARSET (US-ASCII UTF-8)] Charset not supported", tag))
-			return
-		}
+	charset, criteria, ok := parseSearchCharset(rest)
+	if !ok {
+		// Return tagged NO with BADCHARSET response code
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [BADCHARSET (US-ASCII UTF-8)] Charset not supported", tag))
+		return
 	}
 
-	if searchStart >= len(parts) {
+	if len(criteria) == 0 {
 		deps.SendResponse(conn, fmt.Sprintf("%s BAD SEARCH requires search criteria", tag))
 		return
 	}
 
-	email := resolveStateEmail(state)
-	matches, err := SearchMailboxMatchesTokens(targetDB, state.SelectedMailboxID, parts[searchStart:], charset, email, deps)
+	email := SelectedAccountEmail(state)
+	tokens := ExpandSearchResultTokens(criteria, state.SearchResult)
+	matches, err := SearchMailboxMatchesTokens(targetDB, state.SelectedMailboxID, utils.SelectedMessageMap(state, targetDB), tokens, charset, email, deps)
 	if err != nil {
+		// RFC 5182: a failed SEARCH with SAVE empties the saved result
+		if returnOpts.Save {
+			state.SearchResult = nil
+		}
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Search failed: %v", tag, err))
 		return
 	}
 
 	// Build response
-	if len(matches) > 0 {
-		var results []string
-		for _, match := range matches {
-			results = append(results, strconv.Itoa(match.SeqNum))
-		}
-		deps.SendResponse(conn, fmt.Sprintf("* SEARCH %s", strings.Join(results, " ")))
-	} else {
-		deps.SendResponse(conn, "* SEARCH")
-	}
+	SendSearchResults(deps, conn, tag, false, returnOpts, tokens, matches, state)
 	deps.SendResponse(conn, fmt.Sprintf("%s OK SEARCH completed", tag))
 }
 
+// parseSearchCharset parses an optional leading "CHARSET name" and returns
+// the charset and the remaining criteria. ok is false for a charset other than
+// US-ASCII, which MUST be supported (RFC 3501), and UTF-8.
+func parseSearchCharset(args []string) (charset string, criteria []string, ok bool) {
+	charset = "US-ASCII"
+	if len(args) > 1 && strings.ToUpper(args[0]) == "CHARSET" {
+		charset = strings.ToUpper(args[1])
+		args = args[2:]
+	}
+	return charset, args, charset == "US-ASCII" || charset == "UTF-8"
+}
+
 // SearchMailboxMatches evaluates IMAP SEARCH criteria against a mailbox and
 // returns the matching sequence numbers and UIDs from the selected mailbox.
 func SearchMailboxMatches(targetDB *sql.DB, mailboxID int64, criteria string, charset string, email string, deps ServerDeps) ([]SearchMatch, error) {
-	return SearchMailboxMatchesTokens(targetDB, mailboxID, parseSearchTokens(criteria), charset, email, deps)
+	return SearchMailboxMatchesTokens(targetDB, mailboxID, nil, parseSearchTokens(criteria), charset, email, deps)
 }
 
 // SearchMailboxMatchesTokens evaluates already-tokenized IMAP SEARCH criteria.
 // This preserves multi-word string arguments that were parsed by the command layer.
-func SearchMailboxMatchesTokens(targetDB *sql.DB, mailboxID int64, tokens []string, charset string, email string, deps ServerDeps) ([]SearchMatch, error) {
+// When view is set, sequence numbers come from that session's message map and
+// messages outside it are not matched.
+func SearchMailboxMatchesTokens(targetDB *sql.DB, mailboxID int64, view *models.MessageMap, tokens []string, charset string, email string, deps ServerDeps) ([]SearchMatch, error) {
+	loaded, err := loadSearchMessages(targetDB, []int64{mailboxID})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := loaded[mailboxID]
+	if view != nil {
+		visible := messages[:0]
+		for _, msg := range messages {
+			seqNum, ok := view.SeqNum(msg.uid)
+			if !ok {
+				continue
+			}
+			msg.seqNum = seqNum
+			visible = append(visible, msg)
+		}
+		messages = visible
+	}
+
+	return matchSearchMessages(messages, tokens, charset, email, deps), nil
+}
+
+// loadSearchMessages reads the messages of the given mailboxes in one query,
+// by mailbox and in UID order. Sequence numbers are numbered per mailbox.
+func loadSearchMessages(targetDB *sql.DB, mailboxIDs []int64) (map[int64][]messageInfo, error) {
+	loaded := make(map[int64][]messageInfo, len(mailboxIDs))
+	if len(mailboxIDs) == 0 {
+		return loaded, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(mailboxIDs)), ", ")
+	args := make([]interface{}, len(mailboxIDs))
+	for i, id := range mailboxIDs {
+		args[i] = id
+	}
+
+	// #nosec G202 -- only placeholders are added to the query
 	query := `
-		SELECT mm.message_id, mm.uid, mm.flags, mm.internal_date,
-		       ROW_NUMBER() OVER (ORDER BY mm.uid ASC) as seq_num
+		SELECT mm.mailbox_id, mm.message_id, mm.uid, mm.flags, mm.internal_date, mm.modseq,
+		       COALESCE(m.thread_id, 0), mm.added_at,
+		       ROW_NUMBER() OVER (PARTITION BY mm.mailbox_id ORDER BY mm.uid ASC) as seq_num
 		FROM message_mailbox mm
-		WHERE mm.mailbox_id = ?
-		ORDER BY mm.uid ASC
+		LEFT JOIN messages m ON m.id = mm.message_id
+		WHERE mm.mailbox_id IN (` + placeholders + `)
+		ORDER BY mm.mailbox_id, mm.uid ASC
 	`
-	rows, err := targetDB.Query(query, mailboxID)
+	rows, err := targetDB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = rows.Close() }()
 
-	var messages []messageInfo
 	for rows.Next() {
 		var msg messageInfo
+		var mailboxID int64
 		var flagsStr sql.NullString
-		var internalDate sql.NullTime
-		if err := rows.Scan(&msg.messageID, &msg.uid, &flagsStr, &internalDate, &msg.seqNum); err != nil {
+		var internalDate, savedAt sql.NullTime
+		if err := rows.Scan(&mailboxID, &msg.messageID, &msg.uid, &flagsStr, &internalDate, &msg.modseq, &msg.threadID, &savedAt, &msg.seqNum); err != nil {
 			continue
 		}
 		if flagsStr.Valid {
@@ -157,28 +223,34 @@ func SearchMailboxMatchesTokens(targetDB *sql.DB, mailboxID int64, tokens []stri
 		if internalDate.Valid {
 			msg.internalDate = internalDate.Time
 		}
-		messages = append(messages, msg)
+		if savedAt.Valid {
+			msg.savedAt = savedAt.Time
+		}
+		loaded[mailboxID] = append(loaded[mailboxID], msg)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+	return loaded, rows.Err()
+}
 
+// matchSearchMessages returns the messages that match the search criteria
+func matchSearchMessages(messages []messageInfo, tokens []string, charset string, email string, deps messageStore) []SearchMatch {
 	if len(tokens) == 0 {
 		tokens = []string{"ALL"}
 	}
 
+	index := newSearchIndex(deps, email)
 	matches := make([]SearchMatch, 0, len(messages))
 	for _, msg := range messages {
-		if matchesSearchCriteria(msg, tokens, charset, email, deps) {
+		if matchesSearchCriteria(msg, tokens, charset, email, deps, index) {
 			matches = append(matches, SearchMatch{
 				UID:    msg.uid,
 				SeqNum: msg.seqNum,
+				ModSeq: msg.modseq,
 			})
 		}
 	}
 
-	return matches, nil
+	return matches
 }
 
 // parseSearchTokens tokenizes search criteria
@@ -225,18 +297,18 @@ func parseSearchTokens(criteria string) []string {
 }
 
 // matchesSearchCriteria checks if a message matches the search criteria
-func matchesSearchCriteria(msg messageInfo, tokens []string, charset string, email string, deps ServerDeps) bool {
+func matchesSearchCriteria(msg messageInfo, tokens []string, charset string, email string, deps messageStore, index *searchIndex) bool {
 	// Default to ALL - match everything
 	if len(tokens) == 0 {
 		return true
 	}
 
 	// Process tokens (AND logic by default)
-	return evaluateTokens(msg, tokens, charset, email, deps)
+	return evaluateTokens(msg, tokens, charset, email, deps, index)
 }
 
 // evaluateTokens evaluates a list of search tokens
-func evaluateTokens(msg messageInfo, tokens []string, charset string, email string, deps ServerDeps) bool {
+func evaluateTokens(msg messageInfo, tokens []string, charset string, email string, deps messageStore, index *searchIndex) bool {
 	i := 0
 	for i < len(tokens) {
 		token := strings.ToUpper(tokens[i])
@@ -348,7 +420,7 @@ func evaluateTokens(msg messageInfo, tokens []string, charset string, email stri
 				i++
 				nextTokens = append(nextTokens, tokens[i])
 			}
-			if evaluateTokens(msg, nextTokens, charset, email, deps) {
+			if evaluateTokens(msg, nextTokens, charset, email, deps, index) {
 				return false
 			}
 			i++
@@ -370,7 +442,7 @@ func evaluateTokens(msg messageInfo, tokens []string, charset string, email stri
 				i++
 				key2Tokens = append(key2Tokens, tokens[i])
 			}
-			if !evaluateTokens(msg, key1Tokens, charset, email, deps) && !evaluateTokens(msg, key2Tokens, charset, email, deps) {
+			if !evaluateTokens(msg, key1Tokens, charset, email, deps, index) && !evaluateTokens(msg, key2Tokens, charset, email, deps, index) {
 				return false
 			}
 			i++
@@ -382,7 +454,11 @@ func evaluateTokens(msg messageInfo, tokens []string, charset string, email stri
 			}
 			i++
 			searchStr := unquote(tokens[i])
-			if !matchesHeaderOrBody(msg, token, searchStr, charset, email, deps) {
+			if matched, ok := index.match(msg, token, searchStr); ok {
+				if !matched {
+					return false
+				}
+			} else if !matchesHeaderOrBody(msg, token, searchStr, charset, email, deps) {
 				return false
 			}
 			i++
@@ -472,6 +548,22 @@ func evaluateTokens(msg messageInfo, tokens []string, charset string, email stri
 			}
 			i++
 
+		case "SAVEDBEFORE", "SAVEDON", "SAVEDSINCE":
+			// Date-based searches on the save date (RFC 8514)
+			if i+1 >= len(tokens) {
+				return false
+			}
+			i++
+			dateStr := unquote(tokens[i])
+			if msg.savedAt.IsZero() || !matchesDate(msg.savedAt, dateStr, strings.TrimPrefix(token, "SAVED")) {
+				return false
+			}
+			i++
+
+		case "SAVEDATESUPPORTED":
+			// Every mailbox keeps save dates
+			i++
+
 		case "SENTBEFORE", "SENTON", "SENTSINCE":
 			// Date-based searches on Date: header
 			if i+1 >= len(tokens) {
@@ -484,6 +576,36 @@ func evaluateTokens(msg messageInfo, tokens []string, charset string, email stri
 			}
 			i++
 
+		case "MODSEQ":
+			// MODSEQ [<entry-name> <entry-type-req>] <mod-sequence-valzer> (RFC 7162)
+			if i+1 >= len(tokens) {
+				return false
+			}
+			i++
+			if strings.HasPrefix(tokens[i], "\"") {
+				// Per-flag metadata entries are not tracked separately; skip name and type
+				if i+2 >= len(tokens) {
+					return false
+				}
+				i += 2
+			}
+			modseq, err := strconv.ParseInt(tokens[i], 10, 64)
+			if err != nil || msg.modseq < modseq {
+				return false
+			}
+			i++
+
+		case "EMAILID", "THREADID":
+			// EMAILID <objectid> / THREADID <objectid> (RFC 8474 Section 6)
+			if i+1 >= len(tokens) {
+				return false
+			}
+			i++
+			if !matchesObjectID(msg, token, unquote(tokens[i])) {
+				return false
+			}
+			i++
+
 		default:
 			// Unknown search keys must not silently match everything.
 			return false
@@ -493,6 +615,34 @@ func evaluateTokens(msg messageInfo, tokens []string, charset string, email stri
 	return true
 }
 
+// SearchModSeqSuffix returns the " (MODSEQ n)" suffix required in SEARCH responses
+// when the criteria contained MODSEQ (RFC 7162 Section 3.1.5)
+func SearchModSeqSuffix(tokens []string, matches []SearchMatch) string {
+	if len(matches) == 0 {
+		return ""
+	}
+
+	usesModSeq := false
+	for _, token := range tokens {
+		if strings.EqualFold(strings.Trim(token, "()"), "MODSEQ") {
+			usesModSeq = true
+			break
+		}
+	}
+	if !usesModSeq {
+		return ""
+	}
+
+	var highest int64
+	for _, match := range matches {
+		if match.ModSeq > highest {
+			highest = match.ModSeq
+		}
+	}
+
+	return fmt.Sprintf(" (MODSEQ %d)", highest)
+}
+
 // Helper functions for search criteria evaluation
 
 func isSequenceSet(token string) bool {
@@ -547,7 +697,7 @@ func matchesUIDSet(uid int, set string) bool {
 	return matchesSequenceSet(uid, set)
 }
 
-func matchesHeaderOrBody(msg messageInfo, field string, searchStr string, charset string, email string, deps ServerDeps) bool {
+func matchesHeaderOrBody(msg messageInfo, field string, searchStr string, charset string, email string, deps messageStore) bool {
 	// Get user database
 	userDB, err := deps.GetUserDB(email)
 	if err != nil {
@@ -596,7 +746,7 @@ func matchesHeaderOrBody(msg messageInfo, field string, searchStr string, charse
 	return false
 }
 
-func matchesHeader(msg messageInfo, fieldName string, searchStr string, charset string, email string, deps ServerDeps) bool {
+func matchesHeader(msg messageInfo, fieldName string, searchStr string, charset string, email string, deps messageStore) bool {
 	// Get user database
 	userDB, err := deps.GetUserDB(email)
 	if err != nil {
@@ -674,7 +824,7 @@ func headerContains(rawMsg string, fieldName string, searchStr string) bool {
 	return strings.Contains(strings.ToUpper(headerValue.String()), searchStrUpper)
 }
 
-func matchesSize(msg messageInfo, size int, larger bool, email string, deps ServerDeps) bool {
+func matchesSize(msg messageInfo, size int, larger bool, email string, deps messageStore) bool {
 	// Get user database
 	userDB, err := deps.GetUserDB(email)
 	if err != nil {
@@ -697,6 +847,16 @@ func matchesSize(msg messageInfo, size int, larger bool, email string, deps Serv
 	return msgSize < size
 }
 
+// matchesObjectID reports whether a message has the given EMAILID or THREADID
+func matchesObjectID(msg messageInfo, key, objectID string) bool {
+	if key == "EMAILID" {
+		id, ok := db.ParseEmailObjectID(objectID)
+		return ok && id == msg.messageID
+	}
+	id, ok := db.ParseThreadObjectID(objectID)
+	return ok && id == msg.threadID
+}
+
 func matchesDate(internalDate time.Time, dateStr string, comparison string) bool {
 	// Parse RFC 3501 date format: "1-Feb-1994" or "01-Feb-1994"
 	targetDate, err := parseIMAPDate(dateStr)
@@ -720,7 +880,7 @@ func matchesDate(internalDate time.Time, dateStr string, comparison string) bool
 	return false
 }
 
-func matchesSentDate(msg messageInfo, dateStr string, comparison string, email string, deps ServerDeps) bool {
+func matchesSentDate(msg messageInfo, dateStr string, comparison string, email string, deps messageStore) bool {
 	// Get user database
 	userDB, err := deps.GetUserDB(email)
 	if err != nil {
@@ -795,7 +955,9 @@ func requiresArgument(token string) bool {
 	switch token {
 	case "BCC", "CC", "FROM", "SUBJECT", "TO", "BODY", "TEXT",
 		"KEYWORD", "UNKEYWORD", "LARGER", "SMALLER", "UID",
-		"BEFORE", "ON", "SINCE", "SENTBEFORE", "SENTON", "SENTSINCE":
+		"BEFORE", "ON", "SINCE", "SENTBEFORE", "SENTON", "SENTSINCE", "MODSEQ",
+		"SAVEDBEFORE", "SAVEDON", "SAVEDSINCE",
+		"EMAILID", "THREADID":
 		return true
 	case "HEADER":
 		return true // Actually requires 2 arguments, but handle separately
@@ -824,7 +986,22 @@ func HandleStore(deps ServerDeps, conn net.Conn, tag string, parts []string, sta
 	}
 
 	sequenceSet := parts[2]
-	dataItem := strings.ToUpper(parts[3])
+
+	// RFC 7162: optional (UNCHANGEDSINCE n) modifier before the data item
+	storeArgs, unchangedSince, conditional, err := ParseStoreModifier(parts[3:])
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+		return
+	}
+	if len(storeArgs) == 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD STORE requires sequence set, data item, and value", tag))
+		return
+	}
+	if conditional {
+		state.CondStoreEnabled = true
+	}
+
+	dataItem := strings.ToUpper(storeArgs[0])
 
 	// Check if .SILENT suffix is used
 	silent := strings.HasSuffix(dataItem, ".SILENT")
@@ -833,45 +1010,80 @@ func HandleStore(deps ServerDeps, conn net.Conn, tag string, parts []string, sta
 	}
 
 	// Parse flags from remaining parts
-	flagsPart := strings.Join(parts[4:], " ")
+	flagsPart := strings.Join(storeArgs[1:], " ")
 	flagsPart = strings.Trim(flagsPart, "()")
 	newFlags := strings.Fields(flagsPart)
 
 	// Validate data item
 	if dataItem != "FLAGS" && dataItem != "+FLAGS" && dataItem != "-FLAGS" {
-		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid data item: %s", tag, parts[3]))
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid data item: %s", tag, storeArgs[0]))
 		return
 	}
 
-	// Get user database
-	userDB, err := deps.GetUserDB(resolveStateEmail(state))
+	// RFC 4314: each kind of flag needs its own right on a shared mailbox
+	if !utils.HasRights(utils.SelectedRights(state), StoreRequiredRights(dataItem, newFlags)) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+
+	// A read-only mailbox (EXAMINE) must not change (RFC 9051 Section 6.3.3)
+	if state.ReadOnly {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Mailbox is read-only", tag))
+		return
+	}
+
+	// Get the selected mailbox's database
+	userDB, err := deps.GetSelectedDB(state)
 	if err != nil {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
 		return
 	}
 
-	// Parse sequence set
-	sequences := utils.ParseSequenceSetWithDB(sequenceSet, state.SelectedMailboxID, userDB)
+	// Parse sequence set against the session's view of the mailbox
+	messages := utils.SelectedMessageMap(state, userDB)
+	sequenceSet = utils.ExpandSearchResult(sequenceSet, state.SearchResult, messages, false)
+	sequences := utils.ParseSequenceSet(sequenceSet, messages.Count())
 	if len(sequences) == 0 {
 		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid sequence set", tag))
 		return
 	}
 
-	// Process each message in the sequence
+	// Resolve UIDs up front, since auto-moved messages shift later sequence numbers
+	uids := make([]int64, 0, len(sequences))
 	for _, seqNum := range sequences {
-		// Get message by sequence number
+		uid, _ := messages.UID(seqNum)
+		uids = append(uids, uid)
+	}
+
+	// Messages that failed the UNCHANGEDSINCE test
+	var modifiedSeqs []int64
+
+	// Auto-moved messages also change the Spam or original folder
+	changedMailboxID := state.SelectedMailboxID
+
+	// Process each message in the sequence
+	for _, uid := range uids {
+		seqNum, ok := messages.SeqNum(uid)
+		if !ok {
+			continue
+		}
+
 		query := `
-			SELECT mm.message_id, mm.uid, mm.flags, mm.internal_date
+			SELECT mm.message_id, mm.flags, mm.internal_date, mm.modseq
 			FROM message_mailbox mm
-			WHERE mm.mailbox_id = ?
-			ORDER BY mm.uid ASC
-			LIMIT 1 OFFSET ?
+			WHERE mm.mailbox_id = ? AND mm.uid = ?
 		`
-		var messageID, uid int64
+		var messageID, modseq int64
 		var currentFlags, internalDate string
-		err := userDB.QueryRow(query, state.SelectedMailboxID, seqNum-1).Scan(&messageID, &uid, &currentFlags, &internalDate)
+		err := userDB.QueryRow(query, state.SelectedMailboxID, uid).Scan(&messageID, &currentFlags, &internalDate, &modseq)
 		if err != nil {
-			// Message not found - skip
+			// Message expunged by another session - skip
+			continue
+		}
+
+		// Conditional STORE: leave messages modified after UNCHANGEDSINCE untouched
+		if conditional && modseq > unchangedSince {
+			modifiedSeqs = append(modifiedSeqs, int64(seqNum))
 			continue
 		}
 
@@ -898,9 +1110,11 @@ func HandleStore(deps ServerDeps, conn net.Conn, tag string, parts []string, sta
 				log.Printf("Failed to move message %d to Spam: %v", messageID, err)
 			} else {
 				log.Printf("Auto-moved message %d to Spam folder (Junk flag added)", messageID)
+				changedMailboxID = db.AllMailboxes
 				// Send EXPUNGE notification to tell client the message is gone from this mailbox
 				if !silent {
-					deps.SendResponse(conn, fmt.Sprintf("* %d EXPUNGE", seqNum))
+					messages.Expunge(uid)
+					SendExpungeNotifications(deps, conn, state, []int{seqNum}, []int64{uid})
 				}
 				// Message was moved - don't send FETCH response since it's no longer in this mailbox
 				continue
@@ -935,9 +1149,11 @@ func HandleStore(deps ServerDeps, conn net.Conn, tag string, parts []string, sta
 				log.Printf("Failed to move message %d to %s: %v", messageID, targetFolder, err)
 			} else {
 				log.Printf("Auto-moved message %d to %s (NonJunk flag added)", messageID, targetFolder)
+				changedMailboxID = db.AllMailboxes
 				// Send EXPUNGE notification to tell client the message is gone from this mailbox
 				if !silent {
-					deps.SendResponse(conn, fmt.Sprintf("* %d EXPUNGE", seqNum))
+					messages.Expunge(uid)
+					SendExpungeNotifications(deps, conn, state, []int{seqNum}, []int64{uid})
 				}
 				// Message was moved - don't send FETCH response since it's no longer in this mailbox
 				continue
@@ -951,17 +1167,28 @@ func HandleStore(deps ServerDeps, conn net.Conn, tag string, parts []string, sta
 			log.Printf("Failed to update flags for message %d: %v", messageID, err)
 			continue
 		}
+		messages.SetFlags(uid, updatedFlags)
 
 		// Send untagged FETCH response unless .SILENT
-		if !silent {
-			flagsFormatted := "()"
-			if updatedFlags != "" {
-				flagsFormatted = fmt.Sprintf("(%s)", updatedFlags)
+		// A conditional STORE always reports the new MODSEQ (RFC 7162 Section 3.1.3)
+		if !silent || conditional {
+			flagsFormatted := fmt.Sprintf("(%s)", utils.ClientFlags(updatedFlags, state))
+			if state.CondStoreEnabled {
+				newModSeq, _ := db.GetMessageModSeqPerUser(userDB, state.SelectedMailboxID, uid)
+				deps.SendResponse(conn, fmt.Sprintf("* %d FETCH (FLAGS %s %s)", seqNum, flagsFormatted, formatModSeqItem(newModSeq)))
+			} else {
+				deps.SendResponse(conn, fmt.Sprintf("* %d FETCH (FLAGS %s)", seqNum, flagsFormatted))
 			}
-			deps.SendResponse(conn, fmt.Sprintf("* %d FETCH (FLAGS %s)", seqNum, flagsFormatted))
 		}
 	}
 
+	deps.GetDBManager().MailboxChanges().Publish(userDB, changedMailboxID)
+
+	if len(modifiedSeqs) > 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s OK [MODIFIED %s] Conditional STORE failed", tag, utils.FormatSequenceSet(modifiedSeqs)))
+		return
+	}
+
 	deps.SendResponse(conn, fmt.Sprintf("%s OK STORE completed", tag))
 }
 
@@ -1063,18 +1290,23 @@ func HandleCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 	// Some tests call handler directly with parts starting at COPY,
 	// while server command dispatch includes the tag as parts[0].
 	var sequenceSet string
-	var destMailbox string
+	var destArg string
 	switch {
 	case len(parts) >= 3 && strings.EqualFold(parts[0], "COPY"):
 		sequenceSet = parts[1]
-		destMailbox = strings.Trim(strings.Join(parts[2:], " "), "\"")
+		destArg = strings.Join(parts[2:], " ")
 	case len(parts) >= 4 && strings.EqualFold(parts[1], "COPY"):
 		sequenceSet = parts[2]
-		destMailbox = strings.Trim(strings.Join(parts[3:], " "), "\"")
+		destArg = strings.Join(parts[3:], " ")
 	default:
 		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid COPY command syntax", tag))
 		return
 	}
+	destMailbox, err := utils.ParseMailboxArgument(destArg, state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
 
 	// Use selected database so COPY works for both regular and role mailboxes
 	targetDB, err := deps.GetSelectedDB(state)
@@ -1083,23 +1315,29 @@ func HandleCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 		return
 	}
 
-	// Parse sequence set
-	sequences := utils.ParseSequenceSetWithDB(sequenceSet, state.SelectedMailboxID, targetDB)
+	// Parse sequence set against the session's view of the mailbox
+	messages := utils.SelectedMessageMap(state, targetDB)
+	sequenceSet = utils.ExpandSearchResult(sequenceSet, state.SearchResult, messages, false)
+	sequences := utils.ParseSequenceSet(sequenceSet, messages.Count())
 	if len(sequences) == 0 {
 		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid sequence set", tag))
 		return
 	}
+	uids := make([]int, 0, len(sequences))
+	for _, seqNum := range sequences {
+		uid, _ := messages.UID(seqNum)
+		uids = append(uids, int(uid))
+	}
 
-	// Check if destination mailbox exists
-	var destMailboxID int64
-	err = targetDB.QueryRow(`
-		SELECT id FROM mailboxes
-		WHERE name = ?
-	`, destMailbox).Scan(&destMailboxID)
+	// Check that the destination mailbox exists and accepts messages
+	destMailboxID, failure := ResolveCopyTarget(targetDB, state, destMailbox)
+	if failure != "" {
+		deps.SendResponse(conn, fmt.Sprintf("%s %s", tag, failure))
+		return
+	}
 
-	if err != nil {
-		// Destination mailbox doesn't exist - return NO with [TRYCREATE]
-		deps.SendResponse(conn, fmt.Sprintf("%s NO [TRYCREATE] Destination mailbox does not exist", tag))
+	if CopyExceedsQuota(targetDB, state.SelectedMailboxID, uids, true) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [OVERQUOTA] Quota exceeded", tag))
 		return
 	}
 
@@ -1111,21 +1349,8 @@ func HandleCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	// Get the next UID for destination mailbox
-	var nextUID int64
-	err = tx.QueryRow(`
-		SELECT COALESCE(MAX(uid), 0) + 1
-		FROM message_mailbox
-		WHERE mailbox_id = ?
-	`, destMailboxID).Scan(&nextUID)
-
-	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO COPY failed: %v", tag, err))
-		return
-	}
-
 	// Copy each message in the sequence
-	for _, seqNum := range sequences {
+	for _, uid := range uids {
 		// Get message details from source mailbox
 		var messageID int64
 		var flags, internalDate string
@@ -1133,10 +1358,8 @@ func HandleCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 		err = tx.QueryRow(`
 			SELECT mm.message_id, mm.flags, mm.internal_date
 			FROM message_mailbox mm
-			WHERE mm.mailbox_id = ?
-			ORDER BY mm.uid
-			LIMIT 1 OFFSET ?
-		`, state.SelectedMailboxID, seqNum-1).Scan(&messageID, &flags, &internalDate)
+			WHERE mm.mailbox_id = ? AND mm.uid = ?
+		`, state.SelectedMailboxID, uid).Scan(&messageID, &flags, &internalDate)
 
 		if err != nil {
 			deps.SendResponse(conn, fmt.Sprintf("%s NO COPY failed: %v", tag, err))
@@ -1153,6 +1376,12 @@ func HandleCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 			}
 		}
 
+		nextUID, err := AllocateUID(tx, destMailboxID)
+		if err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO COPY failed: %v", tag, err))
+			return
+		}
+
 		// Insert message into destination mailbox
 		_, err = tx.Exec(`
 			INSERT INTO message_mailbox (message_id, mailbox_id, uid, flags, internal_date)
@@ -1163,8 +1392,6 @@ func HandleCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 			deps.SendResponse(conn, fmt.Sprintf("%s NO COPY failed: %v", tag, err))
 			return
 		}
-
-		nextUID++
 	}
 
 	// Commit transaction
@@ -1173,6 +1400,7 @@ func HandleCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, stat
 		deps.SendResponse(conn, fmt.Sprintf("%s NO COPY failed: %v", tag, err))
 		return
 	}
+	deps.GetDBManager().MailboxChanges().Publish(targetDB, destMailboxID)
 
 	deps.SendResponse(conn, fmt.Sprintf("%s OK COPY completed", tag))
 }
@@ -1203,16 +1431,60 @@ func MoveMessageToMailbox(userDB *sql.DB, messageID int64, sourceMailboxID int64
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	// Get the next UID for destination mailbox
-	var nextUID int64
+	var sourceUID int64
 	err = tx.QueryRow(`
-		SELECT COALESCE(MAX(uid), 0) + 1
-		FROM message_mailbox
-		WHERE mailbox_id = ?
-	`, destMailboxID).Scan(&nextUID)
+		SELECT uid FROM message_mailbox
+		WHERE message_id = ? AND mailbox_id = ?
+		ORDER BY uid LIMIT 1
+	`, messageID, sourceMailboxID).Scan(&sourceUID)
+	if err != nil {
+		return fmt.Errorf("message not found in source mailbox: %w", err)
+	}
+
+	if _, err := moveMessageTx(tx, messageID, sourceMailboxID, sourceUID, destMailboxID, flags, internalDate, previousMailboxID); err != nil {
+		return err
+	}
 
+	// Commit transaction
+	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("failed to get next UID: %w", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// AllocateUID returns the next UID of a mailbox and advances its uid_next
+// past it. UIDs must never be reused, so uid_next is honoured when it is
+// ahead of the highest UID currently present, e.g. after an expunge.
+func AllocateUID(tx *sql.Tx, mailboxID int64) (int64, error) {
+	var uid int64
+	err := tx.QueryRow(`
+		SELECT MAX(
+			COALESCE((SELECT MAX(uid) FROM message_mailbox WHERE mailbox_id = ?), 0) + 1,
+			COALESCE((SELECT uid_next FROM mailboxes WHERE id = ?), 1)
+		)
+	`, mailboxID, mailboxID).Scan(&uid)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get next UID: %w", err)
+	}
+
+	// Keep uid_next in step so later APPENDs do not collide with this UID
+	_, err = tx.Exec("UPDATE mailboxes SET uid_next = ? WHERE id = ? AND uid_next <= ?", uid+1, mailboxID, uid)
+	if err != nil {
+		return 0, fmt.Errorf("failed to advance uid_next: %w", err)
+	}
+	return uid, nil
+}
+
+// moveMessageTx relocates the message with sourceUID inside an open
+// transaction and returns the UID assigned in the destination mailbox. The
+// destination may be the source mailbox, in which case the message gets a
+// new UID.
+func moveMessageTx(tx *sql.Tx, messageID int64, sourceMailboxID int64, sourceUID int64, destMailboxID int64, flags string, internalDate string, previousMailboxID *int64) (int64, error) {
+	nextUID, err := AllocateUID(tx, destMailboxID)
+	if err != nil {
+		return 0, err
 	}
 
 	// Insert message into destination mailbox (preserve flags and internal date)
@@ -1222,26 +1494,215 @@ func MoveMessageToMailbox(userDB *sql.DB, messageID int64, sourceMailboxID int64
 	`, messageID, destMailboxID, nextUID, flags, internalDate, previousMailboxID)
 
 	if err != nil {
-		return fmt.Errorf("failed to insert into destination: %w", err)
+		return 0, fmt.Errorf("failed to insert into destination: %w", err)
 	}
 
 	// Delete message from source mailbox
 	_, err = tx.Exec(`
 		DELETE FROM message_mailbox
-		WHERE message_id = ? AND mailbox_id = ?
-	`, messageID, sourceMailboxID)
+		WHERE mailbox_id = ? AND uid = ?
+	`, sourceMailboxID, sourceUID)
 
 	if err != nil {
-		return fmt.Errorf("failed to delete from source: %w", err)
+		return 0, fmt.Errorf("failed to delete from source: %w", err)
 	}
 
-	// Commit transaction
-	err = tx.Commit()
+	return nextUID, nil
+}
+
+// ===== MOVE =====
+
+// HandleMove implements the MOVE command (RFC 6851)
+// Syntax: MOVE sequence-set mailbox-name
+func HandleMove(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if state.SelectedMailboxID == 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO No mailbox selected", tag))
+		return
+	}
+
+	// Accept parts with or without the leading tag, matching HandleCopy
+	var sequenceSet string
+	var destArg string
+	switch {
+	case len(parts) >= 3 && strings.EqualFold(parts[0], "MOVE"):
+		sequenceSet = parts[1]
+		destArg = strings.Join(parts[2:], " ")
+	case len(parts) >= 4 && strings.EqualFold(parts[1], "MOVE"):
+		sequenceSet = parts[2]
+		destArg = strings.Join(parts[3:], " ")
+	default:
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid MOVE command syntax", tag))
+		return
+	}
+	destMailbox, err := utils.ParseMailboxArgument(destArg, state)
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
 	}
 
-	return nil
+	targetDB, err := deps.GetSelectedDB(state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	messages := utils.SelectedMessageMap(state, targetDB)
+	sequenceSet = utils.ExpandSearchResult(sequenceSet, state.SearchResult, messages, false)
+	sequences := utils.ParseSequenceSet(sequenceSet, messages.Count())
+	if len(sequences) == 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid sequence set", tag))
+		return
+	}
+
+	// Resolve sequence numbers to UIDs so both MOVE and UID MOVE share one path
+	var uids []int
+	for _, seqNum := range sequences {
+		uid, _ := messages.UID(seqNum)
+		uids = append(uids, int(uid))
+	}
+
+	HandleMoveForUIDs(deps, conn, tag, "MOVE", uids, destMailbox, state)
+}
+
+// HandleMoveForUIDs moves the given UIDs out of the selected mailbox (used by MOVE and UID MOVE).
+// It sends the untagged COPYUID and EXPUNGE responses followed by the tagged completion.
+func HandleMoveForUIDs(deps ServerDeps, conn net.Conn, tag string, command string, uids []int, destMailbox string, state *models.ClientState) {
+	targetDB, err := deps.GetSelectedDB(state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	// RFC 4314: moving out of a shared mailbox needs the "t" and "e" rights
+	if !utils.HasRights(utils.SelectedRights(state), "te") {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+
+	// A read-only mailbox (EXAMINE) must not change (RFC 9051 Section 6.3.3)
+	if state.ReadOnly {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Mailbox is read-only", tag))
+		return
+	}
+
+	destMailboxID, failure := ResolveCopyTarget(targetDB, state, destMailbox)
+	if failure != "" {
+		deps.SendResponse(conn, fmt.Sprintf("%s %s", tag, failure))
+		return
+	}
+
+	// The session's view, taken before the move, gives the sequence numbers for EXPUNGE
+	messages := utils.SelectedMessageMap(state, targetDB)
+
+	rows, err := targetDB.Query(`
+		SELECT message_id, uid, flags, internal_date
+		FROM message_mailbox
+		WHERE mailbox_id = ?
+		ORDER BY uid ASC
+	`, state.SelectedMailboxID)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO %s failed: %v", tag, command, err))
+		return
+	}
+
+	type moveCandidate struct {
+		messageID    int64
+		uid          int64
+		flags        string
+		internalDate string
+	}
+	byUID := make(map[int64]moveCandidate)
+	for rows.Next() {
+		var c moveCandidate
+		var flags sql.NullString
+		if err := rows.Scan(&c.messageID, &c.uid, &flags, &c.internalDate); err != nil {
+			continue
+		}
+		c.flags = flags.String
+		byUID[c.uid] = c
+	}
+	_ = rows.Close()
+
+	var candidates []moveCandidate
+	seen := make(map[int64]bool)
+	for _, uid := range uids {
+		c, ok := byUID[int64(uid)]
+		if !ok || seen[c.uid] {
+			continue
+		}
+		seen[c.uid] = true
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].uid < candidates[j].uid })
+
+	if len(candidates) == 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s OK %s completed", tag, command))
+		return
+	}
+
+	tx, err := targetDB.Begin()
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO %s failed: %v", tag, command, err))
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	sourceMailboxID := state.SelectedMailboxID
+	sourceUIDs := make([]int64, 0, len(candidates))
+	destUIDs := make([]int64, 0, len(candidates))
+	for _, c := range candidates {
+		destUID, err := moveMessageTx(tx, c.messageID, sourceMailboxID, c.uid, destMailboxID, c.flags, c.internalDate, &sourceMailboxID)
+		if err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO %s failed: %v", tag, command, err))
+			return
+		}
+		sourceUIDs = append(sourceUIDs, c.uid)
+		destUIDs = append(destUIDs, destUID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO %s failed: %v", tag, command, err))
+		return
+	}
+	changes := deps.GetDBManager().MailboxChanges()
+	changes.Publish(targetDB, sourceMailboxID)
+	changes.Publish(targetDB, destMailboxID)
+
+	// RFC 6851: COPYUID is sent in an untagged OK before the EXPUNGE responses
+	uidValidity, _, err := db.GetMailboxInfoPerUser(targetDB, destMailboxID)
+	if err == nil {
+		deps.SendResponse(conn, fmt.Sprintf("* OK [COPYUID %d %s %s] Moved UIDs",
+			uidValidity, utils.FormatSequenceSet(sourceUIDs), utils.FormatSequenceSet(destUIDs)))
+	}
+
+	// Each EXPUNGE shifts later sequence numbers down by one
+	expungedSeqNums := make([]int, 0, len(candidates))
+	expungedUIDs := make([]int64, 0, len(candidates))
+	for _, c := range candidates {
+		if seqNum, ok := messages.Expunge(c.uid); ok {
+			expungedSeqNums = append(expungedSeqNums, seqNum)
+			expungedUIDs = append(expungedUIDs, c.uid)
+		}
+	}
+	SendExpungeNotifications(deps, conn, state, expungedSeqNums, expungedUIDs)
+
+	state.LastMessageCount -= len(expungedUIDs)
+	if state.LastMessageCount < 0 {
+		state.LastMessageCount = 0
+	}
+
+	// Moving into the selected mailbox works like COPY and EXPUNGE: the
+	// messages come back under new UIDs, which the client learns about now
+	if destMailboxID == sourceMailboxID {
+		SendMailboxUpdates(deps, conn, state, AllMailboxUpdates, "")
+	}
+
+	deps.SendResponse(conn, fmt.Sprintf("%s OK %s completed", tag, command))
 }
 
 // ===== APPEND =====
@@ -1258,22 +1719,28 @@ func HandleAppendWithReader(deps ServerDeps, reader io.Reader, conn net.Conn, ta
 		return
 	}
 
-	// Get user database
-	userDB, err := deps.GetUserDB(resolveStateEmail(state))
+	// Parse folder name (could be quoted, in modified UTF-7)
+	folder, err := utils.ParseMailboxName(parts[2], state)
 	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
 		return
 	}
 
-	// Parse folder name (could be quoted)
-	folder := strings.Trim(parts[2], "\"")
-
-	// Validate folder exists using the database with new schema
-	mailboxID, err := db.GetMailboxByNamePerUser(userDB, folder)
-	if err != nil {
+	// Validate folder exists; it may belong to another user (RFC 4314)
+	access, err := utils.ResolveMailboxAccess(deps, resolveStateEmail(state), folder)
+	if errors.Is(err, utils.ErrNoSuchMailbox) {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO [TRYCREATE] Folder does not exist", tag))
 		return
 	}
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+	if !utils.HasRights(access.Rights, "i") {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+	userDB, mailboxID := access.DB, access.MailboxID
 
 	// Parse optional flags and date/time
 	// Format: tag APPEND folder [(flags)] [date-time] {size}
@@ -1288,6 +1755,13 @@ func HandleAppendWithReader(deps ServerDeps, reader io.Reader, conn net.Conn, ta
 		}
 	}
 
+	// RFC 6855: after ENABLE UTF8=ACCEPT the message may be sent as UTF8 (~{size})
+	utf8Append := strings.Contains(strings.ToUpper(fullLine), "UTF8 (~{")
+	if utf8Append && !state.UTF8Enabled {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD APPEND UTF8 requires ENABLE UTF8=ACCEPT", tag))
+		return
+	}
+
 	// Look for literal size indicator {size} or {size+}
 	literalStartIdx := strings.Index(fullLine, "{")
 	literalEndIdx := strings.Index(fullLine, "}")
@@ -1297,6 +1771,9 @@ func HandleAppendWithReader(deps ServerDeps, reader io.Reader, conn net.Conn, ta
 		return
 	}
 
+	// RFC 3516: a literal8 (~{size}) may carry binary content, including NUL octets
+	isLiteral8 := literalStartIdx > 0 && fullLine[literalStartIdx-1] == '~'
+
 	// Extract the size and check for LITERAL+ (RFC 4466)
 	sizeStr := fullLine[literalStartIdx+1 : literalEndIdx]
 	isLiteralPlus := strings.HasSuffix(sizeStr, "+")
@@ -1312,6 +1789,14 @@ func HandleAppendWithReader(deps ServerDeps, reader io.Reader, conn net.Conn, ta
 		return
 	}
 
+	// RFC 9208: refuse messages that would exceed the user's quota. With LITERAL+
+	// the data is already on its way, so it is read before the message is refused.
+	overQuota := exceedsQuota(userDB, int64(messageSize), 1)
+	if overQuota && !isLiteralPlus {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [OVERQUOTA] Quota exceeded", tag))
+		return
+	}
+
 	// Send continuation response only for synchronizing literals
 	// RFC 4466: LITERAL+ ({size+}) means client sends data immediately without waiting
 	if !isLiteralPlus {
@@ -1333,6 +1818,15 @@ func HandleAppendWithReader(deps ServerDeps, reader io.Reader, conn net.Conn, ta
 
 	log.Printf("APPEND successfully read %d bytes", n)
 
+	// The UTF8 message literal is followed by the closing parenthesis
+	if utf8Append {
+		closeBuf := make([]byte, 1)
+		if _, err := io.ReadFull(reader, closeBuf); err != nil || closeBuf[0] != ')' {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD Missing ) after UTF8 message data", tag))
+			return
+		}
+	}
+
 	// Read and discard the trailing CRLF after the literal data
 	// RFC 3501: The client sends CRLF after the literal data
 	// Use a short timeout to avoid delays
@@ -1347,6 +1841,16 @@ func HandleAppendWithReader(deps ServerDeps, reader io.Reader, conn net.Conn, ta
 		// Continue anyway - be lenient with protocol violations
 	}
 
+	if !isLiteral8 && bytes.IndexByte(messageData, 0) >= 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD NUL octets require a literal8", tag))
+		return
+	}
+
+	if overQuota {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [OVERQUOTA] Quota exceeded", tag))
+		return
+	}
+
 	rawMessage := string(messageData)
 
 	// Ensure message has CRLF line endings
@@ -1382,6 +1886,7 @@ func HandleAppendWithReader(deps ServerDeps, reader io.Reader, conn net.Conn, ta
 		deps.SendResponse(conn, fmt.Sprintf("%s NO [SERVERBUG] Failed to add message to mailbox", tag))
 		return
 	}
+	deps.GetDBManager().MailboxChanges().Publish(userDB, mailboxID)
 
 	// Get UID validity for APPENDUID response
 	uidValidity, _, err := db.GetMailboxInfoPerUser(userDB, mailboxID)
@@ -1416,22 +1921,28 @@ func HandleAppend(deps ServerDeps, conn net.Conn, tag string, parts []string, fu
 		return
 	}
 
-	// Get user database
-	userDB, err := deps.GetUserDB(resolveStateEmail(state))
+	// Parse folder name (could be quoted, in modified UTF-7)
+	folder, err := utils.ParseMailboxName(parts[2], state)
 	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
 		return
 	}
 
-	// Parse folder name (could be quoted)
-	folder := strings.Trim(parts[2], "\"")
-
-	// Validate folder exists using the database with new schema
-	mailboxID, err := db.GetMailboxByNamePerUser(userDB, folder)
-	if err != nil {
+	// Validate folder exists; it may belong to another user (RFC 4314)
+	access, err := utils.ResolveMailboxAccess(deps, resolveStateEmail(state), folder)
+	if errors.Is(err, utils.ErrNoSuchMailbox) {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO [TRYCREATE] Folder does not exist", tag))
 		return
 	}
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+	if !utils.HasRights(access.Rights, "i") {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+	userDB, mailboxID := access.DB, access.MailboxID
 
 	// Parse optional flags and date/time
 	// Format: tag APPEND folder [(flags)] [date-time] {size}
@@ -1446,6 +1957,13 @@ func HandleAppend(deps ServerDeps, conn net.Conn, tag string, parts []string, fu
 		}
 	}
 
+	// RFC 6855: after ENABLE UTF8=ACCEPT the message may be sent as UTF8 (~{size})
+	utf8Append := strings.Contains(strings.ToUpper(fullLine), "UTF8 (~{")
+	if utf8Append && !state.UTF8Enabled {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD APPEND UTF8 requires ENABLE UTF8=ACCEPT", tag))
+		return
+	}
+
 	// Look for literal size indicator {size} or {size+}
 	literalStartIdx := strings.Index(fullLine, "{")
 	literalEndIdx := strings.Index(fullLine, "}")
@@ -1455,6 +1973,9 @@ func HandleAppend(deps ServerDeps, conn net.Conn, tag string, parts []string, fu
 		return
 	}
 
+	// RFC 3516: a literal8 (~{size}) may carry binary content, including NUL octets
+	isLiteral8 := literalStartIdx > 0 && fullLine[literalStartIdx-1] == '~'
+
 	// Extract the size and check for LITERAL+ (RFC 4466)
 	sizeStr := fullLine[literalStartIdx+1 : literalEndIdx]
 	isLiteralPlus := strings.HasSuffix(sizeStr, "+")
@@ -1470,6 +1991,14 @@ func HandleAppend(deps ServerDeps, conn net.Conn, tag string, parts []string, fu
 		return
 	}
 
+	// RFC 9208: refuse messages that would exceed the user's quota. With LITERAL+
+	// the data is already on its way, so it is read before the message is refused.
+	overQuota := exceedsQuota(userDB, int64(messageSize), 1)
+	if overQuota && !isLiteralPlus {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [OVERQUOTA] Quota exceeded", tag))
+		return
+	}
+
 	// Send continuation response only for synchronizing literals
 	// RFC 4466: LITERAL+ ({size+}) means client sends data immediately without waiting
 	if !isLiteralPlus {
@@ -1491,6 +2020,15 @@ func HandleAppend(deps ServerDeps, conn net.Conn, tag string, parts []string, fu
 
 	log.Printf("APPEND successfully read %d bytes", n)
 
+	// The UTF8 message literal is followed by the closing parenthesis
+	if utf8Append {
+		closeBuf := make([]byte, 1)
+		if _, err := io.ReadFull(conn, closeBuf); err != nil || closeBuf[0] != ')' {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD Missing ) after UTF8 message data", tag))
+			return
+		}
+	}
+
 	// Read and discard the trailing CRLF after the literal data
 	// RFC 3501: The client sends CRLF after the literal data
 	// Use a short timeout to avoid delays
@@ -1505,6 +2043,16 @@ func HandleAppend(deps ServerDeps, conn net.Conn, tag string, parts []string, fu
 		// Continue anyway - be lenient with protocol violations
 	}
 
+	if !isLiteral8 && bytes.IndexByte(messageData, 0) >= 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD NUL octets require a literal8", tag))
+		return
+	}
+
+	if overQuota {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [OVERQUOTA] Quota exceeded", tag))
+		return
+	}
+
 	rawMessage := string(messageData)
 
 	// Ensure message has CRLF line endings
@@ -1540,6 +2088,7 @@ func HandleAppend(deps ServerDeps, conn net.Conn, tag string, parts []string, fu
 		deps.SendResponse(conn, fmt.Sprintf("%s NO [SERVERBUG] Failed to add message to mailbox", tag))
 		return
 	}
+	deps.GetDBManager().MailboxChanges().Publish(userDB, mailboxID)
 
 	// Get UID validity for APPENDUID response
 	uidValidity, _, err := db.GetMailboxInfoPerUser(userDB, mailboxID)
@@ -1583,12 +2132,21 @@ func HandleExpunge(deps ServerDeps, conn net.Conn, tag string, state *models.Cli
 	// The key difference from CLOSE: EXPUNGE sends untagged responses showing which
 	// messages were deleted
 
-	// Important: Per RFC 3501, if mailbox is read-only (selected with EXAMINE),
-	// EXPUNGE should return NO
-	// TODO: Add ReadOnly field to ClientState to properly handle EXAMINE
+	// RFC 4314: expunging a shared mailbox needs the "e" right
+	if !utils.HasRights(utils.SelectedRights(state), "e") {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
 
-	// Get user database
-	userDB, err := deps.GetUserDB(resolveStateEmail(state))
+	// Per RFC 3501, if mailbox is read-only (selected with EXAMINE),
+	// EXPUNGE returns NO
+	if state.ReadOnly {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Mailbox is read-only", tag))
+		return
+	}
+
+	// Get the selected mailbox's database
+	userDB, err := deps.GetSelectedDB(state)
 	if err != nil {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
 		return
@@ -1628,54 +2186,36 @@ func HandleExpunge(deps ServerDeps, conn net.Conn, tag string, state *models.Cli
 		return
 	}
 
-	// Get all messages in the mailbox to calculate sequence numbers
-	allRows, err := userDB.Query(`
-		SELECT id, uid FROM message_mailbox
-		WHERE mailbox_id = ?
-		ORDER BY uid ASC
-	`, state.SelectedMailboxID)
-
-	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO EXPUNGE failed: %v", tag, err))
-		return
-	}
-	defer func() { _ = allRows.Close() }()
-
-	// Build a map of message IDs to sequence numbers
-	sequenceMap := make(map[int64]int)
-	seqNum := 1
-	for allRows.Next() {
-		var id, uid int64
-		if err := allRows.Scan(&id, &uid); err == nil {
-			sequenceMap[id] = seqNum
-			seqNum++
-		}
-	}
-	_ = allRows.Close()
+	// Sequence numbers come from the session's view of the mailbox
+	messages := utils.SelectedMessageMap(state, userDB)
 
-	// Delete messages and send EXPUNGE responses
-	// Important: As we delete messages, sequence numbers change for subsequent messages
-	// We need to account for this by tracking how many messages we've deleted
+	// Delete messages and collect their EXPUNGE responses. Removing a message
+	// from the view shifts later sequence numbers down, as the client expects.
 	deletedCount := 0
+	var expungedSeqNums []int
+	var expungedUIDs []int64
 	for _, msg := range messagesToDelete {
-		// Get the original sequence number for this message
-		originalSeqNum := sequenceMap[msg.id]
-
-		// Adjust for previously deleted messages in this EXPUNGE operation
-		// When we delete message N, all messages after it shift down by 1
-		adjustedSeqNum := originalSeqNum - deletedCount
-
-		// Send untagged EXPUNGE response with the adjusted sequence number
-		deps.SendResponse(conn, fmt.Sprintf("* %d EXPUNGE", adjustedSeqNum))
-
 		// Delete the message from the mailbox
-		_, _ = userDB.Exec(`DELETE FROM message_mailbox WHERE id = ?`, msg.id)
-
+		if err := db.ExpungeMessagePerUser(userDB, msg.id); err != nil {
+			continue
+		}
 		deletedCount++
+
+		// Messages the client was never told about need no EXPUNGE
+		if seqNum, ok := messages.Expunge(msg.uid); ok {
+			expungedSeqNums = append(expungedSeqNums, seqNum)
+			expungedUIDs = append(expungedUIDs, msg.uid)
+		}
 	}
+	if deletedCount > 0 {
+		deps.GetDBManager().MailboxChanges().Publish(userDB, state.SelectedMailboxID)
+	}
+
+	// Send untagged EXPUNGE (or VANISHED with QRESYNC) responses
+	SendExpungeNotifications(deps, conn, state, expungedSeqNums, expungedUIDs)
 
 	// Update state tracking
-	state.LastMessageCount -= len(messagesToDelete)
+	state.LastMessageCount -= len(expungedUIDs)
 	if state.LastMessageCount < 0 {
 		state.LastMessageCount = 0
 	}
@@ -0,0 +1,240 @@
+package message_test
+
+import (
+	"strings"
+	"testing"
+
+	"raven/internal/models"
+	"raven/internal/server"
+)
+
+// TestMoveCommand_Unauthenticated tests MOVE command without authentication
+func TestMoveCommand_Unauthenticated(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+
+	state := &models.ClientState{
+		Authenticated: false,
+	}
+
+	srv.HandleMove(conn, "M001", []string{"MOVE", "1", "INBOX"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "M001 NO Please authenticate first") {
+		t.Errorf("Expected authentication error, got: %s", response)
+	}
+}
+
+// TestMoveCommand_NoMailboxSelected tests MOVE command without selecting a mailbox
+func TestMoveCommand_NoMailboxSelected(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "moveuser")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: 0,
+	}
+
+	srv.HandleMove(conn, "M002", []string{"MOVE", "1", "INBOX"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "M002 NO No mailbox selected") {
+		t.Errorf("Expected no mailbox error, got: %s", response)
+	}
+}
+
+// TestMoveCommand_DestinationNotExists tests MOVE to a non-existent mailbox
+func TestMoveCommand_DestinationNotExists(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "moveuser")
+	server.InsertTestMail(t, database, "moveuser", "Test message", "sender@test.com", "moveuser@localhost", "INBOX")
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+	}
+
+	srv.HandleMove(conn, "M003", []string{"MOVE", "1", "NonExistentFolder"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "M003 NO [TRYCREATE]") {
+		t.Errorf("Expected TRYCREATE response, got: %s", response)
+	}
+
+	// The message must stay in the source mailbox
+	userDB := server.GetUserDBByID(t, database, userID)
+	var count int
+	if err := userDB.QueryRow("SELECT COUNT(*) FROM message_mailbox WHERE mailbox_id = ?", inboxID).Scan(&count); err != nil {
+		t.Fatalf("Failed to query inbox count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 message to remain in INBOX, got %d", count)
+	}
+}
+
+// TestMoveCommand_SameMailbox tests that moving into the selected mailbox
+// gives the messages new UIDs, like COPY followed by EXPUNGE
+func TestMoveCommand_SameMailbox(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "moveuser")
+	server.InsertTestMail(t, database, "moveuser", "Test message", "sender@test.com", "moveuser@localhost", "INBOX")
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+		LastMessageCount:  1,
+	}
+
+	srv.HandleMove(conn, "M004", []string{"MOVE", "1", "INBOX"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, " 1 2] ") {
+		t.Errorf("Expected COPYUID mapping UID 1 to 2, got: %s", response)
+	}
+	expunge := strings.Index(response, "* 1 EXPUNGE")
+	exists := strings.Index(response, "* 1 EXISTS")
+	if expunge < 0 || exists < expunge {
+		t.Errorf("Expected EXPUNGE followed by EXISTS, got: %s", response)
+	}
+	if !strings.Contains(response, "M004 OK MOVE completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+
+	userDB := server.GetUserDBByID(t, database, userID)
+	var count, uid int64
+	if err := userDB.QueryRow("SELECT COUNT(*), MAX(uid) FROM message_mailbox WHERE mailbox_id = ?", inboxID).Scan(&count, &uid); err != nil {
+		t.Fatalf("Failed to query INBOX: %v", err)
+	}
+	if count != 1 || uid != 2 {
+		t.Errorf("Expected one message with UID 2 in INBOX, got %d messages with highest UID %d", count, uid)
+	}
+}
+
+// TestMoveCommand_MultipleMessages tests moving a range and the resulting untagged responses
+func TestMoveCommand_MultipleMessages(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "moveuser")
+	server.InsertTestMail(t, database, "moveuser", "Message 1", "sender@test.com", "moveuser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "moveuser", "Message 2", "sender@test.com", "moveuser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "moveuser", "Message 3", "sender@test.com", "moveuser@localhost", "INBOX")
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+	trashID, _ := server.GetMailboxID(t, database, userID, "Trash")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+		LastMessageCount:  3,
+	}
+
+	srv.HandleMove(conn, "M005", []string{"MOVE", "2:3", "Trash"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "M005 OK MOVE completed") {
+		t.Fatalf("Expected OK response, got: %s", response)
+	}
+	if !strings.Contains(response, "* OK [COPYUID ") {
+		t.Errorf("Expected COPYUID response, got: %s", response)
+	}
+	// Both moved messages are reported at sequence 2 because each EXPUNGE shifts the rest down
+	if strings.Count(response, "* 2 EXPUNGE") != 2 {
+		t.Errorf("Expected two '* 2 EXPUNGE' responses, got: %s", response)
+	}
+	if strings.Index(response, "COPYUID") > strings.Index(response, "EXPUNGE") {
+		t.Errorf("Expected COPYUID before EXPUNGE responses, got: %s", response)
+	}
+	if state.LastMessageCount != 1 {
+		t.Errorf("Expected LastMessageCount 1, got %d", state.LastMessageCount)
+	}
+
+	userDB := server.GetUserDBByID(t, database, userID)
+	var count int
+	if err := userDB.QueryRow("SELECT COUNT(*) FROM message_mailbox WHERE mailbox_id = ?", inboxID).Scan(&count); err != nil {
+		t.Fatalf("Failed to query inbox count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 message in INBOX, got %d", count)
+	}
+	if err := userDB.QueryRow("SELECT COUNT(*) FROM message_mailbox WHERE mailbox_id = ? AND previous_mailbox_id = ?", trashID, inboxID).Scan(&count); err != nil {
+		t.Fatalf("Failed to query trash count: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 messages in Trash remembering INBOX, got %d", count)
+	}
+
+	// uid_next of the destination must move past the assigned UIDs
+	var uidNext, maxUID int64
+	if err := userDB.QueryRow("SELECT uid_next FROM mailboxes WHERE id = ?", trashID).Scan(&uidNext); err != nil {
+		t.Fatalf("Failed to query uid_next: %v", err)
+	}
+	if err := userDB.QueryRow("SELECT MAX(uid) FROM message_mailbox WHERE mailbox_id = ?", trashID).Scan(&maxUID); err != nil {
+		t.Fatalf("Failed to query max uid: %v", err)
+	}
+	if uidNext <= maxUID {
+		t.Errorf("Expected uid_next > %d, got %d", maxUID, uidNext)
+	}
+}
+
+// TestMoveCommand_EscapedMailboxName tests that quoted destination names are unescaped
+func TestMoveCommand_EscapedMailboxName(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "moveuser")
+	server.InsertTestMail(t, database, "moveuser", "Message 1", "sender@test.com", "moveuser@localhost", "INBOX")
+	server.CreateMailbox(t, database, "moveuser", `Say "Hi"`)
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+	destID, _ := server.GetMailboxID(t, database, userID, `Say "Hi"`)
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+		LastMessageCount:  1,
+	}
+
+	srv.HandleMove(conn, "M006", []string{"MOVE", "1", `"Say \"Hi\""`}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "M006 OK MOVE completed") {
+		t.Fatalf("Expected OK response, got: %s", response)
+	}
+
+	userDB := server.GetUserDBByID(t, database, userID)
+	var count int
+	if err := userDB.QueryRow("SELECT COUNT(*) FROM message_mailbox WHERE mailbox_id = ?", destID).Scan(&count); err != nil {
+		t.Fatalf("Failed to query destination count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 message in the destination, got %d", count)
+	}
+
+	// More than one destination is a syntax error
+	conn = server.NewMockConn()
+	srv.HandleMove(conn, "M007", []string{"MOVE", "1", "Trash", "INBOX"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "M007 BAD Invalid mailbox name") {
+		t.Errorf("Expected BAD response, got: %s", response)
+	}
+}
@@ -0,0 +1,310 @@
+package message
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+
+	"raven/internal/blobstorage"
+	"raven/internal/db"
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== MULTISEARCH (RFC 7377) =====
+
+// MailboxSearchResult holds the messages of one mailbox that matched a
+// multi-mailbox search
+type MailboxSearchResult struct {
+	Mailbox     string
+	MailboxID   int64
+	UIDValidity int64
+	Matches     []SearchMatch
+}
+
+// SearchSource is one filter of the ESEARCH "IN (...)" source list
+type SearchSource struct {
+	Kind      string   // SELECTED, SELECTED-DELAYED, INBOXES, PERSONAL, SUBSCRIBED, SUBTREE, SUBTREE-ONE or MAILBOXES
+	Mailboxes []string // Mailbox names for SUBTREE, SUBTREE-ONE and MAILBOXES
+}
+
+// HandleEsearch handles the ESEARCH command, which searches one or more of
+// the user's mailboxes and reports the matching UIDs of each mailbox:
+//
+//	ESEARCH [IN (source ...)] [RETURN (options)] [CHARSET charset] criteria
+//
+// Without IN the selected mailbox is searched.
+func HandleEsearch(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	args := parts[2:]
+	sources := []SearchSource{{Kind: "SELECTED"}}
+	if len(args) > 0 && strings.EqualFold(args[0], "IN") {
+		content, rest, err := utils.ParseParenthesizedList(args[1:])
+		if err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid ESEARCH source options", tag))
+			return
+		}
+		if sources, err = parseSearchSources(content, state); err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+			return
+		}
+		args = rest
+	}
+
+	returnOpts, rest, err := ParseSearchReturnOptions(args)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+		return
+	}
+	if !returnOpts.Extended {
+		returnOpts.All = true
+	}
+
+	charset, criteria, ok := parseSearchCharset(rest)
+	if !ok {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [BADCHARSET (US-ASCII UTF-8)] Charset not supported", tag))
+		return
+	}
+	if len(criteria) == 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD ESEARCH requires search criteria", tag))
+		return
+	}
+
+	// Sequence numbers and saved results belong to the selected mailbox and
+	// mean nothing in the others (RFC 7377 Section 2)
+	if returnOpts.Save {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD SAVE cannot be used with ESEARCH", tag))
+		return
+	}
+	if usesSequenceNumbers(criteria) {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD ESEARCH criteria cannot refer to sequence numbers", tag))
+		return
+	}
+
+	userDB, err := deps.GetUserDB(state.Email)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	mailboxes, err := resolveSearchSources(userDB, sources, state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	results, err := SearchMailboxes(userDB, deps.GetSharedDB(), deps.GetS3Storage(), mailboxes, criteria, charset)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Search failed: %v", tag, err))
+		return
+	}
+
+	for _, result := range results {
+		values := make([]int64, 0, len(result.Matches))
+		for _, match := range result.Matches {
+			values = append(values, match.UID)
+		}
+		deps.SendResponse(conn, fmt.Sprintf("* ESEARCH (TAG \"%s\" MAILBOX \"%s\" UIDVALIDITY %d) UID%s",
+			tag, utils.ClientMailboxName(result.Mailbox, state), result.UIDValidity,
+			formatESearchData(returnOpts, values, criteria, result.Matches)))
+	}
+
+	deps.SendResponse(conn, fmt.Sprintf("%s OK ESEARCH completed", tag))
+}
+
+// SearchMailboxes evaluates search criteria in the named mailboxes of a
+// per-user database, reading all of their messages with one query. Message
+// contents are read through sharedDB and s3Storage. Only mailboxes with
+// matches are returned, in the order given. Sequence numbers in the matches
+// are those of each mailbox. It needs no session or server, so
+// administrative tools can search a user's account with it too.
+func SearchMailboxes(userDB *sql.DB, sharedDB *sql.DB, s3Storage *blobstorage.S3BlobStorage, mailboxes []string, tokens []string, charset string) ([]MailboxSearchResult, error) {
+	var results []MailboxSearchResult
+	var mailboxIDs []int64
+	for _, name := range mailboxes {
+		mailboxID, err := db.GetMailboxByNamePerUser(userDB, name)
+		if err != nil {
+			continue
+		}
+		uidValidity, _, err := db.GetMailboxInfoPerUser(userDB, mailboxID)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, MailboxSearchResult{Mailbox: name, MailboxID: mailboxID, UIDValidity: uidValidity})
+		mailboxIDs = append(mailboxIDs, mailboxID)
+	}
+
+	loaded, err := loadSearchMessages(userDB, mailboxIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	store := userMessageStore{userDB: userDB, sharedDB: sharedDB, s3Storage: s3Storage}
+	matched := results[:0]
+	for _, result := range results {
+		result.Matches = matchSearchMessages(loaded[result.MailboxID], tokens, charset, "", store)
+		if len(result.Matches) > 0 {
+			matched = append(matched, result)
+		}
+	}
+	return matched, nil
+}
+
+// userMessageStore is the messageStore of a single user's database
+type userMessageStore struct {
+	userDB    *sql.DB
+	sharedDB  *sql.DB
+	s3Storage *blobstorage.S3BlobStorage
+}
+
+func (s userMessageStore) GetUserDB(string) (*sql.DB, error) { return s.userDB, nil }
+
+func (s userMessageStore) GetSharedDB() *sql.DB { return s.sharedDB }
+
+func (s userMessageStore) GetS3Storage() *blobstorage.S3BlobStorage { return s.s3Storage }
+
+// parseSearchSources parses the contents of an ESEARCH "IN (...)" list
+func parseSearchSources(content string, state *models.ClientState) ([]SearchSource, error) {
+	args, err := utils.ParseArguments(content)
+	if err != nil || len(args) == 0 {
+		return nil, fmt.Errorf("invalid ESEARCH source options")
+	}
+
+	var sources []SearchSource
+	for i := 0; i < len(args); i++ {
+		if args[i].Kind != utils.ArgAtom {
+			return nil, fmt.Errorf("invalid ESEARCH source options")
+		}
+		source := SearchSource{Kind: strings.ToUpper(args[i].Value)}
+		switch source.Kind {
+		case "SELECTED", "SELECTED-DELAYED", "INBOXES", "PERSONAL", "SUBSCRIBED":
+		case "SUBTREE", "SUBTREE-ONE", "MAILBOXES":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s requires one or more mailboxes", source.Kind)
+			}
+			i++
+			names := []utils.Arg{args[i]}
+			if args[i].Kind == utils.ArgList {
+				names = args[i].List
+			}
+			if len(names) == 0 {
+				return nil, fmt.Errorf("%s requires one or more mailboxes", source.Kind)
+			}
+			for _, n := range names {
+				if n.Kind == utils.ArgList {
+					return nil, fmt.Errorf("invalid mailbox name")
+				}
+				name, err := utils.ParseMailboxName(n.Raw, state)
+				if err != nil {
+					return nil, fmt.Errorf("invalid mailbox name")
+				}
+				source.Mailboxes = append(source.Mailboxes, name)
+			}
+		default:
+			return nil, fmt.Errorf("unknown ESEARCH source %s", args[i].Value)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// resolveSearchSources returns the names of the user's mailboxes matched by
+// any of the sources, in mailbox list order. Only the user's own mailboxes
+// are searched.
+func resolveSearchSources(userDB *sql.DB, sources []SearchSource, state *models.ClientState) ([]string, error) {
+	names, err := db.GetUserMailboxesPerUser(userDB)
+	if err != nil {
+		return nil, err
+	}
+
+	// The selected mailbox, when it is one of the user's own
+	var selected string
+	if state.SelectedMailboxID > 0 && state.SelectedOwner == "" {
+		_ = userDB.QueryRow("SELECT name FROM mailboxes WHERE id = ?", state.SelectedMailboxID).Scan(&selected)
+	}
+
+	var subscriptions map[string]bool
+	for _, source := range sources {
+		if source.Kind == "SUBSCRIBED" && subscriptions == nil {
+			subscribed, err := db.GetUserSubscriptionsPerUser(userDB)
+			if err != nil {
+				return nil, err
+			}
+			subscriptions = make(map[string]bool, len(subscribed))
+			for _, name := range subscribed {
+				subscriptions[name] = true
+			}
+		}
+	}
+
+	var mailboxes []string
+	for _, name := range names {
+		for _, source := range sources {
+			if searchSourceMatches(source, name, selected, subscriptions) {
+				mailboxes = append(mailboxes, name)
+				break
+			}
+		}
+	}
+	return mailboxes, nil
+}
+
+func searchSourceMatches(source SearchSource, name, selected string, subscriptions map[string]bool) bool {
+	switch source.Kind {
+	case "SELECTED", "SELECTED-DELAYED":
+		return selected != "" && name == selected
+	case "INBOXES":
+		return strings.EqualFold(name, "INBOX")
+	case "PERSONAL":
+		return true
+	case "SUBSCRIBED":
+		return subscriptions[name]
+	case "SUBTREE":
+		for _, root := range source.Mailboxes {
+			if name == root || strings.HasPrefix(name, root+"/") {
+				return true
+			}
+		}
+	case "SUBTREE-ONE":
+		for _, root := range source.Mailboxes {
+			if name == root || (strings.HasPrefix(name, root+"/") && !strings.Contains(name[len(root)+1:], "/")) {
+				return true
+			}
+		}
+	case "MAILBOXES":
+		return utils.Contains(source.Mailboxes, name)
+	}
+	return false
+}
+
+// usesSequenceNumbers reports whether search criteria contain a message
+// sequence set, as opposed to a UID set or the argument of a search key
+func usesSequenceNumbers(tokens []string) bool {
+	for i := 0; i < len(tokens); i++ {
+		token := strings.ToUpper(tokens[i])
+		if token == "HEADER" || (token == "MODSEQ" && i+1 < len(tokens) && strings.HasPrefix(tokens[i+1], "\"")) {
+			// HEADER field value; MODSEQ entry-name entry-type value
+			i += 2
+			if token == "MODSEQ" {
+				i++
+			}
+			continue
+		}
+		if requiresArgument(token) {
+			i++
+			continue
+		}
+		if isSequenceSet(token) || token == "$" {
+			return true
+		}
+		if strings.HasPrefix(token, "(") && usesSequenceNumbers(parseSearchTokens(strings.TrimSuffix(strings.TrimPrefix(tokens[i], "("), ")"))) {
+			return true
+		}
+	}
+	return false
+}
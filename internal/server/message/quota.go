@@ -0,0 +1,56 @@
+package message
+
+import (
+	"database/sql"
+	"errors"
+
+	"raven/internal/db"
+)
+
+// ===== QUOTA enforcement (RFC 9208) =====
+
+// exceedsQuota reports whether adding messages of the given total size would
+// exceed the user's STORAGE or MESSAGE limit
+func exceedsQuota(userDB *sql.DB, addBytes, addMessages int64) bool {
+	return errors.Is(db.CheckQuotaPerUser(userDB, addBytes, addMessages, 0), db.ErrOverQuota)
+}
+
+// CopyExceedsQuota reports whether copying the messages identified by
+// sequence numbers (or UIDs in uidMode) would exceed the user's quota
+func CopyExceedsQuota(userDB *sql.DB, mailboxID int64, ids []int, uidMode bool) bool {
+	rows, err := userDB.Query(`
+		SELECT mm.uid, m.size_bytes
+		FROM message_mailbox mm
+		JOIN messages m ON m.id = mm.message_id
+		WHERE mm.mailbox_id = ?
+		ORDER BY mm.uid ASC
+	`, mailboxID)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = rows.Close() }()
+
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[int64(id)] = true
+	}
+
+	var addBytes, addMessages, seqNum int64
+	for rows.Next() {
+		var uid, size int64
+		if err := rows.Scan(&uid, &size); err != nil {
+			continue
+		}
+		seqNum++
+		key := seqNum
+		if uidMode {
+			key = uid
+		}
+		if wanted[key] {
+			addBytes += size
+			addMessages++
+		}
+	}
+
+	return exceedsQuota(userDB, addBytes, addMessages)
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"raven/internal/db"
 	"raven/internal/models"
 	"raven/internal/server"
 )
@@ -1041,3 +1042,94 @@ func TestSearchCommand_TagHandling(t *testing.T) {
 		})
 	}
 }
+
+// TestSearchCommand_SaveDate tests SAVEDATE in FETCH and the SAVEDBEFORE,
+// SAVEDON and SAVEDSINCE search keys (RFC 8514)
+func TestSearchCommand_SaveDate(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	server.InsertTestMail(t, database, "testuser", "Old", "sender@test.com", "testuser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "testuser", "New", "sender@test.com", "testuser@localhost", "INBOX")
+	userDB, err := database.GetUserDB(state.Email)
+	if err != nil {
+		t.Fatalf("Failed to get user database: %v", err)
+	}
+	saved := time.Date(2020, time.March, 5, 10, 30, 0, 0, time.UTC)
+	if _, err := userDB.Exec("UPDATE message_mailbox SET added_at = ? WHERE uid = 1", saved); err != nil {
+		t.Fatalf("Failed to set save date: %v", err)
+	}
+	srv.HandleSelect(conn, "S001", []string{"S001", "SELECT", "INBOX"}, state)
+
+	conn.ClearWriteBuffer()
+	srv.HandleFetch(conn, "F001", []string{"F001", "FETCH", "1", "(SAVEDATE)"}, state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, `* 1 FETCH (SAVEDATE "05-Mar-2020 10:30:00 +0000")`) {
+		t.Errorf("Expected the save date, got: %s", response)
+	}
+
+	searches := []struct {
+		criteria []string
+		expected string
+	}{
+		{[]string{"SAVEDBEFORE", "1-Jan-2021"}, "* SEARCH 1\r\n"},
+		{[]string{"SAVEDON", "5-Mar-2020"}, "* SEARCH 1\r\n"},
+		{[]string{"SAVEDSINCE", "1-Jan-2021"}, "* SEARCH 2\r\n"},
+		{[]string{"SAVEDATESUPPORTED"}, "* SEARCH 1 2\r\n"},
+	}
+	for i, search := range searches {
+		tag := fmt.Sprintf("SR%02d", i+1)
+		conn.ClearWriteBuffer()
+		srv.HandleSearch(conn, tag, append([]string{tag, "SEARCH"}, search.criteria...), state)
+		if response := conn.GetWrittenData(); !strings.Contains(response, search.expected) {
+			t.Errorf("SEARCH %v: expected %q, got: %s", search.criteria, search.expected, response)
+		}
+	}
+}
+
+// TestSearchCommand_FullTextIndex tests that string search keys are answered
+// from the full-text index, and that messages missing from it are still found
+func TestSearchCommand_FullTextIndex(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	state := server.SetupAuthenticatedState(t, srv, "testuser")
+	database := server.GetDatabaseFromServer(srv)
+
+	userDB, err := database.GetUserDB(state.Email)
+	if err != nil {
+		t.Fatalf("Failed to get user database: %v", err)
+	}
+	if !db.SearchIndexAvailable(userDB) {
+		t.Skip("SQLite built without FTS5 (build with -tags sqlite_fts5)")
+	}
+
+	// The body is only readable once decoded: "Quarterly figures attached"
+	server.InsertTestRawMail(t, database, "testuser", "From: Alice <alice@example.com>\r\nTo: testuser@localhost\r\n"+
+		"Subject: Figures\r\nContent-Transfer-Encoding: base64\r\n\r\nUXVhcnRlcmx5IGZpZ3VyZXMgYXR0YWNoZWQ=\r\n", "INBOX")
+	server.InsertTestMail(t, database, "testuser", "Lunch plans", "bob@example.com", "testuser@localhost", "INBOX")
+	unindexed := server.InsertTestMail(t, database, "testuser", "Old figures", "carol@example.com", "testuser@localhost", "INBOX")
+	if _, err := userDB.Exec("DELETE FROM message_search WHERE rowid = ?", unindexed); err != nil {
+		t.Fatalf("Failed to remove message from index: %v", err)
+	}
+	srv.HandleSelect(conn, "S001", []string{"S001", "SELECT", "INBOX"}, state)
+
+	searches := []struct {
+		criteria []string
+		expected string
+	}{
+		{[]string{"BODY", "quarterly FIGURES"}, "* SEARCH 1\r\n"},
+		{[]string{"SUBJECT", "figures"}, "* SEARCH 1 3\r\n"},
+		{[]string{"FROM", "alice"}, "* SEARCH 1\r\n"},
+		{[]string{"OR", "FROM", "bob", "FROM", "carol"}, "* SEARCH 2 3\r\n"},
+		{[]string{"NOT", "TEXT", "figures"}, "* SEARCH 2\r\n"},
+		{[]string{"TO", "nobody"}, "* SEARCH\r\n"},
+	}
+	for _, tt := range searches {
+		conn.ClearWriteBuffer()
+		srv.HandleSearch(conn, "S002", append([]string{"S002", "SEARCH"}, tt.criteria...), state)
+		if response := conn.GetWrittenData(); !strings.Contains(response, tt.expected) {
+			t.Errorf("SEARCH %v: expected %q, got: %s", tt.criteria, tt.expected, response)
+		}
+	}
+}
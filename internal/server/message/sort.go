@@ -0,0 +1,592 @@
+package message
+
+import (
+	"database/sql"
+	"fmt"
+	"mime"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"raven/internal/delivery/parser"
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== SORT / THREAD (RFC 5256) =====
+
+// sortMessage holds the per-message data needed to sort and thread search results
+type sortMessage struct {
+	SearchMatch
+	internalDate    time.Time
+	sentDate        time.Time
+	size            int64
+	subject         string
+	from            string
+	to              string
+	cc              string
+	displayFrom     string
+	threadID        int64
+	messageIDHeader string
+	parentIDs       []string // Candidate parent Message-IDs, nearest first
+}
+
+// sortKey is a single SORT criterion, optionally reversed
+type sortKey struct {
+	name    string
+	reverse bool
+}
+
+// supportedSortKeys lists the SORT criteria (RFC 5256 and SORT=DISPLAY from RFC 5957)
+var supportedSortKeys = []string{"ARRIVAL", "CC", "DATE", "FROM", "SIZE", "SUBJECT", "TO", "DISPLAYFROM"}
+
+// HandleSort implements the SORT command
+// Syntax: SORT (sort-criteria) charset search-criteria
+func HandleSort(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if state.SelectedMailboxID == 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO No folder selected", tag))
+		return
+	}
+
+	ExecuteSort(deps, conn, tag, "SORT", parts[min(2, len(parts)):], false, state)
+}
+
+// ExecuteSort runs SORT or UID SORT with the arguments following the command name
+func ExecuteSort(deps ServerDeps, conn net.Conn, tag string, command string, args []string, uidMode bool, state *models.ClientState) {
+	if len(args) < 3 || !strings.HasPrefix(args[0], "(") {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %s requires sort criteria, charset and search criteria", tag, command))
+		return
+	}
+
+	content, rest, err := utils.ParseParenthesizedList(args)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid sort criteria", tag))
+		return
+	}
+
+	keys, err := parseSortKeys(content)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+		return
+	}
+
+	messages, ok := searchForSortOrThread(deps, conn, tag, command, rest, state)
+	if !ok {
+		return
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return compareSortMessages(messages[i], messages[j], keys) < 0
+	})
+
+	var results []string
+	for _, msg := range messages {
+		results = append(results, formatSortValue(msg, uidMode))
+	}
+
+	if len(results) > 0 {
+		deps.SendResponse(conn, "* SORT "+strings.Join(results, " "))
+	} else {
+		deps.SendResponse(conn, "* SORT")
+	}
+	deps.SendResponse(conn, fmt.Sprintf("%s OK %s completed", tag, command))
+}
+
+// HandleThread implements the THREAD command
+// Syntax: THREAD algorithm charset search-criteria
+func HandleThread(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if !state.Authenticated {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
+		return
+	}
+
+	if state.SelectedMailboxID == 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO No folder selected", tag))
+		return
+	}
+
+	ExecuteThread(deps, conn, tag, "THREAD", parts[min(2, len(parts)):], false, state)
+}
+
+// ExecuteThread runs THREAD or UID THREAD with the arguments following the command name
+func ExecuteThread(deps ServerDeps, conn net.Conn, tag string, command string, args []string, uidMode bool, state *models.ClientState) {
+	if len(args) < 3 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %s requires algorithm, charset and search criteria", tag, command))
+		return
+	}
+
+	algorithm := strings.ToUpper(args[0])
+	if algorithm != "ORDEREDSUBJECT" && algorithm != "REFERENCES" {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Unsupported threading algorithm %s", tag, args[0]))
+		return
+	}
+
+	messages, ok := searchForSortOrThread(deps, conn, tag, command, args[1:], state)
+	if !ok {
+		return
+	}
+
+	var threads []string
+	if algorithm == "ORDEREDSUBJECT" {
+		threads = threadOrderedSubject(messages, uidMode)
+	} else {
+		threads = threadReferences(messages, uidMode)
+	}
+
+	if len(threads) > 0 {
+		deps.SendResponse(conn, "* THREAD "+strings.Join(threads, ""))
+	} else {
+		deps.SendResponse(conn, "* THREAD")
+	}
+	deps.SendResponse(conn, fmt.Sprintf("%s OK %s completed", tag, command))
+}
+
+// searchForSortOrThread validates the charset, evaluates the search criteria and
+// loads the sort data for every match. It sends the error response on failure.
+func searchForSortOrThread(deps ServerDeps, conn net.Conn, tag string, command string, args []string, state *models.ClientState) ([]*sortMessage, bool) {
+	if len(args) < 2 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %s requires charset and search criteria", tag, command))
+		return nil, false
+	}
+
+	charset := strings.ToUpper(utils.ParseQuotedString(args[0]))
+	if charset != "US-ASCII" && charset != "UTF-8" {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [BADCHARSET (US-ASCII UTF-8)] Charset not supported", tag))
+		return nil, false
+	}
+
+	targetDB, err := deps.GetSelectedDB(state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return nil, false
+	}
+
+	tokens := ExpandSearchResultTokens(args[1:], state.SearchResult)
+	matches, err := SearchMailboxMatchesTokens(targetDB, state.SelectedMailboxID, utils.SelectedMessageMap(state, targetDB), tokens, charset, SelectedAccountEmail(state), deps)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO %s failed: %v", tag, command, err))
+		return nil, false
+	}
+
+	messages, err := loadSortMessages(targetDB, state.SelectedMailboxID, matches)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO %s failed: %v", tag, command, err))
+		return nil, false
+	}
+
+	return messages, true
+}
+
+// parseSortKeys parses the content of a sort criteria list such as "REVERSE DATE SUBJECT"
+func parseSortKeys(content string) ([]sortKey, error) {
+	var keys []sortKey
+	reverse := false
+	for _, field := range strings.Fields(strings.ToUpper(content)) {
+		if field == "REVERSE" {
+			reverse = true
+			continue
+		}
+		if !utils.Contains(supportedSortKeys, field) {
+			return nil, fmt.Errorf("unsupported sort criterion %s", field)
+		}
+		keys = append(keys, sortKey{name: field, reverse: reverse})
+		reverse = false
+	}
+
+	if len(keys) == 0 || reverse {
+		return nil, fmt.Errorf("invalid sort criteria")
+	}
+
+	return keys, nil
+}
+
+// loadSortMessages loads dates, sizes, subjects, addresses and thread data for the matches
+func loadSortMessages(targetDB *sql.DB, mailboxID int64, matches []SearchMatch) ([]*sortMessage, error) {
+	byUID := make(map[int64]*sortMessage, len(matches))
+	messages := make([]*sortMessage, 0, len(matches))
+	for _, match := range matches {
+		msg := &sortMessage{SearchMatch: match}
+		byUID[match.UID] = msg
+		messages = append(messages, msg)
+	}
+	if len(messages) == 0 {
+		return messages, nil
+	}
+
+	rows, err := targetDB.Query(`
+		SELECT mm.uid, m.id, mm.internal_date, m.date, m.size_bytes, m.subject,
+		       m.thread_id, m.message_id_header, m.in_reply_to, m.references_header
+		FROM message_mailbox mm
+		JOIN messages m ON m.id = mm.message_id
+		WHERE mm.mailbox_id = ?
+	`, mailboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	byMessageID := make(map[int64]*sortMessage, len(messages))
+	for rows.Next() {
+		var uid, messageID int64
+		var internalDate, sentDate sql.NullTime
+		var size sql.NullInt64
+		var subject, messageIDHeader, inReplyTo, references sql.NullString
+		var threadID sql.NullInt64
+		if err := rows.Scan(&uid, &messageID, &internalDate, &sentDate, &size, &subject,
+			&threadID, &messageIDHeader, &inReplyTo, &references); err != nil {
+			continue
+		}
+
+		msg, ok := byUID[uid]
+		if !ok {
+			continue
+		}
+		byMessageID[messageID] = msg
+
+		msg.internalDate = internalDate.Time
+		msg.sentDate = sentDate.Time
+		if msg.sentDate.IsZero() {
+			msg.sentDate = msg.internalDate
+		}
+		msg.size = size.Int64
+		msg.subject = BaseSubject(subject.String)
+		msg.threadID = threadID.Int64
+		if !threadID.Valid {
+			msg.threadID = -messageID
+		}
+		msg.messageIDHeader = messageIDHeader.String
+
+		// RFC 5256: the parent is the last entry of References, or In-Reply-To if
+		// there are no References
+		refs := parser.ExtractMessageIDs(references.String)
+		for i := len(refs) - 1; i >= 0; i-- {
+			msg.parentIDs = append(msg.parentIDs, refs[i])
+		}
+		msg.parentIDs = append(msg.parentIDs, parser.ExtractMessageIDs(inReplyTo.String)...)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	addrRows, err := targetDB.Query(`
+		SELECT a.message_id, a.address_type, COALESCE(a.name, ''), a.email
+		FROM addresses a
+		JOIN message_mailbox mm ON mm.message_id = a.message_id
+		WHERE mm.mailbox_id = ? AND a.sequence = 0
+	`, mailboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = addrRows.Close() }()
+
+	for addrRows.Next() {
+		var messageID int64
+		var addressType, name, email string
+		if err := addrRows.Scan(&messageID, &addressType, &name, &email); err != nil {
+			continue
+		}
+		msg, ok := byMessageID[messageID]
+		if !ok {
+			continue
+		}
+
+		// Address keys compare the local part of the first address (RFC 5256)
+		mailbox := strings.ToUpper(email)
+		if at := strings.Index(mailbox, "@"); at != -1 {
+			mailbox = mailbox[:at]
+		}
+		switch addressType {
+		case "from":
+			msg.from = mailbox
+			// SORT=DISPLAY uses the display name, or the address when there is none (RFC 5957)
+			msg.displayFrom = strings.ToUpper(name)
+			if msg.displayFrom == "" {
+				msg.displayFrom = strings.ToUpper(email)
+			}
+		case "to":
+			msg.to = mailbox
+		case "cc":
+			msg.cc = mailbox
+		}
+	}
+
+	return messages, addrRows.Err()
+}
+
+// compareSortMessages compares two messages by the sort keys. Ties are broken
+// by sequence number, which is never reversed.
+func compareSortMessages(a, b *sortMessage, keys []sortKey) int {
+	for _, key := range keys {
+		result := 0
+		switch key.name {
+		case "ARRIVAL":
+			result = compareTimes(a.internalDate, b.internalDate)
+		case "DATE":
+			result = compareTimes(a.sentDate, b.sentDate)
+		case "SIZE":
+			result = compareInts(a.size, b.size)
+		case "SUBJECT":
+			result = strings.Compare(a.subject, b.subject)
+		case "FROM":
+			result = strings.Compare(a.from, b.from)
+		case "TO":
+			result = strings.Compare(a.to, b.to)
+		case "CC":
+			result = strings.Compare(a.cc, b.cc)
+		case "DISPLAYFROM":
+			result = strings.Compare(a.displayFrom, b.displayFrom)
+		}
+		if key.reverse {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+
+	return compareInts(int64(a.SeqNum), int64(b.SeqNum))
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// sortByDate orders messages by sent date, then sequence number
+func sortByDate(messages []*sortMessage) {
+	sort.SliceStable(messages, func(i, j int) bool {
+		return compareSortMessages(messages[i], messages[j], []sortKey{{name: "DATE"}}) < 0
+	})
+}
+
+func formatSortValue(msg *sortMessage, uidMode bool) string {
+	if uidMode {
+		return strconv.FormatInt(msg.UID, 10)
+	}
+	return strconv.Itoa(msg.SeqNum)
+}
+
+// threadOrderedSubject implements THREAD=ORDEREDSUBJECT: messages with the same
+// base subject form a thread, the oldest message is the parent of all others
+func threadOrderedSubject(messages []*sortMessage, uidMode bool) []string {
+	sortByDate(messages)
+
+	groups := make(map[string][]*sortMessage)
+	var order []string
+	for _, msg := range messages {
+		if _, ok := groups[msg.subject]; !ok {
+			order = append(order, msg.subject)
+		}
+		groups[msg.subject] = append(groups[msg.subject], msg)
+	}
+
+	var threads []string
+	for _, subject := range order {
+		group := groups[subject]
+		thread := formatSortValue(group[0], uidMode)
+		switch {
+		case len(group) == 2:
+			thread += " " + formatSortValue(group[1], uidMode)
+		case len(group) > 2:
+			thread += " "
+			for _, child := range group[1:] {
+				thread += "(" + formatSortValue(child, uidMode) + ")"
+			}
+		}
+		threads = append(threads, "("+thread+")")
+	}
+
+	return threads
+}
+
+// threadNode is a message in a REFERENCES thread tree
+type threadNode struct {
+	msg      *sortMessage
+	children []*threadNode
+}
+
+// threadReferences implements THREAD=REFERENCES on top of the thread IDs assigned
+// at delivery. Within a thread, each message hangs below its nearest ancestor that
+// is part of the result; messages whose ancestors are all missing become siblings
+// under an implicit dummy parent. Subject-based merging of separate threads is not
+// performed.
+func threadReferences(messages []*sortMessage, uidMode bool) []string {
+	sortByDate(messages)
+
+	nodes := make(map[*sortMessage]*threadNode, len(messages))
+	byHeader := make(map[int64]map[string]*threadNode)
+	for _, msg := range messages {
+		node := &threadNode{msg: msg}
+		nodes[msg] = node
+		if msg.messageIDHeader == "" {
+			continue
+		}
+		if byHeader[msg.threadID] == nil {
+			byHeader[msg.threadID] = make(map[string]*threadNode)
+		}
+		if _, exists := byHeader[msg.threadID][msg.messageIDHeader]; !exists {
+			byHeader[msg.threadID][msg.messageIDHeader] = node
+		}
+	}
+
+	parents := make(map[*threadNode]*threadNode)
+	isAncestor := func(candidate, node *threadNode) bool {
+		for p := candidate; p != nil; p = parents[p] {
+			if p == node {
+				return true
+			}
+		}
+		return false
+	}
+
+	roots := make(map[int64][]*threadNode)
+	var threadOrder []int64
+	for _, msg := range messages {
+		node := nodes[msg]
+		for _, id := range msg.parentIDs {
+			parent, ok := byHeader[msg.threadID][id]
+			if ok && parent != node && !isAncestor(parent, node) {
+				parents[node] = parent
+				parent.children = append(parent.children, node)
+				break
+			}
+		}
+		if parents[node] == nil {
+			if _, seen := roots[msg.threadID]; !seen {
+				threadOrder = append(threadOrder, msg.threadID)
+			}
+			roots[msg.threadID] = append(roots[msg.threadID], node)
+		}
+	}
+
+	var threads []string
+	for _, threadID := range threadOrder {
+		threadRoots := roots[threadID]
+		if len(threadRoots) == 1 {
+			threads = append(threads, "("+formatThreadNode(threadRoots[0], uidMode)+")")
+			continue
+		}
+		thread := ""
+		for _, root := range threadRoots {
+			thread += "(" + formatThreadNode(root, uidMode) + ")"
+		}
+		threads = append(threads, "("+thread+")")
+	}
+
+	return threads
+}
+
+// formatThreadNode renders a thread subtree: a single child continues the
+// current list, several children each get their own parenthesized list
+func formatThreadNode(node *threadNode, uidMode bool) string {
+	result := formatSortValue(node.msg, uidMode)
+	switch len(node.children) {
+	case 0:
+	case 1:
+		result += " " + formatThreadNode(node.children[0], uidMode)
+	default:
+		result += " "
+		for _, child := range node.children {
+			result += "(" + formatThreadNode(child, uidMode) + ")"
+		}
+	}
+	return result
+}
+
+// BaseSubject extracts the base subject used by SORT and THREAD (RFC 5256 Section 2.1):
+// encoded words are decoded and reply/forward prefixes, [blob] tags and "(fwd)"
+// trailers are removed. The result is upper-cased for case-insensitive comparison.
+func BaseSubject(subject string) string {
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	for {
+		previous := subject
+
+		// Remove trailing "(fwd)" subj-trailers
+		for strings.HasSuffix(strings.ToLower(subject), "(fwd)") {
+			subject = strings.TrimSpace(subject[:len(subject)-len("(fwd)")])
+		}
+
+		// Remove leading subj-leaders ("Re:", "Fwd:", "[list] Re:") and subj-blobs
+		for {
+			stripped := stripSubjectLeader(subject)
+			if stripped == subject {
+				break
+			}
+			subject = stripped
+		}
+
+		// Unwrap "[fwd: ...]"
+		lower := strings.ToLower(subject)
+		if strings.HasPrefix(lower, "[fwd:") && strings.HasSuffix(subject, "]") {
+			subject = strings.TrimSpace(subject[len("[fwd:") : len(subject)-1])
+		}
+
+		if subject == previous {
+			break
+		}
+	}
+
+	return strings.ToUpper(subject)
+}
+
+// stripSubjectLeader removes one leading "re:"/"fw:"/"fwd:" (with optional
+// [blob] tags) or a leading [blob] when something remains after it
+func stripSubjectLeader(subject string) string {
+	rest := skipSubjectBlobs(subject)
+	lower := strings.ToLower(rest)
+	for _, prefix := range []string{"fwd", "fw", "re"} {
+		if !strings.HasPrefix(lower, prefix) {
+			continue
+		}
+		after := strings.TrimLeft(rest[len(prefix):], " ")
+		after = skipSubjectBlobs(after)
+		if strings.HasPrefix(after, ":") {
+			return strings.TrimSpace(after[1:])
+		}
+	}
+
+	// A lone leading [blob] is removed as long as the subject does not become empty
+	if rest != subject && strings.TrimSpace(rest) != "" {
+		return strings.TrimSpace(rest)
+	}
+
+	return subject
+}
+
+// skipSubjectBlobs skips leading "[...]" subj-blobs
+func skipSubjectBlobs(subject string) string {
+	for strings.HasPrefix(subject, "[") {
+		end := strings.Index(subject, "]")
+		if end == -1 || strings.ContainsAny(subject[1:end], "[") {
+			break
+		}
+		subject = strings.TrimLeft(subject[end+1:], " ")
+	}
+	return subject
+}
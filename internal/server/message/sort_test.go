@@ -0,0 +1,198 @@
+package message_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"raven/internal/models"
+	"raven/internal/server"
+	"raven/internal/server/message"
+)
+
+// setupThreadMailbox stores a small conversation:
+//  1. "Lunch" from carol (root)
+//  2. "Re: Lunch" from alice, reply to 1
+//  3. "Budget" from bob, unrelated
+//  4. "Re: Lunch" from bob, reply to 1
+//  5. "Re: Re: Lunch" from carol, reply to 2
+func setupThreadMailbox(t *testing.T) (*server.TestInterface, *models.ClientState) {
+	t.Helper()
+	srv := server.SetupTestServerSimple(t)
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "threaduser")
+	messages := []struct {
+		id, from, subject, date, references string
+		size                                int
+	}{
+		{"<1@test>", "Carol <carol@test.com>", "Lunch", "Mon, 01 Jan 2024 10:00:00 +0000", "", 300},
+		{"<2@test>", "Alice <alice@test.com>", "Re: Lunch", "Mon, 01 Jan 2024 11:00:00 +0000", "<1@test>", 100},
+		{"<3@test>", "Bob <bob@test.com>", "Budget", "Mon, 01 Jan 2024 09:00:00 +0000", "", 500},
+		{"<4@test>", "Bob <bob@test.com>", "Re: Lunch", "Mon, 01 Jan 2024 12:00:00 +0000", "<1@test>", 200},
+		{"<5@test>", "Carol <carol@test.com>", "Re: Re: Lunch", "Mon, 01 Jan 2024 13:00:00 +0000", "<1@test> <2@test>", 400},
+	}
+	for _, m := range messages {
+		raw := fmt.Sprintf("From: %s\r\nTo: threaduser@localhost\r\nSubject: %s\r\nDate: %s\r\nMessage-ID: %s\r\n", m.from, m.subject, m.date, m.id)
+		if m.references != "" {
+			refs := strings.Fields(m.references)
+			raw += fmt.Sprintf("In-Reply-To: %s\r\nReferences: %s\r\n", refs[len(refs)-1], m.references)
+		}
+		raw += "\r\n" + strings.Repeat("x", m.size)
+		server.InsertTestRawMail(t, database, "threaduser", raw, "INBOX")
+	}
+
+	mailboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		Username:          "threaduser",
+		SelectedMailboxID: mailboxID,
+		LastMessageCount:  len(messages),
+	}
+
+	return srv, state
+}
+
+// TestBaseSubject tests RFC 5256 base subject extraction
+func TestBaseSubject(t *testing.T) {
+	tests := map[string]string{
+		"Lunch":                      "LUNCH",
+		"Re: Lunch":                  "LUNCH",
+		"RE: re: Fwd: Lunch":         "LUNCH",
+		"[list] Re: Lunch":           "LUNCH",
+		"Lunch (fwd)":                "LUNCH",
+		"[Fwd: Re: Lunch]":           "LUNCH",
+		"  Lunch   plans ":           "LUNCH PLANS",
+		"[list]":                     "[LIST]",
+		"=?UTF-8?Q?Re:_Caf=C3=A9?=":  "CAFÉ",
+		"Re: [list] Fw: Lunch (fwd)": "LUNCH",
+	}
+	for subject, expected := range tests {
+		if got := message.BaseSubject(subject); got != expected {
+			t.Errorf("BaseSubject(%q) = %q, expected %q", subject, got, expected)
+		}
+	}
+}
+
+// TestSort_Criteria tests SORT with several sort keys
+func TestSort_Criteria(t *testing.T) {
+	srv, state := setupThreadMailbox(t)
+
+	tests := []struct {
+		criteria string
+		expected string
+	}{
+		{"(DATE)", "* SORT 3 1 2 4 5"},
+		{"(REVERSE DATE)", "* SORT 5 4 2 1 3"},
+		{"(SIZE)", "* SORT 2 4 1 5 3"},
+		{"(SUBJECT DATE)", "* SORT 3 1 2 4 5"},
+		{"(FROM REVERSE SIZE)", "* SORT 2 3 4 5 1"},
+		{"(DISPLAYFROM)", "* SORT 2 3 4 1 5"},
+		{"(ARRIVAL)", "* SORT 1 2 3 4 5"},
+	}
+	for _, tt := range tests {
+		conn := server.NewMockConn()
+		srv.HandleSort(conn, "S1", []string{"S1", "SORT", tt.criteria, "UTF-8", "ALL"}, state)
+
+		response := conn.GetWrittenData()
+		if !strings.Contains(response, tt.expected+"\r\n") {
+			t.Errorf("SORT %s: expected '%s', got: %s", tt.criteria, tt.expected, response)
+		}
+		if !strings.Contains(response, "S1 OK SORT completed") {
+			t.Errorf("SORT %s: expected OK, got: %s", tt.criteria, response)
+		}
+	}
+}
+
+// TestSort_SearchCriteria tests that SORT only returns matching messages
+func TestSort_SearchCriteria(t *testing.T) {
+	srv, state := setupThreadMailbox(t)
+	conn := server.NewMockConn()
+
+	srv.HandleSort(conn, "S2", []string{"S2", "SORT", "(REVERSE", "SIZE)", "US-ASCII", "SUBJECT", "Lunch"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* SORT 5 1 4 2\r\n") {
+		t.Errorf("Expected '* SORT 5 1 4 2', got: %s", response)
+	}
+}
+
+// TestSort_Errors tests SORT argument validation
+func TestSort_Errors(t *testing.T) {
+	srv, state := setupThreadMailbox(t)
+
+	tests := []struct {
+		parts    []string
+		expected string
+	}{
+		{[]string{"E1", "SORT", "(DATE)", "UTF-8"}, "E1 BAD"},
+		{[]string{"E2", "SORT", "(COLOR)", "UTF-8", "ALL"}, "E2 BAD"},
+		{[]string{"E3", "SORT", "(REVERSE)", "UTF-8", "ALL"}, "E3 BAD"},
+		{[]string{"E4", "SORT", "(DATE)", "KOI8-R", "ALL"}, "E4 NO [BADCHARSET"},
+	}
+	for _, tt := range tests {
+		conn := server.NewMockConn()
+		srv.HandleSort(conn, tt.parts[0], tt.parts, state)
+		if response := conn.GetWrittenData(); !strings.Contains(response, tt.expected) {
+			t.Errorf("Expected '%s', got: %s", tt.expected, response)
+		}
+	}
+
+	conn := server.NewMockConn()
+	srv.HandleSort(conn, "E5", []string{"E5", "SORT", "(DATE)", "UTF-8", "ALL"}, &models.ClientState{Authenticated: true})
+	if response := conn.GetWrittenData(); !strings.Contains(response, "E5 NO No folder selected") {
+		t.Errorf("Expected NO without selected mailbox, got: %s", response)
+	}
+}
+
+// TestThread_OrderedSubject tests THREAD=ORDEREDSUBJECT
+func TestThread_OrderedSubject(t *testing.T) {
+	srv, state := setupThreadMailbox(t)
+	conn := server.NewMockConn()
+
+	srv.HandleThread(conn, "T1", []string{"T1", "THREAD", "ORDEREDSUBJECT", "UTF-8", "ALL"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* THREAD (3)(1 (2)(4)(5))\r\n") {
+		t.Errorf("Expected '* THREAD (3)(1 (2)(4)(5))', got: %s", response)
+	}
+	if !strings.Contains(response, "T1 OK THREAD completed") {
+		t.Errorf("Expected OK, got: %s", response)
+	}
+}
+
+// TestThread_References tests THREAD=REFERENCES using stored thread IDs
+func TestThread_References(t *testing.T) {
+	srv, state := setupThreadMailbox(t)
+	conn := server.NewMockConn()
+
+	srv.HandleThread(conn, "T2", []string{"T2", "THREAD", "REFERENCES", "UTF-8", "ALL"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* THREAD (3)(1 (2 5)(4))\r\n") {
+		t.Errorf("Expected '* THREAD (3)(1 (2 5)(4))', got: %s", response)
+	}
+
+	// Without the root, the replies become siblings of the same thread
+	conn.ClearWriteBuffer()
+	srv.HandleThread(conn, "T3", []string{"T3", "THREAD", "REFERENCES", "UTF-8", "SUBJECT", "Re:"}, state)
+
+	response = conn.GetWrittenData()
+	if !strings.Contains(response, "* THREAD ((2 5)(4))\r\n") {
+		t.Errorf("Expected '* THREAD ((2 5)(4))', got: %s", response)
+	}
+}
+
+// TestThread_UnknownAlgorithm tests rejection of unsupported algorithms
+func TestThread_UnknownAlgorithm(t *testing.T) {
+	srv, state := setupThreadMailbox(t)
+	conn := server.NewMockConn()
+
+	srv.HandleThread(conn, "T4", []string{"T4", "THREAD", "X-GUESS", "UTF-8", "ALL"}, state)
+
+	if response := conn.GetWrittenData(); !strings.Contains(response, "T4 BAD") {
+		t.Errorf("Expected BAD, got: %s", response)
+	}
+}
@@ -0,0 +1,137 @@
+package message
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"raven/internal/db"
+	"raven/internal/models"
+	"raven/internal/server/utils"
+)
+
+// ===== SELECTED MAILBOX UPDATES =====
+
+// AllMailboxUpdates are the selected mailbox changes reported by NOOP and IDLE
+var AllMailboxUpdates = map[string]bool{"MESSAGENEW": true, "MESSAGEEXPUNGE": true, "FLAGCHANGE": true}
+
+// UpdatesAllowed returns the selected mailbox changes that may be reported
+// before the command in parts. EXPUNGE responses must not be sent during
+// FETCH, STORE or SEARCH (RFC 9051 Section 7.5.1), since the client may be
+// using the sequence numbers they would shift.
+func UpdatesAllowed(parts []string) map[string]bool {
+	if len(parts) >= 2 {
+		switch strings.ToUpper(parts[1]) {
+		case "FETCH", "STORE", "SEARCH":
+			return map[string]bool{"MESSAGENEW": true, "FLAGCHANGE": true}
+		}
+	}
+	return AllMailboxUpdates
+}
+
+// SendMailboxUpdates reports changes to the selected mailbox made since the
+// session last heard about it, limited to the given events, and brings the
+// session's message map up to date with what was reported. New messages are
+// also fetched with fetchAtts when it is set.
+func SendMailboxUpdates(deps ServerDeps, conn net.Conn, state *models.ClientState, events map[string]bool, fetchAtts string) {
+	if !state.Authenticated || state.SelectedMailboxID == 0 {
+		return
+	}
+
+	targetDB, err := deps.GetSelectedDB(state)
+	if err != nil {
+		return
+	}
+
+	// Loading the whole map is only worth it when the mailbox has changed
+	// since the session's map was last brought up to date
+	var version models.MailboxVersion
+	version.HighestModSeq, version.Messages, version.UIDNext, err = db.GetMailboxCountersPerUser(targetDB, state.SelectedMailboxID)
+	if err != nil {
+		return
+	}
+	if utils.IsSelectedMessageMap(state) && state.Messages.Version == version {
+		return
+	}
+
+	current, err := utils.LoadMessageMap(targetDB, state.SelectedMailboxID, state.SelectedOwner)
+	if err != nil {
+		return
+	}
+
+	// A session without a map of its mailbox knows about the first
+	// LastMessageCount messages
+	if !utils.IsSelectedMessageMap(state) {
+		known := models.NewMessageMap(state.SelectedMailboxID, state.SelectedOwner)
+		for seqNum := 1; seqNum <= state.LastMessageCount && seqNum <= current.Count(); seqNum++ {
+			uid, _ := current.UID(seqNum)
+			known.Add(uid, current.Flags[uid])
+		}
+		state.Messages = known
+	}
+	messages := state.Messages
+
+	// Expunged messages, in ascending order of their current sequence numbers
+	if events["MESSAGEEXPUNGE"] {
+		var expungedSeqNums []int
+		var expungedUIDs []int64
+		for _, uid := range append([]int64(nil), messages.UIDs...) {
+			if _, ok := current.Flags[uid]; ok {
+				continue
+			}
+			if seqNum, ok := messages.Expunge(uid); ok {
+				expungedSeqNums = append(expungedSeqNums, seqNum)
+				expungedUIDs = append(expungedUIDs, uid)
+			}
+		}
+		SendExpungeNotifications(deps, conn, state, expungedSeqNums, expungedUIDs)
+	}
+
+	// Flag changes of messages the client knows about
+	if events["FLAGCHANGE"] {
+		for seqNum, uid := range messages.UIDs {
+			flags, ok := current.Flags[uid]
+			if !ok || flags == messages.Flags[uid] {
+				continue
+			}
+			items := fmt.Sprintf("UID %d FLAGS (%s)", uid, utils.ClientFlags(flags, state))
+			if state.CondStoreEnabled {
+				if modseq, err := db.GetMessageModSeqPerUser(targetDB, state.SelectedMailboxID, uid); err == nil {
+					items += " " + formatModSeqItem(modseq)
+				}
+			}
+			deps.SendResponse(conn, fmt.Sprintf("* %d FETCH (%s)", seqNum+1, items))
+			messages.SetFlags(uid, flags)
+		}
+	}
+
+	// New messages are those above the highest UID the client knows about
+	if events["MESSAGENEW"] {
+		var lastUID int64
+		if n := messages.Count(); n > 0 {
+			lastUID, _ = messages.UID(n)
+		}
+		var newUIDs []int
+		for _, uid := range current.UIDs {
+			if uid > lastUID {
+				messages.Add(uid, current.Flags[uid])
+				newUIDs = append(newUIDs, int(uid))
+			}
+		}
+		if len(newUIDs) > 0 {
+			deps.SendResponse(conn, fmt.Sprintf("* %d EXISTS", messages.Count()))
+			if !state.IMAP4rev2Enabled {
+				deps.SendResponse(conn, fmt.Sprintf("* %d RECENT", len(newUIDs)))
+			}
+			if fetchAtts != "" {
+				_ = HandleFetchForUIDs(deps, conn, "", newUIDs, fetchAtts, state)
+			}
+		}
+	}
+
+	// Changes left unreported keep the map behind the mailbox
+	if events["MESSAGEEXPUNGE"] && events["FLAGCHANGE"] && events["MESSAGENEW"] {
+		messages.Version = version
+	}
+	state.LastMessageCount = messages.Count()
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"raven/internal/conf"
+	"raven/internal/socketmap/cache"
+	"raven/internal/socketmap/thunder"
+)
+
+// RoleResolver returns the names of the roles a user holds in the identity provider
+type RoleResolver func(email string) ([]string, error)
+
+// initRoleResolver looks up role memberships in Thunder when it is configured
+func (s *IMAPServer) initRoleResolver(cfg *conf.Config) {
+	if cfg.ThunderHost == "" {
+		log.Printf("IMAP roles: Thunder host not configured, role mailboxes are disabled")
+		return
+	}
+
+	s.SetRoleResolver(func(email string) ([]string, error) {
+		return thunder.GetUserRoles(email, cfg.ThunderHost, cfg.ThunderPort, cfg.TokenRefreshSeconds)
+	}, cfg.RoleCacheTTLSeconds)
+}
+
+// SetRoleResolver sets how role memberships are looked up and how long they are cached (useful for testing)
+func (s *IMAPServer) SetRoleResolver(resolver RoleResolver, cacheTTLSeconds int) {
+	s.roleResolver = resolver
+	s.roleCache = cache.New(cacheTTLSeconds)
+}
+
+// GetUserRoles returns the roles a user holds. Memberships are cached; if the
+// lookup fails the last known roles are used and nothing new is cached.
+func (s *IMAPServer) GetUserRoles(email string) []string {
+	if s.roleResolver == nil || email == "" {
+		return nil
+	}
+
+	key := strings.ToLower(email)
+	entry, found := s.roleCache.Get(key)
+	if found && !s.roleCache.IsExpired(entry) {
+		return splitRoles(entry.Data)
+	}
+
+	roles, err := s.roleResolver(email)
+	if err != nil {
+		log.Printf("IMAP roles: lookup failed for %s: %v", email, err)
+		if found {
+			return splitRoles(entry.Data)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	s.roleCache.Set(key, cache.Entry{
+		Exists:     len(roles) > 0,
+		Data:       strings.Join(roles, ","),
+		Expires:    now.Add(s.roleCache.GetTTL()),
+		LastUpdate: now,
+	})
+
+	return roles
+}
+
+// splitRoles parses the comma-separated role list kept in the cache
+func splitRoles(data string) []string {
+	if data == "" {
+		return nil
+	}
+	return strings.Split(data, ",")
+}
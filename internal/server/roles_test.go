@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestGetUserRoles_Cached tests that role memberships are cached per user
+func TestGetUserRoles_Cached(t *testing.T) {
+	s := &IMAPServer{}
+	if roles := s.GetUserRoles("user@example.com"); roles != nil {
+		t.Errorf("Expected no roles without a resolver, got %v", roles)
+	}
+
+	lookups := 0
+	s.SetRoleResolver(func(email string) ([]string, error) {
+		lookups++
+		return []string{"admin", "support"}, nil
+	}, 300)
+
+	for i := 0; i < 3; i++ {
+		roles := s.GetUserRoles("User@Example.com")
+		if len(roles) != 2 || roles[0] != "admin" || roles[1] != "support" {
+			t.Fatalf("Unexpected roles: %v", roles)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected 1 lookup, got %d", lookups)
+	}
+}
+
+// TestGetUserRoles_LookupFailure tests that the last known roles are kept when the IDP fails
+func TestGetUserRoles_LookupFailure(t *testing.T) {
+	s := &IMAPServer{}
+	fail := false
+	s.SetRoleResolver(func(email string) ([]string, error) {
+		if fail {
+			return nil, errors.New("unavailable")
+		}
+		return []string{"admin"}, nil
+	}, 0)
+
+	if roles := s.GetUserRoles("user@example.com"); len(roles) != 1 {
+		t.Fatalf("Expected one role, got %v", roles)
+	}
+
+	// A zero TTL forces a new lookup, which fails
+	fail = true
+	if roles := s.GetUserRoles("user@example.com"); len(roles) != 1 || roles[0] != "admin" {
+		t.Errorf("Expected cached role after failure, got %v", roles)
+	}
+
+	if roles := s.GetUserRoles("other@example.com"); roles != nil {
+		t.Errorf("Expected no roles for an unknown user, got %v", roles)
+	}
+}
+
+// TestGetUserRoles_FailureNotCached tests that a failed lookup is retried on the next call
+func TestGetUserRoles_FailureNotCached(t *testing.T) {
+	s := &IMAPServer{}
+	lookups := 0
+	s.SetRoleResolver(func(email string) ([]string, error) {
+		lookups++
+		if lookups == 1 {
+			return []string{"admin"}, errors.New("assignment lookup failed for role support")
+		}
+		return []string{"admin", "support"}, nil
+	}, 300)
+
+	if roles := s.GetUserRoles("user@example.com"); roles != nil {
+		t.Errorf("Expected no roles from a failed lookup, got %v", roles)
+	}
+	if roles := s.GetUserRoles("user@example.com"); len(roles) != 2 {
+		t.Errorf("Expected both roles after the retry, got %v", roles)
+	}
+	if lookups != 2 {
+		t.Errorf("Expected 2 lookups, got %d", lookups)
+	}
+}
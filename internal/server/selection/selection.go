@@ -3,18 +3,24 @@ package selection
 import (
 	"database/sql"
 	"fmt"
+	"math"
 	"net"
+	"strconv"
 	"strings"
 
 	"raven/internal/blobstorage"
 	"raven/internal/db"
 	"raven/internal/models"
+	"raven/internal/server/utils"
 )
 
 // ServerDeps defines the dependencies that selection handlers need from the server
 type ServerDeps interface {
 	SendResponse(conn net.Conn, response string)
 	GetUserDB(email string) (*sql.DB, error)
+	GetUserRoles(email string) []string
+	GetSharedDB() *sql.DB
+	GetDBManager() *db.DBManager
 	GetS3Storage() *blobstorage.S3BlobStorage
 }
 
@@ -45,7 +51,28 @@ func HandleSelect(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return
 	}
 
-	folder := strings.Trim(parts[2], "\"")
+	folder, err := utils.ParseMailboxName(parts[2], state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
+
+	// RFC 7162: optional (CONDSTORE) or (QRESYNC (...)) select parameters
+	params, err := parseSelectParams(strings.Join(parts[3:], " "))
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+		return
+	}
+	if params.condStore {
+		state.CondStoreEnabled = true
+	}
+	// The QRESYNC parameter is only allowed once the client has issued
+	// ENABLE QRESYNC (RFC 7162 Section 3.2.5)
+	if params.qresync && !state.QResyncEnabled {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD QRESYNC is not enabled", tag))
+		return
+	}
+
 	state.SelectedFolder = folder
 	stateEmail := resolveStateEmail(state)
 
@@ -59,22 +86,39 @@ func HandleSelect(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 		return name
 	}
 
-	// Regular user mailbox
-	var err error
-	targetDB, err = deps.GetUserDB(stateEmail)
+	// Regular user mailbox, or another user's mailbox shared through an ACL (RFC 4314)
+	access, err := utils.ResolveMailboxAccess(deps, stateEmail, normalizeInbox(folder))
+	if err == utils.ErrNoSuchMailbox {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [TRYCREATE] Mailbox does not exist", tag))
+		return
+	}
 	if err != nil {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
 		return
 	}
-
-	// Get mailbox ID using new schema
-	mailboxID, err := db.GetMailboxByNamePerUser(targetDB, normalizeInbox(folder))
-	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO [TRYCREATE] Mailbox does not exist", tag))
+	if !utils.HasRights(access.Rights, "r") {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
 		return
 	}
 
+	targetDB = access.DB
+	mailboxID := access.MailboxID
+
+	// Tell the client where responses for the previous mailbox end
+	// (RFC 7162 Section 3.2.11, RFC 9051 Section 7.1)
+	if state.SelectedMailboxID != 0 && (state.QResyncEnabled || state.IMAP4rev2Enabled) {
+		deps.SendResponse(conn, "* OK [CLOSED] Previous mailbox closed")
+	}
+
 	state.SelectedMailboxID = mailboxID
+	state.SelectedOwner = access.Owner
+	state.SelectedRights = access.Rights
+	state.SearchResult = nil
+
+	// EXAMINE, and SELECT of a shared mailbox without any right to change
+	// message state, open the mailbox read-only
+	isExamine := strings.EqualFold(parts[1], "EXAMINE")
+	state.ReadOnly = isExamine || !strings.ContainsAny(access.Rights, "swte")
 
 	// Get mailbox info (UID validity and next UID)
 	uidValidity, uidNext, err := db.GetMailboxInfoPerUser(targetDB, mailboxID)
@@ -86,11 +130,13 @@ func HandleSelect(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 	state.UIDValidity = uidValidity
 	state.UIDNext = uidNext
 
-	// Get message count using new schema
-	count, err := db.GetMessageCountPerUser(targetDB, mailboxID)
+	// The session's sequence numbers start out as the mailbox is now
+	messages, err := utils.LoadMessageMap(targetDB, mailboxID, access.Owner)
 	if err != nil {
-		count = 0
+		messages = models.NewMessageMap(mailboxID, access.Owner)
 	}
+	state.Messages = messages
+	count := messages.Count()
 
 	// Get recent count using the actual \Recent flag, not unseen messages.
 	recent, err := db.GetRecentCountPerUser(targetDB, mailboxID)
@@ -118,44 +164,162 @@ func HandleSelect(deps ServerDeps, conn net.Conn, tag string, parts []string, st
 
 	// Determine if this is SELECT or EXAMINE
 	cmd := strings.ToUpper(parts[1])
-	isExamine := (cmd == "EXAMINE")
 
 	// Send REQUIRED untagged responses in the correct order per RFC 3501
 	// For SELECT: FLAGS, EXISTS, RECENT
 	// For EXAMINE: EXISTS, RECENT, then FLAGS (per RFC 3501 example)
+	// IMAP4rev2 drops RECENT and the UNSEEN response code (RFC 9051 Appendix E)
 	if !isExamine {
-		deps.SendResponse(conn, "* FLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft)")
+		deps.SendResponse(conn, fmt.Sprintf("* FLAGS (%s)", utils.MailboxFlags(state)))
 	}
 	deps.SendResponse(conn, fmt.Sprintf("* %d EXISTS", count))
-	deps.SendResponse(conn, fmt.Sprintf("* %d RECENT", recent))
+	if !state.IMAP4rev2Enabled {
+		deps.SendResponse(conn, fmt.Sprintf("* %d RECENT", recent))
+	}
 
 	// Send REQUIRED OK untagged responses
-	if hasUnseen {
+	if hasUnseen && !state.IMAP4rev2Enabled {
 		deps.SendResponse(conn, fmt.Sprintf("* OK [UNSEEN %d] Message %d is first unseen", unseenSeqNum, unseenSeqNum))
 	}
 	deps.SendResponse(conn, fmt.Sprintf("* OK [UIDVALIDITY %d] UIDs valid", uidValidity))
 	deps.SendResponse(conn, fmt.Sprintf("* OK [UIDNEXT %d] Predicted next UID", uidNext))
 
+	// Mod-sequences are persistent, so HIGHESTMODSEQ is always reported (RFC 7162 Section 3.1.2.1)
+	highestModSeq, err := db.GetHighestModSeqPerUser(targetDB, mailboxID)
+	if err == nil {
+		deps.SendResponse(conn, fmt.Sprintf("* OK [HIGHESTMODSEQ %d] Highest", highestModSeq))
+	}
+
+	// A stable identifier for the mailbox (RFC 8474 Section 4.1)
+	deps.SendResponse(conn, fmt.Sprintf("* OK [MAILBOXID (%s)] Ok", db.MailboxObjectID(mailboxID, uidValidity)))
+
 	// FLAGS for EXAMINE comes after OK untagged responses
 	if isExamine {
-		deps.SendResponse(conn, "* FLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft)")
+		deps.SendResponse(conn, fmt.Sprintf("* FLAGS (%s)", utils.MailboxFlags(state)))
 	}
 
 	// PERMANENTFLAGS: Empty for EXAMINE (read-only), full for SELECT
 	if isExamine {
 		deps.SendResponse(conn, "* OK [PERMANENTFLAGS ()] No permanent flags permitted")
 	} else {
-		deps.SendResponse(conn, "* OK [PERMANENTFLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft \\*)] Limited")
+		deps.SendResponse(conn, fmt.Sprintf("* OK [PERMANENTFLAGS (%s \\*)] Limited", utils.MailboxFlags(state)))
+	}
+
+	// QRESYNC: report what changed since the client's cached state
+	if params.qresync && params.uidValidity == uidValidity {
+		sendQResyncChanges(deps, conn, targetDB, mailboxID, params, state)
 	}
 
 	// Send tagged completion response
-	if cmd == "SELECT" {
+	if cmd == "SELECT" && state.ReadOnly {
+		deps.SendResponse(conn, fmt.Sprintf("%s OK [READ-ONLY] SELECT completed", tag))
+	} else if cmd == "SELECT" {
 		deps.SendResponse(conn, fmt.Sprintf("%s OK [READ-WRITE] SELECT completed", tag))
 	} else {
 		deps.SendResponse(conn, fmt.Sprintf("%s OK [READ-ONLY] EXAMINE completed", tag))
 	}
 }
 
+// selectParams holds the optional SELECT/EXAMINE parameters (RFC 7162)
+type selectParams struct {
+	condStore   bool
+	qresync     bool
+	uidValidity int64
+	modSeq      int64
+	knownUIDs   string
+}
+
+// parseSelectParams parses "(CONDSTORE)" or "(QRESYNC (uidvalidity modseq [known-uids [seq-match]]))"
+func parseSelectParams(raw string) (selectParams, error) {
+	var params selectParams
+
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return params, nil
+	}
+	if !strings.HasPrefix(raw, "(") || !strings.HasSuffix(raw, ")") {
+		return params, fmt.Errorf("invalid SELECT parameters")
+	}
+
+	inner := strings.TrimSpace(raw[1 : len(raw)-1])
+	upper := strings.ToUpper(inner)
+
+	switch {
+	case upper == "CONDSTORE":
+		params.condStore = true
+	case strings.HasPrefix(upper, "QRESYNC"):
+		args := strings.TrimSpace(inner[len("QRESYNC"):])
+		if !strings.HasPrefix(args, "(") || !strings.HasSuffix(args, ")") {
+			return params, fmt.Errorf("invalid QRESYNC parameters")
+		}
+		fields := strings.Fields(args[1 : len(args)-1])
+		if len(fields) < 2 {
+			return params, fmt.Errorf("QRESYNC requires UIDVALIDITY and MODSEQ")
+		}
+
+		uidValidity, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || uidValidity < 1 {
+			return params, fmt.Errorf("invalid QRESYNC UIDVALIDITY")
+		}
+		modSeq, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || modSeq < 1 {
+			return params, fmt.Errorf("invalid QRESYNC MODSEQ")
+		}
+
+		params.qresync = true
+		params.uidValidity = uidValidity
+		params.modSeq = modSeq
+
+		// The optional sequence match data is only a hint and is not used
+		if len(fields) >= 3 && !strings.HasPrefix(fields[2], "(") {
+			params.knownUIDs = fields[2]
+		}
+	default:
+		return params, fmt.Errorf("unknown SELECT parameter")
+	}
+
+	return params, nil
+}
+
+// sendQResyncChanges sends VANISHED (EARLIER) and FETCH responses for everything
+// that changed in the mailbox after the client's last known mod-sequence
+func sendQResyncChanges(deps ServerDeps, conn net.Conn, targetDB *sql.DB, mailboxID int64, params selectParams, state *models.ClientState) {
+	expunged, err := db.GetExpungedUIDsSincePerUser(targetDB, mailboxID, params.modSeq)
+	if err == nil {
+		var vanished []int64
+		for _, uid := range expunged {
+			if params.knownUIDs == "" || utils.SequenceSetContains(params.knownUIDs, uid, math.MaxInt64) {
+				vanished = append(vanished, uid)
+			}
+		}
+		if len(vanished) > 0 {
+			deps.SendResponse(conn, fmt.Sprintf("* VANISHED (EARLIER) %s", utils.FormatSequenceSet(vanished)))
+		}
+	}
+
+	rows, err := targetDB.Query(`
+		SELECT seq_num, uid, flags, modseq FROM (
+			SELECT ROW_NUMBER() OVER (ORDER BY uid ASC) as seq_num, uid, flags, modseq
+			FROM message_mailbox
+			WHERE mailbox_id = ?
+		) WHERE modseq > ?
+		ORDER BY uid ASC
+	`, mailboxID, params.modSeq)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var seqNum, uid, modseq int64
+		var flags sql.NullString
+		if err := rows.Scan(&seqNum, &uid, &flags, &modseq); err != nil {
+			continue
+		}
+		deps.SendResponse(conn, fmt.Sprintf("* %d FETCH (UID %d FLAGS (%s) MODSEQ (%d))", seqNum, uid, utils.ClientFlags(flags.String, state), modseq))
+	}
+}
+
 // ===== CLOSE =====
 
 func HandleClose(deps ServerDeps, conn net.Conn, tag string, state *models.ClientState) {
@@ -176,18 +340,20 @@ func HandleClose(deps ServerDeps, conn net.Conn, tag string, state *models.Clien
 	// from the currently selected mailbox, and returns to authenticated state
 	// No untagged EXPUNGE responses are sent (unlike EXPUNGE command)
 
-	// Important: Per RFC 3501, if mailbox is read-only (selected with EXAMINE),
+	// Per RFC 3501, if mailbox is read-only (selected with EXAMINE),
 	// no messages are removed and no error is given.
-	// Since we don't currently track read-only state in ClientState,
-	// we always perform the expunge operation.
-	// TODO: Add ReadOnly field to ClientState to properly handle EXAMINE
 
-	// Get user database
-	userDB, err := deps.GetUserDB(resolveStateEmail(state))
+	// Get the database of the selected mailbox's owner
+	email := resolveStateEmail(state)
+	if state.SelectedOwner != "" {
+		email = state.SelectedOwner
+	}
+	userDB, err := deps.GetUserDB(email)
 	if err != nil {
 		// Clear selection and return
 		state.SelectedMailboxID = 0
 		state.SelectedFolder = ""
+		state.SelectedOwner = ""
 		deps.SendResponse(conn, fmt.Sprintf("%s OK CLOSE completed", tag))
 		return
 	}
@@ -212,9 +378,17 @@ func HandleClose(deps ServerDeps, conn net.Conn, tag string, state *models.Clien
 		}
 
 		// Delete the messages from message_mailbox table
-		// This removes them from the mailbox but keeps the message data
+		// This removes them from the mailbox but keeps the message data.
+		// Without the "e" right nothing is expunged (RFC 4314), and
+		// neither is anything in a read-only mailbox.
+		if state.ReadOnly || !utils.HasRights(utils.SelectedRights(state), "e") {
+			idsToDelete = nil
+		}
 		for _, id := range idsToDelete {
-			_, _ = userDB.Exec(`DELETE FROM message_mailbox WHERE id = ?`, id)
+			_ = db.ExpungeMessagePerUser(userDB, id)
+		}
+		if len(idsToDelete) > 0 {
+			deps.GetDBManager().MailboxChanges().Publish(userDB, state.SelectedMailboxID)
 		}
 	}
 
@@ -225,6 +399,11 @@ func HandleClose(deps ServerDeps, conn net.Conn, tag string, state *models.Clien
 	state.LastRecentCount = 0
 	state.UIDValidity = 0
 	state.UIDNext = 0
+	state.SearchResult = nil
+	state.SelectedOwner = ""
+	state.SelectedRights = ""
+	state.ReadOnly = false
+	state.Messages = nil
 
 	// Always complete successfully per RFC 3501
 	deps.SendResponse(conn, fmt.Sprintf("%s OK CLOSE completed", tag))
@@ -251,5 +430,10 @@ func HandleUnselect(deps ServerDeps, conn net.Conn, tag string, state *models.Cl
 	state.LastRecentCount = 0
 	state.UIDValidity = 0
 	state.UIDNext = 0
+	state.SearchResult = nil
+	state.SelectedOwner = ""
+	state.SelectedRights = ""
+	state.ReadOnly = false
+	state.Messages = nil
 	deps.SendResponse(conn, fmt.Sprintf("%s OK UNSELECT completed", tag))
 }
@@ -1,6 +1,7 @@
 package selection_test
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -294,6 +295,65 @@ func TestExamineCommand_MissingFolderName(t *testing.T) {
 	}
 }
 
+func TestExamineCommand_ReadOnlyEnforced(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "testuser")
+	server.InsertTestMail(t, database, "testuser", "Test Subject", "sender@test.com", "testuser@localhost", "INBOX")
+	mailboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+	userDB := server.GetUserDBByID(t, database, userID)
+	_, _ = userDB.Exec(`UPDATE message_mailbox SET flags = '\Deleted' WHERE mailbox_id = ?`, mailboxID)
+
+	state := &models.ClientState{
+		Authenticated: true,
+		UserID:        userID,
+		Username:      "testuser",
+	}
+	srv.HandleExamine(conn, "R001", []string{"R001", "EXAMINE", "INBOX"}, state)
+	if !state.ReadOnly {
+		t.Fatal("Expected EXAMINE to mark the session read-only")
+	}
+
+	expectRefused := func(tag, command string) {
+		t.Helper()
+		if response := conn.GetWrittenData(); !strings.Contains(response, tag+" NO Mailbox is read-only") {
+			t.Errorf("Expected %s to be refused, got: %s", command, response)
+		}
+		conn.ClearWriteBuffer()
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleStore(conn, "R002", []string{"R002", "STORE", "1", "+FLAGS", "(\\Seen)"}, state)
+	expectRefused("R002", "STORE")
+	srv.HandleUID(conn, "R003", []string{"R003", "UID", "STORE", "1", "+FLAGS", "(\\Seen)"}, state)
+	expectRefused("R003", "UID STORE")
+	srv.HandleExpunge(conn, "R004", state)
+	expectRefused("R004", "EXPUNGE")
+	srv.HandleUID(conn, "R005", []string{"R005", "UID", "EXPUNGE", "1"}, state)
+	expectRefused("R005", "UID EXPUNGE")
+	srv.HandleMove(conn, "R006", []string{"R006", "MOVE", "1", "Trash"}, state)
+	expectRefused("R006", "MOVE")
+
+	// CLOSE succeeds without expunging anything
+	conn.ClearWriteBuffer()
+	srv.HandleClose(conn, "R007", state)
+	if response := conn.GetWrittenData(); !strings.Contains(response, "R007 OK CLOSE completed") {
+		t.Errorf("Expected successful CLOSE, got: %s", response)
+	}
+	if state.ReadOnly {
+		t.Error("Expected CLOSE to clear the read-only state")
+	}
+
+	var flags string
+	var count int
+	_ = userDB.QueryRow(`SELECT COUNT(*), MAX(flags) FROM message_mailbox WHERE mailbox_id = ?`, mailboxID).Scan(&count, &flags)
+	if count != 1 || flags != `\Deleted` {
+		t.Errorf("Expected the mailbox to be unchanged, got %d messages with flags %q", count, flags)
+	}
+}
+
 // ============================================================================
 // CLOSE Command Tests
 // ============================================================================
@@ -674,3 +734,156 @@ func TestCloseCommand_DatabaseError(t *testing.T) {
 		t.Error("SelectedMailboxID should be 0 after CLOSE")
 	}
 }
+
+// ============================================================================
+// CONDSTORE / QRESYNC Tests
+// ============================================================================
+
+func TestSelectCommand_HighestModSeq(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "testuser")
+	server.InsertTestMail(t, database, "testuser", "Message 1", "sender@test.com", "testuser@localhost", "INBOX")
+	state := &models.ClientState{
+		Authenticated: true,
+		UserID:        userID,
+		Username:      "testuser",
+	}
+
+	srv.HandleSelect(conn, "Q001", []string{"Q001", "SELECT", "INBOX", "(CONDSTORE)"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* OK [HIGHESTMODSEQ ") {
+		t.Errorf("Expected HIGHESTMODSEQ response code, got: %s", response)
+	}
+	if !strings.Contains(response, "Q001 OK [READ-WRITE] SELECT completed") {
+		t.Errorf("Expected SELECT to complete, got: %s", response)
+	}
+	if !state.CondStoreEnabled {
+		t.Error("Expected SELECT (CONDSTORE) to enable CONDSTORE")
+	}
+}
+
+func TestSelectCommand_QResync(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "testuser")
+	for i := 1; i <= 3; i++ {
+		server.InsertTestMail(t, database, "testuser", "Message", "sender@test.com", "testuser@localhost", "INBOX")
+	}
+	mailboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+	userDB := server.GetUserDBByID(t, database, userID)
+
+	var uidValidity, modSeq int64
+	if err := userDB.QueryRow("SELECT uid_validity, highest_modseq FROM mailboxes WHERE id = ?", mailboxID).Scan(&uidValidity, &modSeq); err != nil {
+		t.Fatalf("Failed to query mailbox: %v", err)
+	}
+
+	// Changes made after the client's last known mod-sequence
+	if _, err := userDB.Exec("UPDATE message_mailbox SET flags = ? WHERE mailbox_id = ? AND uid = 1", `\Seen`, mailboxID); err != nil {
+		t.Fatalf("Failed to update flags: %v", err)
+	}
+	if _, err := userDB.Exec("DELETE FROM message_mailbox WHERE mailbox_id = ? AND uid = 3", mailboxID); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+
+	state := &models.ClientState{
+		Authenticated: true,
+		UserID:        userID,
+		Username:      "testuser",
+	}
+
+	// The parameter is refused until the client has issued ENABLE QRESYNC
+	params := fmt.Sprintf("(QRESYNC (%d %d 1:3))", uidValidity, modSeq)
+	parts := append([]string{"Q002", "SELECT", "INBOX"}, strings.Fields(params)...)
+	srv.HandleSelect(conn, "Q002", parts, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "Q002 BAD") || state.SelectedMailboxID != 0 || state.QResyncEnabled {
+		t.Fatalf("Expected BAD for QRESYNC without ENABLE, got: %s", response)
+	}
+
+	srv.HandleEnable(conn, "E001", []string{"E001", "ENABLE", "QRESYNC"}, state)
+	conn.ClearWriteBuffer()
+	srv.HandleSelect(conn, "Q002", parts, state)
+
+	response = conn.GetWrittenData()
+	if !strings.Contains(response, "* VANISHED (EARLIER) 3") {
+		t.Errorf("Expected VANISHED (EARLIER) 3, got: %s", response)
+	}
+	if !strings.Contains(response, "* 1 FETCH (UID 1 FLAGS (\\Seen) MODSEQ (") {
+		t.Errorf("Expected FETCH for changed message, got: %s", response)
+	}
+	if strings.Contains(response, "* 2 FETCH") {
+		t.Errorf("Unchanged message must not be reported, got: %s", response)
+	}
+	if !strings.Contains(response, "Q002 OK") {
+		t.Errorf("Expected SELECT to complete, got: %s", response)
+	}
+}
+
+func TestSelectCommand_QResyncIMAP4rev2(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "testuser")
+	server.InsertTestMail(t, database, "testuser", "Message", "sender@test.com", "testuser@localhost", "INBOX")
+	mailboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+	userDB := server.GetUserDBByID(t, database, userID)
+
+	var uidValidity, modSeq int64
+	if err := userDB.QueryRow("SELECT uid_validity, highest_modseq FROM mailboxes WHERE id = ?", mailboxID).Scan(&uidValidity, &modSeq); err != nil {
+		t.Fatalf("Failed to query mailbox: %v", err)
+	}
+	if _, err := userDB.Exec("UPDATE message_mailbox SET flags = ? WHERE mailbox_id = ? AND uid = 1", `\Seen \Recent`, mailboxID); err != nil {
+		t.Fatalf("Failed to update flags: %v", err)
+	}
+
+	state := &models.ClientState{
+		Authenticated: true,
+		UserID:        userID,
+		Username:      "testuser",
+	}
+	srv.HandleEnable(conn, "E001", []string{"E001", "ENABLE", "IMAP4rev2", "QRESYNC"}, state)
+	if !state.IMAP4rev2Enabled || !state.QResyncEnabled {
+		t.Fatalf("Expected IMAP4rev2 and QRESYNC to be enabled, got: %s", conn.GetWrittenData())
+	}
+	conn.ClearWriteBuffer()
+
+	params := fmt.Sprintf("(QRESYNC (%d %d))", uidValidity, modSeq)
+	srv.HandleSelect(conn, "Q004", append([]string{"Q004", "SELECT", "INBOX"}, strings.Fields(params)...), state)
+
+	// \Recent does not exist in IMAP4rev2 (RFC 9051 Appendix E)
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* 1 FETCH (UID 1 FLAGS (\\Seen) MODSEQ (") {
+		t.Errorf("Expected FETCH for changed message, got: %s", response)
+	}
+	if strings.Contains(response, "\\Recent") {
+		t.Errorf("\\Recent must not be sent to an IMAP4rev2 client, got: %s", response)
+	}
+}
+
+func TestSelectCommand_InvalidParameters(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "testuser")
+	state := &models.ClientState{
+		Authenticated: true,
+		UserID:        userID,
+		Username:      "testuser",
+	}
+
+	srv.HandleSelect(conn, "Q003", []string{"Q003", "SELECT", "INBOX", "(BOGUS)"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "Q003 BAD") {
+		t.Errorf("Expected BAD for unknown SELECT parameter, got: %s", response)
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"raven/internal/db"
 	"raven/internal/models"
 	"raven/internal/server/auth"
+	"raven/internal/server/utils"
+	"raven/internal/socketmap/cache"
 )
 
 type IMAPServer struct {
@@ -23,6 +25,11 @@ type IMAPServer struct {
 	s3Storage *blobstorage.S3BlobStorage
 	cfg       *conf.Config
 	oauthVal  *oauthbearer.Validator
+	admins    []string
+
+	// Role memberships from the identity provider, used for the "Shared" namespace
+	roleResolver RoleResolver
+	roleCache    *cache.Cache
 }
 
 func NewIMAPServer(dbManager *db.DBManager) *IMAPServer {
@@ -33,11 +40,22 @@ func NewIMAPServer(dbManager *db.DBManager) *IMAPServer {
 		s3Storage: nil,
 	}
 
-	server.initOAuthValidation()
+	cfg := loadConfig()
+	server.initAccessControl(cfg)
+	server.initOAuthValidation(cfg)
+	server.initMailboxNames()
 
 	return server
 }
 
+// initMailboxNames lets the database manager convert mailbox names stored in
+// modified UTF-7 by older releases to UTF-8 as user databases are opened
+func (s *IMAPServer) initMailboxNames() {
+	if s.dbManager != nil {
+		s.dbManager.SetMailboxNameDecoder(utils.DecodeModifiedUTF7)
+	}
+}
+
 // NewIMAPServerWithS3 creates a new IMAP server with S3 blob storage support
 func NewIMAPServerWithS3(dbManager *db.DBManager, s3Storage *blobstorage.S3BlobStorage) *IMAPServer {
 	server := &IMAPServer{
@@ -47,15 +65,37 @@ func NewIMAPServerWithS3(dbManager *db.DBManager, s3Storage *blobstorage.S3BlobS
 		s3Storage: s3Storage,
 	}
 
-	server.initOAuthValidation()
+	cfg := loadConfig()
+	server.initAccessControl(cfg)
+	server.initOAuthValidation(cfg)
+	server.initMailboxNames()
 
 	return server
 }
 
-func (s *IMAPServer) initOAuthValidation() {
+// loadConfig reads the process configuration. Without it the server runs
+// without administrators, role mailboxes and OAUTHBEARER.
+func loadConfig() *conf.Config {
 	cfg, err := conf.LoadConfig()
 	if err != nil {
-		log.Printf("IMAP OAUTHBEARER: config load skipped at init: %v", err)
+		log.Printf("IMAP: config load skipped at init: %v", err)
+		return nil
+	}
+	return cfg
+}
+
+// initAccessControl sets who may run administrative commands and how role
+// memberships are looked up
+func (s *IMAPServer) initAccessControl(cfg *conf.Config) {
+	if cfg == nil {
+		return
+	}
+	s.admins = cfg.Admins
+	s.initRoleResolver(cfg)
+}
+
+func (s *IMAPServer) initOAuthValidation(cfg *conf.Config) {
+	if cfg == nil {
 		return
 	}
 
@@ -79,7 +119,7 @@ func (s *IMAPServer) oauthSASLReady() bool {
 }
 
 func (s *IMAPServer) greetingCapabilities(isTLS bool) string {
-	capabilities := []string{"IMAP4rev1"}
+	capabilities := []string{"IMAP4rev1", "IMAP4rev2"}
 
 	if isTLS {
 		capabilities = append(capabilities, "AUTH=PLAIN", "LOGIN")
@@ -91,7 +131,7 @@ func (s *IMAPServer) greetingCapabilities(isTLS bool) string {
 		capabilities = append(capabilities, "AUTH=OAUTHBEARER", "AUTH=XOAUTH2", "SASL-IR")
 	}
 
-	capabilities = append(capabilities, "UIDPLUS", "IDLE", "LITERAL+")
+	capabilities = append(capabilities, "UIDPLUS", "IDLE", "NAMESPACE", "UNSELECT", "LITERAL+", "MOVE", "CONDSTORE", "QRESYNC", "SPECIAL-USE", "CREATE-SPECIAL-USE", "LIST-EXTENDED", "LIST-STATUS", "ESEARCH", "SEARCHRES", "SORT", "SORT=DISPLAY", "THREAD=ORDEREDSUBJECT", "THREAD=REFERENCES", "QUOTA", "QUOTA=RES-STORAGE", "QUOTA=RES-MESSAGE", "QUOTA=RES-MAILBOX", "QUOTASET", "ACL", "RIGHTS=kxte", "METADATA", "METADATA-SERVER", "ENABLE", "UTF8=ACCEPT", "BINARY", "COMPRESS=DEFLATE", "NOTIFY", "OBJECTID", "PREVIEW", "STATUS=SIZE", "SAVEDATE", "MULTISEARCH")
 
 	return strings.Join(capabilities, " ")
 }
@@ -116,6 +156,21 @@ func (s *IMAPServer) GetS3Storage() *blobstorage.S3BlobStorage {
 	return s.s3Storage
 }
 
+// SetAdmins sets the addresses allowed to run administrative commands (useful for testing)
+func (s *IMAPServer) SetAdmins(admins []string) {
+	s.admins = admins
+}
+
+// IsAdmin reports whether an address may run administrative commands such as SETQUOTA
+func (s *IMAPServer) IsAdmin(email string) bool {
+	for _, admin := range s.admins {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
 // SetTLSCertificates sets custom TLS certificate paths (useful for testing)
 func (s *IMAPServer) SetTLSCertificates(certPath, keyPath string) {
 	s.certPath = certPath
@@ -155,6 +210,10 @@ func (s *IMAPServer) GetUserDB(email string) (*sql.DB, error) {
 
 // GetSelectedDB returns the selected user's database (exported for commands)
 func (s *IMAPServer) GetSelectedDB(state *models.ClientState) (*sql.DB, error) {
+	// A mailbox shared by another user lives in the owner's database
+	if state.SelectedOwner != "" {
+		return s.dbManager.GetUserDB(state.SelectedOwner)
+	}
 	email := resolveStateEmail(state)
 	userDB, err := s.dbManager.GetUserDB(email)
 	return userDB, err
@@ -64,11 +64,86 @@ func (t *TestInterface) HandleIdle(conn net.Conn, tag string, state *models.Clie
 	extension.HandleIdle(t.server, conn, tag, state)
 }
 
+// HandleEnable exposes the ENABLE handler for testing
+func (t *TestInterface) HandleEnable(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	extension.HandleEnable(t.server, conn, tag, parts, state)
+}
+
+// HandleCompress exposes the COMPRESS handler for testing
+func (t *TestInterface) HandleCompress(conn net.Conn, tag string, parts []string, state *models.ClientState) net.Conn {
+	return extension.HandleCompress(t.server, conn, tag, parts, state)
+}
+
+// HandleNotify exposes the NOTIFY handler for testing
+func (t *TestInterface) HandleNotify(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	extension.HandleNotify(t.server, conn, tag, parts, state)
+}
+
+// DeliverNotifications exposes NOTIFY delivery for testing
+func (t *TestInterface) DeliverNotifications(conn net.Conn, state *models.ClientState) {
+	extension.DeliverNotifications(t.server, conn, state)
+}
+
 // HandleNamespace exposes the namespace handler for testing
 func (t *TestInterface) HandleNamespace(conn net.Conn, tag string, state *models.ClientState) {
 	extension.HandleNamespace(t.server, conn, tag, state)
 }
 
+// HandleGetQuota exposes the GETQUOTA handler for testing
+func (t *TestInterface) HandleGetQuota(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	extension.HandleGetQuota(t.server, conn, tag, parts, state)
+}
+
+// HandleGetQuotaRoot exposes the GETQUOTAROOT handler for testing
+func (t *TestInterface) HandleGetQuotaRoot(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	extension.HandleGetQuotaRoot(t.server, conn, tag, parts, state)
+}
+
+// HandleSetQuota exposes the SETQUOTA handler for testing
+func (t *TestInterface) HandleSetQuota(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	extension.HandleSetQuota(t.server, conn, tag, parts, state)
+}
+
+// HandleReindex exposes the XREINDEX handler for testing
+func (t *TestInterface) HandleReindex(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	extension.HandleReindex(t.server, conn, tag, parts, state)
+}
+
+// HandleGetMetadata exposes the GETMETADATA handler for testing
+func (t *TestInterface) HandleGetMetadata(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	extension.HandleGetMetadata(t.server, conn, tag, parts, state)
+}
+
+// HandleSetMetadata exposes the SETMETADATA handler for testing
+func (t *TestInterface) HandleSetMetadata(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	extension.HandleSetMetadata(t.server, conn, tag, parts, state)
+}
+
+// HandleSetACL exposes the SETACL handler for testing
+func (t *TestInterface) HandleSetACL(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	mailbox.HandleSetACL(t.server, conn, tag, parts, state)
+}
+
+// HandleDeleteACL exposes the DELETEACL handler for testing
+func (t *TestInterface) HandleDeleteACL(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	mailbox.HandleDeleteACL(t.server, conn, tag, parts, state)
+}
+
+// HandleGetACL exposes the GETACL handler for testing
+func (t *TestInterface) HandleGetACL(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	mailbox.HandleGetACL(t.server, conn, tag, parts, state)
+}
+
+// HandleListRights exposes the LISTRIGHTS handler for testing
+func (t *TestInterface) HandleListRights(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	mailbox.HandleListRights(t.server, conn, tag, parts, state)
+}
+
+// HandleMyRights exposes the MYRIGHTS handler for testing
+func (t *TestInterface) HandleMyRights(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	mailbox.HandleMyRights(t.server, conn, tag, parts, state)
+}
+
 // HandleUnselect exposes the unselect handler for testing
 func (t *TestInterface) HandleUnselect(conn net.Conn, tag string, state *models.ClientState) {
 	selection.HandleUnselect(t.server, conn, tag, state)
@@ -147,6 +222,11 @@ func (t *TestInterface) HandleSearch(conn net.Conn, tag string, parts []string,
 	message.HandleSearch(t.server, conn, tag, parts, state)
 }
 
+// HandleEsearch exposes the multi-mailbox ESEARCH handler for testing
+func (t *TestInterface) HandleEsearch(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	message.HandleEsearch(t.server, conn, tag, parts, state)
+}
+
 // HandleFetch exposes the fetch handler for testing
 func (t *TestInterface) HandleFetch(conn net.Conn, tag string, parts []string, state *models.ClientState) {
 	message.HandleFetch(t.server, conn, tag, parts, state)
@@ -162,6 +242,21 @@ func (t *TestInterface) HandleCopy(conn net.Conn, tag string, parts []string, st
 	message.HandleCopy(t.server, conn, tag, parts, state)
 }
 
+// HandleMove exposes the move handler for testing
+func (t *TestInterface) HandleMove(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	message.HandleMove(t.server, conn, tag, parts, state)
+}
+
+// HandleSort exposes the sort handler for testing
+func (t *TestInterface) HandleSort(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	message.HandleSort(t.server, conn, tag, parts, state)
+}
+
+// HandleThread exposes the thread handler for testing
+func (t *TestInterface) HandleThread(conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	message.HandleThread(t.server, conn, tag, parts, state)
+}
+
 // HandleUID exposes the UID handler for testing
 func (t *TestInterface) HandleUID(conn net.Conn, tag string, parts []string, state *models.ClientState) {
 	uid.HandleUID(t.server, conn, tag, parts, state)
@@ -172,6 +267,16 @@ func (t *TestInterface) SetTLSCertificates(certPath, keyPath string) {
 	t.server.SetTLSCertificates(certPath, keyPath)
 }
 
+// SetAdmins sets the administrator addresses for testing
+func (t *TestInterface) SetAdmins(admins []string) {
+	t.server.SetAdmins(admins)
+}
+
+// SetRoleResolver sets the role membership lookup for testing
+func (t *TestInterface) SetRoleResolver(resolver RoleResolver, cacheTTLSeconds int) {
+	t.server.SetRoleResolver(resolver, cacheTTLSeconds)
+}
+
 // GetDBManager exposes the database manager for testing
 func (t *TestInterface) GetDBManager() interface{} {
 	return t.server.dbManager
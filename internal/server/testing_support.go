@@ -304,6 +304,15 @@ func CreateTestUserTable(t *testing.T, database interface{}, username string) {
 
 // InsertTestMail inserts a test mail into a user's mailbox using new schema
 func InsertTestMail(t *testing.T, database interface{}, username, subject, sender, recipient, folder string) int64 {
+	// Create raw message
+	rawMessage := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\nTest message body",
+		sender, recipient, subject, time.Now().Format(time.RFC1123Z))
+
+	return InsertTestRawMail(t, database, username, rawMessage, folder)
+}
+
+// InsertTestRawMail parses and stores a raw RFC 5322 message in the given folder
+func InsertTestRawMail(t *testing.T, database interface{}, username, rawMessage, folder string) int64 {
 	// Handle both *sql.DB (old tests with shared DB) and *db.DBManager (new per-user DB architecture)
 	var userDB *sql.DB
 	var dbManager *db.DBManager
@@ -351,10 +360,6 @@ func InsertTestMail(t *testing.T, database interface{}, username, subject, sende
 		}
 	}
 
-	// Create raw message
-	rawMessage := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\nTest message body",
-		sender, recipient, subject, time.Now().Format(time.RFC1123Z))
-
 	// Parse and store message
 	parsed, err := parser.ParseMIMEMessage(rawMessage)
 	if err != nil {
@@ -2,10 +2,11 @@ package uid
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net"
-	"strconv"
 	"strings"
 
 	"raven/internal/blobstorage"
@@ -33,6 +34,7 @@ type ServerDeps interface {
 	SendResponse(conn net.Conn, response string)
 	GetSelectedDB(state *models.ClientState) (*sql.DB, error)
 	GetUserDB(email string) (*sql.DB, error)
+	GetUserRoles(email string) []string
 	GetSharedDB() *sql.DB
 	GetDBManager() *db.DBManager
 	GetS3Storage() *blobstorage.S3BlobStorage
@@ -42,7 +44,7 @@ type ServerDeps interface {
 
 // HandleUID implements the UID command (RFC 3501 Section 6.4.8)
 // Syntax: UID <command> <arguments>
-// Supports: UID FETCH, UID SEARCH, UID STORE, UID COPY
+// Supports: UID FETCH, UID SEARCH, UID STORE, UID COPY, UID MOVE, UID EXPUNGE, UID SORT, UID THREAD
 func HandleUID(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
 	if !state.Authenticated {
 		deps.SendResponse(conn, fmt.Sprintf("%s NO Please authenticate first", tag))
@@ -69,6 +71,12 @@ func HandleUID(deps ServerDeps, conn net.Conn, tag string, parts []string, state
 		handleUIDStore(deps, conn, tag, parts, state)
 	case "COPY":
 		handleUIDCopy(deps, conn, tag, parts, state)
+	case "MOVE":
+		handleUIDMove(deps, conn, tag, parts, state)
+	case "SORT":
+		message.ExecuteSort(deps, conn, tag, "UID SORT", parts[3:], true, state)
+	case "THREAD":
+		message.ExecuteThread(deps, conn, tag, "UID THREAD", parts[3:], true, state)
 	case "EXPUNGE":
 		handleUIDExpunge(deps, conn, tag, parts, state)
 	default:
@@ -89,6 +97,23 @@ func handleUIDFetch(deps ServerDeps, conn net.Conn, tag string, parts []string,
 	uidSequence := parts[3]
 	items := strings.Join(parts[4:], " ")
 
+	// RFC 7162: optional (CHANGEDSINCE n [VANISHED]) modifier
+	items, mods, err := message.ParseFetchModifiers(items)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+		return
+	}
+	if mods.Vanished && !state.QResyncEnabled {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD VANISHED requires QRESYNC", tag))
+		return
+	}
+	if mods.ChangedSince > 0 {
+		state.CondStoreEnabled = true
+		if !strings.Contains(strings.ToUpper(items), "MODSEQ") {
+			items = strings.TrimSuffix(items, ")") + " MODSEQ"
+		}
+	}
+
 	// Ensure UID is always in the items list
 	itemsUpper := strings.ToUpper(items)
 	if !strings.Contains(itemsUpper, "UID") {
@@ -102,7 +127,25 @@ func handleUIDFetch(deps ServerDeps, conn net.Conn, tag string, parts []string,
 		return
 	}
 
+	// VANISHED (EARLIER) lists UIDs in the requested set expunged since CHANGEDSINCE
+	if mods.Vanished {
+		expunged, err := db.GetExpungedUIDsSincePerUser(targetDB, state.SelectedMailboxID, mods.ChangedSince)
+		if err == nil {
+			var vanished []int64
+			for _, uid := range expunged {
+				// Expunged UIDs are below every live UID, so * is treated as unbounded
+				if utils.SequenceSetContains(uidSequence, uid, math.MaxInt64) {
+					vanished = append(vanished, uid)
+				}
+			}
+			if len(vanished) > 0 {
+				deps.SendResponse(conn, fmt.Sprintf("* VANISHED (EARLIER) %s", utils.FormatSequenceSet(vanished)))
+			}
+		}
+	}
+
 	// Parse UID sequence set using the correct database
+	uidSequence = utils.ExpandSearchResult(uidSequence, state.SearchResult, nil, true)
 	uids := utils.ParseUIDSequenceSetWithDB(uidSequence, state.SelectedMailboxID, targetDB)
 	if len(uids) == 0 {
 		// Non-existent UIDs are ignored without error - just return OK
@@ -112,7 +155,10 @@ func handleUIDFetch(deps ServerDeps, conn net.Conn, tag string, parts []string,
 
 	// Convert UIDs to a sequence set format that HandleFetchForUIDs can use
 	// For each UID, we need to fetch using the same logic as handleFetch
-	message.HandleFetchForUIDs(deps, conn, tag, uids, items, state)
+	if err := message.HandleFetchForUIDsWithModifiers(deps, conn, tag, uids, items, mods, state); errors.Is(err, message.ErrUnknownCTE) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [UNKNOWN-CTE] Cannot decode message part", tag))
+		return
+	}
 
 	deps.SendResponse(conn, fmt.Sprintf("%s OK UID FETCH completed", tag))
 }
@@ -134,11 +180,18 @@ func handleUIDSearch(deps ServerDeps, conn net.Conn, tag string, parts []string,
 		return
 	}
 
-	searchStart := 3
+	// RFC 4731: optional RETURN (...) options come before CHARSET
+	returnOpts, rest, err := message.ParseSearchReturnOptions(parts[3:])
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+		return
+	}
+
+	searchStart := len(parts) - len(rest)
 	charset := "US-ASCII"
-	if len(parts) > 5 && strings.ToUpper(parts[3]) == "CHARSET" {
-		charset = strings.ToUpper(parts[4])
-		searchStart = 5
+	if len(parts) > searchStart+2 && strings.ToUpper(parts[searchStart]) == "CHARSET" {
+		charset = strings.ToUpper(parts[searchStart+1])
+		searchStart += 2
 
 		if charset != "US-ASCII" && charset != "UTF-8" {
 			deps.SendResponse(conn, fmt.Sprintf("%s NO [BADCHARSET (US-ASCII UTF-8)] Charset not supported", tag))
@@ -151,29 +204,26 @@ func handleUIDSearch(deps ServerDeps, conn net.Conn, tag string, parts []string,
 		return
 	}
 
+	tokens := message.ExpandSearchResultTokens(parts[searchStart:], state.SearchResult)
 	matches, err := message.SearchMailboxMatchesTokens(
 		targetDB,
 		state.SelectedMailboxID,
-		parts[searchStart:],
+		utils.SelectedMessageMap(state, targetDB),
+		tokens,
 		charset,
-		resolveStateEmail(state),
+		message.SelectedAccountEmail(state),
 		deps,
 	)
 	if err != nil {
+		// RFC 5182: a failed SEARCH with SAVE empties the saved result
+		if returnOpts.Save {
+			state.SearchResult = nil
+		}
 		deps.SendResponse(conn, fmt.Sprintf("%s NO UID SEARCH failed: %v", tag, err))
 		return
 	}
 
-	var matchingUIDs []string
-	for _, match := range matches {
-		matchingUIDs = append(matchingUIDs, strconv.FormatInt(match.UID, 10))
-	}
-
-	if len(matchingUIDs) > 0 {
-		deps.SendResponse(conn, fmt.Sprintf("* SEARCH %s", strings.Join(matchingUIDs, " ")))
-	} else {
-		deps.SendResponse(conn, "* SEARCH")
-	}
+	message.SendSearchResults(deps, conn, tag, true, returnOpts, tokens, matches, state)
 
 	deps.SendResponse(conn, fmt.Sprintf("%s OK UID SEARCH completed", tag))
 }
@@ -196,8 +246,23 @@ func handleUIDStore(deps ServerDeps, conn net.Conn, tag string, parts []string,
 	}
 
 	uidSequence := parts[3]
-	dataItem := strings.ToUpper(parts[4])
-	flagsParts := parts[5:]
+
+	// RFC 7162: optional (UNCHANGEDSINCE n) modifier before the data item
+	storeArgs, unchangedSince, conditional, err := message.ParseStoreModifier(parts[4:])
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD %v", tag, err))
+		return
+	}
+	if len(storeArgs) < 2 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD UID STORE requires UID sequence, operation, and flags", tag))
+		return
+	}
+	if conditional {
+		state.CondStoreEnabled = true
+	}
+
+	dataItem := strings.ToUpper(storeArgs[0])
+	flagsParts := storeArgs[1:]
 
 	// Check for .SILENT suffix
 	silent := strings.HasSuffix(dataItem, ".SILENT")
@@ -216,7 +281,20 @@ func handleUIDStore(deps ServerDeps, conn net.Conn, tag string, parts []string,
 		return
 	}
 
+	// RFC 4314: each kind of flag needs its own right on a shared mailbox
+	if !utils.HasRights(utils.SelectedRights(state), message.StoreRequiredRights(dataItem, newFlags)) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+
+	// A read-only mailbox (EXAMINE) must not change (RFC 9051 Section 6.3.3)
+	if state.ReadOnly {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Mailbox is read-only", tag))
+		return
+	}
+
 	// Parse UID sequence set using the correct database
+	uidSequence = utils.ExpandSearchResult(uidSequence, state.SearchResult, nil, true)
 	uids := utils.ParseUIDSequenceSetWithDB(uidSequence, state.SelectedMailboxID, targetDB)
 	if len(uids) == 0 {
 		// Non-existent UIDs are ignored without error
@@ -224,27 +302,45 @@ func handleUIDStore(deps ServerDeps, conn net.Conn, tag string, parts []string,
 		return
 	}
 
+	// UIDs that failed the UNCHANGEDSINCE test
+	var modifiedUIDs []int64
+
+	// Auto-moved messages also change the Spam or original folder
+	changedMailboxID := state.SelectedMailboxID
+
+	// Sequence numbers come from the session's view of the mailbox
+	messages := utils.SelectedMessageMap(state, targetDB)
+
 	// Process each UID
 	for _, uid := range uids {
-		// Get current flags, sequence number, message ID, and internal date
+		// Messages the client has not been told about have no sequence number yet
+		seqNum, ok := messages.SeqNum(int64(uid))
+		if !ok {
+			continue
+		}
+
+		// Get current flags, message ID, and internal date
 		var currentFlags string
-		var seqNum int
-		var messageID int64
+		var messageID, modseq int64
 		var internalDate string
 
 		err := targetDB.QueryRow(`
-			SELECT mm.message_id, mm.flags, mm.internal_date,
-				(SELECT COUNT(*) FROM message_mailbox mm2
-				 WHERE mm2.mailbox_id = mm.mailbox_id AND mm2.uid <= mm.uid) as seq_num
+			SELECT mm.message_id, mm.flags, mm.internal_date, mm.modseq
 			FROM message_mailbox mm
 			WHERE mm.mailbox_id = ? AND mm.uid = ?
-		`, state.SelectedMailboxID, uid).Scan(&messageID, &currentFlags, &internalDate, &seqNum)
+		`, state.SelectedMailboxID, uid).Scan(&messageID, &currentFlags, &internalDate, &modseq)
 
 		if err != nil {
 			// Non-existent UID is silently ignored
 			continue
 		}
 
+		// Conditional STORE: leave messages modified after UNCHANGEDSINCE untouched
+		if conditional && modseq > unchangedSince {
+			modifiedUIDs = append(modifiedUIDs, int64(uid))
+			continue
+		}
+
 		// Calculate new flags based on operation
 		updatedFlags := message.CalculateNewFlags(currentFlags, newFlags, dataItem)
 
@@ -268,9 +364,11 @@ func handleUIDStore(deps ServerDeps, conn net.Conn, tag string, parts []string,
 				log.Printf("Failed to move message %d to Spam: %v", messageID, err)
 			} else {
 				log.Printf("Auto-moved message %d to Spam folder (Junk flag added)", messageID)
+				changedMailboxID = db.AllMailboxes
 				// Send EXPUNGE notification to tell client the message is gone from this mailbox
 				if !silent {
-					deps.SendResponse(conn, fmt.Sprintf("* %d EXPUNGE", seqNum))
+					messages.Expunge(int64(uid))
+					message.SendExpungeNotifications(deps, conn, state, []int{seqNum}, []int64{int64(uid)})
 				}
 				// Message was moved - don't send FETCH response since it's no longer in this mailbox
 				continue
@@ -305,9 +403,11 @@ func handleUIDStore(deps ServerDeps, conn net.Conn, tag string, parts []string,
 				log.Printf("Failed to move message %d to %s: %v", messageID, targetFolder, err)
 			} else {
 				log.Printf("Auto-moved message %d to %s (NonJunk flag added)", messageID, targetFolder)
+				changedMailboxID = db.AllMailboxes
 				// Send EXPUNGE notification to tell client the message is gone from this mailbox
 				if !silent {
-					deps.SendResponse(conn, fmt.Sprintf("* %d EXPUNGE", seqNum))
+					messages.Expunge(int64(uid))
+					message.SendExpungeNotifications(deps, conn, state, []int{seqNum}, []int64{int64(uid)})
 				}
 				// Message was moved - don't send FETCH response since it's no longer in this mailbox
 				continue
@@ -325,17 +425,28 @@ func handleUIDStore(deps ServerDeps, conn net.Conn, tag string, parts []string,
 			deps.SendResponse(conn, fmt.Sprintf("%s NO UID STORE failed: %v", tag, err))
 			return
 		}
+		messages.SetFlags(int64(uid), updatedFlags)
 
 		// Send untagged FETCH response unless .SILENT
-		if !silent {
-			flagsResponse := "()"
-			if updatedFlags != "" {
-				flagsResponse = fmt.Sprintf("(%s)", updatedFlags)
+		// A conditional STORE always reports the new MODSEQ (RFC 7162 Section 3.1.3)
+		if !silent || conditional {
+			flagsResponse := fmt.Sprintf("(%s)", utils.ClientFlags(updatedFlags, state))
+			if state.CondStoreEnabled {
+				newModSeq, _ := db.GetMessageModSeqPerUser(targetDB, state.SelectedMailboxID, int64(uid))
+				deps.SendResponse(conn, fmt.Sprintf("* %d FETCH (FLAGS %s UID %d MODSEQ (%d))", seqNum, flagsResponse, uid, newModSeq))
+			} else {
+				deps.SendResponse(conn, fmt.Sprintf("* %d FETCH (FLAGS %s UID %d)", seqNum, flagsResponse, uid))
 			}
-			deps.SendResponse(conn, fmt.Sprintf("* %d FETCH (FLAGS %s UID %d)", seqNum, flagsResponse, uid))
 		}
 	}
 
+	deps.GetDBManager().MailboxChanges().Publish(targetDB, changedMailboxID)
+
+	if len(modifiedUIDs) > 0 {
+		deps.SendResponse(conn, fmt.Sprintf("%s OK [MODIFIED %s] Conditional STORE failed", tag, utils.FormatSequenceSet(modifiedUIDs)))
+		return
+	}
+
 	deps.SendResponse(conn, fmt.Sprintf("%s OK UID STORE completed", tag))
 }
 
@@ -357,9 +468,14 @@ func handleUIDCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, s
 	}
 
 	uidSequence := parts[3]
-	destMailbox := strings.Trim(strings.Join(parts[4:], " "), "\"")
+	destMailbox, err := utils.ParseMailboxArgument(strings.Join(parts[4:], " "), state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
 
 	// Parse UID sequence set using the correct database
+	uidSequence = utils.ExpandSearchResult(uidSequence, state.SearchResult, nil, true)
 	uids := utils.ParseUIDSequenceSetWithDB(uidSequence, state.SelectedMailboxID, targetDB)
 	if len(uids) == 0 {
 		// Non-existent UIDs are ignored without error
@@ -367,15 +483,15 @@ func handleUIDCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, s
 		return
 	}
 
-	// Check if destination mailbox exists
-	var destMailboxID int64
-	err = targetDB.QueryRow(`
-		SELECT id FROM mailboxes
-		WHERE name = ?
-	`, destMailbox).Scan(&destMailboxID)
+	// Check that the destination mailbox exists and accepts messages
+	destMailboxID, failure := message.ResolveCopyTarget(targetDB, state, destMailbox)
+	if failure != "" {
+		deps.SendResponse(conn, fmt.Sprintf("%s %s", tag, failure))
+		return
+	}
 
-	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO [TRYCREATE] Destination mailbox does not exist", tag))
+	if message.CopyExceedsQuota(targetDB, state.SelectedMailboxID, uids, true) {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [OVERQUOTA] Quota exceeded", tag))
 		return
 	}
 
@@ -387,19 +503,6 @@ func handleUIDCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, s
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	// Get next UID for destination mailbox
-	var nextUID int64
-	err = tx.QueryRow(`
-		SELECT COALESCE(MAX(uid), 0) + 1
-		FROM message_mailbox
-		WHERE mailbox_id = ?
-	`, destMailboxID).Scan(&nextUID)
-
-	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO UID COPY failed: %v", tag, err))
-		return
-	}
-
 	// Copy each message by UID
 	for _, uid := range uids {
 		var messageID int64
@@ -426,6 +529,12 @@ func handleUIDCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, s
 			}
 		}
 
+		nextUID, err := message.AllocateUID(tx, destMailboxID)
+		if err != nil {
+			deps.SendResponse(conn, fmt.Sprintf("%s NO UID COPY failed: %v", tag, err))
+			return
+		}
+
 		// Insert message into destination mailbox
 		_, err = tx.Exec(`
 			INSERT INTO message_mailbox (message_id, mailbox_id, uid, flags, internal_date)
@@ -436,8 +545,6 @@ func handleUIDCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, s
 			deps.SendResponse(conn, fmt.Sprintf("%s NO UID COPY failed: %v", tag, err))
 			return
 		}
-
-		nextUID++
 	}
 
 	// Commit transaction
@@ -446,10 +553,42 @@ func handleUIDCopy(deps ServerDeps, conn net.Conn, tag string, parts []string, s
 		deps.SendResponse(conn, fmt.Sprintf("%s NO UID COPY failed: %v", tag, err))
 		return
 	}
+	deps.GetDBManager().MailboxChanges().Publish(targetDB, destMailboxID)
 
 	deps.SendResponse(conn, fmt.Sprintf("%s OK UID COPY completed", tag))
 }
 
+// ===== UID MOVE =====
+
+// handleUIDMove implements UID MOVE command (RFC 6851)
+// Syntax: UID MOVE <uid-set> <mailbox>
+func handleUIDMove(deps ServerDeps, conn net.Conn, tag string, parts []string, state *models.ClientState) {
+	if len(parts) < 5 {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD UID MOVE requires UID sequence and destination mailbox", tag))
+		return
+	}
+
+	// Get appropriate database (user or role mailbox)
+	targetDB, err := deps.GetSelectedDB(state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Database error", tag))
+		return
+	}
+
+	uidSequence := parts[3]
+	destMailbox, err := utils.ParseMailboxArgument(strings.Join(parts[4:], " "), state)
+	if err != nil {
+		deps.SendResponse(conn, fmt.Sprintf("%s BAD Invalid mailbox name", tag))
+		return
+	}
+
+	// Non-existent UIDs are ignored; an empty set still completes successfully
+	uidSequence = utils.ExpandSearchResult(uidSequence, state.SearchResult, nil, true)
+	uids := utils.ParseUIDSequenceSetWithDB(uidSequence, state.SelectedMailboxID, targetDB)
+
+	message.HandleMoveForUIDs(deps, conn, tag, "UID MOVE", uids, destMailbox, state)
+}
+
 // parseFlagsToSet converts a space-separated flags string into a set (map)
 func parseFlagsToSet(flags string) map[string]bool {
 	flagSet := make(map[string]bool)
@@ -492,6 +631,18 @@ func handleUIDExpunge(deps ServerDeps, conn net.Conn, tag string, parts []string
 		return
 	}
 
+	// RFC 4314: expunging a shared mailbox needs the "e" right
+	if !utils.HasRights(utils.SelectedRights(state), "e") {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO [NOPERM] Permission denied", tag))
+		return
+	}
+
+	// A read-only mailbox (EXAMINE) must not change (RFC 9051 Section 6.3.3)
+	if state.ReadOnly {
+		deps.SendResponse(conn, fmt.Sprintf("%s NO Mailbox is read-only", tag))
+		return
+	}
+
 	// Get appropriate database (user or role mailbox)
 	targetDB, err := deps.GetSelectedDB(state)
 	if err != nil {
@@ -501,6 +652,7 @@ func handleUIDExpunge(deps ServerDeps, conn net.Conn, tag string, parts []string
 
 	// Parse UID sequence set
 	uidSequence := parts[3]
+	uidSequence = utils.ExpandSearchResult(uidSequence, state.SearchResult, nil, true)
 	uids := utils.ParseUIDSequenceSetWithDB(uidSequence, state.SelectedMailboxID, targetDB)
 	if len(uids) == 0 {
 		// Non-existent UIDs are ignored without error - just return OK
@@ -555,57 +707,38 @@ func handleUIDExpunge(deps ServerDeps, conn net.Conn, tag string, parts []string
 		return
 	}
 
-	// Get all messages in the mailbox to calculate sequence numbers
-	allRows, err := targetDB.Query(`
-		SELECT id, uid FROM message_mailbox
-		WHERE mailbox_id = ?
-		ORDER BY uid ASC
-	`, state.SelectedMailboxID)
+	// Sequence numbers come from the session's view of the mailbox
+	messages := utils.SelectedMessageMap(state, targetDB)
 
-	if err != nil {
-		deps.SendResponse(conn, fmt.Sprintf("%s NO UID EXPUNGE failed: %v", tag, err))
-		return
-	}
-	defer func() { _ = allRows.Close() }()
-
-	// Build a map of message IDs to sequence numbers
-	sequenceMap := make(map[int64]int)
-	seqNum := 1
-	for allRows.Next() {
-		var id, uid int64
-		if err := allRows.Scan(&id, &uid); err == nil {
-			sequenceMap[id] = seqNum
-			seqNum++
-		}
-	}
-	_ = allRows.Close()
-
-	// Delete messages and send EXPUNGE responses
-	// Important: As we delete messages, sequence numbers change for subsequent messages
-	// We need to account for this by tracking how many messages we've deleted
+	// Delete messages and collect their EXPUNGE responses. Removing a message
+	// from the view shifts later sequence numbers down, as the client expects.
 	deletedCount := 0
+	var expungedSeqNums []int
+	var expungedUIDs []int64
 	for _, msg := range messagesToDelete {
-		// Get the original sequence number for this message
-		originalSeqNum := sequenceMap[msg.id]
-
-		// Adjust for previously deleted messages in this EXPUNGE operation
-		// When we delete message N, all messages after it shift down by 1
-		adjustedSeqNum := originalSeqNum - deletedCount
-
-		// Send untagged EXPUNGE response with the adjusted sequence number
-		deps.SendResponse(conn, fmt.Sprintf("* %d EXPUNGE", adjustedSeqNum))
-
 		// Delete the message from the mailbox
-		_, err = targetDB.Exec(`DELETE FROM message_mailbox WHERE id = ?`, msg.id)
+		err = db.ExpungeMessagePerUser(targetDB, msg.id)
 		if err != nil {
 			log.Printf("Failed to delete message %d (UID %d): %v", msg.id, msg.uid, err)
+			continue
 		}
-
 		deletedCount++
+
+		// Messages the client was never told about need no EXPUNGE
+		if seqNum, ok := messages.Expunge(msg.uid); ok {
+			expungedSeqNums = append(expungedSeqNums, seqNum)
+			expungedUIDs = append(expungedUIDs, msg.uid)
+		}
+	}
+	if deletedCount > 0 {
+		deps.GetDBManager().MailboxChanges().Publish(targetDB, state.SelectedMailboxID)
 	}
 
+	// Send untagged EXPUNGE (or VANISHED with QRESYNC) responses
+	message.SendExpungeNotifications(deps, conn, state, expungedSeqNums, expungedUIDs)
+
 	// Update state tracking
-	state.LastMessageCount -= len(messagesToDelete)
+	state.LastMessageCount -= len(expungedUIDs)
 	if state.LastMessageCount < 0 {
 		state.LastMessageCount = 0
 	}
@@ -987,3 +987,247 @@ func TestUIDSearch_DefaultBehavior(t *testing.T) {
 		t.Errorf("Expected OK response, got: %s", response)
 	}
 }
+
+// TestUIDMove_UIDRange tests UID MOVE with a UID range
+func TestUIDMove_UIDRange(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "uiduser")
+	server.InsertTestMail(t, database, "uiduser", "Message 1", "sender@test.com", "uiduser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "uiduser", "Message 2", "sender@test.com", "uiduser@localhost", "INBOX")
+	server.InsertTestMail(t, database, "uiduser", "Message 3", "sender@test.com", "uiduser@localhost", "INBOX")
+	server.CreateMailbox(t, database, "uiduser", "Archive")
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+	archiveID, _ := server.GetMailboxID(t, database, userID, "Archive")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+	}
+	userDB := server.GetUserDBByID(t, database, state.UserID)
+
+	// UID MOVE 1:2 Archive
+	srv.HandleUID(conn, "U028", []string{"UID", "UID", "MOVE", "1:2", "Archive"}, state)
+
+	response := conn.GetWrittenData()
+
+	if !strings.Contains(response, "U028 OK UID MOVE completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+	if !strings.Contains(response, "* OK [COPYUID ") || !strings.Contains(response, " 1:2 1:2]") {
+		t.Errorf("Expected COPYUID 1:2 1:2, got: %s", response)
+	}
+	if strings.Count(response, "* 1 EXPUNGE") != 2 {
+		t.Errorf("Expected two '* 1 EXPUNGE' responses, got: %s", response)
+	}
+
+	var count int
+	if err := userDB.QueryRow("SELECT COUNT(*) FROM message_mailbox WHERE mailbox_id = ?", archiveID).Scan(&count); err != nil {
+		t.Fatalf("Failed to query archive mailbox count: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 messages in Archive folder, got %d", count)
+	}
+	if err := userDB.QueryRow("SELECT COUNT(*) FROM message_mailbox WHERE mailbox_id = ?", inboxID).Scan(&count); err != nil {
+		t.Fatalf("Failed to query inbox mailbox count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 message left in INBOX, got %d", count)
+	}
+}
+
+// TestUIDMove_NonExistentDestination tests UID MOVE to non-existent mailbox
+func TestUIDMove_NonExistentDestination(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "uiduser")
+	server.InsertTestMail(t, database, "uiduser", "Message 1", "sender@test.com", "uiduser@localhost", "INBOX")
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+	}
+
+	srv.HandleUID(conn, "U029", []string{"UID", "UID", "MOVE", "1", "NonExistent"}, state)
+
+	response := conn.GetWrittenData()
+
+	if !strings.Contains(response, "U029 NO [TRYCREATE]") {
+		t.Errorf("Expected TRYCREATE response, got: %s", response)
+	}
+}
+
+// TestUIDMove_NonExistentUID tests UID MOVE with non-existent UID
+func TestUIDMove_NonExistentUID(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "uiduser")
+	server.InsertTestMail(t, database, "uiduser", "Message 1", "sender@test.com", "uiduser@localhost", "INBOX")
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+	}
+
+	srv.HandleUID(conn, "U030", []string{"UID", "UID", "MOVE", "999", "Trash"}, state)
+
+	response := conn.GetWrittenData()
+
+	if !strings.Contains(response, "U030 OK UID MOVE completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+	if strings.Contains(response, "EXPUNGE") {
+		t.Errorf("Expected no EXPUNGE responses, got: %s", response)
+	}
+}
+
+// TestUIDFetch_ChangedSinceVanished tests UID FETCH with the QRESYNC VANISHED modifier
+func TestUIDFetch_ChangedSinceVanished(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "uiduser")
+	for i := 1; i <= 3; i++ {
+		server.InsertTestMail(t, database, "uiduser", fmt.Sprintf("Message %d", i), "sender@test.com", "uiduser@localhost", "INBOX")
+	}
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+	userDB := server.GetUserDBByID(t, database, userID)
+
+	var baseline int64
+	if err := userDB.QueryRow("SELECT highest_modseq FROM mailboxes WHERE id = ?", inboxID).Scan(&baseline); err != nil {
+		t.Fatalf("Failed to query HIGHESTMODSEQ: %v", err)
+	}
+	if _, err := userDB.Exec("DELETE FROM message_mailbox WHERE mailbox_id = ? AND uid = 2", inboxID); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+		LastMessageCount:  2,
+		CondStoreEnabled:  true,
+		QResyncEnabled:    true,
+	}
+
+	srv.HandleUID(conn, "U031", []string{"UID", "UID", "FETCH", "1:*", "(FLAGS)", fmt.Sprintf("(CHANGEDSINCE %d VANISHED)", baseline)}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* VANISHED (EARLIER) 2") {
+		t.Errorf("Expected VANISHED (EARLIER) 2, got: %s", response)
+	}
+	if strings.Contains(response, "UID 1 ") || strings.Contains(response, "UID 3 ") {
+		t.Errorf("Unchanged messages must not be returned, got: %s", response)
+	}
+	if !strings.Contains(response, "U031 OK UID FETCH completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+
+	// VANISHED is only valid once QRESYNC has been enabled
+	conn.ClearWriteBuffer()
+	state.QResyncEnabled = false
+	srv.HandleUID(conn, "U032", []string{"UID", "UID", "FETCH", "1:*", "(FLAGS)", fmt.Sprintf("(CHANGEDSINCE %d VANISHED)", baseline)}, state)
+
+	if response := conn.GetWrittenData(); !strings.Contains(response, "U032 BAD") {
+		t.Errorf("Expected BAD without QRESYNC, got: %s", response)
+	}
+}
+
+// TestUIDSearch_ESearchAndSave tests UID SEARCH RETURN with SAVE and UID FETCH $
+func TestUIDSearch_ESearchAndSave(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "uiduser")
+	for i := 1; i <= 3; i++ {
+		server.InsertTestMail(t, database, "uiduser", fmt.Sprintf("Message %d", i), "sender@test.com", "uiduser@localhost", "INBOX")
+	}
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		SelectedMailboxID: inboxID,
+	}
+
+	srv.HandleUID(conn, "U033", []string{"UID", "UID", "SEARCH", "RETURN", "(COUNT", "SAVE)", "UID", "2:3"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, `* ESEARCH (TAG "U033") UID COUNT 2`) {
+		t.Errorf("Expected UID ESEARCH response, got: %s", response)
+	}
+	if !strings.Contains(response, "U033 OK UID SEARCH completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleUID(conn, "U034", []string{"UID", "UID", "FETCH", "$", "(FLAGS)"}, state)
+
+	response = conn.GetWrittenData()
+	if !strings.Contains(response, "UID 2") || !strings.Contains(response, "UID 3") || strings.Contains(response, "UID 1 ") {
+		t.Errorf("Expected UID FETCH $ to return UIDs 2 and 3, got: %s", response)
+	}
+}
+
+// TestUIDSortAndThread tests that UID SORT and UID THREAD report UIDs
+func TestUIDSortAndThread(t *testing.T) {
+	srv := server.SetupTestServerSimple(t)
+	conn := server.NewMockConn()
+	database := server.GetDatabaseFromServer(srv)
+
+	userID := server.CreateTestUser(t, database, "uiduser")
+	for i := 1; i <= 3; i++ {
+		server.InsertTestMail(t, database, "uiduser", fmt.Sprintf("Message %d", i), "sender@test.com", "uiduser@localhost", "INBOX")
+	}
+
+	inboxID, _ := server.GetMailboxID(t, database, userID, "INBOX")
+
+	state := &models.ClientState{
+		Authenticated:     true,
+		UserID:            userID,
+		Username:          "uiduser",
+		SelectedMailboxID: inboxID,
+		LastMessageCount:  3,
+	}
+
+	// Remove UID 1 so sequence numbers and UIDs differ
+	srv.HandleStore(conn, "U035", []string{"U035", "STORE", "1", "+FLAGS.SILENT", "(\\Deleted)"}, state)
+	srv.HandleExpunge(conn, "U036", state)
+	conn.ClearWriteBuffer()
+
+	srv.HandleUID(conn, "U037", []string{"U037", "UID", "SORT", "(REVERSE", "ARRIVAL)", "UTF-8", "ALL"}, state)
+
+	response := conn.GetWrittenData()
+	if !strings.Contains(response, "* SORT 3 2\r\n") {
+		t.Errorf("Expected '* SORT 3 2', got: %s", response)
+	}
+	if !strings.Contains(response, "U037 OK UID SORT completed") {
+		t.Errorf("Expected OK response, got: %s", response)
+	}
+
+	conn.ClearWriteBuffer()
+	srv.HandleUID(conn, "U038", []string{"U038", "UID", "THREAD", "ORDEREDSUBJECT", "UTF-8", "ALL"}, state)
+
+	response = conn.GetWrittenData()
+	if !strings.Contains(response, "* THREAD (2)(3)\r\n") {
+		t.Errorf("Expected '* THREAD (2)(3)', got: %s", response)
+	}
+}
@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"raven/internal/db"
+	"raven/internal/models"
+)
+
+// OtherUsersNamespace is the prefix under which mailboxes shared by other users
+// appear (RFC 2342), e.g. "Other Users/boss@example.com/INBOX"
+const OtherUsersNamespace = "Other Users/"
+
+// ErrNoSuchMailbox is returned when a mailbox does not exist or is not visible to the user
+var ErrNoSuchMailbox = errors.New("mailbox does not exist")
+
+// MailboxAccess describes the mailbox a client-visible name refers to
+type MailboxAccess struct {
+	DB        *sql.DB
+	Owner     string // Owner's address; empty for the user's own mailboxes
+	Name      string // Mailbox name within the owner's account
+	MailboxID int64
+	Rights    string // Rights the user holds on the mailbox
+}
+
+// SplitOtherUsersMailbox splits "Other Users/<owner>/<mailbox>" into the owner's
+// address and the mailbox name within the owner's account
+func SplitOtherUsersMailbox(name string) (owner, mailbox string, ok bool) {
+	if !strings.HasPrefix(name, OtherUsersNamespace) {
+		return "", "", false
+	}
+
+	rest := strings.TrimPrefix(name, OtherUsersNamespace)
+	owner, mailbox, _ = strings.Cut(rest, "/")
+	if owner == "" {
+		return "", "", false
+	}
+
+	return strings.ToLower(owner), mailbox, true
+}
+
+// OtherUsersMailboxName returns the name under which another user's mailbox is shown
+func OtherUsersMailboxName(owner, mailbox string) string {
+	return OtherUsersNamespace + owner + "/" + mailbox
+}
+
+// AccountResolver locates the database of a user or role mailbox account and
+// the roles a user holds
+type AccountResolver interface {
+	GetUserDB(email string) (*sql.DB, error)
+	GetUserRoles(email string) []string
+	GetSharedDB() *sql.DB
+}
+
+// IsUserAccount reports whether account is a plain address that names a
+// user's own database, rather than a role account or a database file
+func IsUserAccount(account string) bool {
+	return strings.Contains(account, "@") && !strings.HasSuffix(account, ".db") &&
+		!strings.ContainsAny(account, `/\`) && !strings.Contains(account, "..")
+}
+
+// SharesWith reports whether the user account owner granted rights on any of
+// its mailboxes to email or to anyone. Other users' accounts are only opened
+// when it does, so that names sent by the client never create or open an
+// arbitrary database.
+func SharesWith(resolver AccountResolver, owner, email string) bool {
+	if !IsUserAccount(owner) {
+		return false
+	}
+	sharedDB := resolver.GetSharedDB()
+	if sharedDB == nil {
+		return false
+	}
+	shared, err := db.HasMailboxShare(sharedDB, owner, email)
+	return err == nil && shared
+}
+
+// MailboxAccount returns the account that holds a mailbox given by the name the
+// client used, and the mailbox name within that account. account is empty for
+// the user's own mailboxes, the owner's address for the "Other Users"
+// namespace and the role mailbox identity for the "Shared" namespace.
+func MailboxAccount(email, name string) (account, mailbox string) {
+	if owner, mailbox, ok := SplitOtherUsersMailbox(name); ok {
+		if strings.EqualFold(owner, email) {
+			return "", mailbox
+		}
+		return owner, mailbox
+	}
+
+	if role, mailbox, ok := SplitSharedMailbox(name); ok {
+		if account := RoleMailboxIdentity(role, email); account != "" {
+			return account, mailbox
+		}
+	}
+
+	return "", name
+}
+
+// ResolveMailboxAccess looks up a mailbox by the name the client used. Names in
+// the "Other Users" and "Shared" namespaces resolve to the owning account's
+// database; a mailbox on which the user holds no rights is reported as
+// non-existent.
+func ResolveMailboxAccess(resolver AccountResolver, email, name string) (*MailboxAccess, error) {
+	account, mailbox := MailboxAccount(email, name)
+	if account == "" {
+		userDB, err := resolver.GetUserDB(email)
+		if err != nil {
+			return nil, err
+		}
+		mailboxID, err := db.GetMailboxByNamePerUser(userDB, mailbox)
+		if err != nil {
+			return nil, ErrNoSuchMailbox
+		}
+		return &MailboxAccess{DB: userDB, Name: mailbox, MailboxID: mailboxID, Rights: db.AllRights}, nil
+	}
+
+	// Check role membership or the owner's grants before opening the account
+	// so that unknown role names and owners never create a database
+	isRole := IsRoleAccount(account)
+	if isRole && !HoldsRoleAccount(resolver, email, account) {
+		return nil, ErrNoSuchMailbox
+	}
+	if !isRole && !SharesWith(resolver, account, email) {
+		return nil, ErrNoSuchMailbox
+	}
+
+	accountDB, err := resolver.GetUserDB(account)
+	if err != nil {
+		return nil, err
+	}
+	mailboxID, err := db.GetMailboxByNamePerUser(accountDB, mailbox)
+	if err != nil {
+		return nil, ErrNoSuchMailbox
+	}
+
+	rights := RoleMemberRights
+	if !isRole {
+		rights, err = db.GetMailboxRightsPerUser(accountDB, mailboxID, email)
+		if err != nil {
+			return nil, err
+		}
+		if rights == "" {
+			return nil, ErrNoSuchMailbox
+		}
+	}
+
+	return &MailboxAccess{DB: accountDB, Owner: account, Name: mailbox, MailboxID: mailboxID, Rights: rights}, nil
+}
+
+// HasRights reports whether rights include every right in required
+func HasRights(rights, required string) bool {
+	for _, right := range required {
+		if !strings.ContainsRune(rights, right) {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectedRights returns the rights the user holds on the selected mailbox.
+// Users hold every right on their own mailboxes.
+func SelectedRights(state *models.ClientState) string {
+	if state.SelectedOwner == "" {
+		return db.AllRights
+	}
+	return state.SelectedRights
+}
+
+// ApplyRightsModification applies a SETACL rights modification ("+rights",
+// "-rights" or "rights") to the current rights (RFC 4314 Section 3.1).
+// The obsolete "c" and "d" rights map to "kx" and "xte".
+func ApplyRightsModification(current, modification string) (string, error) {
+	mode := byte(0)
+	if modification != "" && (modification[0] == '+' || modification[0] == '-') {
+		mode = modification[0]
+		modification = modification[1:]
+	}
+
+	var rights strings.Builder
+	for _, right := range modification {
+		switch {
+		case right == 'c':
+			rights.WriteString("kx")
+		case right == 'd':
+			rights.WriteString("xte")
+		case strings.ContainsRune(db.AllRights, right):
+			rights.WriteRune(right)
+		default:
+			return "", fmt.Errorf("unsupported right %c", right)
+		}
+	}
+
+	switch mode {
+	case '+':
+		return db.CanonicalRights(current + rights.String()), nil
+	case '-':
+		var result strings.Builder
+		for _, right := range current {
+			if !strings.ContainsRune(rights.String(), right) {
+				result.WriteRune(right)
+			}
+		}
+		return db.CanonicalRights(result.String()), nil
+	}
+
+	return db.CanonicalRights(rights.String()), nil
+}
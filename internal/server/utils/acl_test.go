@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"testing"
+
+	"raven/internal/models"
+)
+
+func TestSplitOtherUsersMailbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		owner   string
+		mailbox string
+		ok      bool
+	}{
+		{"Other Users/Boss@Example.com/INBOX", "boss@example.com", "INBOX", true},
+		{"Other Users/boss@example.com/Projects/2024", "boss@example.com", "Projects/2024", true},
+		{"Other Users/boss@example.com", "boss@example.com", "", true},
+		{"Other Users/", "", "", false},
+		{"INBOX", "", "", false},
+	}
+
+	for _, tt := range tests {
+		owner, mailbox, ok := SplitOtherUsersMailbox(tt.name)
+		if owner != tt.owner || mailbox != tt.mailbox || ok != tt.ok {
+			t.Errorf("SplitOtherUsersMailbox(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				tt.name, owner, mailbox, ok, tt.owner, tt.mailbox, tt.ok)
+		}
+	}
+
+	if name := OtherUsersMailboxName("boss@example.com", "INBOX"); name != "Other Users/boss@example.com/INBOX" {
+		t.Errorf("Unexpected name: %s", name)
+	}
+}
+
+func TestApplyRightsModification(t *testing.T) {
+	tests := []struct {
+		current      string
+		modification string
+		expected     string
+	}{
+		{"", "rl", "lr"},
+		{"lr", "+sw", "lrsw"},
+		{"lrsw", "-rw", "ls"},
+		{"lrsw", "i", "i"},
+		{"", "c", "kx"},
+		{"", "d", "xte"},
+		{"lr", "", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := ApplyRightsModification(tt.current, tt.modification)
+		if err != nil {
+			t.Errorf("ApplyRightsModification(%q, %q) failed: %v", tt.current, tt.modification, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ApplyRightsModification(%q, %q) = %q, want %q", tt.current, tt.modification, got, tt.expected)
+		}
+	}
+
+	if _, err := ApplyRightsModification("", "lrz"); err == nil {
+		t.Error("Expected error for unsupported right")
+	}
+}
+
+func TestSelectedRights(t *testing.T) {
+	own := &models.ClientState{}
+	if rights := SelectedRights(own); !HasRights(rights, "lrswipkxtea") {
+		t.Errorf("Expected all rights on own mailbox, got %q", rights)
+	}
+
+	shared := &models.ClientState{SelectedOwner: "boss@example.com", SelectedRights: "lr"}
+	if HasRights(SelectedRights(shared), "s") {
+		t.Error("Expected no seen right on shared mailbox")
+	}
+	if !HasRights(SelectedRights(shared), "lr") {
+		t.Error("Expected lookup and read rights on shared mailbox")
+	}
+}
+
+func TestMailboxAccount(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		mailbox string
+	}{
+		{"INBOX", "", "INBOX"},
+		{"Other Users/boss@example.com/Sent", "boss@example.com", "Sent"},
+		{"Other Users/Me@Example.com/Sent", "", "Sent"},
+		{"Shared/Admin/INBOX", "role_admin@example.com.db", "INBOX"},
+	}
+
+	for _, tt := range tests {
+		account, mailbox := MailboxAccount("me@example.com", tt.name)
+		if account != tt.account || mailbox != tt.mailbox {
+			t.Errorf("MailboxAccount(%q) = (%q, %q), want (%q, %q)", tt.name, account, mailbox, tt.account, tt.mailbox)
+		}
+	}
+
+	if !IsRoleAccount("role_admin@example.com.db") || IsRoleAccount("boss@example.com") {
+		t.Error("IsRoleAccount misclassified an account")
+	}
+}
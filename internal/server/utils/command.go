@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ===== COMMAND PARSER (RFC 9051 Section 9) =====
+
+// MaxCommandLiteral is the largest literal accepted in a command argument.
+// APPEND message literals are read by the APPEND handler and have their own
+// limit.
+const MaxCommandLiteral = 1024 * 1024
+
+// ErrLiteralTooLarge is returned for a literal above MaxCommandLiteral
+var ErrLiteralTooLarge = errors.New("literal too large")
+
+// ErrNonSyncLiteralTooLarge is returned for a non-synchronizing literal above
+// MaxCommandLiteral. The client sends its data without waiting, so the rest
+// of the stream can no longer be read as commands.
+var ErrNonSyncLiteralTooLarge = fmt.Errorf("non-synchronizing %w", ErrLiteralTooLarge)
+
+// literalMarker matches a literal announcement at the end of a line:
+// {n}, {n+} (LITERAL+, RFC 7888) or a literal8 ~{n} (RFC 3516)
+var literalMarker = regexp.MustCompile(`~?\{(\d+)(\+?)\}$`)
+
+// ArgKind is the kind of a command argument
+type ArgKind int
+
+const (
+	ArgAtom   ArgKind = iota // atom, number, NIL or sequence set
+	ArgString                // quoted string or literal
+	ArgList                  // parenthesized list
+)
+
+// Arg is a parsed command argument. Handlers whose arguments have nested
+// structure, such as NOTIFY and ESEARCH, parse them with ParseArguments.
+type Arg struct {
+	Kind  ArgKind
+	Value string // atom text or string contents, without quotes
+	Raw   string // source text, including quotes or parentheses
+	List  []Arg  // elements of a parenthesized list
+}
+
+// Command is a command read from the client
+type Command struct {
+	Tag  string
+	Name string // command name, in upper case
+
+	// Line is the command with its literals rewritten as quoted strings, so
+	// it fits on one line. An APPEND message literal is not read; its
+	// announcement is left at the end of Line for the APPEND handler.
+	Line string
+}
+
+// Parts splits the command line into whitespace-separated arguments, keeping
+// quoted strings (and literals) whole. This is the argument form the command
+// handlers take.
+func (c *Command) Parts() []string {
+	return SplitArguments(c.Line)
+}
+
+// ReadCommand reads one command from r, including the literals in its
+// arguments. continuation is called before each synchronizing literal is
+// read, to send the "+" continuation request. Literals larger than
+// MaxCommandLiteral end the command with ErrLiteralTooLarge, or
+// ErrNonSyncLiteralTooLarge when the client did not wait for a continuation;
+// the partial command is returned so the error can be tagged.
+func ReadCommand(r *bufio.Reader, continuation func()) (*Command, error) {
+	var line strings.Builder
+	for {
+		chunk, err := r.ReadString('\n')
+		if err != nil && (err != io.EOF || chunk == "") {
+			return nil, err
+		}
+		chunk = strings.TrimRight(chunk, "\r\n")
+
+		match := literalMarker.FindStringSubmatchIndex(chunk)
+		if match == nil {
+			line.WriteString(chunk)
+			break
+		}
+
+		before := line.String() + chunk[:match[0]]
+		size, convErr := strconv.Atoi(chunk[match[2]:match[3]])
+		synchronizing := match[4] == match[5]
+
+		// The message literal of APPEND is left for the APPEND handler,
+		// which checks the mailbox and the message size before reading it
+		if isAppendMessageLiteral(before) {
+			line.WriteString(chunk)
+			break
+		}
+
+		if convErr != nil || size > MaxCommandLiteral {
+			// A non-synchronizing literal is already on its way
+			if !synchronizing {
+				return parseCommand(before), ErrNonSyncLiteralTooLarge
+			}
+			return parseCommand(before), ErrLiteralTooLarge
+		}
+
+		if synchronizing && continuation != nil {
+			continuation()
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+
+		line.WriteString(chunk[:match[0]])
+		line.WriteString(QuoteString(string(data)))
+	}
+
+	return parseCommand(line.String()), nil
+}
+
+// ParseCommand parses a command line that contains no literals
+func ParseCommand(line string) *Command {
+	return parseCommand(strings.TrimRight(line, "\r\n"))
+}
+
+func parseCommand(line string) *Command {
+	cmd := &Command{Line: line}
+	parts := SplitArguments(line)
+	if len(parts) > 0 {
+		cmd.Tag = parts[0]
+	}
+	if len(parts) > 1 {
+		cmd.Name = strings.ToUpper(parts[1])
+	}
+	return cmd
+}
+
+// isAppendMessageLiteral reports whether a literal following line is the
+// message of an APPEND command, i.e. it comes after the mailbox name
+func isAppendMessageLiteral(line string) bool {
+	parts := SplitArguments(line)
+	return len(parts) >= 3 && strings.EqualFold(parts[1], "APPEND")
+}
+
+// SplitArguments splits s at spaces outside quoted strings
+func SplitArguments(s string) []string {
+	var parts []string
+	start, inQuote := -1, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote && c == '\\' && i+1 < len(s):
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case c == ' ' && !inQuote:
+			if start >= 0 {
+				parts = append(parts, s[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
+
+// ParseArguments parses command arguments into atoms, strings and
+// parenthesized lists. Atoms may contain bracketed sections with spaces, such
+// as BODY.PEEK[HEADER.FIELDS (FROM)].
+func ParseArguments(s string) ([]Arg, error) {
+	args, _, err := parseArguments(s, 0, false)
+	return args, err
+}
+
+// parseArguments parses s from pos until the end, or until the closing
+// parenthesis when inList is set, and returns the position after it
+func parseArguments(s string, pos int, inList bool) ([]Arg, int, error) {
+	var args []Arg
+	for pos < len(s) {
+		switch s[pos] {
+		case ' ':
+			pos++
+		case ')':
+			if !inList {
+				return nil, pos, fmt.Errorf("unexpected )")
+			}
+			return args, pos + 1, nil
+		case '(':
+			list, next, err := parseArguments(s, pos+1, true)
+			if err != nil {
+				return nil, next, err
+			}
+			args = append(args, Arg{Kind: ArgList, Raw: s[pos:next], List: list})
+			pos = next
+		case '"':
+			var b strings.Builder
+			end := pos + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' && end+1 < len(s) {
+					end++
+				}
+				b.WriteByte(s[end])
+			}
+			if end >= len(s) {
+				return nil, end, fmt.Errorf("unterminated quoted string")
+			}
+			args = append(args, Arg{Kind: ArgString, Value: b.String(), Raw: s[pos : end+1]})
+			pos = end + 1
+		default:
+			end, depth := pos, 0
+			for ; end < len(s); end++ {
+				c := s[end]
+				if c == '[' {
+					depth++
+				} else if c == ']' && depth > 0 {
+					depth--
+				} else if depth == 0 && (c == ' ' || c == '(' || c == ')') {
+					break
+				}
+			}
+			args = append(args, Arg{Kind: ArgAtom, Value: s[pos:end], Raw: s[pos:end]})
+			pos = end
+		}
+	}
+
+	if inList {
+		return nil, pos, fmt.Errorf("unterminated list")
+	}
+	return args, pos, nil
+}
+
+// QuoteString renders s as a quoted string, escaping quotes and backslashes
+func QuoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand_Literals(t *testing.T) {
+	input := "A1 LOGIN {4}\r\nuser {11+}\r\npass \"word\"\r\nA2 NOOP\r\n"
+	r := bufio.NewReader(strings.NewReader(input))
+
+	continuations := 0
+	cmd, err := ReadCommand(r, func() { continuations++ })
+	if err != nil {
+		t.Fatalf("ReadCommand failed: %v", err)
+	}
+	if continuations != 1 {
+		t.Errorf("Expected one continuation for the synchronizing literal, got %d", continuations)
+	}
+	if cmd.Tag != "A1" || cmd.Name != "LOGIN" {
+		t.Errorf("Expected tag A1 and LOGIN, got %q %q", cmd.Tag, cmd.Name)
+	}
+	parts := cmd.Parts()
+	if len(parts) != 4 || ParseQuotedString(parts[2]) != "user" || ParseQuotedString(parts[3]) != `pass "word"` {
+		t.Errorf("Expected each literal as one quoted argument, got %q", parts)
+	}
+
+	next, err := ReadCommand(r, nil)
+	if err != nil || next.Name != "NOOP" {
+		t.Errorf("Expected the following command to be read, got %+v (%v)", next, err)
+	}
+}
+
+func TestReadCommand_AppendMessageLiteral(t *testing.T) {
+	input := "A1 APPEND {5}\r\nINBOX (\\Seen) {12}\r\nSubject: x\r\n"
+	r := bufio.NewReader(strings.NewReader(input))
+
+	cmd, err := ReadCommand(r, nil)
+	if err != nil {
+		t.Fatalf("ReadCommand failed: %v", err)
+	}
+	if cmd.Line != `A1 APPEND "INBOX" (\Seen) {12}` {
+		t.Errorf("Expected the message literal to be left unread, got %q", cmd.Line)
+	}
+	rest, _ := r.ReadString('\n')
+	if rest != "Subject: x\r\n" {
+		t.Errorf("Expected the message data to remain in the reader, got %q", rest)
+	}
+}
+
+func TestReadCommand_LiteralTooLarge(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("A1 CREATE {99999999}\r\n"))
+	cmd, err := ReadCommand(r, func() { t.Error("Expected no continuation") })
+	if !errors.Is(err, ErrLiteralTooLarge) || cmd == nil || cmd.Tag != "A1" {
+		t.Errorf("Expected ErrLiteralTooLarge for A1, got %+v (%v)", cmd, err)
+	}
+}
+
+func TestReadCommand_NonSyncLiteralTooLarge(t *testing.T) {
+	for _, input := range []string{
+		"A1 CREATE {99999999+}\r\n",
+		"A1 CREATE {99999999999999999999999+}\r\n",
+	} {
+		r := bufio.NewReader(strings.NewReader(input))
+		cmd, err := ReadCommand(r, func() { t.Error("Expected no continuation") })
+		if !errors.Is(err, ErrNonSyncLiteralTooLarge) || !errors.Is(err, ErrLiteralTooLarge) || cmd == nil || cmd.Tag != "A1" {
+			t.Errorf("%q: expected ErrNonSyncLiteralTooLarge for A1, got %+v (%v)", input, cmd, err)
+		}
+	}
+}
+
+func TestParseArguments_Nested(t *testing.T) {
+	args, err := ParseArguments(`1:* (FLAGS BODY.PEEK[HEADER.FIELDS (FROM TO)]) "a \"b\"" NIL`)
+	if err != nil {
+		t.Fatalf("ParseArguments failed: %v", err)
+	}
+	if len(args) != 4 {
+		t.Fatalf("Expected 4 arguments, got %d: %+v", len(args), args)
+	}
+	if args[1].Kind != ArgList || len(args[1].List) != 2 || args[1].List[1].Value != "BODY.PEEK[HEADER.FIELDS (FROM TO)]" {
+		t.Errorf("Unexpected list: %+v", args[1])
+	}
+	if args[2].Kind != ArgString || args[2].Value != `a "b"` {
+		t.Errorf("Unexpected string: %+v", args[2])
+	}
+
+	if _, err := ParseArguments("(FLAGS"); err == nil {
+		t.Error("Expected an error for an unterminated list")
+	}
+}
+
+func TestSplitArguments_QuotedSpaces(t *testing.T) {
+	parts := SplitArguments(`A1 RENAME "Old Name" "New \"Name\""`)
+	expected := []string{"A1", "RENAME", `"Old Name"`, `"New \"Name\""`}
+	if strings.Join(parts, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, parts)
+	}
+	if ParseQuotedString(parts[3]) != `New "Name"` {
+		t.Errorf("Expected escapes to be removed, got %q", ParseQuotedString(parts[3]))
+	}
+}
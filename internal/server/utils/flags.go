@@ -2,6 +2,8 @@ package utils
 
 import (
 	"strings"
+
+	"raven/internal/models"
 )
 
 // CalculateNewFlags determines the new flags based on the operation
@@ -67,3 +69,80 @@ func GetMailboxAttributes(mailboxName string) string {
 		return "\\Unmarked"
 	}
 }
+
+// specialUseAttributes lists the mailbox attributes defined by RFC 6154
+var specialUseAttributes = []string{"\\All", "\\Archive", "\\Drafts", "\\Flagged", "\\Junk", "\\Sent", "\\Trash"}
+
+// IsSpecialUseAttribute checks if an attribute is an RFC 6154 special-use attribute
+func IsSpecialUseAttribute(attr string) bool {
+	for _, known := range specialUseAttributes {
+		if strings.EqualFold(attr, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeSpecialUseAttribute returns the canonical spelling of a special-use attribute
+func NormalizeSpecialUseAttribute(attr string) string {
+	for _, known := range specialUseAttributes {
+		if strings.EqualFold(attr, known) {
+			return known
+		}
+	}
+	return attr
+}
+
+// GetMailboxAttributesWithSpecialUse returns the attributes for a mailbox using the
+// special-use value stored in the database, falling back to the name-based defaults.
+// Values that are not RFC 6154 attributes (such as the internal \Inbox marker) are ignored.
+func GetMailboxAttributesWithSpecialUse(mailboxName, specialUse string) string {
+	var attrs []string
+	for _, attr := range strings.Fields(specialUse) {
+		if IsSpecialUseAttribute(attr) {
+			attrs = append(attrs, NormalizeSpecialUseAttribute(attr))
+		}
+	}
+
+	if len(attrs) == 0 {
+		return GetMailboxAttributes(mailboxName)
+	}
+
+	return strings.Join(attrs, " ")
+}
+
+// HasSpecialUseAttribute checks if a stored special-use value contains an RFC 6154 attribute
+func HasSpecialUseAttribute(specialUse string) bool {
+	for _, attr := range strings.Fields(specialUse) {
+		if IsSpecialUseAttribute(attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientFlags returns a message's flags as the session sees them.
+// IMAP4rev2 has no \Recent flag (RFC 9051 Appendix E).
+func ClientFlags(flags string, state *models.ClientState) string {
+	if !state.IMAP4rev2Enabled || !strings.Contains(flags, "\\Recent") {
+		return flags
+	}
+	var kept []string
+	for _, flag := range strings.Fields(flags) {
+		if flag != "\\Recent" {
+			kept = append(kept, flag)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// MailboxFlags returns the flags listed in the FLAGS response of SELECT and
+// EXAMINE. IMAP4rev2 sessions are also told about the forwarding and junk
+// keywords of RFC 9051 Section 2.3.2.
+func MailboxFlags(state *models.ClientState) string {
+	flags := "\\Answered \\Flagged \\Deleted \\Seen \\Draft"
+	if state.IMAP4rev2Enabled {
+		flags += " $Forwarded $Junk $NotJunk"
+	}
+	return flags
+}
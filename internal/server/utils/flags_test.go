@@ -261,3 +261,23 @@ func TestGetMailboxAttributes_EmptyName(t *testing.T) {
 		t.Errorf("Expected %s for empty name, got %s", expected, result)
 	}
 }
+
+func TestGetMailboxAttributesWithSpecialUse(t *testing.T) {
+	tests := []struct {
+		name       string
+		specialUse string
+		expected   string
+	}{
+		{"Archiv", "\\Archive", "\\Archive"},
+		{"Papierkorb", "\\trash", "\\Trash"},
+		{"INBOX", "\\Inbox", "\\Unmarked"},
+		{"Sent", "", "\\Sent"},
+		{"Custom", "", "\\Unmarked"},
+	}
+
+	for _, tt := range tests {
+		if result := GetMailboxAttributesWithSpecialUse(tt.name, tt.specialUse); result != tt.expected {
+			t.Errorf("GetMailboxAttributesWithSpecialUse(%q, %q) = %q, want %q", tt.name, tt.specialUse, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"database/sql"
+
+	"raven/internal/models"
+)
+
+// LoadMessageMap reads the UIDs and flags of a mailbox in sequence order
+func LoadMessageMap(targetDB *sql.DB, mailboxID int64, owner string) (*models.MessageMap, error) {
+	rows, err := targetDB.Query(`
+		SELECT uid, COALESCE(flags, '') FROM message_mailbox
+		WHERE mailbox_id = ?
+		ORDER BY uid ASC
+	`, mailboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	messages := models.NewMessageMap(mailboxID, owner)
+	for rows.Next() {
+		var uid int64
+		var flags string
+		if err := rows.Scan(&uid, &flags); err != nil {
+			return nil, err
+		}
+		messages.Add(uid, flags)
+	}
+	return messages, rows.Err()
+}
+
+// IsSelectedMessageMap reports whether the session's message map belongs to
+// the selected mailbox
+func IsSelectedMessageMap(state *models.ClientState) bool {
+	m := state.Messages
+	return m != nil && m.MailboxID == state.SelectedMailboxID && m.Owner == state.SelectedOwner
+}
+
+// SelectedMessageMap returns the session's message map of the selected
+// mailbox. Sessions that never selected the mailbox (such as handlers driven
+// directly) get a map of the mailbox as it is now.
+func SelectedMessageMap(state *models.ClientState, targetDB *sql.DB) *models.MessageMap {
+	if IsSelectedMessageMap(state) {
+		return state.Messages
+	}
+	messages, err := LoadMessageMap(targetDB, state.SelectedMailboxID, state.SelectedOwner)
+	if err != nil {
+		return models.NewMessageMap(state.SelectedMailboxID, state.SelectedOwner)
+	}
+	return messages
+}
@@ -3,10 +3,12 @@ package utils
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
 	"raven/internal/db"
+	"raven/internal/models"
 )
 
 // ParseQuotedString parses a quoted string argument, handling both quoted and unquoted strings
@@ -15,9 +17,9 @@ func ParseQuotedString(arg string) string {
 		return ""
 	}
 
-	// Handle quoted strings
+	// Handle quoted strings, which may escape quotes and backslashes
 	if arg[0] == '"' && len(arg) >= 2 && arg[len(arg)-1] == '"' {
-		return arg[1 : len(arg)-1]
+		return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(arg[1 : len(arg)-1])
 	}
 
 	// Handle unquoted strings (including empty string represented as "")
@@ -30,11 +32,19 @@ func ParseQuotedString(arg string) string {
 
 // ParseSequenceSetWithDB parses a sequence set and returns message sequence numbers
 func ParseSequenceSetWithDB(sequenceSet string, mailboxID int64, userDB *sql.DB) []int {
-	var sequences []int
-
 	// Get total message count
 	totalMessages, err := db.GetMessageCountPerUser(userDB, mailboxID)
-	if err != nil || totalMessages == 0 {
+	if err != nil {
+		return nil
+	}
+	return ParseSequenceSet(sequenceSet, totalMessages)
+}
+
+// ParseSequenceSet parses a sequence set against a mailbox of totalMessages
+// messages and returns the message sequence numbers it contains
+func ParseSequenceSet(sequenceSet string, totalMessages int) []int {
+	var sequences []int
+	if totalMessages == 0 {
 		return sequences
 	}
 
@@ -178,3 +188,132 @@ func ParseUIDSequenceSetWithDB(sequenceSet string, mailboxID int64, userDB *sql.
 
 	return uids
 }
+
+// FormatSequenceSet renders a list of numbers as a compact IMAP sequence set,
+// collapsing consecutive runs into ranges (e.g. 1,2,3,5 becomes "1:3,5").
+// The input order is preserved so UID lists stay aligned in COPYUID responses.
+func FormatSequenceSet(numbers []int64) string {
+	if len(numbers) == 0 {
+		return ""
+	}
+
+	var parts []string
+	start := numbers[0]
+	prev := numbers[0]
+
+	flush := func() {
+		if start == prev {
+			parts = append(parts, strconv.FormatInt(start, 10))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d:%d", start, prev))
+		}
+	}
+
+	for _, n := range numbers[1:] {
+		if n == prev+1 {
+			prev = n
+			continue
+		}
+		flush()
+		start = n
+		prev = n
+	}
+	flush()
+
+	return strings.Join(parts, ",")
+}
+
+// SequenceSetContains reports whether n is a member of an IMAP sequence set
+// such as "1,4:7,10:*". The * symbol is resolved to maxValue.
+func SequenceSetContains(sequenceSet string, n int64, maxValue int64) bool {
+	resolve := func(s string) (int64, bool) {
+		if s == "*" {
+			return maxValue, true
+		}
+		v, err := strconv.ParseInt(s, 10, 64)
+		return v, err == nil
+	}
+
+	for _, part := range strings.Split(sequenceSet, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if strings.Contains(part, ":") {
+			rangeParts := strings.SplitN(part, ":", 2)
+			start, ok1 := resolve(rangeParts[0])
+			end, ok2 := resolve(rangeParts[1])
+			if !ok1 || !ok2 {
+				continue
+			}
+			if start > end {
+				start, end = end, start
+			}
+			if n >= start && n <= end {
+				return true
+			}
+		} else if v, ok := resolve(part); ok && v == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseParenthesizedList collects a parenthesized list that may have been split
+// across several whitespace-separated arguments, e.g. ["(USE", "(\Archive))"].
+// It returns the content between the outer parentheses and the arguments that follow.
+func ParseParenthesizedList(args []string) (string, []string, error) {
+	if len(args) == 0 || !strings.HasPrefix(args[0], "(") {
+		return "", args, fmt.Errorf("expected parenthesized list")
+	}
+
+	depth := 0
+	for i, arg := range args {
+		for _, ch := range arg {
+			switch ch {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+		}
+		if depth == 0 {
+			joined := strings.Join(args[:i+1], " ")
+			if !strings.HasSuffix(joined, ")") {
+				return "", args, fmt.Errorf("unexpected data after parenthesized list")
+			}
+			return joined[1 : len(joined)-1], args[i+1:], nil
+		}
+		if depth < 0 {
+			break
+		}
+	}
+
+	return "", args, fmt.Errorf("unbalanced parentheses")
+}
+
+// ExpandSearchResult resolves the "$" saved search result reference (RFC 5182)
+// into an explicit set. UID commands get the saved UIDs; sequence-number commands
+// get the sequence numbers of those messages in the session's message map.
+// Other sets are returned as-is.
+func ExpandSearchResult(sequenceSet string, savedUIDs []int64, messages *models.MessageMap, uidMode bool) string {
+	if sequenceSet != "$" {
+		return sequenceSet
+	}
+
+	if uidMode {
+		return FormatSequenceSet(savedUIDs)
+	}
+
+	var seqNums []int64
+	for _, uid := range savedUIDs {
+		if seqNum, ok := messages.SeqNum(uid); ok {
+			seqNums = append(seqNums, int64(seqNum))
+		}
+	}
+	sort.Slice(seqNums, func(i, j int) bool { return seqNums[i] < seqNums[j] })
+
+	return FormatSequenceSet(seqNums)
+}
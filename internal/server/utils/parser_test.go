@@ -545,3 +545,65 @@ func TestParseUIDSequenceSetWithDB_MultipleSequences(t *testing.T) {
 		t.Errorf("Expected 2 UIDs, got %d: %v", len(result), result)
 	}
 }
+
+func TestFormatSequenceSet(t *testing.T) {
+	tests := []struct {
+		input    []int64
+		expected string
+	}{
+		{nil, ""},
+		{[]int64{7}, "7"},
+		{[]int64{1, 2, 3, 5}, "1:3,5"},
+		{[]int64{4, 5, 9, 10, 11}, "4:5,9:11"},
+		{[]int64{3, 1, 2}, "3,1:2"},
+	}
+
+	for _, tt := range tests {
+		if result := FormatSequenceSet(tt.input); result != tt.expected {
+			t.Errorf("FormatSequenceSet(%v) = '%s', expected '%s'", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestSequenceSetContains(t *testing.T) {
+	tests := []struct {
+		set      string
+		n        int64
+		expected bool
+	}{
+		{"1,4:7,10:*", 1, true},
+		{"1,4:7,10:*", 5, true},
+		{"1,4:7,10:*", 8, false},
+		{"1,4:7,10:*", 20, true},
+		{"1,4:7,10:*", 21, false},
+		{"*", 20, true},
+		{"7:4", 6, true},
+		{"abc", 1, false},
+	}
+
+	for _, tt := range tests {
+		if result := SequenceSetContains(tt.set, tt.n, 20); result != tt.expected {
+			t.Errorf("SequenceSetContains(%q, %d) = %v, expected %v", tt.set, tt.n, result, tt.expected)
+		}
+	}
+}
+
+func TestParseParenthesizedList(t *testing.T) {
+	content, rest, err := ParseParenthesizedList([]string{"(USE", "(\\Archive))", "extra"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content != "USE (\\Archive)" {
+		t.Errorf("Expected content 'USE (\\Archive)', got '%s'", content)
+	}
+	if len(rest) != 1 || rest[0] != "extra" {
+		t.Errorf("Expected remaining [extra], got %v", rest)
+	}
+
+	if _, _, err := ParseParenthesizedList([]string{"(USE", "(\\Archive)"}); err == nil {
+		t.Error("Expected error for unbalanced parentheses")
+	}
+	if _, _, err := ParseParenthesizedList([]string{"USE"}); err == nil {
+		t.Error("Expected error for missing parenthesis")
+	}
+}
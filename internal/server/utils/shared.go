@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SharedNamespace is the prefix under which role mailboxes appear to the users
+// holding the role (RFC 2342), e.g. "Shared/admin/INBOX" for admin@<domain>
+const SharedNamespace = "Shared/"
+
+// RoleMemberRights are the rights every holder of a role has on the role's
+// mailboxes. Members read and file mail but do not change the hierarchy or ACLs.
+const RoleMemberRights = "lrswipte"
+
+// SplitSharedMailbox splits "Shared/<role>/<mailbox>" into the role name and the
+// mailbox name within the role's account
+func SplitSharedMailbox(name string) (role, mailbox string, ok bool) {
+	if !strings.HasPrefix(name, SharedNamespace) {
+		return "", "", false
+	}
+
+	rest := strings.TrimPrefix(name, SharedNamespace)
+	role, mailbox, _ = strings.Cut(rest, "/")
+	if role == "" {
+		return "", "", false
+	}
+
+	return strings.ToLower(role), mailbox, true
+}
+
+// SharedMailboxName returns the name under which a role's mailbox is shown
+func SharedMailboxName(role, mailbox string) string {
+	return SharedNamespace + role + "/" + mailbox
+}
+
+// RoleMailboxIdentity returns the account that holds the mailboxes of a role in
+// the user's domain, in the role_<name>@<domain>.db form LMTP delivers to
+func RoleMailboxIdentity(role, email string) string {
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok || domain == "" {
+		return ""
+	}
+	return fmt.Sprintf("role_%s@%s.db", strings.ToLower(role), strings.ToLower(domain))
+}
+
+// IsRoleAccount reports whether an account is a role mailbox identity
+func IsRoleAccount(account string) bool {
+	return strings.HasPrefix(account, "role_") && strings.HasSuffix(account, ".db")
+}
+
+// HoldsRoleAccount reports whether the user holds the role whose mailboxes live in account
+func HoldsRoleAccount(resolver AccountResolver, email, account string) bool {
+	if account == "" {
+		return false
+	}
+	for _, role := range resolver.GetUserRoles(email) {
+		if RoleMailboxIdentity(role, email) == account {
+			return true
+		}
+	}
+	return false
+}
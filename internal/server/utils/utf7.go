@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"raven/internal/models"
+)
+
+// ===== Modified UTF-7 mailbox names (RFC 3501 §5.1.3) =====
+
+// modifiedBase64 is base64 with "," in place of "/" and no padding
+var modifiedBase64 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// EncodeModifiedUTF7 encodes a UTF-8 mailbox name in modified UTF-7
+func EncodeModifiedUTF7(name string) string {
+	var b strings.Builder
+	var pending []rune
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		units := utf16.Encode(pending)
+		buf := make([]byte, 0, len(units)*2)
+		for _, u := range units {
+			buf = append(buf, byte(u>>8), byte(u))
+		}
+		b.WriteByte('&')
+		b.WriteString(modifiedBase64.EncodeToString(buf))
+		b.WriteByte('-')
+		pending = pending[:0]
+	}
+
+	for _, r := range name {
+		switch {
+		case r == '&':
+			flush()
+			b.WriteString("&-")
+		case r >= 0x20 && r <= 0x7e:
+			flush()
+			b.WriteRune(r)
+		default:
+			pending = append(pending, r)
+		}
+	}
+	flush()
+
+	return b.String()
+}
+
+// DecodeModifiedUTF7 decodes a modified UTF-7 mailbox name to UTF-8
+func DecodeModifiedUTF7(name string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		if ch < 0x20 || ch > 0x7e {
+			return "", fmt.Errorf("invalid character in mailbox name")
+		}
+		if ch != '&' {
+			b.WriteByte(ch)
+			continue
+		}
+
+		end := strings.IndexByte(name[i+1:], '-')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated shift sequence in mailbox name")
+		}
+		encoded := name[i+1 : i+1+end]
+		i += end + 1
+
+		if encoded == "" {
+			b.WriteByte('&')
+			continue
+		}
+
+		buf, err := modifiedBase64.DecodeString(encoded)
+		if err != nil || len(buf)%2 != 0 {
+			return "", fmt.Errorf("invalid shift sequence in mailbox name")
+		}
+		units := make([]uint16, len(buf)/2)
+		for j := range units {
+			units[j] = uint16(buf[2*j])<<8 | uint16(buf[2*j+1])
+		}
+		decoded := utf16.Decode(units)
+		for _, r := range decoded {
+			// Printable ASCII must not be encoded
+			if r == utf8.RuneError || (r >= 0x20 && r <= 0x7e) {
+				return "", fmt.Errorf("invalid shift sequence in mailbox name")
+			}
+		}
+		b.WriteString(string(decoded))
+	}
+
+	return b.String(), nil
+}
+
+// ClientMailboxName converts a stored (UTF-8) mailbox name to the form the
+// client expects: UTF-8 after ENABLE UTF8=ACCEPT (RFC 6855) or ENABLE
+// IMAP4rev2 (RFC 9051), otherwise modified UTF-7
+func ClientMailboxName(name string, state *models.ClientState) string {
+	if state.UTF8Enabled || state.IMAP4rev2Enabled {
+		return name
+	}
+	return EncodeModifiedUTF7(name)
+}
+
+// ParseMailboxName parses a mailbox name argument into its stored UTF-8 form.
+// Clients that have not enabled UTF8=ACCEPT or IMAP4rev2 send modified UTF-7, but raw
+// UTF-8 names from such clients are accepted as well.
+func ParseMailboxName(arg string, state *models.ClientState) (string, error) {
+	name := ParseQuotedString(arg)
+	if state.UTF8Enabled || state.IMAP4rev2Enabled || (!isASCII(name) && utf8.ValidString(name)) {
+		return name, nil
+	}
+	return DecodeModifiedUTF7(name)
+}
+
+// ParseMailboxArgument parses args, the rest of a command line that must be a
+// single mailbox name such as the destination of COPY or MOVE, into its stored
+// UTF-8 form
+func ParseMailboxArgument(args string, state *models.ClientState) (string, error) {
+	parsed, err := ParseArguments(args)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed) != 1 || parsed[0].Kind == ArgList {
+		return "", fmt.Errorf("expected one mailbox name")
+	}
+	return ParseMailboxName(parsed[0].Raw, state)
+}
+
+// isASCII reports whether s contains only 7-bit characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"testing"
+
+	"raven/internal/models"
+)
+
+func TestModifiedUTF7(t *testing.T) {
+	tests := []struct {
+		decoded string
+		encoded string
+	}{
+		{"INBOX", "INBOX"},
+		{"Été", "&AMk-t&AOk-"},
+		{"Tom & Jerry", "Tom &- Jerry"},
+		{"සිංහල", "&DcMN0g2CDcQNvQ-"},
+		{"Projects/日本語", "Projects/&ZeVnLIqe-"},
+	}
+
+	for _, tt := range tests {
+		if got := EncodeModifiedUTF7(tt.decoded); got != tt.encoded {
+			t.Errorf("EncodeModifiedUTF7(%q) = %q, want %q", tt.decoded, got, tt.encoded)
+		}
+		got, err := DecodeModifiedUTF7(tt.encoded)
+		if err != nil || got != tt.decoded {
+			t.Errorf("DecodeModifiedUTF7(%q) = (%q, %v), want %q", tt.encoded, got, err, tt.decoded)
+		}
+	}
+
+	for _, invalid := range []string{"&AMk", "&AGE-", "Été", "&A-"} {
+		if _, err := DecodeModifiedUTF7(invalid); err == nil {
+			t.Errorf("Expected DecodeModifiedUTF7(%q) to fail", invalid)
+		}
+	}
+}
+
+func TestClientMailboxName(t *testing.T) {
+	legacy := &models.ClientState{}
+	if name := ClientMailboxName("Été", legacy); name != "&AMk-t&AOk-" {
+		t.Errorf("Expected modified UTF-7 for legacy clients, got %q", name)
+	}
+	if name := ClientMailboxName("R&D", legacy); name != "R&-D" {
+		t.Errorf("Expected & to be escaped for legacy clients, got %q", name)
+	}
+
+	utf8Client := &models.ClientState{UTF8Enabled: true}
+	if name := ClientMailboxName("Été", utf8Client); name != "Été" {
+		t.Errorf("Expected UTF-8 after ENABLE UTF8=ACCEPT, got %q", name)
+	}
+}
+
+func TestParseMailboxName(t *testing.T) {
+	legacy := &models.ClientState{}
+	tests := []struct {
+		arg      string
+		expected string
+	}{
+		{`"&AMk-t&AOk-"`, "Été"},
+		{"R&-D", "R&D"},
+		{"Été", "Été"},
+		{`"INBOX"`, "INBOX"},
+	}
+	for _, tt := range tests {
+		name, err := ParseMailboxName(tt.arg, legacy)
+		if err != nil || name != tt.expected {
+			t.Errorf("ParseMailboxName(%q) = (%q, %v), want %q", tt.arg, name, err, tt.expected)
+		}
+	}
+
+	if _, err := ParseMailboxName("R&D", legacy); err == nil {
+		t.Error("Expected an invalid shift sequence to be rejected")
+	}
+
+	utf8Client := &models.ClientState{UTF8Enabled: true}
+	if name, err := ParseMailboxName("R&D", utf8Client); err != nil || name != "R&D" {
+		t.Errorf("Expected UTF-8 names to be taken as-is, got (%q, %v)", name, err)
+	}
+}
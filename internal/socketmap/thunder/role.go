@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -108,3 +109,180 @@ func ValidateRoleAddress(email, host, port string, tokenRefreshSeconds int) (boo
 	log.Printf("      │ ✗ Role not found for OU/domain")
 	return false, "", nil
 }
+
+// GetUserRoles returns the lower-cased names of the roles a user holds in the OU
+// of the user's domain, either directly or through a group the user belongs to.
+func GetUserRoles(email, host, port string, tokenRefreshSeconds int) ([]string, error) {
+	log.Printf("      ┌─ Thunder User Roles ──────────")
+	log.Printf("      │ Email: %s", email)
+	defer log.Printf("      └──────────────────────────────")
+
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		log.Printf("      │ ✗ Invalid email format")
+		return nil, nil
+	}
+
+	auth, err := GetAuth(host, port, tokenRefreshSeconds)
+	if err != nil {
+		log.Printf("      │ ⚠ Auth failed: %v", err)
+		return nil, err
+	}
+
+	ouID, err := GetOrgUnitIDForDomain(parts[1], host, port, tokenRefreshSeconds)
+	if err != nil {
+		log.Printf("      │ ⚠ Failed to get OU ID: %v", err)
+		return nil, err
+	}
+
+	baseURL := fmt.Sprintf("https://%s:%s", host, port)
+
+	// Find the user's ID within the domain's OU
+	var usersResp UsersResponse
+	filter := url.Values{"filter": {fmt.Sprintf("username eq \"%s\"", escapeFilterValue(parts[0]))}}
+	if err := getThunderJSON(baseURL+"/users", filter, auth.BearerToken, &usersResp); err != nil {
+		log.Printf("      │ ✗ User lookup failed: %v", err)
+		return nil, err
+	}
+	userID := ""
+	for _, user := range usersResp.Users {
+		if user.OrganizationUnit == ouID {
+			userID = user.ID
+			break
+		}
+	}
+	if userID == "" {
+		log.Printf("      │ ✗ User not found in OU")
+		return nil, nil
+	}
+
+	// Walk the roles of the OU and check their assignments
+	groupMember := make(map[string]bool)
+	var roles []string
+	startIndex := 1
+	for {
+		var rolesResp RolesResponse
+		if err := getThunderJSON(baseURL+"/roles", pageQuery(startIndex), auth.BearerToken, &rolesResp); err != nil {
+			log.Printf("      │ ✗ Role listing failed: %v", err)
+			return nil, err
+		}
+
+		for _, role := range rolesResp.Roles {
+			if role.OrganizationUnitID != ouID {
+				continue
+			}
+			// A role that cannot be checked fails the whole lookup, so a
+			// partial set of roles is never reported (and cached) as complete
+			held, err := roleHeldBy(baseURL, auth.BearerToken, role.ID, userID, groupMember)
+			if err != nil {
+				log.Printf("      │ ✗ Assignment lookup failed for role %s: %v", role.Name, err)
+				return nil, fmt.Errorf("assignment lookup failed for role %s: %w", role.Name, err)
+			}
+			if held {
+				roles = append(roles, strings.ToLower(role.Name))
+			}
+		}
+
+		if rolesResp.Count <= 0 || rolesResp.StartIndex+rolesResp.Count > rolesResp.TotalResults {
+			break
+		}
+		startIndex = rolesResp.StartIndex + rolesResp.Count
+	}
+
+	log.Printf("      │ ✓ Roles: %v", roles)
+	return roles, nil
+}
+
+// roleHeldBy reports whether a role is assigned to the user directly or to a
+// group the user is a member of. Group membership is memoized in groupMember.
+func roleHeldBy(baseURL, token, roleID, userID string, groupMember map[string]bool) (bool, error) {
+	startIndex := 1
+	for {
+		var assignments RoleAssignmentsResponse
+		endpoint := fmt.Sprintf("%s/roles/%s/assignments", baseURL, url.PathEscape(roleID))
+		if err := getThunderJSON(endpoint, pageQuery(startIndex), token, &assignments); err != nil {
+			return false, err
+		}
+
+		for _, assignment := range assignments.Assignments {
+			switch assignment.Type {
+			case "user":
+				if assignment.ID == userID {
+					return true, nil
+				}
+			case "group":
+				member, known := groupMember[assignment.ID]
+				if !known {
+					var err error
+					member, err = isGroupMember(baseURL, token, assignment.ID, userID)
+					if err != nil {
+						return false, err
+					}
+					groupMember[assignment.ID] = member
+				}
+				if member {
+					return true, nil
+				}
+			}
+		}
+
+		if assignments.Count <= 0 || assignments.StartIndex+assignments.Count > assignments.TotalResults {
+			return false, nil
+		}
+		startIndex = assignments.StartIndex + assignments.Count
+	}
+}
+
+// isGroupMember reports whether the user is a direct member of a group
+func isGroupMember(baseURL, token, groupID, userID string) (bool, error) {
+	startIndex := 1
+	for {
+		var members GroupMembersResponse
+		endpoint := fmt.Sprintf("%s/groups/%s/members", baseURL, url.PathEscape(groupID))
+		if err := getThunderJSON(endpoint, pageQuery(startIndex), token, &members); err != nil {
+			return false, err
+		}
+
+		for _, member := range members.Members {
+			if member.Type == "user" && member.ID == userID {
+				return true, nil
+			}
+		}
+
+		if members.Count <= 0 || members.StartIndex+members.Count > members.TotalResults {
+			return false, nil
+		}
+		startIndex = members.StartIndex + members.Count
+	}
+}
+
+// pageQuery returns the pagination parameters for a list request
+func pageQuery(startIndex int) url.Values {
+	return url.Values{
+		"startIndex": {fmt.Sprintf("%d", startIndex)},
+		"count":      {"100"},
+	}
+}
+
+// getThunderJSON performs an authenticated GET request and decodes the JSON response
+func getThunderJSON(endpoint string, query url.Values, token string, out any) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.URL.RawQuery = query.Encode()
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := GetHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
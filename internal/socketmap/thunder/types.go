@@ -80,3 +80,25 @@ type Role struct {
 	Name               string `json:"name"`
 	OrganizationUnitID string `json:"ouId"`
 }
+
+// RoleAssignmentsResponse represents the response from the Thunder role assignments API.
+type RoleAssignmentsResponse struct {
+	TotalResults int              `json:"totalResults"`
+	StartIndex   int              `json:"startIndex"`
+	Count        int              `json:"count"`
+	Assignments  []RoleAssignment `json:"assignments"`
+}
+
+// RoleAssignment is a user or group assigned to a role.
+type RoleAssignment struct {
+	ID   string `json:"id"`
+	Type string `json:"type"` // "user" or "group"
+}
+
+// GroupMembersResponse represents the response from the Thunder group members API.
+type GroupMembersResponse struct {
+	TotalResults int              `json:"totalResults"`
+	StartIndex   int              `json:"startIndex"`
+	Count        int              `json:"count"`
+	Members      []RoleAssignment `json:"members"`
+}